@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -23,11 +24,16 @@ func newDaemonCommand() *cobra.Command {
 	}
 	daemonCommand.Flags().Duration("tick", 3*time.Second, "tick for polling events")
 	daemonCommand.Flags().Int("vsock-port", 0, "use vsock server instead a UNIX socket")
+	daemonCommand.Flags().String("socket", "/run/lima-guestagent.sock", "path of the UNIX socket, e.g., for an additional guest agent (see guestAgent.additional)")
+	daemonCommand.Flags().String("reachability-command-file", "/etc/lima-guestagent/reachability-command", "path of the file with the command template for checking the port reachability (see guestAgent.reachabilityCommand), ignored if missing")
 	return daemonCommand
 }
 
 func daemonAction(cmd *cobra.Command, _ []string) error {
-	socket := "/run/lima-guestagent.sock"
+	socket, err := cmd.Flags().GetString("socket")
+	if err != nil {
+		return err
+	}
 	tick, err := cmd.Flags().GetDuration("tick")
 	if err != nil {
 		return err
@@ -36,6 +42,10 @@ func daemonAction(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	reachabilityCommandFile, err := cmd.Flags().GetString("reachability-command-file")
+	if err != nil {
+		return err
+	}
 	if tick == 0 {
 		return errors.New("tick must be specified")
 	}
@@ -52,7 +62,15 @@ func daemonAction(cmd *cobra.Command, _ []string) error {
 		return ticker.C, ticker.Stop
 	}
 
-	agent, err := guestagent.New(newTicker, tick*20)
+	var reachabilityCommand string
+	if b, err := os.ReadFile(reachabilityCommandFile); err == nil {
+		reachabilityCommand = strings.TrimSpace(string(b))
+		logrus.Infof("reachability command: %q", reachabilityCommand)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	agent, err := guestagent.New(newTicker, tick*20, reachabilityCommand)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/start"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newAttachCommand() *cobra.Command {
+	attachCommand := &cobra.Command{
+		Use:   "attach INSTANCE",
+		Short: "Follow the host agent of a running instance",
+		Long: `Follow the host agent of a running instance, like 'limactl start' does, until the instance is running.
+The host agent runs in the background, so the instance keeps running after 'limactl start' or 'limactl attach'
+has exited, e.g., by closing the terminal or pressing Ctrl-C. Use 'limactl stop' to stop the instance.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              attachAction,
+		ValidArgsFunction: attachBashComplete,
+	}
+	attachCommand.Flags().BoolP("follow", "f", false, "keep following the warnings and the logs of the host agent until it exits")
+	return attachCommand
+}
+
+func attachAction(cmd *cobra.Command, args []string) error {
+	instName := DefaultInstanceName
+	if len(args) > 0 {
+		instName = args[0]
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	return start.Attach(cmd.Context(), inst, follow)
+}
+
+func attachBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -52,6 +52,7 @@ func copyAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	instDirs := make(map[string]string)
+	guestUsers := make(map[string]string)
 	scpFlags := []string{}
 	scpArgs := []string{}
 	debug, err := cmd.Flags().GetBool("debug")
@@ -85,13 +86,18 @@ func copyAction(cmd *cobra.Command, args []string) error {
 			if inst.Status == store.StatusStopped {
 				return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
 			}
+			guestUser := u.Username
+			if inst.Config != nil && inst.Config.SSH.RuntimeUser != nil {
+				guestUser = *inst.Config.SSH.RuntimeUser
+			}
 			if legacySSH {
 				scpFlags = append(scpFlags, "-P", fmt.Sprintf("%d", inst.SSHLocalPort))
-				scpArgs = append(scpArgs, fmt.Sprintf("%s@127.0.0.1:%s", u.Username, path[1]))
+				scpArgs = append(scpArgs, fmt.Sprintf("%s@127.0.0.1:%s", guestUser, path[1]))
 			} else {
-				scpArgs = append(scpArgs, fmt.Sprintf("scp://%s@127.0.0.1:%d/%s", u.Username, inst.SSHLocalPort, path[1]))
+				scpArgs = append(scpArgs, fmt.Sprintf("scp://%s@127.0.0.1:%d/%s", guestUser, inst.SSHLocalPort, path[1]))
 			}
 			instDirs[instName] = inst.Dir
+			guestUsers[instName] = guestUser
 		default:
 			return fmt.Errorf("path %q contains multiple colons", arg)
 		}
@@ -107,8 +113,8 @@ func copyAction(cmd *cobra.Command, args []string) error {
 		// Only one (instance) host is involved; we can use the instance-specific
 		// arguments such as ControlPath.  This is preferred as we can multiplex
 		// sessions without re-authenticating (MaxSessions permitting).
-		for _, instDir := range instDirs {
-			sshOpts, err = sshutil.SSHOpts(instDir, false, false, false, false)
+		for instName, instDir := range instDirs {
+			sshOpts, err = sshutil.SSHOpts(instDir, guestUsers[instName], false, false, false, false)
 			if err != nil {
 				return err
 			}
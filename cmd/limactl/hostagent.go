@@ -30,6 +30,7 @@ func newHostagentCommand() *cobra.Command {
 	hostagentCommand.Flags().String("socket", "", "hostagent socket")
 	hostagentCommand.Flags().Bool("run-gui", false, "run gui synchronously within hostagent")
 	hostagentCommand.Flags().String("nerdctl-archive", "", "local file path (not URL) of nerdctl-full-VERSION-GOOS-GOARCH.tar.gz")
+	hostagentCommand.Flags().Int("guestagent-raw-events", 0, "emit up to N raw guest agent events, for debugging")
 	return hostagentCommand
 }
 
@@ -82,6 +83,13 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 	if nerdctlArchive != "" {
 		opts = append(opts, hostagent.WithNerdctlArchive(nerdctlArchive))
 	}
+	guestAgentRawEvents, err := cmd.Flags().GetInt("guestagent-raw-events")
+	if err != nil {
+		return err
+	}
+	if guestAgentRawEvents > 0 {
+		opts = append(opts, hostagent.WithGuestAgentRawEvents(guestAgentRawEvents))
+	}
 	ha, err := hostagent.New(instName, stdout, sigintCh, opts...)
 	if err != nil {
 		return err
@@ -99,6 +99,7 @@ func newApp() *cobra.Command {
 		newCreateCommand(),
 		newStartCommand(),
 		newStopCommand(),
+		newAttachCommand(),
 		newShellCommand(),
 		newCopyCommand(),
 		newListCommand(),
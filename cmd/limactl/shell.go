@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/mattn/go-isatty"
 	"github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
@@ -81,6 +86,12 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if *y.HostAgent.IdleSuspend != "" {
+		// The VM may have been paused after the inactivity
+		if err := resumeInstance(cmd.Context(), inst); err != nil {
+			logrus.WithError(err).Warnf("failed to resume the instance %q", inst.Name)
+		}
+	}
 
 	// When workDir is explicitly set, the shell MUST have workDir as the cwd, or exit with an error.
 	//
@@ -168,7 +179,7 @@ func shellAction(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.RuntimeUser, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
 	if err != nil {
 		return err
 	}
@@ -198,6 +209,20 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	return sshCmd.Run()
 }
 
+// resumeTimeout is the timeout for resuming the instance paused by `hostAgent.idleSuspend`
+const resumeTimeout = 30 * time.Second
+
+// resumeInstance asks the host agent to resume the instance paused by `hostAgent.idleSuspend`.
+func resumeInstance(ctx context.Context, inst *store.Instance) error {
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, resumeTimeout)
+	defer cancel()
+	return haClient.Resume(ctx)
+}
+
 func shellBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteInstanceNames(cmd)
 }
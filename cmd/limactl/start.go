@@ -83,6 +83,11 @@ $ limactl start
 To create an instance "default" from a template "docker", and start it:
 $ limactl start --name=default template://docker
 
+To start an instance "default" on the first connection to its forwarded ports:
+$ limactl start --lazy default
+The ports are bound only until the first start: they are not bound again after a later 'limactl stop'.
+The connections that arrive while the host agent is setting up the port forwards are refused.
+
 'limactl start' also accepts the 'limactl create' flags such as '--set'.
 See the examples in 'limactl create --help'.
 `,
@@ -93,6 +98,7 @@ See the examples in 'limactl create --help'.
 	}
 	registerCreateFlags(startCommand, "[limactl create] ")
 	startCommand.Flags().Duration("timeout", start.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out")
+	startCommand.Flags().Bool("lazy", false, "bind the host ports of the TCP port forwards, and start the instance on the first connection (once; the ports are not bound again after a later stop)")
 	return startCommand
 }
 
@@ -517,6 +523,13 @@ func startAction(cmd *cobra.Command, args []string) error {
 		ctx = start.WithWatchHostAgentTimeout(ctx, timeout)
 	}
 
+	lazy, err := cmd.Flags().GetBool("lazy")
+	if err != nil {
+		return err
+	}
+	if lazy {
+		return start.StartLazily(ctx, inst)
+	}
 	return start.Start(ctx, inst)
 }
 
@@ -0,0 +1,25 @@
+#!/bin/sh
+set -eux
+
+# On systems without systemd-resolved, the search domains are written to
+# /etc/resolv.conf by cloud-init (see user-data).
+conf=/etc/systemd/resolved.conf.d/lima-search-domains.conf
+
+if ! command -v systemctl >/dev/null 2>&1 || ! systemctl is-active --quiet systemd-resolved; then
+	exit 0
+fi
+
+if [ -z "${LIMA_CIDATA_DNS_SEARCH_DOMAINS}" ]; then
+	if [ -e "${conf}" ]; then
+		rm -f "${conf}"
+		systemctl restart systemd-resolved
+	fi
+	exit 0
+fi
+
+mkdir -p "$(dirname "${conf}")"
+cat >"${conf}" <<EOT
+[Resolve]
+Domains=${LIMA_CIDATA_DNS_SEARCH_DOMAINS}
+EOT
+systemctl restart systemd-resolved
@@ -0,0 +1,36 @@
+#!/bin/sh
+set -eux
+
+# The "managed" mode is handled by cloud-init (see user-data), and the "unmanaged" mode
+# leaves the nameservers configured by the guest alone.
+conf=/etc/systemd/resolved.conf.d/lima-dns.conf
+resolved=
+if command -v systemctl >/dev/null 2>&1 && systemctl is-active --quiet systemd-resolved; then
+	resolved=1
+fi
+
+if [ "${LIMA_CIDATA_RESOLV_CONF_MODE}" != "append" ] || [ -z "${LIMA_CIDATA_DNS_ADDRESSES}" ]; then
+	if [ -e "${conf}" ]; then
+		rm -f "${conf}"
+		if [ -n "${resolved}" ]; then
+			systemctl restart systemd-resolved
+		fi
+	fi
+	exit 0
+fi
+
+if [ -n "${resolved}" ]; then
+	mkdir -p "$(dirname "${conf}")"
+	cat >"${conf}" <<EOT
+[Resolve]
+DNS=${LIMA_CIDATA_DNS_ADDRESSES}
+EOT
+	systemctl restart systemd-resolved
+	exit 0
+fi
+
+for ns in ${LIMA_CIDATA_DNS_ADDRESSES}; do
+	if ! grep -q "^nameserver ${ns}\$" /etc/resolv.conf 2>/dev/null; then
+		echo "nameserver ${ns}" >>/etc/resolv.conf
+	fi
+done
@@ -17,6 +17,14 @@ fi
 # Install or update the guestagent binary
 install -m 755 "${LIMA_CIDATA_MNT}"/lima-guestagent "${LIMA_CIDATA_GUEST_INSTALL_PREFIX}"/bin/lima-guestagent
 
+# Install or remove the command for checking the port reachability (guestAgent.reachabilityCommand)
+if [ -f "${LIMA_CIDATA_MNT}"/reachability-command ]; then
+	mkdir -p /etc/lima-guestagent
+	install -m 644 "${LIMA_CIDATA_MNT}"/reachability-command /etc/lima-guestagent/reachability-command
+else
+	rm -f /etc/lima-guestagent/reachability-command
+fi
+
 # Launch the guestagent service
 if [ -f /sbin/openrc-run ]; then
 	# Install the openrc lima-guestagent service script
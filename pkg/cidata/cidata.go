@@ -163,6 +163,12 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		args.SlirpIPAddress = networks.SlirpIPAddress
 	}
 
+	for _, guestUser := range []string{*y.SSH.ProvisionUser, *y.SSH.RuntimeUser} {
+		if guestUser != args.User && !slices.Contains(args.AdditionalUsers, guestUser) {
+			args.AdditionalUsers = append(args.AdditionalUsers, guestUser)
+		}
+	}
+
 	// change instance id on every boot so network config will be processed again
 	args.IID = fmt.Sprintf("iid-%d", time.Now().Unix())
 
@@ -173,6 +179,14 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	if len(pubKeys) == 0 {
 		return errors.New("no SSH key was found, run `ssh-keygen`")
 	}
+	// The rotated SSH key of the instance replaces $LIMA_HOME/_config/user.pub
+	instPubKey, err := sshutil.InstancePubKey(instDir)
+	if err != nil {
+		return err
+	}
+	if instPubKey != nil {
+		pubKeys[0] = *instPubKey
+	}
 	for _, f := range pubKeys {
 		args.SSHPubKeys = append(args.SSHPubKeys, f.Content)
 	}
@@ -283,6 +297,9 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		}
 	}
 
+	args.DNSSearchDomains = y.HostResolver.SearchDomains
+	args.ResolvConfMode = *y.HostResolver.ResolvConfMode
+
 	args.CACerts.RemoveDefaults = y.CACertificates.RemoveDefaults
 
 	for _, path := range y.CACertificates.Files {
@@ -346,6 +363,13 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		Reader: guestAgentBinary,
 	})
 
+	if *y.GuestAgent.ReachabilityCommand != "" {
+		layout = append(layout, iso9660util.Entry{
+			Path:   "reachability-command",
+			Reader: strings.NewReader(*y.GuestAgent.ReachabilityCommand),
+		})
+	}
+
 	if nerdctlArchive != "" {
 		nftgzR, err := os.Open(nerdctlArchive)
 		if err != nil {
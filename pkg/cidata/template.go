@@ -58,6 +58,7 @@ type TemplateArgs struct {
 	User                            string // user name
 	Home                            string // home directory
 	UID                             int
+	AdditionalUsers                 []string // provisioning and runtime users other than User
 	SSHPubKeys                      []string
 	Mounts                          []Mount
 	MountType                       string
@@ -73,6 +74,8 @@ type TemplateArgs struct {
 	TCPDNSLocalPort                 int
 	Env                             map[string]string
 	DNSAddresses                    []string
+	DNSSearchDomains                []string
+	ResolvConfMode                  string
 	CACerts                         CACerts
 	HostHomeMountPoint              string
 	BootCmds                        []BootCmds
@@ -100,6 +103,14 @@ func ValidateTemplateArgs(args TemplateArgs) error {
 	if args.Home == "" {
 		return errors.New("field Home must be set")
 	}
+	for i, u := range args.AdditionalUsers {
+		if err := identifiers.Validate(u); err != nil {
+			return fmt.Errorf("field AdditionalUsers[%d] is invalid: %w", i, err)
+		}
+		if u == args.User {
+			return fmt.Errorf("field AdditionalUsers[%d] must not be %q", i, u)
+		}
+	}
 	if len(args.SSHPubKeys) == 0 {
 		return errors.New("field SSHPubKeys must be set")
 	}
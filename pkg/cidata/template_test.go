@@ -65,3 +65,46 @@ func TestTemplate9p(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateAdditionalUsers(t *testing.T) {
+	args := TemplateArgs{
+		Name:            "default",
+		User:            "foo",
+		UID:             501,
+		Home:            "/home/foo.linux",
+		AdditionalUsers: []string{"provisioner"},
+		SSHPubKeys: []string{
+			"ssh-rsa dummy foo@example.com",
+		},
+		MountType: "reverse-sshfs",
+	}
+	layout, err := ExecuteTemplate(args)
+	assert.NilError(t, err)
+	for _, f := range layout {
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		if f.Path == "user-data" {
+			assert.Assert(t, strings.Contains(string(b), `- name: "provisioner"`))
+			assert.Equal(t, strings.Count(string(b), `"ssh-rsa dummy foo@example.com"`), 2)
+		}
+	}
+
+	// root can be used for provisioning
+	args.AdditionalUsers = []string{"root"}
+	layout, err = ExecuteTemplate(args)
+	assert.NilError(t, err)
+	for _, f := range layout {
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		if f.Path == "user-data" {
+			assert.Assert(t, strings.Contains(string(b), `- name: "root"`))
+			assert.Assert(t, strings.Contains(string(b), "disable_root: false"))
+			// only the default user is granted sudo
+			assert.Equal(t, strings.Count(string(b), "sudo: ALL=(ALL) NOPASSWD:ALL"), 1)
+		}
+	}
+
+	args.AdditionalUsers = []string{"foo"}
+	_, err = ExecuteTemplate(args)
+	assert.ErrorContains(t, err, "AdditionalUsers[0]")
+}
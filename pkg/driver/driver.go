@@ -3,6 +3,7 @@ package driver
 import (
 	"context"
 	"fmt"
+	"net"
 
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store"
@@ -43,6 +44,13 @@ type Driver interface {
 	// It returns error if there are any errors during Stop
 	Stop(_ context.Context) error
 
+	// Pause suspends the execution of the running vm instance, keeping its memory.
+	// It returns error if the driver does not support pausing
+	Pause(_ context.Context) error
+
+	// Resume resumes the execution of the paused vm instance.
+	Resume(_ context.Context) error
+
 	// Register will add an instance to a registry.
 	// It returns error if there are any errors during Register
 	Register(_ context.Context) error
@@ -62,6 +70,10 @@ type Driver interface {
 	DeleteSnapshot(_ context.Context, tag string) error
 
 	ListSnapshots(_ context.Context) (string, error)
+
+	// GuestAgentConn returns a connection to the guest agent listening on the vsock port VSockPort.
+	// It returns an error when the driver does not provide vsock.
+	GuestAgentConn(_ context.Context) (net.Conn, error)
 }
 
 type BaseDriver struct {
@@ -69,6 +81,8 @@ type BaseDriver struct {
 	Yaml     *limayaml.LimaYAML
 
 	SSHLocalPort int
+	// VSockPort is the vsock port of the guest agent, or 0 when the guest agent socket is forwarded over SSH
+	VSockPort int
 }
 
 var _ Driver = (*BaseDriver)(nil)
@@ -101,6 +115,14 @@ func (d *BaseDriver) Stop(_ context.Context) error {
 	return nil
 }
 
+func (d *BaseDriver) Pause(_ context.Context) error {
+	return fmt.Errorf("unimplemented")
+}
+
+func (d *BaseDriver) Resume(_ context.Context) error {
+	return fmt.Errorf("unimplemented")
+}
+
 func (d *BaseDriver) Register(_ context.Context) error {
 	return nil
 }
@@ -132,3 +154,7 @@ func (d *BaseDriver) DeleteSnapshot(_ context.Context, _ string) error {
 func (d *BaseDriver) ListSnapshots(_ context.Context) (string, error) {
 	return "", fmt.Errorf("unimplemented")
 }
+
+func (d *BaseDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
@@ -2,6 +2,7 @@ package driverutil
 
 import (
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/vz"
 	"github.com/lima-vm/lima/pkg/wsl2"
 )
@@ -17,3 +18,16 @@ func Drivers() []string {
 	}
 	return drivers
 }
+
+// GuestAgentVSockSupported returns true if the driver of vmType can connect to the guest agent
+// over vsock with GuestAgentConn. WSL2 is connected over Hyper-V sockets by the guest agent client instead.
+func GuestAgentVSockSupported(vmType limayaml.VMType) bool {
+	switch vmType {
+	case limayaml.VZ:
+		return vz.Enabled
+	case limayaml.QEMU:
+		return qemu.VSockSupported()
+	default:
+		return false
+	}
+}
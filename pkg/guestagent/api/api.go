@@ -4,6 +4,8 @@ import (
 	"net"
 	"strconv"
 	"time"
+
+	"github.com/lima-vm/lima/pkg/textutil"
 )
 
 var IPv4loopback1 = net.IPv4(127, 0, 0, 1)
@@ -17,6 +19,19 @@ func (x *IPPort) String() string {
 	return net.JoinHostPort(x.IP.String(), strconv.Itoa(x.Port))
 }
 
+// ReachabilityCommand expands the template of `guestAgent.reachabilityCommand` for the port,
+// e.g., "nc -z {{.IP}} {{.Port}}".
+func ReachabilityCommand(tmpl string, ipPort IPPort) (string, error) {
+	b, err := textutil.ExecuteTemplate(tmpl, struct {
+		IP   string
+		Port int
+	}{IP: ipPort.IP.String(), Port: ipPort.Port})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 type Info struct {
 	// LocalPorts contain 127.0.0.1 and 0.0.0.0.
 	// LocalPorts do NOT contain addresses such as 127.0.0.53 and 192.168.5.15.
@@ -25,6 +40,17 @@ type Info struct {
 	LocalPorts []IPPort `json:"localPorts"`
 }
 
+// Activity contains the cumulative activity counters of the guest.
+// The counters are only meaningful when compared with the previous ones.
+type Activity struct {
+	// CPUBusy is the number of the clock ticks spent by all the CPUs in the states other than idle and iowait.
+	CPUBusy uint64 `json:"cpuBusy"`
+	// NetworkBytes is the number of the bytes received and transmitted by the non-loopback interfaces.
+	NetworkBytes uint64 `json:"networkBytes"`
+	// Terminals is the number of the open pseudo terminals, e.g., the interactive SSH sessions.
+	Terminals int `json:"terminals"`
+}
+
 type Event struct {
 	Time time.Time `json:"time,omitempty"`
 	// The first event contains the full ports as LocalPortsAdded
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReachabilityCommand(t *testing.T) {
+	cmd, err := ReachabilityCommand("nc -z {{.IP}} {{.Port}}", IPPort{IP: IPv4loopback1, Port: 8080})
+	assert.NilError(t, err)
+	assert.Equal(t, cmd, "nc -z 127.0.0.1 8080")
+
+	cmd, err = ReachabilityCommand("nc -z {{.IP}} {{.Port}}", IPPort{IP: net.IPv6loopback, Port: 80})
+	assert.NilError(t, err)
+	assert.Equal(t, cmd, "nc -z ::1 80")
+
+	_, err = ReachabilityCommand("nc -z {{.Host}} {{.Port}}", IPPort{IP: IPv4loopback1, Port: 80})
+	assert.ErrorContains(t, err, "Host")
+
+	_, err = ReachabilityCommand("nc -z {{.IP", IPPort{IP: IPv4loopback1, Port: 80})
+	assert.ErrorContains(t, err, "unclosed action")
+}
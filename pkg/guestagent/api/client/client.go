@@ -6,10 +6,13 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
@@ -19,6 +22,8 @@ type GuestAgentClient interface {
 	HTTPClient() *http.Client
 	Info(context.Context) (*api.Info, error)
 	Events(context.Context, func(api.Event)) error
+	CheckPort(context.Context, api.IPPort) error
+	Activity(context.Context) (*api.Activity, error)
 }
 
 type Proto = string
@@ -31,6 +36,12 @@ const (
 // NewGuestAgentClient creates a client.
 // remote is a path to the UNIX socket, without unix:// prefix or a remote hostname/IP address.
 func NewGuestAgentClient(remote string, proto Proto, instanceName string) (GuestAgentClient, error) {
+	return NewGuestAgentClientWithDialTimeout(remote, proto, instanceName, 0)
+}
+
+// NewGuestAgentClientWithDialTimeout creates a client that fails to connect after dialTimeout.
+// A zero dialTimeout means no timeout.
+func NewGuestAgentClientWithDialTimeout(remote string, proto Proto, instanceName string, dialTimeout time.Duration) (GuestAgentClient, error) {
 	var hc *http.Client
 	switch proto {
 	case UNIX:
@@ -53,10 +64,78 @@ func NewGuestAgentClient(remote string, proto Proto, instanceName string) (Guest
 			return nil, err
 		}
 	}
+	if dialTimeout > 0 {
+		if err := setDialTimeout(hc, dialTimeout); err != nil {
+			return nil, err
+		}
+	}
 
 	return NewGuestAgentClientWithHTTPClient(hc), nil
 }
 
+// NewGuestAgentClientWithDialer creates a client that connects to the guest agent with dial,
+// e.g., over the vsock provided by the VM driver. A zero dialTimeout means no timeout.
+func NewGuestAgentClientWithDialer(dial func(ctx context.Context) (net.Conn, error), dialTimeout time.Duration) (GuestAgentClient, error) {
+	hc := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx)
+			},
+		},
+	}
+	if dialTimeout > 0 {
+		if err := setDialTimeout(hc, dialTimeout); err != nil {
+			return nil, err
+		}
+	}
+	return NewGuestAgentClientWithHTTPClient(hc), nil
+}
+
+// setDialTimeout wraps the dial function of the transport of hc with timeout.
+func setDialTimeout(hc *http.Client, timeout time.Duration) error {
+	tr, ok := hc.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected transport type %T", hc.Transport)
+	}
+	dialContext := tr.DialContext
+	if dialContext == nil && tr.Dial != nil {
+		// The vsock dialer does not take a context, so the dial is abandoned on timeout
+		dial := tr.Dial
+		dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			type result struct {
+				conn net.Conn
+				err  error
+			}
+			ch := make(chan result, 1)
+			go func() {
+				conn, err := dial(network, addr)
+				ch <- result{conn, err}
+			}()
+			select {
+			case r := <-ch:
+				return r.conn, r.err
+			case <-ctx.Done():
+				go func() {
+					if r := <-ch; r.conn != nil {
+						_ = r.conn.Close()
+					}
+				}()
+				return nil, ctx.Err()
+			}
+		}
+		tr.Dial = nil
+	}
+	if dialContext == nil {
+		return errors.New("the transport has no dial function")
+	}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return dialContext(ctx, network, addr)
+	}
+	return nil
+}
+
 func NewGuestAgentClientWithHTTPClient(hc *http.Client) GuestAgentClient {
 	return &client{
 		Client:    hc,
@@ -108,3 +187,31 @@ func (c *client) Events(ctx context.Context, onEvent func(api.Event)) error {
 		onEvent(ev)
 	}
 }
+
+// CheckPort returns nil if the guest port is accepting connections.
+func (c *client) CheckPort(ctx context.Context, ipPort api.IPPort) error {
+	q := url.Values{}
+	q.Set("ip", ipPort.IP.String())
+	q.Set("port", strconv.Itoa(ipPort.Port))
+	u := fmt.Sprintf("http://%s/%s/check-port?%s", c.dummyHost, c.version, q.Encode())
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Activity(ctx context.Context) (*api.Activity, error) {
+	u := fmt.Sprintf("http://%s/%s/activity", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var activity api.Activity
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetDialTimeout(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+
+	t.Run("DialContext", func(t *testing.T) {
+		var hasDeadline bool
+		tr := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				_, hasDeadline = ctx.Deadline()
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}
+		assert.NilError(t, setDialTimeout(&http.Client{Transport: tr}, timeout))
+		_, err := tr.DialContext(context.Background(), "unix", "/dev/null")
+		assert.Assert(t, hasDeadline)
+		assert.Assert(t, errors.Is(err, context.DeadlineExceeded), err)
+	})
+
+	t.Run("Dial", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		tr := &http.Transport{
+			// Like the vsock dialer, which does not take a context
+			Dial: func(_, _ string) (net.Conn, error) {
+				<-unblock
+				return nil, errors.New("unblocked")
+			},
+		}
+		assert.NilError(t, setDialTimeout(&http.Client{Transport: tr}, timeout))
+		assert.Assert(t, tr.Dial == nil)
+		start := time.Now()
+		_, err := tr.DialContext(context.Background(), "vsock", "2:2222")
+		assert.Assert(t, errors.Is(err, context.DeadlineExceeded), err)
+		assert.Assert(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("no dial function", func(t *testing.T) {
+		err := setDialTimeout(&http.Client{Transport: &http.Transport{}}, timeout)
+		assert.Error(t, err, "the transport has no dial function")
+	})
+
+	t.Run("unexpected transport", func(t *testing.T) {
+		rt := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("not implemented")
+		})
+		err := setDialTimeout(&http.Client{Transport: rt}, timeout)
+		assert.ErrorContains(t, err, "unexpected transport type")
+	})
+}
@@ -3,7 +3,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/lima-vm/lima/pkg/guestagent"
@@ -76,8 +79,56 @@ func (b *Backend) GetEvents(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetCheckPort is the handler for GET /v{N}/check-port?ip={IP}&port={PORT}.
+// It responds with 204 No Content if the guest port is accepting connections.
+func (b *Backend) GetCheckPort(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q := r.URL.Query()
+	ip := net.ParseIP(q.Get("ip"))
+	if ip == nil {
+		b.onError(w, fmt.Errorf("invalid ip %q", q.Get("ip")), http.StatusBadRequest)
+		return
+	}
+	port, err := strconv.Atoi(q.Get("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		b.onError(w, fmt.Errorf("invalid port %q", q.Get("port")), http.StatusBadRequest)
+		return
+	}
+	if err := b.Agent.CheckPort(ctx, api.IPPort{IP: ip, Port: port}); err != nil {
+		b.onError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetActivity is the handler for GET /v{N}/activity
+func (b *Backend) GetActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	activity, err := b.Agent.Activity(ctx)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	m, err := json.Marshal(activity)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m)
+}
+
 func AddRoutes(r *mux.Router, b *Backend) {
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.Path("/info").Methods("GET").HandlerFunc(b.GetInfo)
 	v1.Path("/events").Methods("GET").HandlerFunc(b.GetEvents)
+	v1.Path("/check-port").Methods("GET").HandlerFunc(b.GetCheckPort)
+	v1.Path("/activity").Methods("GET").HandlerFunc(b.GetActivity)
 }
@@ -10,4 +10,8 @@ type Agent interface {
 	Info(ctx context.Context) (*api.Info, error)
 	Events(ctx context.Context, ch chan api.Event)
 	LocalPorts(ctx context.Context) ([]api.IPPort, error)
+	// CheckPort checks whether the port is accepting connections inside the guest.
+	CheckPort(ctx context.Context, ipPort api.IPPort) error
+	// Activity returns the cumulative activity counters of the guest.
+	Activity(ctx context.Context) (*api.Activity, error)
 }
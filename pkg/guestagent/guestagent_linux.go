@@ -3,7 +3,12 @@ package guestagent
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
 	"reflect"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,15 +19,24 @@ import (
 	"github.com/lima-vm/lima/pkg/guestagent/iptables"
 	"github.com/lima-vm/lima/pkg/guestagent/kubernetesservice"
 	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+	"github.com/lima-vm/lima/pkg/guestagent/procstat"
 	"github.com/lima-vm/lima/pkg/guestagent/timesync"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/cpu"
 )
 
-func New(newTicker func() (<-chan time.Time, func()), iptablesIdle time.Duration) (Agent, error) {
+// New creates the guest agent.
+// reachabilityCommand is the template of `guestAgent.reachabilityCommand` for CheckPort; empty to dial the ports.
+func New(newTicker func() (<-chan time.Time, func()), iptablesIdle time.Duration, reachabilityCommand string) (Agent, error) {
+	if reachabilityCommand != "" {
+		if _, err := api.ReachabilityCommand(reachabilityCommand, api.IPPort{IP: api.IPv4loopback1, Port: 80}); err != nil {
+			return nil, fmt.Errorf("invalid reachability command %q: %w", reachabilityCommand, err)
+		}
+	}
 	a := &agent{
 		newTicker:                newTicker,
 		kubernetesServiceWatcher: kubernetesservice.NewServiceWatcher(),
+		reachabilityCommand:      reachabilityCommand,
 	}
 
 	auditClient, err := libaudit.NewMulticastAuditClient(nil)
@@ -93,6 +107,10 @@ type agent struct {
 	latestIPTables           []iptables.Entry
 	latestIPTablesMu         sync.RWMutex
 	kubernetesServiceWatcher *kubernetesservice.ServiceWatcher
+
+	reachabilityCommand         string
+	reachabilityCommandMissing  bool
+	reachabilityCommandMissingM sync.Mutex
 }
 
 // setWorthCheckingIPTablesRoutine sets worthCheckingIPTables to be true
@@ -306,6 +324,101 @@ func (a *agent) Info(ctx context.Context) (*api.Info, error) {
 	return &info, nil
 }
 
+func (a *agent) CheckPort(ctx context.Context, ipPort api.IPPort) error {
+	ip := ipPort.IP
+	if ip.IsUnspecified() {
+		// A listener on 0.0.0.0 or :: is reachable via the loopback address of the same family
+		if ip.To4() != nil {
+			ip = api.IPv4loopback1
+		} else {
+			ip = net.IPv6loopback
+		}
+	}
+	target := api.IPPort{IP: ip, Port: ipPort.Port}
+	ctx, cancel := context.WithTimeout(ctx, checkPortTimeout)
+	defer cancel()
+	if a.reachabilityCommand != "" && !a.isReachabilityCommandMissing() {
+		err := a.runReachabilityCommand(ctx, target)
+		if !errors.Is(err, errReachabilityCommandMissing) {
+			return err
+		}
+		logrus.WithError(err).Warn("falling back to dialing the ports for checking the reachability")
+		a.reachabilityCommandMissingM.Lock()
+		a.reachabilityCommandMissing = true
+		a.reachabilityCommandMissingM.Unlock()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", target.String())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+const checkPortTimeout = 3 * time.Second
+
+var errReachabilityCommandMissing = errors.New("reachability command not found")
+
+func (a *agent) isReachabilityCommandMissing() bool {
+	a.reachabilityCommandMissingM.Lock()
+	defer a.reachabilityCommandMissingM.Unlock()
+	return a.reachabilityCommandMissing
+}
+
+// runReachabilityCommand runs the reachability command for the port with `/bin/sh -c`.
+// errReachabilityCommandMissing is returned when the shell reports the command as not found (exit status 127).
+func (a *agent) runReachabilityCommand(ctx context.Context, ipPort api.IPPort) error {
+	script, err := api.ReachabilityCommand(a.reachabilityCommand, ipPort)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.Is(err, exec.ErrNotFound) || (errors.As(err, &exitErr) && exitErr.ExitCode() == 127) {
+			return fmt.Errorf("%w: %q: %s", errReachabilityCommandMissing, script, strings.TrimSpace(string(out)))
+		}
+		return fmt.Errorf("port %s is not reachable: %q failed: %w (output: %q)", ipPort.String(), script, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (a *agent) Activity(_ context.Context) (*api.Activity, error) {
+	var (
+		activity api.Activity
+		err      error
+	)
+	activity.CPUBusy, err = procstat.CPUBusy()
+	if err != nil {
+		return nil, err
+	}
+	activity.NetworkBytes, err = procstat.NetDevBytes()
+	if err != nil {
+		return nil, err
+	}
+	activity.Terminals, err = countTerminals()
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// countTerminals counts the entries of /dev/pts other than ptmx.
+func countTerminals() (int, error) {
+	entries, err := os.ReadDir("/dev/pts")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if e.Name() != "ptmx" {
+			n++
+		}
+	}
+	return n, nil
+}
+
 const deltaLimit = 2 * time.Second
 
 func (a *agent) fixSystemTimeSkew() {
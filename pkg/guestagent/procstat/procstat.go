@@ -0,0 +1,74 @@
+package procstat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseCPUBusy parses /proc/stat, and returns the number of the clock ticks spent by all the CPUs
+// in the states other than idle and iowait.
+func ParseCPUBusy(r io.Reader) (uint64, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var busy uint64
+		// user nice system idle iowait irq softirq steal guest guest_nice.
+		// guest and guest_nice are already included in user and nice.
+		for i, f := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse %q: %w", sc.Text(), err)
+			}
+			switch i {
+			case 3, 4: // idle, iowait
+			default:
+				busy += v
+			}
+		}
+		return busy, nil
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no \"cpu\" line found")
+}
+
+// ParseNetDevBytes parses /proc/net/dev, and returns the number of the bytes received and transmitted
+// by all the interfaces except the loopback interface.
+func ParseNetDevBytes(r io.Reader) (uint64, error) {
+	var total uint64
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		name, counters, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			// header
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			return 0, fmt.Errorf("unexpected line %q", sc.Text())
+		}
+		// fields[0] is the received bytes, fields[8] is the transmitted bytes
+		for _, f := range []string{fields[0], fields[8]} {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse %q: %w", sc.Text(), err)
+			}
+			total += v
+		}
+	}
+	return total, sc.Err()
+}
@@ -0,0 +1,25 @@
+package procstat
+
+import (
+	"os"
+)
+
+// CPUBusy parses /proc/stat
+func CPUBusy() (uint64, error) {
+	r, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return ParseCPUBusy(r)
+}
+
+// NetDevBytes parses /proc/net/dev
+func NetDevBytes() (uint64, error) {
+	r, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return ParseNetDevBytes(r)
+}
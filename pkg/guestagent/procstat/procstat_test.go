@@ -0,0 +1,35 @@
+package procstat
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseCPUBusy(t *testing.T) {
+	procStat := `cpu  1000 20 300 90000 400 5 6 7 100 0
+cpu0 500 10 150 45000 200 3 3 4 50 0
+cpu1 500 10 150 45000 200 2 3 3 50 0
+intr 123456 0 0
+ctxt 654321
+`
+	busy, err := ParseCPUBusy(strings.NewReader(procStat))
+	assert.NilError(t, err)
+	assert.Equal(t, busy, uint64(1000+20+300+5+6+7))
+
+	_, err = ParseCPUBusy(strings.NewReader("intr 123456 0 0\n"))
+	assert.ErrorContains(t, err, "no \"cpu\" line")
+}
+
+func TestParseNetDevBytes(t *testing.T) {
+	procNetDev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 9999999    1000    0    0    0     0          0         0  9999999    1000    0    0    0     0       0          0
+  eth0: 1200        10    0    0    0     0          0         0      340       5    0    0    0     0       0          0
+  eth1:   56         1    0    0    0     0          0         0        7       1    0    0    0     0       0          0
+`
+	total, err := ParseNetDevBytes(strings.NewReader(procNetDev))
+	assert.NilError(t, err)
+	assert.Equal(t, total, uint64(1200+340+56+7))
+}
@@ -0,0 +1,64 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// vmPID returns the PID of the process running the VM.
+func (a *HostAgent) vmPID(ctx context.Context) (int, error) {
+	switch *a.y.VMType {
+	case limayaml.VZ:
+		// The VM runs inside the host agent process
+		return os.Getpid(), nil
+	case limayaml.QEMU:
+		pidFile := filepath.Join(a.instDir, filenames.PIDFile(*a.y.VMType))
+		// QEMU writes the PID file shortly after being started
+		for i := 0; i < 10; i++ {
+			pid, err := store.ReadPIDFile(pidFile)
+			if err != nil {
+				return 0, err
+			}
+			if pid != 0 {
+				return pid, nil
+			}
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		return 0, fmt.Errorf("PID file %q was not written", pidFile)
+	default:
+		return 0, fmt.Errorf("the VM process is not managed by the host agent for vmType %q", *a.y.VMType)
+	}
+}
+
+// applyCPUAffinity pins the VM process to y.Host.CPUAffinity.
+// A failure does not stop the instance; a warning event is emitted instead.
+func (a *HostAgent) applyCPUAffinity(ctx context.Context) {
+	cpus := a.y.Host.CPUAffinity
+	if len(cpus) == 0 {
+		return
+	}
+	pid, err := a.vmPID(ctx)
+	if err == nil {
+		err = setCPUAffinity(pid, cpus)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("failed to apply host.cpuAffinity %v: %v", cpus, err)
+		logrus.Warn(msg)
+		a.emitEvent(ctx, events.Event{Warnings: []string{msg}})
+		return
+	}
+	logrus.Infof("Pinned the VM process (pid=%d) to host CPUs %v", pid, cpus)
+}
@@ -0,0 +1,49 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setCPUAffinity pins all the threads of the process to the CPUs, like `taskset -a -p`.
+// The CPUs must be available to the host agent itself.
+func setCPUAffinity(pid int, cpus []int) error {
+	var available unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &available); err != nil {
+		return fmt.Errorf("failed to get the available CPUs: %w", err)
+	}
+	var (
+		set         unix.CPUSet
+		unavailable []int
+	)
+	for _, cpu := range cpus {
+		if !available.IsSet(cpu) {
+			unavailable = append(unavailable, cpu)
+			continue
+		}
+		set.Set(cpu)
+	}
+	if len(unavailable) > 0 {
+		return fmt.Errorf("host CPUs %v are not available (%d CPUs are available)", unavailable, available.Count())
+	}
+	tasks, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.SchedSetaffinity(tid, &set); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set the CPU affinity of thread %d: %w", tid, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package hostagent
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func setCPUAffinity(_ int, _ []int) error {
+	return fmt.Errorf("setting the CPU affinity is not supported on %s", runtime.GOOS)
+}
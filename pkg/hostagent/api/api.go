@@ -1,5 +1,54 @@
 package api
 
+import (
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
 type Info struct {
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// SSHConfigFile is the absolute path of the SSH config file that can be passed to `ssh -F`
+	SSHConfigFile string `json:"sshConfigFile,omitempty"`
+	// SSHOpts are the effective SSH options used by the host agent, with the secrets redacted
+	SSHOpts []string `json:"sshOpts,omitempty"`
+	// DNSPorts are the local ports of the DNS server of the hostResolver, nil when it is not running
+	DNSPorts *DNSPorts `json:"dnsPorts,omitempty"`
+	// DNSCache is the statistics of the cache of the DNS server, nil when the server is not running
+	// or the cache is disabled
+	DNSCache *DNSCache `json:"dnsCache,omitempty"`
+	// GuestExports are the KEY=VALUE pairs read from /run/lima-exports in the guest
+	GuestExports map[string]string `json:"guestExports,omitempty"`
+	// PortForwardBytes are the bytes relayed by the active forwards relayed by the host agent
+	PortForwardBytes []events.PortForwardBytes `json:"portForwardBytes,omitempty"`
+	// Suspended is true while the VM is paused by `hostAgent.idleSuspend`
+	Suspended bool `json:"suspended,omitempty"`
+}
+
+// DNSPorts are the local ports of the DNS server of the host agent.
+type DNSPorts struct {
+	UDP int `json:"udp,omitempty"`
+	TCP int `json:"tcp,omitempty"`
+}
+
+// DNSCache is the statistics of the cache of the DNS server of the host agent.
+// The UDP and TCP listeners have separate caches, Size is the size of each of them.
+type DNSCache struct {
+	Size    int    `json:"size"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// GuestAgentInfo is the latest Info received from the guest agent, with the local ports
+// updated by the events of the guest agent.
+type GuestAgentInfo struct {
+	// Connected is false before the first connection to the guest agent, and while reconnecting.
+	// Info is stale while Connected is false.
+	Connected bool `json:"connected"`
+	// UpdatedAt is the time of the last update of Info, zero before the first connection
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	// Info is nil before the first connection
+	Info *guestagentapi.Info `json:"info,omitempty"`
 }
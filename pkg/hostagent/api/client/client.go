@@ -6,16 +6,33 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/lima-vm/lima/pkg/hostagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
 )
 
 type HostAgentClient interface {
 	HTTPClient() *http.Client
 	Info(context.Context) (*api.Info, error)
+	GuestAgentInfo(context.Context) (*api.GuestAgentInfo, error)
+	ReconnectGuestAgent(context.Context) error
+	PortForwardsSSHConfig(context.Context) (string, error)
+	ReconcilePortForwards(context.Context) error
+	// ReloadPortForwards applies the port forward rules of lima.yaml without restarting the instance
+	ReloadPortForwards(context.Context) error
+	// RotateSSHKey replaces the SSH key of the instance with a new key, and revokes the old key in the guest
+	RotateSSHKey(context.Context) error
+	// Shutdown requests the graceful shutdown of the instance, without waiting for it
+	Shutdown(context.Context) error
+	// Resume resumes the VM paused by `hostAgent.idleSuspend`, and waits for it
+	Resume(context.Context) error
+	// Events returns the logged events whose sequence numbers are greater than since
+	Events(ctx context.Context, since uint64) ([]events.Event, error)
 }
 
 // NewHostAgentClient creates a client.
@@ -62,3 +79,107 @@ func (c *client) Info(ctx context.Context) (*api.Info, error) {
 	}
 	return &info, nil
 }
+
+func (c *client) GuestAgentInfo(ctx context.Context) (*api.GuestAgentInfo, error) {
+	u := fmt.Sprintf("http://%s/%s/guestagent/info", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var info api.GuestAgentInfo
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *client) ReconnectGuestAgent(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/guestagent/reconnect", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) PortForwardsSSHConfig(ctx context.Context) (string, error) {
+	u := fmt.Sprintf("http://%s/%s/port-forwards/ssh-config", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (c *client) ReconcilePortForwards(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/port-forwards/reconcile", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) ReloadPortForwards(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/port-forwards/reload", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) RotateSSHKey(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/ssh/rotate-key", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Shutdown(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/shutdown", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Resume(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/resume", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Events(ctx context.Context, since uint64) ([]events.Event, error) {
+	u := fmt.Sprintf("http://%s/%s/events?since=%d", c.dummyHost, c.version, since)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res []events.Event
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev events.Event
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return nil, err
+		}
+		res = append(res, ev)
+	}
+}
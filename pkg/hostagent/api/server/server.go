@@ -3,7 +3,9 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/lima-vm/lima/pkg/hostagent"
@@ -46,7 +48,158 @@ func (b *Backend) GetInfo(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(m)
 }
 
+// GetGuestAgentInfo is the handler for GET /v{N}/guestagent/info
+func (b *Backend) GetGuestAgentInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	info, err := b.Agent.GuestAgentInfo(ctx)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	m, err := json.Marshal(info)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m)
+}
+
+// PostGuestAgentReconnect is the handler for POST /v{N}/guestagent/reconnect
+func (b *Backend) PostGuestAgentReconnect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.ReconnectGuestAgent(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPortForwardsSSHConfig is the handler for GET /v{N}/port-forwards/ssh-config
+func (b *Backend) GetPortForwardsSSHConfig(w http.ResponseWriter, _ *http.Request) {
+	s, err := b.Agent.PortForwardsSSHConfig()
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(s))
+}
+
+// PostPortForwardsReconcile is the handler for POST /v{N}/port-forwards/reconcile
+func (b *Backend) PostPortForwardsReconcile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.ReconcilePortForwards(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostPortForwardsReload is the handler for POST /v{N}/port-forwards/reload
+func (b *Backend) PostPortForwardsReload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.ReloadPortForwards(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostSSHRotateKey is the handler for POST /v{N}/ssh/rotate-key
+func (b *Backend) PostSSHRotateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.RotateSSHKey(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostResume is the handler for POST /v{N}/resume
+func (b *Backend) PostResume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.Resume(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEvents is the handler for GET /v{N}/events?since={seq}
+// The events are returned as JSON lines, like the events emitted on the stdout of the host agent.
+func (b *Backend) GetEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			b.onError(w, fmt.Errorf("invalid since %q: %w", s, err), http.StatusBadRequest)
+			return
+		}
+	}
+	evs, err := b.Agent.Events(ctx, since)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, ev := range evs {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+	}
+}
+
+// PostShutdown is the handler for POST /v{N}/shutdown
+func (b *Backend) PostShutdown(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.Shutdown(ctx); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func AddRoutes(r *mux.Router, b *Backend) {
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.Path("/info").Methods("GET").HandlerFunc(b.GetInfo)
+	v1.Path("/guestagent/info").Methods("GET").HandlerFunc(b.GetGuestAgentInfo)
+	v1.Path("/guestagent/reconnect").Methods("POST").HandlerFunc(b.PostGuestAgentReconnect)
+	v1.Path("/port-forwards/ssh-config").Methods("GET").HandlerFunc(b.GetPortForwardsSSHConfig)
+	v1.Path("/port-forwards/reconcile").Methods("POST").HandlerFunc(b.PostPortForwardsReconcile)
+	v1.Path("/port-forwards/reload").Methods("POST").HandlerFunc(b.PostPortForwardsReload)
+	v1.Path("/ssh/rotate-key").Methods("POST").HandlerFunc(b.PostSSHRotateKey)
+	v1.Path("/resume").Methods("POST").HandlerFunc(b.PostResume)
+	v1.Path("/events").Methods("GET").HandlerFunc(b.GetEvents)
+	v1.Path("/shutdown").Methods("POST").HandlerFunc(b.PostShutdown)
 }
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package hostagent
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setListenBacklog changes the listen backlog of ln, by calling listen(2) again on the socket.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("unexpected listener type %T", ln)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := rc.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,13 @@
+package hostagent
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+)
+
+// setListenBacklog is not implemented on Windows, where the system default is used.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	logrus.Warnf("ignoring the listen backlog %d for %s, as it is not supported on Windows", backlog, ln.Addr())
+	return nil
+}
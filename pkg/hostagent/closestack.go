@@ -0,0 +1,66 @@
+package hostagent
+
+import (
+	"errors"
+	"sort"
+)
+
+// The priorities of the close handlers that depend on each other.
+// The handlers pushed without a priority have priority 0.
+const (
+	// closePriorityResume resumes the VM paused by `hostAgent.idleSuspend`, before the handlers that use SSH
+	closePriorityResume = 200
+	// closePriorityMounts unmounts the reverse-sshfs mounts while the SSH master is still alive
+	closePriorityMounts = 100
+	// closePriorityGuestPoweroff powers off the guest after the other handlers that use SSH, e.g., unmounting
+	closePriorityGuestPoweroff = -50
+	// closePrioritySSHMaster exits the SSH master after the handlers that still use SSH
+	closePrioritySSHMaster = -100
+	// closePriorityEventSyslog closes the syslog after the other handlers, so that they can still emit events
+	closePriorityEventSyslog = -200
+	// closePriorityEventLog closes the event log (`hostAgent.eventLog`) last, after the syslog
+	closePriorityEventLog = -300
+)
+
+type closeHandler struct {
+	priority int
+	f        func() error
+}
+
+// closeStack is the list of the cleanups run on shutting down the host agent.
+// The handlers with a higher priority run first; the handlers with the same priority run in LIFO order.
+type closeStack struct {
+	handlers []closeHandler
+}
+
+// push pushes f with priority 0.
+func (s *closeStack) push(f func() error) {
+	s.pushWithPriority(0, f)
+}
+
+func (s *closeStack) pushWithPriority(priority int, f func() error) {
+	s.handlers = append(s.handlers, closeHandler{priority: priority, f: f})
+}
+
+// ordered returns the handlers in the order they run.
+func (s *closeStack) ordered() []closeHandler {
+	handlers := make([]closeHandler, len(s.handlers))
+	for i, h := range s.handlers {
+		handlers[len(handlers)-1-i] = h
+	}
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return handlers[i].priority > handlers[j].priority
+	})
+	return handlers
+}
+
+// run runs all the handlers, even when some of them fail, and returns the joined errors.
+func (s *closeStack) run() error {
+	var errs []error
+	for _, h := range s.ordered() {
+		if err := h.f(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
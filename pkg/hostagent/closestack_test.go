@@ -0,0 +1,55 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCloseStack(t *testing.T) {
+	var order []string
+	handler := func(name string) func() error {
+		return func() error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	t.Run("LIFO", func(t *testing.T) {
+		order = nil
+		var s closeStack
+		s.push(handler("a"))
+		s.push(handler("b"))
+		s.push(handler("c"))
+		assert.NilError(t, s.run())
+		assert.DeepEqual(t, order, []string{"c", "b", "a"})
+	})
+
+	t.Run("priorities", func(t *testing.T) {
+		order = nil
+		var s closeStack
+		s.pushWithPriority(closePrioritySSHMaster, handler("sshMaster"))
+		s.pushWithPriority(closePriorityGuestPoweroff, handler("poweroff"))
+		s.pushWithPriority(closePriorityEventLog, handler("eventLog"))
+		s.push(handler("a"))
+		s.pushWithPriority(closePriorityEventSyslog, handler("syslog"))
+		s.pushWithPriority(closePriorityMounts, handler("mounts"))
+		s.push(handler("b"))
+		s.pushWithPriority(closePriorityMounts, handler("moreMounts"))
+		assert.NilError(t, s.run())
+		assert.DeepEqual(t, order, []string{"moreMounts", "mounts", "b", "a", "poweroff", "sshMaster", "syslog", "eventLog"})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		order = nil
+		var s closeStack
+		s.push(handler("a"))
+		s.push(func() error { return errors.New("b failed") })
+		s.push(func() error { return errors.New("c failed") })
+		err := s.run()
+		assert.ErrorContains(t, err, "b failed")
+		assert.ErrorContains(t, err, "c failed")
+		assert.DeepEqual(t, order, []string{"a"})
+	})
+}
@@ -0,0 +1,105 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// copyToGuestScript writes stdin to the guest file $1 with the owner $2 and the permissions $3.
+// The file is replaced atomically, so that the guest services never read a partial file.
+const copyToGuestScript = `set -eu
+file=$1
+dir=$(dirname -- "$file")
+mkdir -p -- "$dir"
+tmp=$(mktemp -- "$dir/.lima-copy-XXXXXX")
+trap 'rm -f -- "$tmp"' EXIT
+cat >"$tmp"
+chown -- "$2" "$tmp"
+chmod -- "$3" "$tmp"
+mv -f -- "$tmp" "$file"
+`
+
+func copyToGuest(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, rule limayaml.CopyToGuest) error {
+	f, err := os.Open(rule.HostFile)
+	if err != nil {
+		return fmt.Errorf("can't read local file %q: %w", rule.HostFile, err)
+	}
+	defer f.Close()
+	args := sshConfig.Args()
+	args = append(args,
+		"-p", strconv.Itoa(port),
+		"127.0.0.1",
+		"--",
+		shellescape.QuoteCommand([]string{"sudo", "sh", "-c", copyToGuestScript, "sh", rule.GuestFile, rule.Owner, rule.Permissions}),
+	)
+	logrus.Infof("Copying %s to %s in the guest", rule.HostFile, rule.GuestFile)
+	stderr := &limitedBuffer{limit: outputLimit}
+	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
+	cmd.Stdin = f
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy %q to %q in the guest: stderr=%q: %w", rule.HostFile, rule.GuestFile, stderr.String(), err)
+	}
+	return nil
+}
+
+// watchCopyToGuest copies the host file of the rule again, whenever its digest differs from the guest
+// file, until ctx is canceled. Only the content is compared, not the owner and the permissions.
+// A guest file that has been removed is not copied again.
+func (a *HostAgent) watchCopyToGuest(ctx context.Context, rule limayaml.CopyToGuest) {
+	// Validated by limayaml
+	interval, _ := time.ParseDuration(rule.WatchInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.suspended() {
+			continue
+		}
+		hostDigest, err := hostFileSHA256(rule.HostFile)
+		if err != nil || hostDigest == "" {
+			// The host file may be missing while it is being replaced
+			logrus.WithError(err).Debugf("failed to check %s for changes", rule.HostFile)
+			continue
+		}
+		guestDigest, err := a.guestFileSHA256(ctx, rule.GuestFile)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).Debugf("failed to check %s for changes", rule.GuestFile)
+			}
+			continue
+		}
+		if guestDigest == hostDigest {
+			continue
+		}
+		logrus.Infof("%s has changed, copying it again", rule.HostFile)
+		ev := events.Event{
+			CopyToGuestUpdate: &events.CopyToGuestUpdate{
+				HostFile:  rule.HostFile,
+				GuestFile: rule.GuestFile,
+			},
+		}
+		if err := copyToGuest(ctx, a.provisionSSHConfig, a.sshLocalPort, a.sshOutputLimit, rule); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Warnf("failed to copy %s to %s in the guest", rule.HostFile, rule.GuestFile)
+			ev.CopyToGuestUpdate.Error = err.Error()
+		}
+		a.emitEvent(ctx, ev)
+	}
+}
@@ -0,0 +1,103 @@
+package hostagent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// guestFileSHA256 returns the hex-encoded SHA-256 digest of the guest file.
+func (a *HostAgent) guestFileSHA256(ctx context.Context, guestFile string) (string, error) {
+	script := fmt.Sprintf(`#!/bin/sh
+set -eu
+sudo -n sha256sum -- %s
+`, shellescape.Quote(guestFile))
+	stdout, stderr, err := executeScript(ctx, a.instSSHAddress, a.sshLocalPort, a.provisionSSHConfig, script, "checking "+guestFile)
+	if err != nil {
+		return "", fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	digest, _, _ := strings.Cut(strings.TrimSpace(stdout), " ")
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != hex.EncodedLen(sha256.Size) {
+		return "", fmt.Errorf("unexpected output of sha256sum: %q", stdout)
+	}
+	return digest, nil
+}
+
+// hostFileSHA256 returns the hex-encoded SHA-256 digest of the host file, or an empty string
+// if it does not exist.
+func hostFileSHA256(hostFile string) (string, error) {
+	f, err := os.Open(hostFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// watchCopyToHost copies the guest file of the rule again, whenever its digest differs from the host
+// file, until ctx is canceled. The guest file may be missing while it is being rotated, so the errors
+// of the checks are only logged.
+func (a *HostAgent) watchCopyToHost(ctx context.Context, rule limayaml.CopyToHost) {
+	// Validated by limayaml
+	interval, _ := time.ParseDuration(rule.WatchInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.suspended() {
+			continue
+		}
+		guestDigest, err := a.guestFileSHA256(ctx, rule.GuestFile)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).Debugf("failed to check %s for changes", rule.GuestFile)
+			}
+			continue
+		}
+		hostDigest, err := hostFileSHA256(rule.HostFile)
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to check %s for changes", rule.HostFile)
+			continue
+		}
+		if guestDigest == hostDigest {
+			continue
+		}
+		logrus.Infof("%s has changed, copying it again", rule.GuestFile)
+		ev := events.Event{
+			CopyToHostUpdate: &events.CopyToHostUpdate{
+				GuestFile: rule.GuestFile,
+				HostFile:  rule.HostFile,
+			},
+		}
+		if err := copyToHost(ctx, a.provisionSSHConfig, a.sshLocalPort, a.sshOutputLimit, rule.HostFile, rule.GuestFile, rule.IfExists, "", a.hostFileUmask); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Warnf("failed to copy %s to %s", rule.GuestFile, rule.HostFile)
+			ev.CopyToHostUpdate.Error = err.Error()
+		}
+		a.emitEvent(ctx, ev)
+	}
+}
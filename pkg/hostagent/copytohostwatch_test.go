@@ -0,0 +1,21 @@
+package hostagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHostFileSHA256(t *testing.T) {
+	hostFile := filepath.Join(t.TempDir(), "kubeconfig.yaml")
+	digest, err := hostFileSHA256(hostFile)
+	assert.NilError(t, err)
+	assert.Equal(t, digest, "")
+
+	assert.NilError(t, os.WriteFile(hostFile, []byte("hello\n"), 0o600))
+	digest, err = hostFileSHA256(hostFile)
+	assert.NilError(t, err)
+	assert.Equal(t, digest, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03")
+}
@@ -0,0 +1,62 @@
+package hostagent
+
+import (
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+)
+
+// The actions of the forwarding decisions.
+const (
+	forwardActionForward           = "forward"
+	forwardActionLazyForward       = "lazyForward"
+	forwardActionAlreadyForwarding = "alreadyForwarding"
+	forwardActionIgnore            = "ignore"
+	forwardActionCancel            = "cancel"
+)
+
+// forwardDecision is a line of the forwarding decision log, see `portForwarding.decisionLog`.
+type forwardDecision struct {
+	Time  time.Time `json:"time"`
+	Guest string    `json:"guest"`
+	// Action is one of "forward", "lazyForward", "alreadyForwarding", "ignore", and "cancel"
+	Action string `json:"action"`
+	Host   string `json:"host,omitempty"`
+	// Rule is the index of the matched rule, counting the included rules and the builtin fallback rule.
+	// For "ignore", it is the index of the `ignore` rule, if any.
+	Rule     *int   `json:"rule,omitempty"`
+	RuleName string `json:"ruleName,omitempty"`
+	// Agent is the name of the additional guest agent that reported the guest address, see `guestAgent.additional`
+	Agent string `json:"agent,omitempty"`
+	// Result is "ok", "pending" for "lazyForward", or "error"
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// decide reports the decision of OnEvent for the guest address to onDecision.
+func (pf *portForwarder) decide(guest api.IPPort, action, local string, err error) {
+	if pf.onDecision == nil {
+		return
+	}
+	d := forwardDecision{
+		Time:   time.Now(),
+		Guest:  guest.String(),
+		Action: action,
+		Host:   local,
+		Agent:  pf.agentOf(guest.String()),
+		Result: "ok",
+	}
+	rules := pf.currentRules()
+	if i, _ := matchRuleIndex(rules, guest); i >= 0 {
+		d.Rule = &i
+		d.RuleName = rules[i].Name
+	}
+	switch {
+	case err != nil:
+		d.Result = "error"
+		d.Error = err.Error()
+	case action == forwardActionLazyForward:
+		d.Result = "pending"
+	}
+	pf.onDecision(d)
+}
@@ -0,0 +1,56 @@
+package hostagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func readDecisions(t *testing.T, path string) []forwardDecision {
+	t.Helper()
+	f, err := os.Open(path)
+	assert.NilError(t, err)
+	defer f.Close()
+	var decisions []forwardDecision
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d forwardDecision
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &d))
+		decisions = append(decisions, d)
+	}
+	assert.NilError(t, scanner.Err())
+	return decisions
+}
+
+func TestDecisionLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	d := forwardDecision{Guest: "127.0.0.1:8080", Action: forwardActionForward, Host: "127.0.0.1:8080", Result: "ok"}
+	b, err := json.Marshal(d)
+	assert.NilError(t, err)
+	lineSize := int64(len(b) + 1)
+
+	l, err := openJSONLinesLog(path, 2*lineSize, 0o600)
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, l.write(d))
+	}
+	assert.NilError(t, l.close())
+	assert.ErrorIs(t, l.write(d), os.ErrClosed)
+
+	// The third line did not fit, so the first two lines have been rotated
+	assert.Equal(t, len(readDecisions(t, path+".1")), 2)
+	decisions := readDecisions(t, path)
+	assert.Equal(t, len(decisions), 1)
+	assert.DeepEqual(t, decisions[0], d)
+
+	// The log is appended to on reopening
+	l, err = openJSONLinesLog(path, 2*lineSize, 0o600)
+	assert.NilError(t, err)
+	assert.NilError(t, l.write(d))
+	assert.NilError(t, l.close())
+	assert.Equal(t, len(readDecisions(t, path)), 2)
+}
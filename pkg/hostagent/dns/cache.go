@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// cache is an LRU cache of the replies, keyed by the question.
+// The replies expire with the smallest TTL of their records.
+type cache struct {
+	size    int
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		now:     time.Now,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// cacheKeyOf returns the key of the request, which must have exactly one question.
+func cacheKeyOf(req *dns.Msg) (cacheKey, bool) {
+	if len(req.Question) != 1 {
+		return cacheKey{}, false
+	}
+	q := req.Question[0]
+	return cacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}, true
+}
+
+// get returns a copy of the cached reply, with the TTLs decremented by the time spent in the cache.
+func (c *cache) get(key cacheKey) *dns.Msg {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	elem, ok := c.entries[key]
+	if ok && !now.Before(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil
+	}
+	c.hits.Add(1)
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	msg := entry.msg.Copy()
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			if _, isOPT := rr.(*dns.OPT); !isOPT {
+				rr.Header().Ttl -= elapsed
+			}
+		}
+	}
+	return msg
+}
+
+// put caches a copy of the reply, unless it has no records with a TTL, or it is truncated or failed.
+func (c *cache) put(key cacheKey, msg *dns.Msg) {
+	if msg.Truncated || (msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError) {
+		return
+	}
+	ttl, ok := minTTL(msg)
+	if !ok || ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	entry := &cacheEntry{
+		key:     key,
+		msg:     msg.Copy(),
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+func (c *cache) stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// len returns the number of the cached replies, including the expired ones not evicted yet.
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func minTTL(msg *dns.Msg) (uint32, bool) {
+	var (
+		ttl   uint32
+		found bool
+	)
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			if _, isOPT := rr.(*dns.OPT); isOPT {
+				continue
+			}
+			if t := rr.Header().Ttl; !found || t < ttl {
+				ttl = t
+				found = true
+			}
+		}
+	}
+	return ttl, found
+}
+
+// cachingResponseWriter caches the reply written to the client.
+type cachingResponseWriter struct {
+	dns.ResponseWriter
+	cache *cache
+	key   cacheKey
+}
+
+func (w *cachingResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.cache.put(w.key, msg)
+	return w.ResponseWriter.WriteMsg(msg)
+}
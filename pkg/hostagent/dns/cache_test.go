@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+func newTestReply(name string, ttl uint32) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	reply := new(dns.Msg)
+	reply.SetReply(req)
+	reply.Answer = append(reply.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+		A:   net.ParseIP("192.168.5.2").To4(),
+	})
+	return reply
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := newCache(2)
+	c.now = func() time.Time { return now }
+
+	reply := newTestReply("foo.example.com.", 60)
+	key, ok := cacheKeyOf(reply)
+	assert.Assert(t, ok)
+	assert.Assert(t, c.get(key) == nil)
+
+	c.put(key, reply)
+	now = now.Add(10 * time.Second)
+	cached := c.get(key)
+	assert.Assert(t, cached != nil)
+	assert.Equal(t, cached.Answer[0].Header().Ttl, uint32(50))
+	// The cached reply must not be modified by the TTL adjustment
+	assert.Equal(t, reply.Answer[0].Header().Ttl, uint32(60))
+
+	// The key is case-insensitive
+	upperKey, _ := cacheKeyOf(newTestReply("FOO.example.com.", 60))
+	assert.Assert(t, c.get(upperKey) != nil)
+
+	now = now.Add(50 * time.Second)
+	assert.Assert(t, c.get(key) == nil)
+
+	hits, misses := c.stats()
+	assert.Equal(t, hits, uint64(2))
+	assert.Equal(t, misses, uint64(2))
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2)
+	keys := make([]cacheKey, 3)
+	for i, name := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+		reply := newTestReply(name, 60)
+		keys[i], _ = cacheKeyOf(reply)
+		c.put(keys[i], reply)
+		if i == 1 {
+			// Touch "a", so that "b" is the least recently used
+			assert.Assert(t, c.get(keys[0]) != nil)
+		}
+	}
+	assert.Assert(t, c.get(keys[0]) != nil)
+	assert.Assert(t, c.get(keys[1]) == nil)
+	assert.Assert(t, c.get(keys[2]) != nil)
+	assert.Equal(t, c.len(), 2)
+}
+
+func TestCacheNotCached(t *testing.T) {
+	c := newCache(10)
+
+	zeroTTL := newTestReply("zero.example.com.", 0)
+	key, _ := cacheKeyOf(zeroTTL)
+	c.put(key, zeroTTL)
+	assert.Assert(t, c.get(key) == nil)
+
+	noData := newTestReply("nodata.example.com.", 60)
+	noData.Answer = nil
+	key, _ = cacheKeyOf(noData)
+	c.put(key, noData)
+	assert.Assert(t, c.get(key) == nil)
+
+	failed := newTestReply("failed.example.com.", 60)
+	failed.Rcode = dns.RcodeServerFailure
+	key, _ = cacheKeyOf(failed)
+	c.put(key, failed)
+	assert.Assert(t, c.get(key) == nil)
+}
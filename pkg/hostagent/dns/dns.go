@@ -31,10 +31,22 @@ const (
 )
 
 type HandlerOptions struct {
-	IPv6            bool
-	StaticHosts     map[string]string
+	IPv6        bool
+	StaticHosts map[string]string
+	// UpstreamServers are "IP", "IP:port", "tls://host[:port]" (DNS-over-TLS), or "https://host[:port]/path"
+	// (DNS-over-HTTPS). When set, the names that are not static are resolved by these servers rather than
+	// by the system resolver.
 	UpstreamServers []string
 	TruncateReply   bool
+	// SearchDomains are used for completing unqualified names that are not in StaticHosts
+	SearchDomains []string
+	// CacheSize is the maximum number of the cached replies. 0 disables the cache.
+	CacheSize int
+	// Forwarders maps the domains to the upstream servers (in the same forms as UpstreamServers) resolving
+	// the names in these domains, instead of the system resolver. The longest matching domain is used.
+	Forwarders map[string][]string
+	// OnQuery is called after serving each query, when not nil.
+	OnQuery func(QueryLog)
 }
 
 type ServerOptions struct {
@@ -45,17 +57,29 @@ type ServerOptions struct {
 }
 
 type Handler struct {
-	truncate     bool
-	clientConfig *dns.ClientConfig
-	clients      []*dns.Client
-	ipv6         bool
-	cnameToHost  map[string]string
-	hostToIP     map[string]net.IP
+	truncate    bool
+	upstreams   []upstream
+	clients     []*dns.Client
+	ipv6        bool
+	cnameToHost map[string]string
+	hostToIP    map[string]net.IP
+	// wildcards are the keys of the wildcard static hosts in cnameToHost and hostToIP, e.g., "*.test."
+	wildcards []string
+
+	searchDomains []string
+	cache         *cache
+	// forwarders maps the canonical domains to the upstream servers
+	forwarders map[string][]upstream
+	// relayAll relays the queries for the names that are not static to the upstreams, rather than
+	// resolving them with the system resolver
+	relayAll bool
+	onQuery  func(QueryLog)
 }
 
 type Server struct {
-	udp *dns.Server
-	tcp *dns.Server
+	udp      *dns.Server
+	tcp      *dns.Server
+	handlers []*Handler
 }
 
 func (s *Server) Shutdown() {
@@ -67,6 +91,27 @@ func (s *Server) Shutdown() {
 	}
 }
 
+// CacheStats returns the numbers of the cache hits and misses of the UDP and TCP handlers.
+func (s *Server) CacheStats() (hits, misses uint64) {
+	for _, h := range s.handlers {
+		hh, hm := h.CacheStats()
+		hits += hh
+		misses += hm
+	}
+	return hits, misses
+}
+
+// CacheEntries returns the numbers of the replies cached by the UDP and TCP handlers.
+func (s *Server) CacheEntries() int {
+	var entries int
+	for _, h := range s.handlers {
+		if h.cache != nil {
+			entries += h.cache.len()
+		}
+	}
+	return entries
+}
+
 func newStaticClientConfig(ips []string) (*dns.ClientConfig, error) {
 	logrus.Tracef("newStaticClientConfig creating config for the following IPs: %v", ips)
 	s := ``
@@ -77,6 +122,21 @@ func newStaticClientConfig(ips []string) (*dns.ClientConfig, error) {
 	return dns.ClientConfigFromReader(r)
 }
 
+// forwarderOf returns the upstream servers of the longest forwarded domain containing name, or nil.
+func (h *Handler) forwarderOf(name string) []upstream {
+	var (
+		upstreams []upstream
+		labels    = -1
+	)
+	for domain, domainUpstreams := range h.forwarders {
+		if dns.IsSubDomain(domain, name) && dns.CountLabel(domain) > labels {
+			upstreams = domainUpstreams
+			labels = dns.CountLabel(domain)
+		}
+	}
+	return upstreams
+}
+
 func (h *Handler) lookupCnameToHost(cname string) string {
 	seen := make(map[string]bool)
 	for {
@@ -84,9 +144,9 @@ func (h *Handler) lookupCnameToHost(cname string) string {
 		if seen[cname] {
 			break
 		}
-		if _, ok := h.cnameToHost[cname]; ok {
+		if target, ok := h.staticCname(cname); ok {
 			seen[cname] = true
-			cname = h.cnameToHost[cname]
+			cname = target
 			continue
 		}
 		break
@@ -94,9 +154,78 @@ func (h *Handler) lookupCnameToHost(cname string) string {
 	return cname
 }
 
+func (h *Handler) isStaticHost(name string) bool {
+	if _, ok := h.hostToIP[name]; ok {
+		return true
+	}
+	if _, ok := h.cnameToHost[name]; ok {
+		return true
+	}
+	return h.wildcardOf(name) != ""
+}
+
+// wildcardOf returns the longest wildcard static host matching name, e.g., "*.test." for "foo.test.", or "".
+// A wildcard matches the names at any depth below its domain, but not the domain itself.
+func (h *Handler) wildcardOf(name string) string {
+	name = dns.CanonicalName(name)
+	var (
+		wildcard string
+		labels   = -1
+	)
+	for _, w := range h.wildcards {
+		domain := strings.TrimPrefix(w, "*.")
+		if name != domain && dns.IsSubDomain(domain, name) && dns.CountLabel(domain) > labels {
+			wildcard = w
+			labels = dns.CountLabel(domain)
+		}
+	}
+	return wildcard
+}
+
+// staticIP returns the IP address of a static host. The exact names take precedence over the wildcards.
+func (h *Handler) staticIP(name string) (net.IP, bool) {
+	if ip, ok := h.hostToIP[name]; ok {
+		return ip, true
+	}
+	if _, ok := h.cnameToHost[name]; ok {
+		return nil, false
+	}
+	ip, ok := h.hostToIP[h.wildcardOf(name)]
+	return ip, ok
+}
+
+// staticCname returns the target of a static host defined as a name. The exact names take precedence over the wildcards.
+func (h *Handler) staticCname(name string) (string, bool) {
+	if target, ok := h.cnameToHost[name]; ok {
+		return target, true
+	}
+	if _, ok := h.hostToIP[name]; ok {
+		return "", false
+	}
+	target, ok := h.cnameToHost[h.wildcardOf(name)]
+	return target, ok
+}
+
+// expandSearchDomains returns the first static host formed by appending a search domain
+// to the unqualified name. Otherwise name is returned unchanged.
+func (h *Handler) expandSearchDomains(name string) string {
+	if dns.CountLabel(name) != 1 || h.isStaticHost(name) {
+		return name
+	}
+	for _, domain := range h.searchDomains {
+		if expanded := dns.Fqdn(name) + domain; h.isStaticHost(expanded) {
+			return expanded
+		}
+	}
+	return name
+}
+
 func NewHandler(opts HandlerOptions) (dns.Handler, error) {
-	var cc *dns.ClientConfig
-	var err error
+	var (
+		cc        *dns.ClientConfig
+		upstreams []upstream
+		err       error
+	)
 	if len(opts.UpstreamServers) == 0 {
 		if runtime.GOOS != "windows" {
 			cc, err = dns.ClientConfigFromFile("/etc/resolv.conf")
@@ -115,12 +244,15 @@ func NewHandler(opts HandlerOptions) (dns.Handler, error) {
 				return nil, err
 			}
 		}
-	} else {
-		if cc, err = newStaticClientConfig(opts.UpstreamServers); err != nil {
-			logrus.WithError(err).Warnf("failed to create a client config from: %v, falling back to %v", opts.UpstreamServers, defaultFallbackIPs)
-			if cc, err = newStaticClientConfig(defaultFallbackIPs); err != nil {
-				return nil, err
-			}
+	} else if upstreams, err = parseUpstreams(opts.UpstreamServers); err != nil {
+		logrus.WithError(err).Warnf("failed to create a client config from: %v, falling back to %v", opts.UpstreamServers, defaultFallbackIPs)
+		if cc, err = newStaticClientConfig(defaultFallbackIPs); err != nil {
+			return nil, err
+		}
+	}
+	if cc != nil {
+		for _, srv := range cc.Servers {
+			upstreams = append(upstreams, upstream{addr: net.JoinHostPort(srv, cc.Port)})
 		}
 	}
 	clients := []*dns.Client{
@@ -128,15 +260,36 @@ func NewHandler(opts HandlerOptions) (dns.Handler, error) {
 		{Net: "tcp"},
 	}
 	h := &Handler{
-		truncate:     opts.TruncateReply,
-		clientConfig: cc,
-		clients:      clients,
-		ipv6:         opts.IPv6,
-		cnameToHost:  make(map[string]string),
-		hostToIP:     make(map[string]net.IP),
+		truncate:    opts.TruncateReply,
+		upstreams:   upstreams,
+		relayAll:    len(opts.UpstreamServers) > 0,
+		onQuery:     opts.OnQuery,
+		clients:     clients,
+		ipv6:        opts.IPv6,
+		cnameToHost: make(map[string]string),
+		hostToIP:    make(map[string]net.IP),
+	}
+	if opts.CacheSize > 0 {
+		h.cache = newCache(opts.CacheSize)
+	}
+	for _, domain := range opts.SearchDomains {
+		h.searchDomains = append(h.searchDomains, dns.CanonicalName(domain))
+	}
+	for domain, servers := range opts.Forwarders {
+		domainUpstreams, err := parseUpstreams(servers)
+		if err != nil {
+			return nil, fmt.Errorf("domain %q: %w", domain, err)
+		}
+		if h.forwarders == nil {
+			h.forwarders = make(map[string][]upstream)
+		}
+		h.forwarders[dns.CanonicalName(strings.TrimPrefix(domain, "*."))] = domainUpstreams
 	}
 	for host, address := range opts.StaticHosts {
 		cname := dns.CanonicalName(host)
+		if strings.HasPrefix(cname, "*.") {
+			h.wildcards = append(h.wildcards, cname)
+		}
 		if ip := net.ParseIP(address); ip != nil {
 			h.hostToIP[cname] = ip
 		} else {
@@ -152,6 +305,22 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 		handled bool
 	)
 	defer w.Close()
+	if len(req.Question) > 0 {
+		name := h.expandSearchDomains(dns.CanonicalName(req.Question[0].Name))
+		// AAAA queries are answered with NODATA below when IPv6 is disabled
+		ipv6Disabled := req.Question[0].Qtype == dns.TypeAAAA && !h.ipv6
+		if !h.isStaticHost(name) && !ipv6Disabled {
+			if upstreams := h.forwarderOf(name); upstreams != nil {
+				logrus.Tracef("handleQuery forwarding DNS query to %v: %v", upstreams, req)
+				h.exchange(w, req, upstreams)
+				return
+			}
+			if h.relayAll {
+				h.handleDefault(w, req)
+				return
+			}
+		}
+	}
 	reply.SetReply(req)
 	logrus.Tracef("handleQuery received DNS query: %v", req)
 	for _, q := range req.Question {
@@ -182,9 +351,9 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 		case dns.TypeA:
 			var err error
 			var addrs []net.IP
-			cname := h.lookupCnameToHost(q.Name)
-			if _, ok := h.hostToIP[cname]; ok {
-				addrs = []net.IP{h.hostToIP[cname]}
+			cname := h.lookupCnameToHost(h.expandSearchDomains(q.Name))
+			if ip, ok := h.staticIP(cname); ok {
+				addrs = []net.IP{ip}
 			} else {
 				addrs, err = net.LookupIP(cname)
 				if err != nil {
@@ -214,9 +383,9 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 				handled = true
 			}
 		case dns.TypeCNAME:
-			cname := h.lookupCnameToHost(q.Name)
+			cname := h.lookupCnameToHost(h.expandSearchDomains(q.Name))
 			var err error
-			if _, ok := h.hostToIP[cname]; !ok {
+			if _, ok := h.staticIP(cname); !ok {
 				cname, err = net.LookupCNAME(cname)
 				if err != nil {
 					logrus.WithError(err).Debug("handleQuery lookup CNAME failed")
@@ -317,12 +486,20 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 
 func (h *Handler) handleDefault(w dns.ResponseWriter, req *dns.Msg) {
 	logrus.Tracef("handleDefault for %v", req)
-	for _, client := range h.clients {
-		for _, srv := range h.clientConfig.Servers {
-			addr := net.JoinHostPort(srv, h.clientConfig.Port)
-			reply, _, err := client.Exchange(req, addr)
+	h.exchange(w, req, h.upstreams)
+}
+
+// exchange relays req to the first upstream server that replies, or replies with an empty answer.
+// The plain DNS servers are tried over UDP first, then over TCP; the encrypted servers are tried once.
+func (h *Handler) exchange(w dns.ResponseWriter, req *dns.Msg, upstreams []upstream) {
+	for i, client := range h.clients {
+		for _, u := range upstreams {
+			if u.encrypted() && i > 0 {
+				continue
+			}
+			reply, err := u.exchange(client, req)
 			if err != nil {
-				logrus.WithError(err).Debugf("handleDefault failed to perform a synchronous query with upstream [%v]", addr)
+				logrus.WithError(err).Debugf("handleDefault failed to perform a synchronous query with upstream [%v]", u)
 				continue
 			}
 			if h.truncate {
@@ -330,7 +507,7 @@ func (h *Handler) handleDefault(w dns.ResponseWriter, req *dns.Msg) {
 				reply.Truncate(truncateSize)
 			}
 			if err = w.WriteMsg(reply); err != nil {
-				logrus.WithError(err).Debugf("handleDefault failed writing DNS reply to [%v]", addr)
+				logrus.WithError(err).Debugf("handleDefault failed writing DNS reply to [%v]", u)
 			}
 			return
 		}
@@ -346,35 +523,77 @@ func (h *Handler) handleDefault(w dns.ResponseWriter, req *dns.Msg) {
 	}
 }
 
+// CacheStats returns the numbers of the cache hits and misses.
+func (h *Handler) CacheStats() (hits, misses uint64) {
+	if h.cache == nil {
+		return 0, 0
+	}
+	return h.cache.stats()
+}
+
 func (h *Handler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if h.onQuery == nil {
+		h.serveDNS(w, req)
+		return
+	}
+	start := time.Now()
+	// The writer is closed by handleQuery
+	client := w.RemoteAddr().String()
+	rw := &recordingResponseWriter{ResponseWriter: w}
+	cached := h.serveDNS(rw, req)
+	h.onQuery(newQueryLog(start, client, req, rw.reply, cached))
+}
+
+// serveDNS serves req, and returns true when the reply was cached.
+func (h *Handler) serveDNS(w dns.ResponseWriter, req *dns.Msg) (cached bool) {
+	if h.cache != nil && req.Opcode == dns.OpcodeQuery {
+		if key, ok := cacheKeyOf(req); ok {
+			if reply := h.cache.get(key); reply != nil {
+				logrus.Tracef("ServeDNS cache hit for %v", req.Question[0])
+				reply.Id = req.Id
+				reply.Question = req.Question
+				if h.truncate {
+					reply.Truncate(truncateSize)
+				}
+				if err := w.WriteMsg(reply); err != nil {
+					logrus.WithError(err).Debugf("ServeDNS failed writing cached DNS reply")
+				}
+				return true
+			}
+			w = &cachingResponseWriter{ResponseWriter: w, cache: h.cache, key: key}
+		}
+	}
 	switch req.Opcode {
 	case dns.OpcodeQuery:
 		h.handleQuery(w, req)
 	default:
 		h.handleDefault(w, req)
 	}
+	return false
 }
 
 func Start(opts ServerOptions) (*Server, error) {
 	server := &Server{}
 	if opts.UDPPort > 0 {
-		udpSrv, err := listenAndServe(UDP, opts)
+		udpSrv, h, err := listenAndServe(UDP, opts)
 		if err != nil {
 			return nil, err
 		}
 		server.udp = udpSrv
+		server.handlers = append(server.handlers, h)
 	}
 	if opts.TCPPort > 0 {
-		tcpSrv, err := listenAndServe(TCP, opts)
+		tcpSrv, h, err := listenAndServe(TCP, opts)
 		if err != nil {
 			return nil, err
 		}
 		server.tcp = tcpSrv
+		server.handlers = append(server.handlers, h)
 	}
 	return server, nil
 }
 
-func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
+func listenAndServe(network Network, opts ServerOptions) (*dns.Server, *Handler, error) {
 	var addr string
 	// always enable reply truncate for UDP
 	if network == UDP {
@@ -385,7 +604,7 @@ func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
 	}
 	h, err := NewHandler(opts.HandlerOptions)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	s := &dns.Server{Net: string(network), Addr: addr, Handler: h}
 	go func() {
@@ -395,7 +614,7 @@ func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
 		}
 	}()
 
-	return s, nil
+	return s, h.(*Handler), nil
 }
 
 func chunkify(buffer string, limit int) []string {
@@ -119,6 +119,167 @@ func TestDNSRecords(t *testing.T) {
 	})
 }
 
+func TestDNSSearchDomains(t *testing.T) {
+	w := new(TestResponseWriter)
+	options := HandlerOptions{
+		StaticHosts: map[string]string{
+			"foo.lima.internal": "192.168.5.2",
+			"bar.example.com":   "foo.lima.internal",
+			"baz":               "10.0.0.1",
+			"baz.lima.internal": "10.0.0.2",
+		},
+		SearchDomains: []string{"example.com", "LIMA.internal."},
+	}
+
+	h, err := NewHandler(options)
+	assert.NilError(t, err)
+
+	t.Run("test expansion", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			expected string
+		}{
+			{name: "foo.", expected: "foo.lima.internal."},
+			{name: "bar.", expected: "bar.example.com."},
+			// static hosts take precedence over the search domains
+			{name: "baz.", expected: "baz."},
+			// qualified names are never expanded
+			{name: "foo.example.com.", expected: "foo.example.com."},
+			{name: "unknown.", expected: "unknown."},
+		}
+
+		for _, tc := range tests {
+			assert.Equal(t, h.(*Handler).expandSearchDomains(tc.name), tc.expected)
+		}
+	})
+
+	t.Run("test A records", func(t *testing.T) {
+		tests := []struct {
+			testDomain      string
+			expectedARecord string
+		}{
+			{testDomain: "foo", expectedARecord: `foo.\s+5\s+IN\s+A\s+192.168.5.2`},
+			{testDomain: "bar", expectedARecord: `bar.\s+5\s+IN\s+A\s+192.168.5.2`},
+			{testDomain: "baz", expectedARecord: `baz.\s+5\s+IN\s+A\s+10.0.0.1`},
+		}
+
+		for _, tc := range tests {
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn(tc.testDomain), dns.TypeA)
+			h.ServeDNS(w, req)
+			assert.Assert(t, cmp.Regexp(tc.expectedARecord, dnsResult.String()))
+		}
+	})
+
+	t.Run("test CNAME records", func(t *testing.T) {
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn("foo"), dns.TypeCNAME)
+		h.ServeDNS(w, req)
+		assert.Assert(t, cmp.Regexp(`foo.\s+5\s+IN\s+CNAME\s+foo.lima.internal.`, dnsResult.String()))
+	})
+}
+
+func TestDNSWildcards(t *testing.T) {
+	w := new(TestResponseWriter)
+	options := HandlerOptions{
+		StaticHosts: map[string]string{
+			"*.test":            "127.0.0.1",
+			"*.app.test":        "web.lima.internal",
+			"web.lima.internal": "192.168.5.15",
+			"exact.test":        "10.0.0.1",
+		},
+	}
+	h, err := NewHandler(options)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		testDomain      string
+		expectedARecord string
+	}{
+		{testDomain: "foo.test", expectedARecord: `foo.test.\s+5\s+IN\s+A\s+127.0.0.1`},
+		{testDomain: "a.b.test", expectedARecord: `a.b.test.\s+5\s+IN\s+A\s+127.0.0.1`},
+		// the longest wildcard is used
+		{testDomain: "foo.app.test", expectedARecord: `foo.app.test.\s+5\s+IN\s+A\s+192.168.5.15`},
+		// the exact names take precedence over the wildcards
+		{testDomain: "exact.test", expectedARecord: `exact.test.\s+5\s+IN\s+A\s+10.0.0.1`},
+	}
+	for _, tc := range tests {
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn(tc.testDomain), dns.TypeA)
+		h.ServeDNS(w, req)
+		assert.Assert(t, cmp.Regexp(tc.expectedARecord, dnsResult.String()))
+	}
+
+	// a wildcard does not match its own domain
+	assert.Equal(t, h.(*Handler).wildcardOf("test."), "")
+	assert.Equal(t, h.(*Handler).wildcardOf("app.test."), "*.test.")
+
+	req := new(dns.Msg)
+	req.SetQuestion("foo.app.test.", dns.TypeCNAME)
+	h.ServeDNS(w, req)
+	assert.Assert(t, cmp.Regexp(`foo.app.test.\s+5\s+IN\s+CNAME\s+web.lima.internal.`, dnsResult.String()))
+}
+
+func TestDNSForwarders(t *testing.T) {
+	srv, err := mockdns.NewServerWithLogger(map[string]mockdns.Zone{
+		"host.corp.example.": {
+			A: []string{"10.0.0.80"},
+		},
+	}, log.New(io.Discard, "mockdns server: ", log.LstdFlags), false)
+	assert.NilError(t, err)
+	defer srv.Close()
+
+	w := new(TestResponseWriter)
+	options := HandlerOptions{
+		StaticHosts: map[string]string{
+			"static.corp.example": "192.168.5.2",
+		},
+		Forwarders: map[string][]string{
+			"*.corp.example":     {srv.LocalAddr().String()},
+			"vpn.corp.example.":  {"10.0.0.53"},
+			"unrelated.example.": {"10.0.0.54:5353"},
+		},
+	}
+	h, err := NewHandler(options)
+	assert.NilError(t, err)
+
+	t.Run("test longest match", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			expected []string
+		}{
+			{name: "host.corp.example.", expected: []string{srv.LocalAddr().String()}},
+			{name: "CORP.example.", expected: []string{srv.LocalAddr().String()}},
+			{name: "a.vpn.corp.example.", expected: []string{"10.0.0.53:53"}},
+			{name: "notcorp.example.", expected: nil},
+		}
+		for _, tc := range tests {
+			var servers []string
+			for _, u := range h.(*Handler).forwarderOf(dns.CanonicalName(tc.name)) {
+				servers = append(servers, u.String())
+			}
+			assert.DeepEqual(t, servers, tc.expected)
+		}
+	})
+
+	t.Run("test forwarded A record", func(t *testing.T) {
+		req := new(dns.Msg)
+		req.SetQuestion("host.corp.example.", dns.TypeA)
+		h.ServeDNS(w, req)
+		assert.Assert(t, cmp.Regexp(`host.corp.example.\s+\d+\s+IN\s+A\s+10.0.0.80`, dnsResult.String()))
+	})
+
+	t.Run("test static hosts take precedence", func(t *testing.T) {
+		req := new(dns.Msg)
+		req.SetQuestion("static.corp.example.", dns.TypeA)
+		h.ServeDNS(w, req)
+		assert.Assert(t, cmp.Regexp(`static.corp.example.\s+5\s+IN\s+A\s+192.168.5.2`, dnsResult.String()))
+	})
+
+	_, err = NewHandler(HandlerOptions{Forwarders: map[string][]string{"corp.example": {"ns.corp.example"}}})
+	assert.ErrorContains(t, err, "invalid upstream server")
+}
+
 type TestResponseWriter struct{}
 
 // LocalAddr returns the net.Addr of the server
@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// QueryLog is a query served by the DNS server, see HandlerOptions.OnQuery.
+type QueryLog struct {
+	Time time.Time `json:"time"`
+	// Client is the address of the client, e.g., "127.0.0.1:54321"
+	Client string `json:"client"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Rcode is empty when no reply was written
+	Rcode string `json:"rcode,omitempty"`
+	// Answers are the type and the data of the answer records, e.g., "A 192.168.5.2"
+	Answers []string      `json:"answers,omitempty"`
+	Cached  bool          `json:"cached,omitempty"`
+	Latency time.Duration `json:"latency"`
+}
+
+// recordingResponseWriter records the reply written to the client.
+type recordingResponseWriter struct {
+	dns.ResponseWriter
+	reply *dns.Msg
+}
+
+func (w *recordingResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.reply = msg
+	return w.ResponseWriter.WriteMsg(msg)
+}
+
+func newQueryLog(start time.Time, client string, req, reply *dns.Msg, cached bool) QueryLog {
+	ql := QueryLog{
+		Time:    start,
+		Client:  client,
+		Cached:  cached,
+		Latency: time.Since(start),
+	}
+	if len(req.Question) > 0 {
+		q := req.Question[0]
+		ql.Name = q.Name
+		ql.Type = dns.TypeToString[q.Qtype]
+	}
+	if reply != nil {
+		ql.Rcode = dns.RcodeToString[reply.Rcode]
+		for _, rr := range reply.Answer {
+			hdr := rr.Header()
+			ql.Answers = append(ql.Answers, dns.TypeToString[hdr.Rrtype]+" "+rr.String()[len(hdr.String()):])
+		}
+	}
+	return ql
+}
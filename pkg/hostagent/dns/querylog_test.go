@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+func TestQueryLog(t *testing.T) {
+	var logs []QueryLog
+	h, err := NewHandler(HandlerOptions{
+		StaticHosts: map[string]string{
+			"foo.lima.internal": "192.168.5.2",
+		},
+		CacheSize: 10,
+		OnQuery: func(q QueryLog) {
+			logs = append(logs, q)
+		},
+	})
+	assert.NilError(t, err)
+
+	w := new(TestResponseWriter)
+	req := new(dns.Msg)
+	req.SetQuestion("foo.lima.internal.", dns.TypeA)
+	h.ServeDNS(w, req)
+	h.ServeDNS(w, req)
+
+	assert.Equal(t, len(logs), 2)
+	assert.Equal(t, logs[0].Name, "foo.lima.internal.")
+	assert.Equal(t, logs[0].Type, "A")
+	assert.Equal(t, logs[0].Rcode, "NOERROR")
+	assert.DeepEqual(t, logs[0].Answers, []string{"A 192.168.5.2"})
+	assert.Assert(t, !logs[0].Cached)
+	assert.Assert(t, !logs[0].Time.IsZero())
+	assert.Assert(t, logs[1].Cached)
+	assert.DeepEqual(t, logs[1].Answers, []string{"A 192.168.5.2"})
+}
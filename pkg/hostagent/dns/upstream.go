@@ -0,0 +1,163 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohContentType = "application/dns-message"
+	dohTimeout     = 5 * time.Second
+	// dohMaxReplySize is the maximum size of a DNS message
+	dohMaxReplySize = 65535
+)
+
+// dohClient is replaced in the tests
+var dohClient = &http.Client{Timeout: dohTimeout}
+
+// upstream is an upstream DNS server.
+type upstream struct {
+	// addr is the "host:port" address of a plain DNS or a DNS-over-TLS server.
+	addr string
+	// tlsClient is the client of a DNS-over-TLS server, nil for the other servers.
+	tlsClient *dns.Client
+	// dohURL is the URL of a DNS-over-HTTPS server, empty for the other servers.
+	dohURL string
+}
+
+// parseUpstream parses an upstream server given as "IP", "IP:port", "tls://host[:port]" for DNS-over-TLS
+// (RFC 7858), or "https://host[:port]/path" for DNS-over-HTTPS (RFC 8484).
+func parseUpstream(server string) (upstream, error) {
+	switch {
+	case strings.HasPrefix(server, "tls://"):
+		hostPort := strings.TrimPrefix(server, "tls://")
+		host, port := hostPort, "853"
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			host, port = h, p
+		}
+		if host == "" || strings.Contains(host, "/") {
+			return upstream{}, fmt.Errorf("invalid DNS-over-TLS server %q", server)
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return upstream{}, fmt.Errorf("invalid port %q: %w", port, err)
+		}
+		return upstream{
+			addr: net.JoinHostPort(host, port),
+			tlsClient: &dns.Client{
+				Net:       "tcp-tls",
+				TLSConfig: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+			},
+		}, nil
+	case strings.HasPrefix(server, "https://"):
+		u, err := url.Parse(server)
+		if err != nil {
+			return upstream{}, err
+		}
+		if u.Host == "" {
+			return upstream{}, fmt.Errorf("invalid DNS-over-HTTPS server %q", server)
+		}
+		return upstream{dohURL: server}, nil
+	}
+	if ip := net.ParseIP(server); ip != nil {
+		return upstream{addr: net.JoinHostPort(ip.String(), "53")}, nil
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return upstream{}, err
+	}
+	if net.ParseIP(host) == nil {
+		return upstream{}, fmt.Errorf("%q is not an IP address", host)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return upstream{}, fmt.Errorf("invalid port %q: %w", port, err)
+	}
+	return upstream{addr: net.JoinHostPort(host, port)}, nil
+}
+
+func parseUpstreams(servers []string) ([]upstream, error) {
+	upstreams := make([]upstream, 0, len(servers))
+	for _, server := range servers {
+		u, err := parseUpstream(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream server %q: %w", server, err)
+		}
+		upstreams = append(upstreams, u)
+	}
+	return upstreams, nil
+}
+
+// encrypted returns true for the DNS-over-TLS and DNS-over-HTTPS servers.
+func (u upstream) encrypted() bool {
+	return u.tlsClient != nil || u.dohURL != ""
+}
+
+func (u upstream) String() string {
+	if u.dohURL != "" {
+		return u.dohURL
+	}
+	if u.tlsClient != nil {
+		return "tls://" + u.addr
+	}
+	return u.addr
+}
+
+// exchange sends req to the server. client is used for the plain DNS servers only.
+func (u upstream) exchange(client *dns.Client, req *dns.Msg) (*dns.Msg, error) {
+	switch {
+	case u.dohURL != "":
+		return exchangeDoH(u.dohURL, req)
+	case u.tlsClient != nil:
+		client = u.tlsClient
+	}
+	reply, _, err := client.Exchange(req, u.addr)
+	return reply, err
+}
+
+// exchangeDoH sends req to a DNS-over-HTTPS server with the POST method.
+func exchangeDoH(dohURL string, req *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 recommends the ID 0 for the cache friendliness
+	q := req.Copy()
+	q.Id = 0
+	b, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, dohURL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohContentType)
+	httpReq.Header.Set("Accept", dohContentType)
+	resp, err := dohClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %q", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxReplySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > dohMaxReplySize {
+		return nil, errors.New("the reply is too large")
+	}
+	var reply dns.Msg
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	reply.Id = req.Id
+	return &reply, nil
+}
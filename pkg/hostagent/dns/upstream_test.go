@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		server     string
+		expected   string
+		encrypted  bool
+		serverName string
+	}{
+		{server: "10.0.0.53", expected: "10.0.0.53:53"},
+		{server: "[::1]:5353", expected: "[::1]:5353"},
+		{server: "tls://dns.example", expected: "tls://dns.example:853", encrypted: true, serverName: "dns.example"},
+		{server: "tls://1.1.1.1:8853", expected: "tls://1.1.1.1:8853", encrypted: true, serverName: "1.1.1.1"},
+		{server: "https://dns.example/dns-query", expected: "https://dns.example/dns-query", encrypted: true},
+	}
+	for _, tc := range tests {
+		u, err := parseUpstream(tc.server)
+		assert.NilError(t, err, tc.server)
+		assert.Equal(t, u.String(), tc.expected)
+		assert.Equal(t, u.encrypted(), tc.encrypted)
+		if tc.serverName != "" {
+			assert.Equal(t, u.tlsClient.TLSConfig.ServerName, tc.serverName)
+		}
+	}
+	for _, invalid := range []string{"dns.example", "10.0.0.53:99999", "tls://", "https:///dns-query"} {
+		_, err := parseUpstream(invalid)
+		assert.Assert(t, err != nil, invalid)
+	}
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req dns.Msg
+		if err := req.Unpack(body); err != nil || req.Id != 0 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		reply := new(dns.Msg)
+		reply.SetReply(&req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.80")
+		reply.Answer = append(reply.Answer, rr)
+		b, _ := reply.Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+	origClient := dohClient
+	dohClient = srv.Client()
+	defer func() { dohClient = origClient }()
+
+	h, err := NewHandler(HandlerOptions{UpstreamServers: []string{srv.URL + "/dns-query"}})
+	assert.NilError(t, err)
+
+	w := new(TestResponseWriter)
+	req := new(dns.Msg)
+	req.SetQuestion("host.example.", dns.TypeA)
+	h.ServeDNS(w, req)
+	assert.Equal(t, dnsResult.Id, req.Id)
+	assert.Assert(t, cmp.Regexp(`host.example.\s+60\s+IN\s+A\s+10.0.0.80`, dnsResult.String()))
+}
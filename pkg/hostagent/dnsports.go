@@ -0,0 +1,86 @@
+package hostagent
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// dnsPorts are the ports of the DNS server saved by `hostResolver.persistPorts`.
+type dnsPorts struct {
+	UDP int `json:"udp"`
+	TCP int `json:"tcp"`
+}
+
+// allocateDNSPorts returns free local UDP and TCP ports for the DNS server.
+// When persist is true, the ports saved in instDir are reused if they are still free,
+// and the allocated ports are saved again.
+func allocateDNSPorts(instDir string, persist bool, umask os.FileMode) (udpPort, tcpPort int, err error) {
+	portsFile := filepath.Join(instDir, filenames.HostResolverPorts)
+	var saved dnsPorts
+	if persist {
+		b, err := os.ReadFile(portsFile)
+		if err == nil {
+			if err := json.Unmarshal(b, &saved); err != nil {
+				logrus.WithError(err).Warnf("ignoring the invalid file %q", portsFile)
+				saved = dnsPorts{}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, 0, err
+		}
+	}
+	if saved.UDP > 0 && udpLocalPortFree(saved.UDP) {
+		udpPort = saved.UDP
+	} else {
+		if saved.UDP > 0 {
+			logrus.Infof("The saved UDP port %d of the DNS server is not free, allocating a new one", saved.UDP)
+		}
+		if udpPort, err = findFreeUDPLocalPort(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if saved.TCP > 0 && tcpLocalPortFree(saved.TCP) {
+		tcpPort = saved.TCP
+	} else {
+		if saved.TCP > 0 {
+			logrus.Infof("The saved TCP port %d of the DNS server is not free, allocating a new one", saved.TCP)
+		}
+		if tcpPort, err = findFreeTCPLocalPort(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if persist && (udpPort != saved.UDP || tcpPort != saved.TCP) {
+		b, err := json.Marshal(dnsPorts{UDP: udpPort, TCP: tcpPort})
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := os.WriteFile(portsFile, b, hostFileMode(umask)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return udpPort, tcpPort, nil
+}
+
+func udpLocalPortFree(port int) bool {
+	l, err := net.ListenPacket("udp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
+
+func tcpLocalPortFree(port int) bool {
+	l, err := net.Listen("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
@@ -0,0 +1,56 @@
+package hostagent
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestAllocateDNSPorts(t *testing.T) {
+	dir := t.TempDir()
+	portsFile := filepath.Join(dir, filenames.HostResolverPorts)
+
+	// Without persistence, nothing is saved
+	udpPort, tcpPort, err := allocateDNSPorts(dir, false, 0o022)
+	assert.NilError(t, err)
+	assert.Assert(t, udpPort > 0 && tcpPort > 0)
+	_, err = os.Stat(portsFile)
+	assert.Assert(t, os.IsNotExist(err))
+
+	// With persistence, the ports are saved and reused
+	udpPort, tcpPort, err = allocateDNSPorts(dir, true, 0o022)
+	assert.NilError(t, err)
+	var saved dnsPorts
+	b, err := os.ReadFile(portsFile)
+	assert.NilError(t, err)
+	assert.NilError(t, json.Unmarshal(b, &saved))
+	assert.DeepEqual(t, saved, dnsPorts{UDP: udpPort, TCP: tcpPort})
+
+	udpPort2, tcpPort2, err := allocateDNSPorts(dir, true, 0o022)
+	assert.NilError(t, err)
+	assert.Equal(t, udpPort2, udpPort)
+	assert.Equal(t, tcpPort2, tcpPort)
+
+	// A saved port that is in use is replaced
+	l, err := net.Listen("tcp4", net.JoinHostPort("127.0.0.1", "0"))
+	assert.NilError(t, err)
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+	b, err = json.Marshal(dnsPorts{UDP: udpPort, TCP: busy})
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(portsFile, b, 0o644))
+
+	udpPort3, tcpPort3, err := allocateDNSPorts(dir, true, 0o022)
+	assert.NilError(t, err)
+	assert.Equal(t, udpPort3, udpPort)
+	assert.Assert(t, tcpPort3 != busy)
+	b, err = os.ReadFile(portsFile)
+	assert.NilError(t, err)
+	assert.NilError(t, json.Unmarshal(b, &saved))
+	assert.DeepEqual(t, saved, dnsPorts{UDP: udpPort, TCP: tcpPort3})
+}
@@ -0,0 +1,61 @@
+package hostagent
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/dns"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// dnsQueryLogMaxSize is the size after which the DNS query log is rotated.
+const dnsQueryLogMaxSize = 10 * 1024 * 1024
+
+// logDNSQuery logs q at the debug level.
+func logDNSQuery(q dns.QueryLog) {
+	answers := strings.Join(q.Answers, ", ")
+	if answers == "" {
+		answers = "no answers"
+	}
+	cached := ""
+	if q.Cached {
+		cached = ", cached"
+	}
+	logrus.Debugf("DNS query from %s: %s %s -> %s [%s] (%v%s)", q.Client, q.Type, q.Name, q.Rcode, answers, q.Latency, cached)
+}
+
+// openDNSQueryLogger returns the callback logging the DNS queries, see `hostResolver.logQueries`
+// and `hostResolver.queryLog`, and the function closing the query log. The callback is nil when
+// both are disabled.
+func (a *HostAgent) openDNSQueryLogger() (func(dns.QueryLog), func() error, error) {
+	logQueries, queryLog := *a.y.HostResolver.LogQueries, *a.y.HostResolver.QueryLog
+	if !logQueries && !queryLog {
+		return nil, func() error { return nil }, nil
+	}
+	var ql *jsonLinesLog
+	if queryLog {
+		var err error
+		ql, err = openJSONLinesLog(filepath.Join(a.instDir, filenames.DNSQueries), dnsQueryLogMaxSize, hostFileMode(a.hostFileUmask))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	onQuery := func(q dns.QueryLog) {
+		if logQueries {
+			logDNSQuery(q)
+		}
+		if ql != nil {
+			if err := ql.write(q); err != nil {
+				logrus.WithError(err).Warn("failed to write the DNS query log")
+			}
+		}
+	}
+	closeLog := func() error {
+		if ql == nil {
+			return nil
+		}
+		return ql.close()
+	}
+	return onQuery, closeLog, nil
+}
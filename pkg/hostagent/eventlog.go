@@ -0,0 +1,80 @@
+package hostagent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/sirupsen/logrus"
+)
+
+// eventLogFiles returns the files of the event log, from the oldest to the newest.
+func eventLogFiles(path string) []string {
+	return []string{path + ".1", path}
+}
+
+// readEventLog returns the events of the event log at path, including the rotated one, whose
+// sequence numbers are greater than since. The lines that cannot be decoded, e.g., the last line
+// truncated by a crash, are skipped.
+func readEventLog(path string, since uint64) ([]events.Event, error) {
+	var res []events.Event
+	for _, file := range eventLogFiles(path) {
+		f, err := os.Open(file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		// The events with the guest agent raw events may be longer than the default limit of 64KiB
+		sc.Buffer(nil, 16*1024*1024)
+		for sc.Scan() {
+			var ev events.Event
+			if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+				logrus.WithError(err).Debugf("skipping an invalid line of %q", file)
+				continue
+			}
+			if ev.Seq > since {
+				res = append(res, ev)
+			}
+		}
+		err = sc.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// lastEventSeq returns the sequence number of the last event of the event log at path, or 0.
+func lastEventSeq(path string) (uint64, error) {
+	evs, err := readEventLog(path, 0)
+	if err != nil {
+		return 0, err
+	}
+	var seq uint64
+	for _, ev := range evs {
+		if ev.Seq > seq {
+			seq = ev.Seq
+		}
+	}
+	return seq, nil
+}
+
+// Events returns the events whose sequence numbers are greater than since, from the event log.
+// The events that have been rotated out of the event log twice are no longer returned.
+func (a *HostAgent) Events(_ context.Context, since uint64) ([]events.Event, error) {
+	if a.eventLogPath == "" {
+		return nil, errors.New("the event log is disabled, see `hostAgent.eventLog`")
+	}
+	// Hold the lock so that the event being written is not read partially
+	a.eventEncMu.Lock()
+	defer a.eventEncMu.Unlock()
+	return readEventLog(a.eventLogPath, since)
+}
@@ -0,0 +1,44 @@
+package hostagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestReadEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	seq, err := lastEventSeq(path)
+	assert.NilError(t, err)
+	assert.Equal(t, seq, uint64(0))
+
+	// Small enough to rotate the log on every event, so only the last two events are kept
+	l, err := openJSONLinesLog(path, 100, 0o600)
+	assert.NilError(t, err)
+	for i := 1; i <= 5; i++ {
+		assert.NilError(t, l.write(events.Event{Seq: uint64(i), Status: events.Status{Running: true}}))
+	}
+	assert.NilError(t, l.close())
+
+	// A line truncated by a crash is skipped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	assert.NilError(t, err)
+	_, err = f.WriteString(`{"seq":6,"status":`)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	seq, err = lastEventSeq(path)
+	assert.NilError(t, err)
+	assert.Equal(t, seq, uint64(5))
+
+	evs, err := readEventLog(path, 3)
+	assert.NilError(t, err)
+	var seqs []uint64
+	for _, ev := range evs {
+		seqs = append(seqs, ev.Seq)
+	}
+	assert.DeepEqual(t, seqs, []uint64{4, 5})
+}
@@ -1,7 +1,26 @@
 package events
 
 import (
+	"encoding/json"
 	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+)
+
+// Phase is the boot phase of the instance, reported in Status.Phase on the transitions.
+type Phase = string
+
+const (
+	// PhaseDriverStart is starting the VM with the driver
+	PhaseDriverStart Phase = "driver-start"
+	// PhaseRequirementsEssential is waiting for SSH and the guest agent
+	PhaseRequirementsEssential Phase = "requirements-essential"
+	// PhaseRequirementsOptional is waiting for containerd and the readiness probes
+	PhaseRequirementsOptional Phase = "requirements-optional"
+	// PhaseRequirementsFinal is waiting for the boot scripts, i.e., cloud-init, to finish
+	PhaseRequirementsFinal Phase = "requirements-final"
+	// PhaseRunning is emitted along with Running
+	PhaseRunning Phase = "running"
 )
 
 type Status struct {
@@ -14,9 +33,320 @@ type Status struct {
 	Errors []string `json:"errors,omitempty"`
 
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// SSHConfigFile is the absolute path of the SSH config file that can be passed to `ssh -F`
+	SSHConfigFile string `json:"sshConfigFile,omitempty"`
+
+	// Probes is the results of the readiness probes of lima.yaml, only set in the Running status
+	Probes []ProbeResult `json:"probes,omitempty"`
+
+	// Phase is set on entering a boot phase, see Phase
+	Phase Phase `json:"phase,omitempty"`
+}
+
+// ProbeResult is the result of a readiness probe.
+type ProbeResult struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description"`
+	// Phase is "essential", "optional", or "final"
+	Phase     string `json:"phase"`
+	Satisfied bool   `json:"satisfied"`
+	Error     string `json:"error,omitempty"`
 }
 
 type Event struct {
-	Time   time.Time `json:"time,omitempty"`
-	Status Status    `json:"status,omitempty"`
+	// Time is encoded in RFC3339Nano, e.g., "2006-01-02T15:04:05.999999999Z07:00".
+	// The offset is "Z" when the host agent emits the events in UTC.
+	Time time.Time `json:"time,omitempty"`
+	// Seq is the sequence number of the event, starting from 1.
+	// With `hostAgent.eventLog`, the numbering continues from the last logged event across restarts.
+	Seq    uint64 `json:"seq,omitempty"`
+	Status Status `json:"status,omitempty"`
+
+	// GuestAgentRawEvent is an event received from the guest agent, as is.
+	// Only emitted when the host agent is started with raw guest agent events enabled.
+	GuestAgentRawEvent *guestagentapi.Event `json:"guestAgentRawEvent,omitempty"`
+
+	HostPrerequisite *HostPrerequisite `json:"hostPrerequisite,omitempty"`
+
+	SSHMasterRecovery *SSHMasterRecovery `json:"sshMasterRecovery,omitempty"`
+
+	SSHMasterTermination *SSHMasterTermination `json:"sshMasterTermination,omitempty"`
+
+	SSHAddressResolution *SSHAddressResolution `json:"sshAddressResolution,omitempty"`
+
+	SSHConnectivity *SSHConnectivity `json:"sshConnectivity,omitempty"`
+
+	IdleSuspend *IdleSuspend `json:"idleSuspend,omitempty"`
+
+	GuestAgentReconnect *GuestAgentReconnect `json:"guestAgentReconnect,omitempty"`
+
+	MountSetup *MountSetup `json:"mountSetup,omitempty"`
+
+	MountDisconnection *MountDisconnection `json:"mountDisconnection,omitempty"`
+
+	GuestTLSHandshakeFailure *GuestTLSHandshakeFailure `json:"guestTLSHandshakeFailure,omitempty"`
+
+	GuestTargets *GuestTargets `json:"guestTargets,omitempty"`
+
+	PortForwardBytes *PortForwardBytes `json:"portForwardBytes,omitempty"`
+
+	CopyToHostDeletion *CopyToHostDeletion `json:"copyToHostDeletion,omitempty"`
+
+	CopyToHostSkip *CopyToHostSkip `json:"copyToHostSkip,omitempty"`
+
+	CopyToHostChecksumMismatch *CopyToHostChecksumMismatch `json:"copyToHostChecksumMismatch,omitempty"`
+
+	CopyToHostUpdate *CopyToHostUpdate `json:"copyToHostUpdate,omitempty"`
+
+	CopyToGuestUpdate *CopyToGuestUpdate `json:"copyToGuestUpdate,omitempty"`
+
+	PortForwardOnReadyFailure *PortForwardOnReadyFailure `json:"portForwardOnReadyFailure,omitempty"`
+
+	X11Forwarding *X11Forwarding `json:"x11Forwarding,omitempty"`
+
+	GuestExports *GuestExports `json:"guestExports,omitempty"`
+
+	// ShutdownSummary is emitted along with the Exiting status
+	ShutdownSummary *ShutdownSummary `json:"shutdownSummary,omitempty"`
+
+	// Timeline is emitted along with the Running status, when enabled
+	Timeline *Timeline `json:"timeline,omitempty"`
+
+	// Warnings are not fatal, unlike Status.Errors
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Extra contains the payloads of custom events emitted by the programs embedding the host agent.
+	// The keys should be namespaced, e.g., "example.com/foo", to avoid conflicts.
+	Extra map[string]json.RawMessage `json:"extra,omitempty"`
+}
+
+// HostPrerequisite is emitted for each of `host.prerequisites`, before the VM is started.
+// The host agent stops at the first prerequisite that is not met.
+type HostPrerequisite struct {
+	Description string `json:"description,omitempty"`
+	Satisfied   bool   `json:"satisfied,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Hint is `host.prerequisites[].hint`, set when the prerequisite is not met
+	Hint string `json:"hint,omitempty"`
+}
+
+// GuestAgentReconnect is emitted when a reconnection to the guest agent has been requested,
+// and again with Connected set once the connection has been reestablished.
+type GuestAgentReconnect struct {
+	Connected bool `json:"connected,omitempty"`
+}
+
+// MountSetup is emitted before and after setting up the mounts, when the setup is deferred
+// until the requirements specified by `mountsAfter` are satisfied.
+type MountSetup struct {
+	After     string `json:"after,omitempty"`
+	Completed bool   `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// MountDisconnection is emitted on each transition of a reverse-sshfs mount after its
+// disconnection has been detected, according to `mounts[].sshfs.onDisconnect`.
+type MountDisconnection struct {
+	Location   string `json:"location,omitempty"`
+	MountPoint string `json:"mountPoint,omitempty"`
+	// State is one of "disconnected", "remounting", "remounted", "remountFailed", "ignored", and "degraded"
+	State string `json:"state,omitempty"`
+	// Attempt is the number of the remount attempt, starting from 1
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Timeline contains the startup phases of the host agent, in the order of completion.
+type Timeline struct {
+	Phases []TimelinePhase `json:"phases,omitempty"`
+}
+
+// TimelinePhase is a startup phase.
+// Start is the offset from the start of the host agent, and the durations are encoded in nanoseconds.
+type TimelinePhase struct {
+	// Name is one of "driverStart", "sshReady", "essentialRequirements", "mounts",
+	// "optionalRequirements", "finalRequirements", and "firstPortForward".
+	// "firstPortForward" is missing when no port has been forwarded before Running.
+	Name     string        `json:"name"`
+	Start    time.Duration `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ShutdownSummary contains the statistics of the run of the host agent.
+// Uptime is encoded in nanoseconds.
+type ShutdownSummary struct {
+	Uptime time.Duration `json:"uptime"`
+	// PortForwards is the number of the port forwards that have been set up
+	PortForwards         int `json:"portForwards"`
+	GuestAgentReconnects int `json:"guestAgentReconnects"`
+	SSHMasterRecoveries  int `json:"sshMasterRecoveries"`
+	// DNSCacheHits and DNSCacheMisses are the statistics of the cache of the host resolver, see `hostResolver.cacheSize`
+	DNSCacheHits   uint64 `json:"dnsCacheHits,omitempty"`
+	DNSCacheMisses uint64 `json:"dnsCacheMisses,omitempty"`
+	// Reason is "signal" when the host agent received SIGINT, "api" when the shutdown was requested via
+	// the host agent API, "driverStopped" when the driver stopped unexpectedly, "sshConnectivityLoss" when
+	// stopped by `ssh.onConnectivityLoss`, or "error" when the host agent failed, e.g., to start the instance
+	Reason string `json:"reason"`
+	// Graceful is true when the host agent was stopped by a signal or by the host agent API
+	Graceful bool `json:"graceful"`
+	// TeardownErrors are the errors during shutting down the host agent and stopping the driver
+	TeardownErrors []string `json:"teardownErrors,omitempty"`
+}
+
+// CopyToHostDeletion is emitted for each file copied by a `copyToHost` rule with `deleteOnStop`,
+// when it is deleted from the host on stop.
+type CopyToHostDeletion struct {
+	HostFile string `json:"hostFile,omitempty"`
+	// Error is set when the file could not be deleted
+	Error string `json:"error,omitempty"`
+}
+
+// CopyToHostSkip is emitted for each `copyToHost` rule with `ifExists: skip`, when the copy is
+// skipped because the host file already exists.
+type CopyToHostSkip struct {
+	GuestFile string `json:"guestFile,omitempty"`
+	HostFile  string `json:"hostFile,omitempty"`
+}
+
+// CopyToHostChecksumMismatch is emitted when a file copied by a `copyToHost` rule does not match
+// `expectedSHA256`. The copy is discarded, and the host file is left as is.
+type CopyToHostChecksumMismatch struct {
+	GuestFile string `json:"guestFile,omitempty"`
+	HostFile  string `json:"hostFile,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+}
+
+// CopyToHostUpdate is emitted when a file copied by a `copyToHost` rule with `watch` has changed
+// in the guest, and has been copied again.
+type CopyToHostUpdate struct {
+	GuestFile string `json:"guestFile,omitempty"`
+	HostFile  string `json:"hostFile,omitempty"`
+	// Error is set when the file could not be copied
+	Error string `json:"error,omitempty"`
+}
+
+// CopyToGuestUpdate is emitted when a file copied by a `copyToGuest` rule with `watch` has changed
+// on the host, and has been copied again.
+type CopyToGuestUpdate struct {
+	HostFile  string `json:"hostFile,omitempty"`
+	GuestFile string `json:"guestFile,omitempty"`
+	// Error is set when the file could not be copied
+	Error string `json:"error,omitempty"`
+}
+
+// GuestTargets is emitted when the relay of a `portForwards` rule with `guestTargets` has been set up,
+// and whenever the health of its targets has changed.
+type GuestTargets struct {
+	// Name is the name of the rule, if any
+	Name    string        `json:"name,omitempty"`
+	Local   string        `json:"local,omitempty"`
+	Targets []GuestTarget `json:"targets,omitempty"`
+}
+
+// PortForwardBytes is emitted when a forward relayed by the host agent has been stopped, with the bytes
+// relayed since it was set up. Only the forwards with `guestTLS`, `guestTargets`, `maxConnections`, or
+// `idleTimeout` are relayed by the host agent; the bytes of the forwards set up by SSH are not counted.
+type PortForwardBytes struct {
+	// Name is the name of the rule, if any
+	Name  string `json:"name,omitempty"`
+	Local string `json:"local,omitempty"`
+	// Remote is empty for the rules with `guestTargets`
+	Remote string `json:"remote,omitempty"`
+	// ToGuest is the number of the bytes received from the host clients and sent to the guest
+	ToGuest uint64 `json:"toGuest"`
+	// FromGuest is the number of the bytes received from the guest and sent to the host clients
+	FromGuest uint64 `json:"fromGuest"`
+}
+
+// GuestTarget is a target of the relay. Unhealthy targets are skipped, unless all of them are unhealthy.
+type GuestTarget struct {
+	Remote  string `json:"remote,omitempty"`
+	Healthy bool   `json:"healthy,omitempty"`
+}
+
+// PortForwardOnReadyFailure is emitted when the `onReady` command of a port forward failed.
+type PortForwardOnReadyFailure struct {
+	// Name is the name of the rule, if any
+	Name   string `json:"name,omitempty"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	// ExitCode is -1 when the command could not be started or was killed
+	ExitCode int    `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GuestExports is emitted after the final requirements, when the guest has written /run/lima-exports.
+type GuestExports struct {
+	Values map[string]string `json:"values,omitempty"`
+	// Error is set when the file could not be read or parsed
+	Error string `json:"error,omitempty"`
+}
+
+// X11Forwarding is emitted on start when X11 forwarding is enabled by `ssh.forwardX11` or
+// `ssh.forwardX11Trusted`, with the result of the detection of the X server on the host.
+type X11Forwarding struct {
+	// Display is the value of $DISPLAY of the host agent
+	Display   string `json:"display,omitempty"`
+	Available bool   `json:"available,omitempty"`
+	// Action is "forward" when the X server is available, otherwise `ssh.onX11Unavailable`
+	Action string `json:"action,omitempty"`
+}
+
+// GuestTLSHandshakeFailure is emitted when the TLS handshake with a guest service failed,
+// for a port forward with `guestTLS`.
+type GuestTLSHandshakeFailure struct {
+	// Name is the name of the rule, if any
+	Name   string `json:"name,omitempty"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SSHMasterRecovery is emitted when the SSH control master stopped servicing requests or exited,
+// and was recreated along with the forwards.
+type SSHMasterRecovery struct {
+	PreviousPID int `json:"previousPID,omitempty"`
+	// Exited is true when the SSH master had exited, rather than being wedged
+	Exited bool   `json:"exited,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Error is set when the SSH master could not be recreated
+	Error string `json:"error,omitempty"`
+}
+
+// SSHMasterTermination is emitted on shutdown when the SSH control master did not exit within
+// `ssh.exitMasterTimeout`, and has been killed. Timeout is encoded in nanoseconds.
+type SSHMasterTermination struct {
+	PID     int           `json:"pid,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Error is set when the SSH master could not be killed, e.g., as its PID is unknown
+	Error string `json:"error,omitempty"`
+}
+
+// SSHAddressResolution is emitted when the SSH address of a WSL2 instance could not be resolved yet,
+// before each retry until `ssh.addressTimeout`.
+type SSHAddressResolution struct {
+	// Attempt is the number of the failed attempt, starting from 1
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SSHConnectivity is emitted when the SSH connectivity has been lost according to
+// `ssh.probeFailureThreshold`, and again without Lost once it has been restored.
+type SSHConnectivity struct {
+	Lost bool `json:"lost,omitempty"`
+	// Failures is the number of consecutive failed health probes
+	Failures int `json:"failures,omitempty"`
+	// Action is `ssh.onConnectivityLoss`
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// IdleSuspend is emitted when the VM has been paused after `hostAgent.idleSuspend` of inactivity,
+// and again without Suspended once it has been resumed. Idle is encoded in nanoseconds.
+type IdleSuspend struct {
+	Suspended bool          `json:"suspended,omitempty"`
+	Idle      time.Duration `json:"idle,omitempty"`
+	// Reason is the cause of the resumption, "connection to <host address>", "request", or "shutdown"
+	Reason string `json:"reason,omitempty"`
 }
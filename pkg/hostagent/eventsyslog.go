@@ -0,0 +1,26 @@
+package hostagent
+
+import "github.com/lima-vm/lima/pkg/hostagent/events"
+
+type syslogSeverity int
+
+const (
+	syslogSeverityInfo syslogSeverity = iota
+	syslogSeverityWarning
+	syslogSeverityError
+)
+
+// eventSyslogSeverity returns the syslog severity of the event.
+// A degraded status is a warning, even though it carries the errors that degraded the instance.
+func eventSyslogSeverity(ev events.Event) syslogSeverity {
+	switch {
+	case ev.Status.Degraded:
+		return syslogSeverityWarning
+	case len(ev.Status.Errors) > 0:
+		return syslogSeverityError
+	case len(ev.Warnings) > 0:
+		return syslogSeverityWarning
+	default:
+		return syslogSeverityInfo
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package hostagent
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogFacilities maps the names of limayaml.SyslogFacilities to the facilities.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// eventSyslog forwards the events to the system log.
+type eventSyslog struct {
+	w *syslog.Writer
+}
+
+func newEventSyslog(tag, facility string) (*eventSyslog, error) {
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	w, err := syslog.New(f|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &eventSyslog{w: w}, nil
+}
+
+func (s *eventSyslog) write(severity syslogSeverity, msg string) error {
+	switch severity {
+	case syslogSeverityError:
+		return s.w.Err(msg)
+	case syslogSeverityWarning:
+		return s.w.Warning(msg)
+	default:
+		return s.w.Info(msg)
+	}
+}
+
+func (s *eventSyslog) close() error {
+	return s.w.Close()
+}
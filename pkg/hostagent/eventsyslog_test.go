@@ -0,0 +1,30 @@
+package hostagent
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestEventSyslogSeverity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ev       events.Event
+		expected syslogSeverity
+	}{
+		{name: "running", ev: events.Event{Status: events.Status{Running: true}}, expected: syslogSeverityInfo},
+		{
+			name:     "degraded",
+			ev:       events.Event{Status: events.Status{Running: true, Degraded: true, Errors: []string{"mount failed"}}},
+			expected: syslogSeverityWarning,
+		},
+		{name: "errors", ev: events.Event{Status: events.Status{Errors: []string{"boot failed"}}}, expected: syslogSeverityError},
+		{name: "warnings", ev: events.Event{Warnings: []string{"no X server"}}, expected: syslogSeverityWarning},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, eventSyslogSeverity(tc.ev), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package hostagent
+
+import "errors"
+
+// eventSyslog is not implemented on Windows, which has no syslog.
+type eventSyslog struct{}
+
+func newEventSyslog(_, _ string) (*eventSyslog, error) {
+	return nil, errors.New("syslog is not supported on Windows")
+}
+
+func (s *eventSyslog) write(_ syslogSeverity, _ string) error {
+	return nil
+}
+
+func (s *eventSyslog) close() error {
+	return nil
+}
@@ -0,0 +1,120 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// additionalGuestAgentSock returns the local path of the socket forwarded from the additional guest agent.
+func additionalGuestAgentSock(instDir, name string) string {
+	return filepath.Join(instDir, fmt.Sprintf(filenames.AdditionalGuestAgentSock, name))
+}
+
+// additionalGuestAgentEvent replaces the unspecified address of the ports with the `guestIP` of the
+// additional guest agent, and skips the loopback ports, which are not reachable from outside of its
+// network namespace. ev is returned as is when `guestIP` is not set.
+func additionalGuestAgentEvent(ga limayaml.AdditionalGuestAgent, ev guestagentapi.Event) guestagentapi.Event {
+	if ga.GuestIP == nil {
+		return ev
+	}
+	rewrite := func(ports []guestagentapi.IPPort) []guestagentapi.IPPort {
+		var res []guestagentapi.IPPort
+		for _, p := range ports {
+			switch {
+			case p.IP.IsLoopback():
+				continue
+			case p.IP.IsUnspecified():
+				p.IP = ga.GuestIP
+			}
+			res = append(res, p)
+		}
+		return res
+	}
+	ev.LocalPortsAdded = rewrite(ev.LocalPortsAdded)
+	ev.LocalPortsRemoved = rewrite(ev.LocalPortsRemoved)
+	return ev
+}
+
+// startAdditionalGuestAgents starts watching the guest agents of `guestAgent.additional`.
+func (a *HostAgent) startAdditionalGuestAgents(ctx context.Context) {
+	if len(a.y.GuestAgent.Additional) == 0 {
+		return
+	}
+	if *a.y.VMType == limayaml.WSL2 {
+		logrus.Warn("guestAgent.additional is not supported for WSL2")
+		return
+	}
+	for _, ga := range a.y.GuestAgent.Additional {
+		ga := ga
+		a.onClose.push(func() error {
+			// using ctx.Background() because ctx has already been cancelled
+			return forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, a.sshOutputLimit,
+				additionalGuestAgentSock(a.instDir, ga.Name), ga.Socket, verbCancel, false)
+		})
+		go a.watchAdditionalGuestAgent(ctx, ga)
+	}
+}
+
+// watchAdditionalGuestAgent forwards the socket of the additional guest agent over SSH, and forwards the ports
+// reported by it until ctx is done. The connection is retried with the backoff of the guest agent of Lima.
+func (a *HostAgent) watchAdditionalGuestAgent(ctx context.Context, ga limayaml.AdditionalGuestAgent) {
+	localUnix := additionalGuestAgentSock(a.instDir, ga.Name)
+	var failures int
+	for {
+		if !isGuestAgentSocketAccessible(ctx, localUnix, guestagentclient.UNIX, a.instName, a.guestAgentDialTimeout) {
+			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, localUnix, ga.Socket, verbForward, false)
+		}
+		err := a.processAdditionalGuestAgentEvents(ctx, ga, localUnix)
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).Debugf("connection to the guest agent %q was closed", ga.Name)
+		if errors.Is(err, errGuestAgentUnreachable) {
+			failures++
+		} else {
+			failures = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(a.nextGuestAgentBackoff(failures)):
+		}
+	}
+}
+
+func (a *HostAgent) processAdditionalGuestAgentEvents(ctx context.Context, ga limayaml.AdditionalGuestAgent, localUnix string) error {
+	client, err := guestagentclient.NewGuestAgentClientWithDialTimeout(localUnix, guestagentclient.UNIX, a.instName, a.guestAgentDialTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errGuestAgentUnreachable, err)
+	}
+	if _, err := client.Info(ctx); err != nil {
+		return fmt.Errorf("%w: %w", errGuestAgentUnreachable, err)
+	}
+	logrus.Infof("Connected to the guest agent %q", ga.Name)
+	onEvent := func(ev guestagentapi.Event) {
+		logrus.Debugf("guest agent %q event: %+v", ga.Name, ev)
+		for _, f := range ev.Errors {
+			logrus.Warnf("received error from the guest agent %q: %q", ga.Name, f)
+		}
+		ev = additionalGuestAgentEvent(ga, ev)
+		if a.portForwardsDryRun {
+			a.portForwarder.logEvent(ev, a.instSSHAddress)
+			return
+		}
+		a.portForwarder.OnAgentEvent(ctx, ga.Name, client, ev, a.instSSHAddress)
+	}
+	if err := client.Events(ctx, onEvent); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,37 @@
+package hostagent
+
+import (
+	"net"
+	"testing"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestAdditionalGuestAgentEvent(t *testing.T) {
+	ev := guestagentapi.Event{
+		LocalPortsAdded: []guestagentapi.IPPort{
+			{IP: net.IPv4zero, Port: 80},
+			{IP: net.ParseIP("127.0.0.1"), Port: 6443},
+			{IP: net.ParseIP("10.0.0.5"), Port: 8080},
+		},
+		LocalPortsRemoved: []guestagentapi.IPPort{
+			{IP: net.IPv6zero, Port: 443},
+		},
+	}
+	// Without guestIP, the event is kept as is
+	assert.DeepEqual(t, additionalGuestAgentEvent(limayaml.AdditionalGuestAgent{Name: "kind"}, ev), ev)
+
+	guestIP := net.ParseIP("172.18.0.2")
+	got := additionalGuestAgentEvent(limayaml.AdditionalGuestAgent{Name: "kind", GuestIP: guestIP}, ev)
+	assert.DeepEqual(t, got, guestagentapi.Event{
+		LocalPortsAdded: []guestagentapi.IPPort{
+			{IP: guestIP, Port: 80},
+			{IP: net.ParseIP("10.0.0.5"), Port: 8080},
+		},
+		LocalPortsRemoved: []guestagentapi.IPPort{
+			{IP: guestIP, Port: 443},
+		},
+	})
+}
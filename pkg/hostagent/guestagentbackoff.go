@@ -0,0 +1,29 @@
+package hostagent
+
+import (
+	"math/rand"
+	"time"
+)
+
+// guestAgentBackoffJitter is the ratio of the random jitter of the intervals between the attempts to connect
+// to the guest agent, so that the host agents of many instances do not retry in lockstep.
+const guestAgentBackoffJitter = 0.2
+
+// guestAgentBackoff returns the interval before the next attempt to connect to the guest agent after the
+// consecutive failures: initial after the first failure, doubled for each further failure up to max.
+// rnd is in [0, 1), and shifts the interval by up to guestAgentBackoffJitter in either direction.
+func guestAgentBackoff(initial, max time.Duration, failures int, rnd float64) time.Duration {
+	d := initial
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d + time.Duration(float64(d)*guestAgentBackoffJitter*(2*rnd-1))
+}
+
+// nextGuestAgentBackoff returns guestAgentBackoff with a random jitter.
+func (a *HostAgent) nextGuestAgentBackoff(failures int) time.Duration {
+	return guestAgentBackoff(a.guestAgentReconnectInterval, a.guestAgentReconnectMaxInterval, failures, rand.Float64())
+}
@@ -0,0 +1,29 @@
+package hostagent
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGuestAgentBackoff(t *testing.T) {
+	testCases := []struct {
+		failures int
+		rnd      float64
+		expected time.Duration
+	}{
+		{failures: 0, rnd: 0.5, expected: 10 * time.Second},
+		{failures: 1, rnd: 0.5, expected: 10 * time.Second},
+		{failures: 2, rnd: 0.5, expected: 20 * time.Second},
+		{failures: 4, rnd: 0.5, expected: 80 * time.Second},
+		{failures: 6, rnd: 0.5, expected: 5 * time.Minute},
+		{failures: 1000, rnd: 0.5, expected: 5 * time.Minute},
+		{failures: 1, rnd: 0, expected: 8 * time.Second},
+		{failures: 1000, rnd: 0, expected: 4 * time.Minute},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, guestAgentBackoff(10*time.Second, 5*time.Minute, tc.failures, tc.rnd), tc.expected,
+			"failures=%d, rnd=%v", tc.failures, tc.rnd)
+	}
+}
@@ -0,0 +1,27 @@
+package hostagent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/lima-vm/lima/pkg/httpclientutil"
+)
+
+// isPermanentGuestAgentError returns true if err from processGuestAgentEvents will not go away by
+// reconnecting: the guest agent rejected the request, e.g., for an authentication failure or an unknown
+// API version, or responded with something that is not the guest agent API.
+// The other errors, e.g., connection failures, timeouts, and 5xx responses, are transient.
+func isPermanentGuestAgentError(err error) bool {
+	var statusErr *httpclientutil.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
@@ -0,0 +1,41 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/httpclientutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestIsPermanentGuestAgentError(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("<html>"), new(map[string]any))
+	typeErr := json.Unmarshal([]byte(`{"localPorts":"22"}`), new(struct {
+		LocalPorts []int `json:"localPorts"`
+	}))
+	cases := []struct {
+		err       error
+		permanent bool
+	}{
+		{&httpclientutil.HTTPStatusError{StatusCode: http.StatusUnauthorized}, true},
+		{&httpclientutil.HTTPStatusError{StatusCode: http.StatusNotFound}, true},
+		{fmt.Errorf("%w: %w", errGuestAgentUnreachable, &httpclientutil.HTTPStatusError{StatusCode: http.StatusForbidden}), true},
+		{fmt.Errorf("%w: %w", errGuestAgentUnreachable, syntaxErr), true},
+		{typeErr, true},
+		{&httpclientutil.HTTPStatusError{StatusCode: http.StatusTooManyRequests}, false},
+		{&httpclientutil.HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, false},
+		{fmt.Errorf("%w: %w", errGuestAgentUnreachable, syscall.ECONNREFUSED), false},
+		{io.EOF, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("unexpected EOF"), false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, isPermanentGuestAgentError(tc.err), tc.permanent, tc.err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package hostagent
+
+import (
+	"sync"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+)
+
+// guestAgentInfoCache contains the latest Info of the guest agent, with the local ports updated
+// by the events.
+type guestAgentInfoCache struct {
+	info      *guestagentapi.Info
+	updatedAt time.Time
+	connected bool
+	// firstEvent is true until the first event after a connection, which contains the full ports
+	firstEvent bool
+	mu         sync.Mutex
+}
+
+// connect caches the Info received on a new connection.
+func (c *guestAgentInfoCache) connect(info *guestagentapi.Info, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copied := *info
+	copied.LocalPorts = append([]guestagentapi.IPPort(nil), info.LocalPorts...)
+	c.info = &copied
+	c.updatedAt = now
+	c.connected = true
+	c.firstEvent = true
+}
+
+// disconnect marks the cached Info as stale.
+func (c *guestAgentInfoCache) disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = false
+}
+
+// applyEvent updates the local ports of the cached Info with ev.
+func (c *guestAgentInfoCache) applyEvent(ev guestagentapi.Event, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info == nil {
+		return
+	}
+	var ports []guestagentapi.IPPort
+	if !c.firstEvent {
+		removed := make(map[string]bool)
+		for _, f := range ev.LocalPortsRemoved {
+			removed[f.String()] = true
+		}
+		for _, f := range c.info.LocalPorts {
+			if !removed[f.String()] {
+				ports = append(ports, f)
+			}
+		}
+	}
+	c.firstEvent = false
+	seen := make(map[string]bool)
+	for _, f := range ports {
+		seen[f.String()] = true
+	}
+	for _, f := range ev.LocalPortsAdded {
+		if !seen[f.String()] {
+			seen[f.String()] = true
+			ports = append(ports, f)
+		}
+	}
+	c.info.LocalPorts = ports
+	c.updatedAt = now
+}
+
+func (c *guestAgentInfoCache) get() *hostagentapi.GuestAgentInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := &hostagentapi.GuestAgentInfo{
+		Connected: c.connected,
+		UpdatedAt: c.updatedAt,
+	}
+	if c.info != nil {
+		copied := *c.info
+		copied.LocalPorts = append([]guestagentapi.IPPort(nil), c.info.LocalPorts...)
+		res.Info = &copied
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+package hostagent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestGuestAgentInfoCache(t *testing.T) {
+	port := func(p int) guestagentapi.IPPort {
+		return guestagentapi.IPPort{IP: net.IPv4(127, 0, 0, 1), Port: p}
+	}
+	var c guestAgentInfoCache
+	info := c.get()
+	assert.Equal(t, info.Connected, false)
+	assert.Assert(t, info.Info == nil)
+	assert.Assert(t, info.UpdatedAt.IsZero())
+
+	// Events before the first connection are ignored
+	c.applyEvent(guestagentapi.Event{LocalPortsAdded: []guestagentapi.IPPort{port(80)}}, time.Now())
+	assert.Assert(t, c.get().Info == nil)
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.connect(&guestagentapi.Info{LocalPorts: []guestagentapi.IPPort{port(22), port(80)}}, t0)
+	info = c.get()
+	assert.Equal(t, info.Connected, true)
+	assert.Equal(t, info.UpdatedAt, t0)
+	assert.DeepEqual(t, info.Info.LocalPorts, []guestagentapi.IPPort{port(22), port(80)})
+
+	// The first event contains the full ports
+	t1 := t0.Add(time.Second)
+	c.applyEvent(guestagentapi.Event{LocalPortsAdded: []guestagentapi.IPPort{port(22), port(443)}}, t1)
+	info = c.get()
+	assert.Equal(t, info.UpdatedAt, t1)
+	assert.DeepEqual(t, info.Info.LocalPorts, []guestagentapi.IPPort{port(22), port(443)})
+
+	t2 := t1.Add(time.Second)
+	c.applyEvent(guestagentapi.Event{
+		LocalPortsAdded:   []guestagentapi.IPPort{port(8080), port(22)},
+		LocalPortsRemoved: []guestagentapi.IPPort{port(443)},
+	}, t2)
+	assert.DeepEqual(t, c.get().Info.LocalPorts, []guestagentapi.IPPort{port(22), port(8080)})
+
+	c.disconnect()
+	info = c.get()
+	assert.Equal(t, info.Connected, false)
+	assert.Equal(t, info.UpdatedAt, t2)
+	assert.DeepEqual(t, info.Info.LocalPorts, []guestagentapi.IPPort{port(22), port(8080)})
+}
@@ -0,0 +1,75 @@
+package hostagent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// guestExportsFile contains the KEY=VALUE pairs written by the provisioning scripts,
+// to be exposed by the host agent.
+const guestExportsFile = "/run/lima-exports"
+
+// readGuestExportsScript prints guestExportsFile, or nothing when it does not exist.
+const readGuestExportsScript = `#!/bin/sh
+set -eu
+if [ -e ` + guestExportsFile + ` ]; then
+	echo exists
+	cat ` + guestExportsFile + `
+fi
+`
+
+// readGuestExports reads guestExportsFile as the provisioning user, and exposes its values
+// via Info and a GuestExports event. Nothing is emitted when the file does not exist.
+func (a *HostAgent) readGuestExports(ctx context.Context) {
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.provisionSSHConfig, readGuestExportsScript, "reading "+guestExportsFile)
+	if err == nil && !strings.HasPrefix(stdout, "exists\n") {
+		logrus.Debugf("%s does not exist in the guest", guestExportsFile)
+		return
+	}
+	ev := &events.GuestExports{}
+	if err != nil {
+		err = fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	} else {
+		ev.Values, err = parseGuestExports(strings.TrimPrefix(stdout, "exists\n"))
+	}
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to read %s from the guest", guestExportsFile)
+		ev.Error = err.Error()
+	} else {
+		logrus.Infof("Read %d values from %s", len(ev.Values), guestExportsFile)
+		a.guestExportsMu.Lock()
+		a.guestExports = ev.Values
+		a.guestExportsMu.Unlock()
+	}
+	a.emitEvent(ctx, events.Event{GuestExports: ev})
+}
+
+// parseGuestExports parses KEY=VALUE lines. Empty lines and lines starting with "#" are skipped,
+// and a leading "export " and the quotes around the values are removed, so that the file can
+// also be sourced by shell scripts.
+func parseGuestExports(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for i := 1; sc.Scan(); i++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i, line)
+		}
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		res[k] = v
+	}
+	return res, sc.Err()
+}
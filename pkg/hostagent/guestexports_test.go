@@ -0,0 +1,32 @@
+package hostagent
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseGuestExports(t *testing.T) {
+	values, err := parseGuestExports(`
+# written by the provisioning script
+TOKEN=abc=def
+export PORT=8080
+QUOTED="hello world"
+SINGLE='x'
+EMPTY=
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{
+		"TOKEN":  "abc=def",
+		"PORT":   "8080",
+		"QUOTED": "hello world",
+		"SINGLE": "x",
+		"EMPTY":  "",
+	})
+
+	_, err = parseGuestExports("FOO=bar\nnot a pair\n")
+	assert.Error(t, err, `line 2: expected KEY=VALUE, got "not a pair"`)
+
+	_, err = parseGuestExports("=value\n")
+	assert.ErrorContains(t, err, "expected KEY=VALUE")
+}
@@ -3,6 +3,8 @@ package hostagent
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,16 +12,19 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/networks"
 
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/cidata"
 	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
 	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
@@ -44,21 +49,131 @@ type HostAgent struct {
 	instName        string
 	instSSHAddress  string
 	sshConfig       *ssh.SSHConfig
+	sshOptsMu       sync.Mutex
+	sshOpts         []string
+	// sshKeyMu serializes the rotations of the SSH key
+	sshKeyMu        sync.Mutex
 	portForwarder   *portForwarder
-	onClose         []func() error // LIFO
+	onClose         closeStack
 	guestAgentProto guestagentclient.Proto
 
 	driver   driver.Driver
 	sigintCh chan os.Signal
+	// stopCh stops the instance like sigintCh, when `ssh.onConnectivityLoss` is "stop"
+	stopCh chan struct{}
+	// shutdownCh stops the instance like sigintCh, when requested by Shutdown
+	shutdownCh chan struct{}
+	// driverErrCh receives the exit of the VM from the driver
+	driverErrCh chan error
+
+	// guestPoweroffTimeout is the time to wait for the guest to power off on a graceful stop, or 0
+	guestPoweroffTimeout time.Duration
+	// idleSuspend is the duration of the inactivity after which the VM is paused, or 0
+	idleSuspend time.Duration
+	// idle is nil unless `hostAgent.idleSuspend` is enabled
+	idle *idleTracker
+	// suspendMu serializes pausing and resuming the VM
+	suspendMu sync.Mutex
+	// gracefulStop is set on SIGINT and Shutdown, for powering off the guest on close
+	gracefulStop atomic.Bool
+	// guestPoweredOff is true when the guest has powered off on close
+	guestPoweredOff bool
 
 	eventEnc   *json.Encoder
 	eventEncMu sync.Mutex
+	// eventTimeUTC is true when the event timestamps are in UTC rather than in local time
+	eventTimeUTC bool
+	// eventSyslog is the system log the events are forwarded to, or nil
+	eventSyslog *eventSyslog
+	// eventSeq is the sequence number of the last emitted event
+	eventSeq uint64
+	// eventLog is the log the events are appended to, or nil, see `hostAgent.eventLog`
+	eventLog     *jsonLinesLog
+	eventLogPath string
+
+	vSockPort      int
+	nerdctlArchive string
+
+	// hostResolverErr is the error from starting the optional hostResolver, reported as degraded
+	hostResolverErr error
+	// dnsServer is the running DNS server of the hostResolver, for the cache statistics
+	dnsServer atomic.Pointer[dns.Server]
+
+	// provisionSSHConfig is used for the requirement checks and copyToHost
+	provisionSSHConfig *ssh.SSHConfig
+
+	hostFileUmask os.FileMode
+
+	guestAgentRawEvents     int // the maximum number of raw guest agent events to emit
+	guestAgentRawEventsSent int
+
+	// guestAgentCancel cancels the current connection to the guest agent
+	guestAgentCancel       context.CancelFunc
+	guestAgentReconnecting bool
+	guestAgentGaveUp       bool
+	guestAgentCancelMu     sync.Mutex
+	guestAgentReconnectCh  chan struct{}
+	// guestAgentInfo is the latest Info of the guest agent, for the API
+	guestAgentInfo guestAgentInfoCache
+
+	eagerPortForwards bool
+	// guestExports are the values read from guestExportsFile
+	guestExports   map[string]string
+	guestExportsMu sync.Mutex
+	// x11Forwarding is the result of the detection of the X server, when X11 forwarding is enabled
+	x11Forwarding *events.X11Forwarding
+	// portForwardsDryRun is true when the forwards are only logged, see `portForwarding.dryRun`
+	portForwardsDryRun bool
+
+	// sshOutputLimit is the maximum number of bytes captured from the stdout and the stderr of the SSH commands
+	sshOutputLimit int
+
+	// guestAgentDialTimeout is the timeout for connecting to the guest agent, or 0
+	guestAgentDialTimeout time.Duration
+	// guestAgentReconnectInterval and guestAgentReconnectMaxInterval are the bounds of the backoff of the
+	// reconnections to the guest agent
+	guestAgentReconnectInterval    time.Duration
+	guestAgentReconnectMaxInterval time.Duration
+	// sshAddressTimeout is the timeout for resolving the SSH address of a WSL2 instance
+	sshAddressTimeout time.Duration
+	// sshExitMasterTimeout is the timeout for the SSH master to exit on shutdown
+	sshExitMasterTimeout time.Duration
+	// sshMasterPID is the PID of the SSH master last seen by watchSSHMaster, or 0
+	sshMasterPID atomic.Int64
+	// instanceEnvFile is the file with the instance environment, passed to the host commands as LIMA_INSTANCE_ENV_FILE
+	instanceEnvFile string
+
+	// probeResults are the results of the readiness probes, reported in the Running status
+	probeResults   []events.ProbeResult
+	probeResultsMu sync.Mutex
 
-	vSockPort int
+	// timeline is nil unless the startup timeline or the metrics are enabled
+	timeline *timeline
+	// startupTimeline is true when the timeline is emitted along with the Running status
+	startupTimeline bool
+	// stats are reported in the ShutdownSummary event
+	stats shutdownStats
+
+	// sshConfigFile is the absolute path of the SSH config file for `ssh -F`, or empty if not written
+	sshConfigFile string
+
+	portForwardsSSHConfigMu sync.Mutex
+
+	// sshControlSock is the path of the SSH control socket
+	sshControlSock string
+
+	// running is true once the Running status has been emitted.
+	// Until then, the errors passed to reportDegraded are kept in degradedErrs.
+	running      bool
+	degradedErrs []string
+	// degraded is true once the Degraded status has been emitted
+	degraded  bool
+	runningMu sync.Mutex
 }
 
 type options struct {
-	nerdctlArchive string // local path, not URL
+	nerdctlArchive      string // local path, not URL
+	guestAgentRawEvents int
 }
 
 type Opt func(*options) error
@@ -70,10 +185,22 @@ func WithNerdctlArchive(s string) Opt {
 	}
 }
 
+// WithGuestAgentRawEvents enables emitting up to n events received from the guest agent
+// as GuestAgentRawEvent, for debugging.
+func WithGuestAgentRawEvents(n int) Opt {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("the maximum number of raw guest agent events must not be negative, got %d", n)
+		}
+		o.guestAgentRawEvents = n
+		return nil
+	}
+}
+
 // New creates the HostAgent.
 //
 // stdout is for emitting JSON lines of Events.
-func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt) (*HostAgent, error) {
+func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt) (_ *HostAgent, retErr error) {
 	var o options
 	for _, f := range opts {
 		if err := f(&o); err != nil {
@@ -84,6 +211,9 @@ func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt
 	if err != nil {
 		return nil, err
 	}
+	if err := checkInstDir(inst.Dir); err != nil {
+		return nil, err
+	}
 
 	y, err := inst.LoadYAML()
 	if err != nil {
@@ -91,6 +221,8 @@ func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt
 	}
 	// y is loaded with FillDefault() already, so no need to care about nil pointers.
 
+	sshOutputLimit := *y.SSH.OutputLimit
+
 	sshLocalPort, err := determineSSHLocalPort(y, instName)
 	if err != nil {
 		return nil, err
@@ -99,64 +231,111 @@ func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt
 		sshLocalPort = inst.SSHLocalPort
 	}
 
+	hostFileUmask, err := limayaml.ParseUmask(*y.HostFileUmask)
+	if err != nil {
+		return nil, err
+	}
+
 	var udpDNSLocalPort, tcpDNSLocalPort int
 	if *y.HostResolver.Enabled {
-		udpDNSLocalPort, err = findFreeUDPLocalPort()
-		if err != nil {
-			return nil, err
-		}
-		tcpDNSLocalPort, err = findFreeTCPLocalPort()
+		udpDNSLocalPort, tcpDNSLocalPort, err = allocateDNSPorts(inst.Dir, *y.HostResolver.PersistPorts, hostFileUmask)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	guestAgentProto := guestagentclient.UNIX
-	if *y.VMType == limayaml.WSL2 {
+	if *y.VMType == limayaml.WSL2 || (*y.GuestAgent.VSock && driverutil.GuestAgentVSockSupported(*y.VMType)) {
 		guestAgentProto = guestagentclient.VSOCK
 	}
 
 	vSockPort := 0
 	if guestAgentProto == guestagentclient.VSOCK {
+		vSockFallback := *y.GuestAgent.VSockFallback
 		port, err := getFreeVSockPort()
 		if err != nil {
-			logrus.WithError(err).Error("failed to get free VSock port")
+			if !vSockFallback {
+				return nil, fmt.Errorf("failed to get free VSock port: %w", err)
+			}
+			// The guest agent listens on the unix socket when the VSock port is 0
+			logrus.WithError(err).Warn("failed to get free VSock port, falling back to forwarding the guest agent socket over SSH")
+			guestAgentProto = guestagentclient.UNIX
+		} else {
+			vSockPort = port
 		}
-		vSockPort = port
 	}
 
 	if err := cidata.GenerateISO9660(inst.Dir, instName, y, udpDNSLocalPort, tcpDNSLocalPort, o.nerdctlArchive, vSockPort); err != nil {
 		return nil, err
 	}
 
-	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted)
+	guestAgentDialTimeout, err := time.ParseDuration(*y.GuestAgent.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	guestAgentReconnectInterval, err := time.ParseDuration(*y.GuestAgent.ReconnectInterval)
 	if err != nil {
 		return nil, err
 	}
-	if err = writeSSHConfigFile(inst, inst.SSHAddress, sshLocalPort, sshOpts); err != nil {
+	guestAgentReconnectMaxInterval, err := time.ParseDuration(*y.GuestAgent.ReconnectMaxInterval)
+	if err != nil {
+		return nil, err
+	}
+	sshAddressTimeout, err := time.ParseDuration(*y.SSH.AddressTimeout)
+	if err != nil {
+		return nil, err
+	}
+	sshExitMasterTimeout, err := time.ParseDuration(*y.SSH.ExitMasterTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	forwardX11, forwardX11Trusted := *y.SSH.ForwardX11, *y.SSH.ForwardX11Trusted
+	var x11Forwarding *events.X11Forwarding
+	if forwardX11 || forwardX11Trusted {
+		x11Forwarding = &events.X11Forwarding{Display: sshutil.X11Display(), Action: "forward"}
+		x11Forwarding.Available = x11Forwarding.Display != ""
+		if !x11Forwarding.Available {
+			x11Forwarding.Action = *y.SSH.OnX11Unavailable
+			if x11Forwarding.Action == limayaml.X11UnavailableDisable {
+				forwardX11, forwardX11Trusted = false, false
+			}
+		}
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.RuntimeUser, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, forwardX11, forwardX11Trusted)
+	if err != nil {
+		return nil, err
+	}
+	sshControlSock := filepath.Join(inst.Dir, filenames.SSHSock)
+	sshConfigFile, err := writeSSHConfigFile(inst.Name, inst.Dir, inst.SSHAddress, sshLocalPort, sshOpts, hostFileUmask)
+	if err != nil {
 		return nil, err
 	}
 	sshConfig := &ssh.SSHConfig{
-		AdditionalArgs: sshutil.SSHArgsFromOpts(sshOpts),
+		AdditionalArgs: sshutil.SSHArgsFromOpts(withInstanceKeyOpt(inst.Dir, sshOpts)),
+	}
+	provisionSSHConfig := sshConfig
+	if *y.SSH.ProvisionUser != *y.SSH.RuntimeUser {
+		// The SSH control master is bound to the runtime user
+		provisionSSHOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.ProvisionUser, *y.SSH.LoadDotSSHPubKeys, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		provisionSSHConfig = &ssh.SSHConfig{
+			AdditionalArgs: sshutil.SSHArgsFromOpts(sshutil.DisableControlMaster(withInstanceKeyOpt(inst.Dir, provisionSSHOpts))),
+		}
 	}
 
-	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
-	// Block ports 22 and sshLocalPort on all IPs
-	for _, port := range []int{sshGuestPort, sshLocalPort} {
-		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
-		limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-		rules = append(rules, rule)
+	rules, err := portForwardRules(y, inst.Dir, sshLocalPort)
+	if err != nil {
+		return nil, err
 	}
-	rules = append(rules, y.PortForwards...)
-	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
-	rule := limayaml.PortForward{GuestIP: guestagentapi.IPv4loopback1}
-	limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-	rules = append(rules, rule)
 
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance:     inst,
 		Yaml:         y,
 		SSHLocalPort: sshLocalPort,
+		VSockPort:    vSockPort,
 	})
 
 	a := &HostAgent{
@@ -168,36 +347,210 @@ func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt
 		instName:        instName,
 		instSSHAddress:  inst.SSHAddress,
 		sshConfig:       sshConfig,
-		portForwarder:   newPortForwarder(sshConfig, sshLocalPort, rules, inst.VMType),
+		sshOpts:         sshOpts,
+		portForwarder:   newPortForwarder(sshConfig, sshLocalPort, sshOutputLimit, rules, inst.VMType),
 		driver:          limaDriver,
 		sigintCh:        sigintCh,
+		stopCh:          make(chan struct{}, 1),
+		shutdownCh:      make(chan struct{}, 1),
 		eventEnc:        json.NewEncoder(stdout),
+		eventTimeUTC:    *y.HostAgent.EventTimeUTC,
+		sshOutputLimit:  sshOutputLimit,
 		vSockPort:       vSockPort,
+		nerdctlArchive:  o.nerdctlArchive,
 		guestAgentProto: guestAgentProto,
+		hostFileUmask:   hostFileUmask,
+
+		provisionSSHConfig:    provisionSSHConfig,
+		guestAgentRawEvents:   o.guestAgentRawEvents,
+		guestAgentReconnectCh: make(chan struct{}, 1),
+		stats:                 shutdownStats{start: time.Now()},
+		eagerPortForwards:     *y.GuestAgent.EagerPortForwards,
+		portForwardsDryRun:    *y.PortForwarding.DryRun,
+		x11Forwarding:         x11Forwarding,
+		sshConfigFile:         sshConfigFile,
+		sshControlSock:        sshControlSock,
+		guestAgentDialTimeout: guestAgentDialTimeout,
+		sshAddressTimeout:     sshAddressTimeout,
+		sshExitMasterTimeout:  sshExitMasterTimeout,
+		instanceEnvFile:       filepath.Join(inst.Dir, filenames.HostAgentEnv),
+		probeResults:          newProbeResults(y.Probes),
+
+		guestAgentReconnectInterval:    guestAgentReconnectInterval,
+		guestAgentReconnectMaxInterval: guestAgentReconnectMaxInterval,
+	}
+	// Release what has been opened so far, e.g., the event syslog, when New fails
+	defer func() {
+		if retErr != nil {
+			if err := a.onClose.run(); err != nil {
+				logrus.WithError(err).Warn("an error during cleaning up the host agent")
+			}
+		}
+	}()
+	a.portForwarder.onTLSHandshakeError = func(name, local, remote string, err error) {
+		a.emitEvent(context.Background(), events.Event{
+			GuestTLSHandshakeFailure: &events.GuestTLSHandshakeFailure{
+				Name:   name,
+				Local:  local,
+				Remote: remote,
+				Error:  err.Error(),
+			},
+		})
+	}
+	a.portForwarder.onRelayStopped = func(ev events.PortForwardBytes) {
+		a.emitEvent(context.Background(), events.Event{PortForwardBytes: &ev})
+	}
+	a.portForwarder.onGuestTargets = func(ev events.GuestTargets) {
+		a.emitEvent(context.Background(), events.Event{GuestTargets: &ev})
+	}
+	a.portForwarder.onReady = a.runOnReady
+	a.startupTimeline = *y.HostAgent.StartupTimeline
+	if a.startupTimeline || *y.HostAgent.MetricsAddress != "" {
+		a.timeline = newTimeline()
+	}
+	if *y.HostAgent.SyslogTag != "" {
+		a.eventSyslog, err = newEventSyslog(*y.HostAgent.SyslogTag, *y.HostAgent.SyslogFacility)
+		if err != nil {
+			return nil, err
+		}
+		a.onClose.pushWithPriority(closePriorityEventSyslog, func() error {
+			a.eventEncMu.Lock()
+			defer a.eventEncMu.Unlock()
+			// syslog.Writer reconnects on write after Close, so drop it
+			s := a.eventSyslog
+			a.eventSyslog = nil
+			return s.close()
+		})
+	}
+	if timeout := *y.HostAgent.GuestPoweroffTimeout; timeout != "" && *y.VMType != limayaml.WSL2 {
+		// The timeout has been validated by limayaml.Validate
+		a.guestPoweroffTimeout, _ = time.ParseDuration(timeout)
+		a.onClose.pushWithPriority(closePriorityGuestPoweroff, func() error {
+			if a.gracefulStop.Load() {
+				a.guestPoweredOff = a.poweroffGuest()
+			}
+			return nil
+		})
+	}
+	if idleSuspend := *y.HostAgent.IdleSuspend; idleSuspend != "" && !*y.Plain {
+		// The duration has been validated by limayaml.Validate
+		a.idleSuspend, _ = time.ParseDuration(idleSuspend)
+		a.idle = newIdleTracker(time.Now())
+		// The connections are relayed in userspace, so that they can resume the VM
+		logrus.Info("Relaying all the TCP port forwards in userspace, for hostAgent.idleSuspend")
+		a.portForwarder.relayAll = true
+		a.portForwarder.onConnect = a.onRelayConnect
+		a.onClose.pushWithPriority(closePriorityResume, func() error {
+			return a.resume(context.Background(), "shutdown")
+		})
+	}
+	if *y.HostAgent.EventLog {
+		a.eventLogPath = filepath.Join(inst.Dir, filenames.HostAgentEvents)
+		// Continue the numbering, so that the clients can replay the events across restarts
+		a.eventSeq, err = lastEventSeq(a.eventLogPath)
+		if err != nil {
+			return nil, err
+		}
+		// The size has been validated by limayaml.Validate
+		maxSize, _ := units.RAMInBytes(*y.HostAgent.EventLogMaxSize)
+		a.eventLog, err = openJSONLinesLog(a.eventLogPath, maxSize, hostFileMode(hostFileUmask))
+		if err != nil {
+			return nil, err
+		}
+		a.onClose.pushWithPriority(closePriorityEventLog, func() error {
+			a.eventEncMu.Lock()
+			defer a.eventEncMu.Unlock()
+			return a.eventLog.close()
+		})
+	}
+	if err := writeInstanceEnvFile(a.instanceEnvFile, a.instanceEnv(), hostFileUmask); err != nil {
+		return nil, err
+	}
+	a.onClose.push(func() error {
+		return os.RemoveAll(a.instanceEnvFile)
+	})
+	a.portForwarder.onForwarded = func() {
+		a.stats.recordPortForward()
+		a.timeline.recordFirstForward()
+	}
+	a.portForwarder.onForwardFailed = a.stats.recordPortForwardFailure
+	if *y.PortForwarding.DecisionLog {
+		// The size has been validated by limayaml.Validate
+		maxSize, _ := units.RAMInBytes(*y.PortForwarding.DecisionLogMaxSize)
+		dl, err := openJSONLinesLog(filepath.Join(inst.Dir, filenames.ForwardDecisions), maxSize, hostFileMode(hostFileUmask))
+		if err != nil {
+			return nil, err
+		}
+		a.portForwarder.onDecision = func(d forwardDecision) {
+			if err := dl.write(d); err != nil {
+				logrus.WithError(err).Warn("failed to write the forwarding decision log")
+			}
+		}
+		a.onClose.push(dl.close)
+	}
+	if *y.SSH.PortForwardsConfig {
+		a.portForwarder.onChange = a.writePortForwardsSSHConfig
+		a.writePortForwardsSSHConfig()
+		a.onClose.push(func() error {
+			return os.RemoveAll(filepath.Join(a.instDir, filenames.SSHForwardsConfig))
+		})
 	}
 	return a, nil
 }
 
-func writeSSHConfigFile(inst *store.Instance, instSSHAddress string, sshLocalPort int, sshOpts []string) error {
-	if inst.Dir == "" {
-		return fmt.Errorf("directory is unknown for the instance %q", inst.Name)
+// writeSSHConfigFile writes the SSH config file for `ssh -F`, and returns its absolute path.
+// The file is replaced atomically, as it is rewritten on rotating the SSH key.
+func writeSSHConfigFile(instName, instDir, instSSHAddress string, sshLocalPort int, sshOpts []string, umask os.FileMode) (string, error) {
+	if instDir == "" {
+		return "", fmt.Errorf("directory is unknown for the instance %q", instName)
 	}
 	var b bytes.Buffer
 	if _, err := fmt.Fprintf(&b, `# This SSH config file can be passed to 'ssh -F'.
 # This file is created by Lima, but not used by Lima itself currently.
 # Modifications to this file will be lost on restarting the Lima instance.
 `); err != nil {
-		return err
+		return "", err
 	}
-	if err := sshutil.Format(&b, inst.Name, sshutil.FormatConfig,
+	if err := sshutil.Format(&b, instName, sshutil.FormatConfig,
 		append(sshOpts,
 			fmt.Sprintf("Hostname=%s", instSSHAddress),
 			fmt.Sprintf("Port=%d", sshLocalPort),
 		)); err != nil {
-		return err
+		return "", err
+	}
+	fileName, err := filepath.Abs(filepath.Join(instDir, filenames.SSHConfig))
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(instDir, "."+filenames.SSHConfig+".tmp-")
+	if err != nil {
+		return "", err
 	}
-	fileName := filepath.Join(inst.Dir, filenames.SSHConfig)
-	return os.WriteFile(fileName, b.Bytes(), 0o600)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(b.Bytes()); err != nil {
+		return "", err
+	}
+	if err := f.Chmod(hostFileMode(umask)); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), fileName); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+// hostFileMode returns the mode for a file created on the host, with the umask applied.
+func hostFileMode(umask os.FileMode) os.FileMode {
+	return 0o666 &^ umask
+}
+
+// hostDirMode returns the mode for a directory created on the host, with the umask applied.
+func hostDirMode(umask os.FileMode) os.FileMode {
+	return 0o777 &^ umask
 }
 
 func determineSSHLocalPort(y *limayaml.LimaYAML, instName string) (int, error) {
@@ -270,14 +623,48 @@ func (a *HostAgent) emitEvent(_ context.Context, ev events.Event) {
 	if ev.Time.IsZero() {
 		ev.Time = time.Now()
 	}
+	if a.eventTimeUTC {
+		ev.Time = ev.Time.UTC()
+	}
+	a.eventSeq++
+	ev.Seq = a.eventSeq
 	if err := a.eventEnc.Encode(ev); err != nil {
 		logrus.WithField("event", ev).WithError(err).Error("failed to emit an event")
 	}
+	if a.eventLog != nil {
+		if err := a.eventLog.write(ev); err != nil {
+			logrus.WithError(err).Debug("failed to append an event to the event log")
+		}
+	}
+	if a.eventSyslog != nil {
+		// Failing to write to the system log must not affect the main stream
+		b, err := json.Marshal(ev)
+		if err == nil {
+			err = a.eventSyslog.write(eventSyslogSeverity(ev), string(b))
+		}
+		if err != nil {
+			logrus.WithError(err).Debug("failed to forward an event to syslog")
+		}
+	}
 }
 
-func generatePassword(length int) (string, error) {
-	// avoid any special symbols, to make it easier to copy/paste
-	return password.Generate(length, length/4, 0, false, false)
+// EmitCustomEvent emits an event with the JSON representation of payload as Extra[key].
+// The event is interleaved with the other events, in the order of emission.
+func (a *HostAgent) EmitCustomEvent(ctx context.Context, key string, payload any) error {
+	if key == "" {
+		return errors.New("the key of a custom event must not be empty")
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the payload of custom event %q: %w", key, err)
+	}
+	a.emitEvent(ctx, events.Event{Extra: map[string]json.RawMessage{key: b}})
+	return nil
+}
+
+// generatePassword generates a secret conforming to the policy.
+func generatePassword(p limayaml.SecretPolicy) (string, error) {
+	return password.Generate(*p.Length, *p.Digits, *p.Symbols, *p.NoUpper, false)
 }
 
 func (a *HostAgent) Run(ctx context.Context) error {
@@ -286,87 +673,97 @@ func (a *HostAgent) Run(ctx context.Context) error {
 			Status: events.Status{
 				Exiting: true,
 			},
+			ShutdownSummary: a.stats.summary(),
 		}
 		a.emitEvent(ctx, exitingEv)
 	}()
+	a.reportX11Forwarding(ctx)
+
+	// The metrics listener is bound here rather than in New, so that a failed New does not keep the port busy
+	if metricsAddress := *a.y.HostAgent.MetricsAddress; metricsAddress != "" {
+		srv, err := a.startMetricsServer(metricsAddress)
+		if err != nil {
+			return fmt.Errorf("failed to start the metrics listener on %s: %w", metricsAddress, err)
+		}
+		defer srv.Close()
+	}
 
 	firstUsernetIndex := limayaml.FirstUsernetIndex(a.y)
 	if firstUsernetIndex == -1 && *a.y.HostResolver.Enabled {
 		hosts := a.y.HostResolver.Hosts
 		hosts["host.lima.internal"] = networks.SlirpGateway
 		hosts[fmt.Sprintf("lima-%s", a.instName)] = networks.SlirpIPAddress
+		onQuery, closeQueryLog, err := a.openDNSQueryLogger()
+		if err != nil {
+			return fmt.Errorf("failed to open the DNS query log: %w", err)
+		}
+		defer func() {
+			if err := closeQueryLog(); err != nil {
+				logrus.WithError(err).Warn("failed to close the DNS query log")
+			}
+		}()
 		srvOpts := dns.ServerOptions{
 			UDPPort: a.udpDNSLocalPort,
 			TCPPort: a.tcpDNSLocalPort,
 			Address: "127.0.0.1",
 			HandlerOptions: dns.HandlerOptions{
-				IPv6:        *a.y.HostResolver.IPv6,
-				StaticHosts: hosts,
+				IPv6:            *a.y.HostResolver.IPv6,
+				StaticHosts:     hosts,
+				SearchDomains:   a.y.HostResolver.SearchDomains,
+				CacheSize:       *a.y.HostResolver.CacheSize,
+				UpstreamServers: a.y.HostResolver.UpstreamServers,
+				Forwarders:      a.y.HostResolver.Forwarders,
+				OnQuery:         onQuery,
 			},
 		}
 		dnsServer, err := dns.Start(srvOpts)
-		if err != nil {
+		if err == nil {
+			a.dnsServer.Store(dnsServer)
+			defer func() {
+				a.dnsServer.Store(nil)
+				a.stats.recordDNSCache(dnsServer.CacheStats())
+				dnsServer.Shutdown()
+			}()
+		} else if !*a.y.HostResolver.Optional {
 			return fmt.Errorf("cannot start DNS server: %w", err)
+		} else if err := a.disableHostResolver(err); err != nil {
+			return err
 		}
-		defer dnsServer.Shutdown()
 	}
 
+	if err := a.checkHostPrerequisites(ctx); err != nil {
+		return err
+	}
+
+	a.emitPhase(ctx, events.PhaseDriverStart)
+	driverStart := time.Now()
 	errCh, err := a.driver.Start(ctx)
 	if err != nil {
 		return err
 	}
+	a.timeline.record("driverStart", driverStart)
 
 	// WSL instance SSH address isn't known until after VM start
 	if *a.y.VMType == limayaml.WSL2 {
-		sshAddr, err := store.GetSSHAddress(a.instName)
+		sshAddr, err := a.resolveSSHAddress(ctx)
 		if err != nil {
 			return err
 		}
 		a.instSSHAddress = sshAddr
 	}
 
+	a.applyCPUAffinity(ctx)
+
 	if a.y.Video.Display != nil && *a.y.Video.Display == "vnc" {
-		vncdisplay, vncoptions, _ := strings.Cut(*a.y.Video.VNC.Display, ",")
-		vnchost, vncnum, err := net.SplitHostPort(vncdisplay)
-		if err != nil {
-			return err
-		}
-		n, err := strconv.Atoi(vncnum)
-		if err != nil {
-			return err
-		}
-		vncport := strconv.Itoa(5900 + n)
-		vncpwdfile := filepath.Join(a.instDir, filenames.VNCPasswordFile)
-		vncpasswd, err := generatePassword(8)
-		if err != nil {
-			return err
-		}
-		if err := a.driver.ChangeDisplayPassword(ctx, vncpasswd); err != nil {
-			return err
-		}
-		if err := os.WriteFile(vncpwdfile, []byte(vncpasswd), 0o600); err != nil {
-			return err
-		}
-		if strings.Contains(vncoptions, "to=") {
-			vncport, err = a.driver.GetDisplayConnection(ctx)
-			if err != nil {
-				return err
-			}
-			p, err := strconv.Atoi(vncport)
-			if err != nil {
+		if err := a.setUpVNC(ctx); err != nil {
+			var displayErr *invalidVNCDisplayError
+			if !errors.As(err, &displayErr) || *a.y.Video.VNC.OnInvalidDisplay != limayaml.VNCInvalidDisplayDisable {
 				return err
 			}
-			vncnum = strconv.Itoa(p - 5900)
-			vncdisplay = net.JoinHostPort(vnchost, vncnum)
+			msg := fmt.Sprintf("VNC is disabled, as %v", err)
+			logrus.Warn(msg)
+			a.emitEvent(ctx, events.Event{Warnings: []string{msg}})
 		}
-		vncfile := filepath.Join(a.instDir, filenames.VNCDisplayFile)
-		if err := os.WriteFile(vncfile, []byte(vncdisplay), 0o600); err != nil {
-			return err
-		}
-		vncurl := "vnc://" + net.JoinHostPort(vnchost, vncport)
-		logrus.Infof("VNC server running at %s <%s>", vncdisplay, vncurl)
-		logrus.Infof("VNC Display: `%s`", vncfile)
-		logrus.Infof("VNC Password: `%s`", vncpwdfile)
 	}
 
 	if a.driver.CanRunGUI() {
@@ -381,48 +778,188 @@ func (a *HostAgent) Run(ctx context.Context) error {
 	return a.startRoutinesAndWait(ctx, errCh)
 }
 
+// disableHostResolver regenerates cidata without the hostResolver ports, so that the guest
+// falls back to the DNS server provided by the VM. Must be called before starting the driver.
+func (a *HostAgent) disableHostResolver(dnsErr error) error {
+	logrus.WithError(dnsErr).Warn("cannot start DNS server, continuing without the hostResolver as `hostResolver.optional` is set")
+	a.udpDNSLocalPort = 0
+	a.tcpDNSLocalPort = 0
+	if err := cidata.GenerateISO9660(a.instDir, a.instName, a.y, 0, 0, a.nerdctlArchive, a.vSockPort); err != nil {
+		return fmt.Errorf("failed to regenerate cidata without the hostResolver: %w", err)
+	}
+	a.hostResolverErr = fmt.Errorf("cannot start DNS server: %w", dnsErr)
+	return nil
+}
+
 func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh chan error) error {
+	a.driverErrCh = errCh
 	stBase := events.Status{
-		SSHLocalPort: a.sshLocalPort,
+		SSHLocalPort:  a.sshLocalPort,
+		SSHConfigFile: a.sshConfigFile,
 	}
 	stBooting := stBase
 	a.emitEvent(ctx, events.Event{Status: stBooting})
 	ctxHA, cancelHA := context.WithCancel(ctx)
 	go func() {
 		stRunning := stBase
+		if a.hostResolverErr != nil {
+			stRunning.Degraded = true
+			stRunning.Errors = append(stRunning.Errors, a.hostResolverErr.Error())
+		}
 		if haErr := a.startHostAgentRoutines(ctxHA); haErr != nil {
 			stRunning.Degraded = true
 			stRunning.Errors = append(stRunning.Errors, haErr.Error())
 		}
+		stRunning.Probes = a.probeResultsSnapshot()
 		stRunning.Running = true
-		a.emitEvent(ctx, events.Event{Status: stRunning})
+		stRunning.Phase = events.PhaseRunning
+		a.runningMu.Lock()
+		if len(a.degradedErrs) > 0 {
+			stRunning.Degraded = true
+			stRunning.Errors = append(stRunning.Errors, a.degradedErrs...)
+		}
+		a.running = true
+		a.degraded = stRunning.Degraded
+		var tl *events.Timeline
+		if a.startupTimeline {
+			tl = a.timeline.event()
+		}
+		a.emitEvent(ctx, events.Event{Status: stRunning, Timeline: tl})
+		a.runningMu.Unlock()
 	}()
 	for {
 		select {
 		case driverErr := <-errCh:
 			logrus.Infof("Driver stopped due to error: %q", driverErr)
 			cancelHA()
-			if closeErr := a.close(); closeErr != nil {
+			closeErr := a.close()
+			if closeErr != nil {
 				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
 			}
 			err := a.driver.Stop(ctx)
+			a.stats.recordStop(stopReasonDriverStopped, closeErr, err)
 			return err
 		case <-a.sigintCh:
 			logrus.Info("Received SIGINT, shutting down the host agent")
 			cancelHA()
-			if closeErr := a.close(); closeErr != nil {
+			a.gracefulStop.Store(true)
+			closeErr := a.close()
+			if closeErr != nil {
+				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
+			}
+			err := a.stopDriver(ctx)
+			a.stats.recordStop(stopReasonSignal, closeErr, err)
+			return err
+		case <-a.shutdownCh:
+			logrus.Info("Shutdown requested via the API, shutting down the host agent")
+			cancelHA()
+			a.gracefulStop.Store(true)
+			closeErr := a.close()
+			if closeErr != nil {
+				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
+			}
+			err := a.stopDriver(ctx)
+			a.stats.recordStop(stopReasonAPI, closeErr, err)
+			return err
+		case <-a.stopCh:
+			logrus.Info("SSH connectivity lost, shutting down the host agent")
+			cancelHA()
+			closeErr := a.close()
+			if closeErr != nil {
 				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
 			}
 			err := a.driver.Stop(ctx)
+			a.stats.recordStop(stopReasonSSHConnectivityLoss, closeErr, err)
 			return err
 		}
 	}
 }
 
+// emitPhase emits the transition to the boot phase.
+func (a *HostAgent) emitPhase(ctx context.Context, phase events.Phase) {
+	a.emitEvent(ctx, events.Event{
+		Status: events.Status{
+			SSHLocalPort:  a.sshLocalPort,
+			SSHConfigFile: a.sshConfigFile,
+			Phase:         phase,
+		},
+	})
+}
+
+// reportDegraded marks the instance as degraded with msg.
+// Before the Running status has been emitted, msg is only reported as an error, and the degradation
+// is deferred to the Running status, so that `limactl start` does not consider the boot to be completed.
+func (a *HostAgent) reportDegraded(ctx context.Context, msg string) {
+	a.runningMu.Lock()
+	defer a.runningMu.Unlock()
+	st := events.Status{
+		Running:       a.running,
+		Degraded:      a.running,
+		Errors:        []string{msg},
+		SSHLocalPort:  a.sshLocalPort,
+		SSHConfigFile: a.sshConfigFile,
+	}
+	if a.running {
+		a.degraded = true
+	} else {
+		a.degradedErrs = append(a.degradedErrs, msg)
+	}
+	a.emitEvent(ctx, events.Event{Status: st})
+}
+
+// reportX11Forwarding emits the result of the detection of the X server, and applies
+// `ssh.onX11Unavailable`. The "disable" action has already been applied to the SSH options.
+func (a *HostAgent) reportX11Forwarding(ctx context.Context) {
+	x := a.x11Forwarding
+	if x == nil {
+		return
+	}
+	a.emitEvent(ctx, events.Event{X11Forwarding: x})
+	if x.Available {
+		logrus.Debugf("Forwarding X11 to display %q", x.Display)
+		return
+	}
+	msg := "X11 forwarding is enabled, but no X server was detected on the host ($DISPLAY is not set)"
+	switch x.Action {
+	case limayaml.X11UnavailableDisable:
+		logrus.Info(msg + "; disabled X11 forwarding")
+	case limayaml.X11UnavailableFail:
+		logrus.Error(msg)
+		a.reportDegraded(ctx, msg)
+	default:
+		logrus.Warn(msg)
+		a.emitEvent(ctx, events.Event{Warnings: []string{msg}})
+	}
+}
+
 func (a *HostAgent) Info(_ context.Context) (*hostagentapi.Info, error) {
 	info := &hostagentapi.Info{
-		SSHLocalPort: a.sshLocalPort,
+		SSHLocalPort:  a.sshLocalPort,
+		SSHConfigFile: a.sshConfigFile,
+	}
+	a.sshOptsMu.Lock()
+	info.SSHOpts = sshutil.RedactOpts(a.sshOpts)
+	a.sshOptsMu.Unlock()
+	if a.udpDNSLocalPort != 0 || a.tcpDNSLocalPort != 0 {
+		info.DNSPorts = &hostagentapi.DNSPorts{
+			UDP: a.udpDNSLocalPort,
+			TCP: a.tcpDNSLocalPort,
+		}
+	}
+	if dnsServer := a.dnsServer.Load(); dnsServer != nil && *a.y.HostResolver.CacheSize > 0 {
+		hits, misses := dnsServer.CacheStats()
+		info.DNSCache = &hostagentapi.DNSCache{
+			Size:    *a.y.HostResolver.CacheSize,
+			Entries: dnsServer.CacheEntries(),
+			Hits:    hits,
+			Misses:  misses,
+		}
 	}
+	a.guestExportsMu.Lock()
+	info.GuestExports = a.guestExports
+	a.guestExportsMu.Unlock()
+	info.PortForwardBytes = a.portForwarder.portForwardBytes()
+	info.Suspended = a.suspended()
 	return info, nil
 }
 
@@ -430,17 +967,20 @@ func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 	if *a.y.Plain {
 		logrus.Info("Running in plain mode. Mounts, port forwarding, containerd, etc. will be ignored. Guest agent will not be running.")
 	}
-	a.onClose = append(a.onClose, func() error {
+	if *a.y.HostAgent.MDNS {
+		a.startMDNS(*a.y.HostAgent.MDNSAddress)
+	}
+	a.onClose.pushWithPriority(closePrioritySSHMaster, func() error {
 		logrus.Debugf("shutting down the SSH master")
-		if exitMasterErr := ssh.ExitMaster(a.instSSHAddress, a.sshLocalPort, a.sshConfig); exitMasterErr != nil {
-			logrus.WithError(exitMasterErr).Warn("failed to exit SSH master")
-		}
+		a.exitSSHMaster()
 		return nil
 	})
 	var errs []error
 	if err := a.waitForRequirements("essential", a.essentialRequirements()); err != nil {
 		errs = append(errs, err)
 	}
+	go a.watchSSHMaster(ctx)
+	go a.watchSSHConnectivity(ctx)
 	if *a.y.SSH.ForwardAgent {
 		faScript := `#!/bin/bash
 set -eux -o pipefail
@@ -454,12 +994,33 @@ sudo chown -R "${USER}" /run/host-services`
 			errs = append(errs, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err))
 		}
 	}
-	if *a.y.MountType == limayaml.REVSSHFS && !*a.y.Plain {
+	for _, rule := range a.y.CopyToGuest {
+		if err := copyToGuest(ctx, a.provisionSSHConfig, a.sshLocalPort, a.sshOutputLimit, rule); err != nil {
+			errs = append(errs, err)
+		}
+		if rule.Watch {
+			go a.watchCopyToGuest(ctx, rule)
+		}
+	}
+	setUpMounts := func(after limayaml.MountsAfter) {
+		if *a.y.MountType != limayaml.REVSSHFS || *a.y.Plain || *a.y.MountsAfter != after {
+			return
+		}
+		deferred := after != limayaml.MountsAfterEssential
+		if deferred {
+			logrus.Infof("Setting up the mounts after the %s requirements", after)
+			a.emitEvent(ctx, events.Event{MountSetup: &events.MountSetup{After: after}})
+		}
+		mountsStart := time.Now()
 		mounts, err := a.setupMounts()
 		if err != nil {
 			errs = append(errs, err)
 		}
-		a.onClose = append(a.onClose, func() error {
+		a.timeline.record("mounts", mountsStart)
+		for _, m := range mounts {
+			go a.watchMount(ctx, m)
+		}
+		a.onClose.pushWithPriority(closePriorityMounts, func() error {
 			var unmountErrs []error
 			for _, m := range mounts {
 				if unmountErr := m.close(); unmountErr != nil {
@@ -468,9 +1029,17 @@ sudo chown -R "${USER}" /run/host-services`
 			}
 			return errors.Join(unmountErrs...)
 		})
+		if deferred {
+			ev := events.Event{MountSetup: &events.MountSetup{After: after, Completed: true}}
+			if err != nil {
+				ev.MountSetup.Error = err.Error()
+			}
+			a.emitEvent(ctx, ev)
+		}
 	}
+	setUpMounts(limayaml.MountsAfterEssential)
 	if len(a.y.AdditionalDisks) > 0 {
-		a.onClose = append(a.onClose, func() error {
+		a.onClose.push(func() error {
 			var unlockErrs []error
 			for _, d := range a.y.AdditionalDisks {
 				disk, inspectErr := store.InspectDisk(d.Name)
@@ -488,27 +1057,82 @@ sudo chown -R "${USER}" /run/host-services`
 	}
 	if !*a.y.Plain {
 		go a.watchGuestAgentEvents(ctx)
+		a.startAdditionalGuestAgents(ctx)
+		if a.idle != nil {
+			a.idle.touch(time.Now())
+			go a.watchIdleSuspend(ctx)
+		}
 	}
 	if err := a.waitForRequirements("optional", a.optionalRequirements()); err != nil {
 		errs = append(errs, err)
 	}
+	setUpMounts(limayaml.MountsAfterOptional)
 	if err := a.waitForRequirements("final", a.finalRequirements()); err != nil {
 		errs = append(errs, err)
 	}
+	setUpMounts(limayaml.MountsAfterFinal)
+	go a.watchResolvConf(ctx)
+	a.readGuestExports(ctx)
 	// Copy all config files _after_ the requirements are done
-	for _, rule := range a.y.CopyToHost {
-		if err := copyToHost(ctx, a.sshConfig, a.sshLocalPort, rule.HostFile, rule.GuestFile); err != nil {
+	skipped := make(map[int]bool)
+	for i, rule := range a.y.CopyToHost {
+		if rule.IfExists == limayaml.CopyToHostSkip {
+			if _, err := os.Stat(rule.HostFile); err == nil {
+				logrus.Infof("Not copying %s to %s, as it already exists", rule.GuestFile, rule.HostFile)
+				skipped[i] = true
+				a.emitEvent(ctx, events.Event{
+					CopyToHostSkip: &events.CopyToHostSkip{
+						GuestFile: rule.GuestFile,
+						HostFile:  rule.HostFile,
+					},
+				})
+				continue
+			}
+		}
+		if err := copyToHost(ctx, a.provisionSSHConfig, a.sshLocalPort, a.sshOutputLimit, rule.HostFile, rule.GuestFile, rule.IfExists, rule.ExpectedSHA256, a.hostFileUmask); err != nil {
+			var mismatch *checksumMismatchError
+			if errors.As(err, &mismatch) {
+				a.emitEvent(ctx, events.Event{
+					CopyToHostChecksumMismatch: &events.CopyToHostChecksumMismatch{
+						GuestFile: rule.GuestFile,
+						HostFile:  rule.HostFile,
+						Expected:  mismatch.expected,
+						Actual:    mismatch.actual,
+					},
+				})
+			}
 			errs = append(errs, err)
 		}
 	}
-	a.onClose = append(a.onClose, func() error {
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	var watchWG sync.WaitGroup
+	for _, rule := range a.y.CopyToHost {
+		if rule.Watch {
+			watchWG.Add(1)
+			go func(rule limayaml.CopyToHost) {
+				defer watchWG.Done()
+				a.watchCopyToHost(watchCtx, rule)
+			}(rule)
+		}
+	}
+	a.onClose.push(func() error {
+		// Stop the watches first, so that the files are not copied again after being deleted
+		cancelWatch()
+		watchWG.Wait()
 		var rmErrs []error
-		for _, rule := range a.y.CopyToHost {
-			if rule.DeleteOnStop {
+		for i, rule := range a.y.CopyToHost {
+			if rule.DeleteOnStop && !skipped[i] {
 				logrus.Infof("Deleting %s", rule.HostFile)
+				ev := events.Event{
+					CopyToHostDeletion: &events.CopyToHostDeletion{
+						HostFile: rule.HostFile,
+					},
+				}
 				if err := os.RemoveAll(rule.HostFile); err != nil {
 					rmErrs = append(rmErrs, err)
+					ev.CopyToHostDeletion.Error = err.Error()
 				}
+				a.emitEvent(context.Background(), ev)
 			}
 		}
 		return errors.Join(rmErrs...)
@@ -518,46 +1142,110 @@ sudo chown -R "${USER}" /run/host-services`
 
 func (a *HostAgent) close() error {
 	logrus.Infof("Shutting down the host agent")
-	var errs []error
-	for i := len(a.onClose) - 1; i >= 0; i-- {
-		f := a.onClose[i]
-		if err := f(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-	return errors.Join(errs...)
+	return a.onClose.run()
 }
 
 func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 	// TODO: use vSock (when QEMU for macOS gets support for vSock)
 
 	// Setup all socket forwards and defer their teardown
-	if *a.y.VMType != limayaml.WSL2 {
+	if a.portForwardsDryRun {
+		logrus.Warn("portForwarding.dryRun is enabled; the ports and the sockets are not forwarded")
+		for _, rule := range a.portForwarder.currentRules() {
+			if rule.GuestSocket != "" {
+				logrus.Infof("Would forward unix socket %s (guest) to %s (host)", rule.GuestSocket, hostAddress(rule, guestagentapi.IPPort{}))
+			}
+			if len(rule.GuestTargets) > 0 {
+				logrus.Infof("Would relay %s (host) to %v (guest)%s", hostAddress(rule, guestagentapi.IPPort{}), rule.GuestTargets, forwardName(rule.Name))
+			}
+			if isReverseTCPRule(rule) {
+				local, remote := reverseTCPAddresses(rule)
+				logrus.Infof("Would forward TCP from %s (host) to %s (guest)%s", local, remote, forwardName(rule.Name))
+			}
+		}
+		if socksProxy := *a.y.PortForwarding.SOCKSProxy; socksProxy != "" {
+			logrus.Infof("Would start the SOCKS5 proxy into the guest network on %s", socksProxy)
+		}
+	} else if *a.y.VMType != limayaml.WSL2 {
 		logrus.Debugf("Forwarding unix sockets")
-		for _, rule := range a.y.PortForwards {
+		for _, rule := range a.portForwarder.currentRules() {
 			if rule.GuestSocket != "" {
 				local := hostAddress(rule, guestagentapi.IPPort{})
-				_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward, rule.Reverse)
+				if len(rule.GuestSocketPruneDirs) > 0 {
+					if err := executeSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, "mkdir", "-p", path.Dir(rule.GuestSocket)); err != nil {
+						logrus.WithError(err).Warnf("Failed to create the parent directory of %q (guest)", rule.GuestSocket)
+					}
+				}
+				err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, rule.GuestSocket, verbForward, rule.Reverse)
+				if err == nil && len(rule.OnReady) > 0 {
+					a.runOnReady(rule, local, rule.GuestSocket)
+				}
+			}
+			if isReverseTCPRule(rule) {
+				local, remote := reverseTCPAddresses(rule)
+				logrus.Infof("Forwarding TCP from %s (host) to %s (guest)%s", local, remote, forwardName(rule.Name))
+				if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, remote, verbForward, true); err != nil {
+					logrus.WithError(err).Warnf("Failed to forward TCP from %s (host) to %s (guest)", local, remote)
+				} else if len(rule.OnReady) > 0 {
+					a.runOnReady(rule, local, remote)
+				}
+			}
+			if len(rule.GuestTargets) > 0 {
+				local := hostAddress(rule, guestagentapi.IPPort{})
+				logrus.Infof("Relaying %s (host) to %v (guest)%s", local, rule.GuestTargets, forwardName(rule.Name))
+				if err := a.portForwarder.forwardGuestTargets(ctx, rule); err != nil {
+					logrus.WithError(err).Warnf("Failed to relay %s (host) to the guest targets", local)
+				} else if len(rule.OnReady) > 0 {
+					a.runOnReady(rule, local, strings.Join(rule.GuestTargets, ","))
+				}
 			}
 		}
+		a.startSOCKSProxy(ctx)
+	} else if *a.y.PortForwarding.SOCKSProxy != "" {
+		logrus.Warn("portForwarding.socksProxy is not supported for WSL2")
 	}
 
 	localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
 	remoteUnix := "/run/lima-guestagent.sock"
 
-	a.onClose = append(a.onClose, func() error {
+	a.onClose.push(func() error {
 		logrus.Debugf("Stop forwarding unix sockets")
 		var errs []error
-		for _, rule := range a.y.PortForwards {
-			if rule.GuestSocket != "" {
+		// using ctx.Background() because ctx has already been cancelled
+		if err := a.portForwarder.cancelSocketForwards(context.Background()); err != nil {
+			errs = append(errs, err)
+		}
+		if err := a.portForwarder.cancelGuestTargets(context.Background()); err != nil {
+			errs = append(errs, err)
+		}
+		if !a.portForwardsDryRun && *a.y.VMType != limayaml.WSL2 {
+			if err := a.stopSOCKSProxy(context.Background()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, rule := range a.portForwarder.currentRules() {
+			if isReverseTCPRule(rule) && !a.portForwardsDryRun && *a.y.VMType != limayaml.WSL2 {
+				local, remote := reverseTCPAddresses(rule)
+				logrus.Infof("Stopping forwarding TCP from %s (host) to %s (guest)", local, remote)
+				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, remote, verbCancel, true); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if rule.GuestSocket != "" && !a.portForwardsDryRun {
 				local := hostAddress(rule, guestagentapi.IPPort{})
-				// using ctx.Background() because ctx has already been cancelled
-				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbCancel, rule.Reverse); err != nil {
+				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, rule.GuestSocket, verbCancel, rule.Reverse); err != nil {
 					errs = append(errs, err)
 				}
+				if dirs := guestSocketPruneCandidates(rule.GuestSocket, rule.GuestSocketPruneDirs); len(dirs) > 0 {
+					// rmdir only removes the empty directories, so the outer ones are kept when an inner one is not empty
+					args := append([]string{"rmdir", "--"}, dirs...)
+					if err := executeSSH(context.Background(), a.sshConfig, a.sshLocalPort, a.sshOutputLimit, args...); err != nil {
+						logrus.WithError(err).Debugf("Stopped pruning the parent directories of %q (guest)", rule.GuestSocket)
+					}
+				}
 			}
 		}
-		if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbCancel, false); err != nil {
+		if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, a.sshOutputLimit, localUnix, remoteUnix, verbCancel, false); err != nil {
 			errs = append(errs, err)
 		}
 		return errors.Join(errs...)
@@ -568,53 +1256,213 @@ func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 		guestSocketAddr = fmt.Sprintf("0.0.0.0:%d", a.vSockPort)
 	}
 
+	// failures is the number of consecutive failed attempts to connect to the guest agent
+	var failures int
+	warnings := logThrottle{interval: guestAgentWarningInterval}
 	for {
-		if !isGuestAgentSocketAccessible(ctx, guestSocketAddr, a.guestAgentProto, a.instName) {
-			if a.guestAgentProto != guestagentclient.VSOCK {
-				_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbForward, false)
-			}
+		// The vsock connections do not depend on SSH
+		if a.guestAgentProto != guestagentclient.VSOCK && !isGuestAgentSocketAccessible(ctx, guestSocketAddr, a.guestAgentProto, a.instName, a.guestAgentDialTimeout) {
+			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, localUnix, remoteUnix, verbForward, false)
 		}
-		if err := a.processGuestAgentEvents(ctx, guestSocketAddr, a.guestAgentProto, a.instName); err != nil {
-			if !errors.Is(err, context.Canceled) {
+		gaCtx, gaCancel := context.WithCancel(ctx)
+		a.guestAgentCancelMu.Lock()
+		a.guestAgentCancel = gaCancel
+		a.guestAgentCancelMu.Unlock()
+		err := a.processGuestAgentEvents(gaCtx, guestSocketAddr, a.guestAgentProto, a.instName)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			// The warnings are coalesced while the guest agent stays unreachable
+			if ok, suppressed := warnings.allow(time.Now()); !ok {
+				logrus.WithError(err).Debug("connection to the guest agent was closed unexpectedly")
+			} else if suppressed > 0 {
+				logrus.WithError(err).Warnf("connection to the guest agent was closed unexpectedly (%d similar warnings suppressed)", suppressed)
+			} else {
 				logrus.WithError(err).Warn("connection to the guest agent was closed unexpectedly")
 			}
 		}
+		gaCancel()
+		if err != nil && ctx.Err() == nil && isPermanentGuestAgentError(err) {
+			if *a.y.GuestAgent.OnPermanentError == limayaml.GuestAgentPermanentErrorDegrade {
+				a.giveUpGuestAgent(ctx, fmt.Sprintf("gave up connecting to the guest agent after a permanent error: %v", err))
+				return
+			}
+			logrus.WithError(err).Debug("retrying the guest agent after a permanent error (guestAgent.onPermanentError: retry)")
+		}
+		if errors.Is(err, errGuestAgentUnreachable) {
+			failures++
+		} else {
+			failures = 0
+			warnings.reset()
+		}
+		if maxReconnects := *a.y.GuestAgent.MaxReconnects; maxReconnects > 0 && failures >= maxReconnects && ctx.Err() == nil {
+			a.giveUpGuestAgent(ctx, fmt.Sprintf("gave up connecting to the guest agent after %d attempts: %v", failures, err))
+			return
+		}
+		// Reported once for each series of failures, while retrying
+		if degradeAfter := *a.y.GuestAgent.DegradeAfterFailures; degradeAfter > 0 && failures == degradeAfter && ctx.Err() == nil {
+			msg := fmt.Sprintf("failed to connect to the guest agent %d times in a row: %v", failures, err)
+			logrus.Error(msg)
+			a.reportDegraded(ctx, msg)
+		}
+		// The backoff restarts from `guestAgent.reconnectInterval` after an established connection has been closed
+		backoff := a.nextGuestAgentBackoff(failures)
+		logrus.Debugf("retrying to connect to the guest agent in %s", backoff)
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(10 * time.Second):
+		case <-a.guestAgentReconnectCh:
+			logrus.Info("Reconnecting to the guest agent")
+		case <-time.After(backoff):
 		}
 	}
 }
 
-func isGuestAgentSocketAccessible(ctx context.Context, localUnix string, proto guestagentclient.Proto, instanceName string) bool {
-	client, err := guestagentclient.NewGuestAgentClient(localUnix, proto, instanceName)
+// giveUpGuestAgent stops watchGuestAgentEvents after too many failed attempts to connect, or
+// after a permanent error, and reports the instance as degraded with msg.
+// The existing port forwards are kept as is.
+func (a *HostAgent) giveUpGuestAgent(ctx context.Context, msg string) {
+	a.guestAgentCancelMu.Lock()
+	a.guestAgentGaveUp = true
+	a.guestAgentCancel = nil
+	a.guestAgentCancelMu.Unlock()
+	logrus.Error(msg)
+	a.reportDegraded(ctx, msg)
+}
+
+// ReconnectGuestAgent closes the current connection to the guest agent, and reconnects immediately
+// instead of waiting for the next retry.
+func (a *HostAgent) ReconnectGuestAgent(ctx context.Context) error {
+	if *a.y.Plain {
+		return errors.New("the guest agent is not running in plain mode")
+	}
+	a.guestAgentCancelMu.Lock()
+	gaveUp := a.guestAgentGaveUp
+	a.guestAgentCancelMu.Unlock()
+	if gaveUp {
+		return errors.New("gave up connecting to the guest agent (see guestAgent.maxReconnects and guestAgent.onPermanentError)")
+	}
+	a.emitEvent(ctx, events.Event{GuestAgentReconnect: &events.GuestAgentReconnect{}})
+	select {
+	case a.guestAgentReconnectCh <- struct{}{}:
+	default:
+		// a reconnection is already pending
+	}
+	a.guestAgentCancelMu.Lock()
+	a.guestAgentReconnecting = true
+	if a.guestAgentCancel != nil {
+		a.guestAgentCancel()
+	}
+	a.guestAgentCancelMu.Unlock()
+	return nil
+}
+
+// ReconcilePortForwards sets up the active port forwards again, e.g., after they have been
+// disrupted on the host, without waiting for the guest agent to report the ports again.
+func (a *HostAgent) ReconcilePortForwards(ctx context.Context) error {
+	if *a.y.Plain {
+		return errors.New("port forwarding is disabled in plain mode")
+	}
+	if a.portForwardsDryRun {
+		return errors.New("portForwarding.dryRun is enabled; the ports are not forwarded")
+	}
+	logrus.Info("Reconciling the port forwards")
+	a.portForwarder.reforward(ctx)
+	return nil
+}
+
+// Shutdown requests the graceful shutdown of the host agent and the instance, like SIGINT.
+// It returns without waiting for the shutdown.
+func (a *HostAgent) Shutdown(_ context.Context) error {
+	select {
+	case a.shutdownCh <- struct{}{}:
+	default:
+		// a shutdown is already pending
+	}
+	return nil
+}
+
+// GuestAgentInfo returns the latest Info received from the guest agent.
+func (a *HostAgent) GuestAgentInfo(_ context.Context) (*hostagentapi.GuestAgentInfo, error) {
+	if *a.y.Plain {
+		return nil, errors.New("the guest agent is not running in plain mode")
+	}
+	return a.guestAgentInfo.get(), nil
+}
+
+func isGuestAgentSocketAccessible(ctx context.Context, localUnix string, proto guestagentclient.Proto, instanceName string, dialTimeout time.Duration) bool {
+	client, err := guestagentclient.NewGuestAgentClientWithDialTimeout(localUnix, proto, instanceName, dialTimeout)
 	if err != nil {
 		return false
 	}
+	if dialTimeout > 0 {
+		// A socket that accepts connections but does not respond is not accessible either
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
 	_, err = client.Info(ctx)
 	return err == nil
 }
 
+// newGuestAgentClient returns the client of the guest agent. The vsock connections of VZ and QEMU
+// are made by the driver.
+func (a *HostAgent) newGuestAgentClient(localUnix string, proto guestagentclient.Proto, instanceName string) (guestagentclient.GuestAgentClient, error) {
+	if proto == guestagentclient.VSOCK && *a.y.VMType != limayaml.WSL2 {
+		return guestagentclient.NewGuestAgentClientWithDialer(a.driver.GuestAgentConn, a.guestAgentDialTimeout)
+	}
+	return guestagentclient.NewGuestAgentClientWithDialTimeout(localUnix, proto, instanceName, a.guestAgentDialTimeout)
+}
+
+// errGuestAgentUnreachable is returned by processGuestAgentEvents when it could not connect at all.
+var errGuestAgentUnreachable = errors.New("guest agent is unreachable")
+
 func (a *HostAgent) processGuestAgentEvents(ctx context.Context, localUnix string, proto guestagentclient.Proto, instanceName string) error {
-	client, err := guestagentclient.NewGuestAgentClient(localUnix, proto, instanceName)
+	client, err := a.newGuestAgentClient(localUnix, proto, instanceName)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", errGuestAgentUnreachable, err)
 	}
 
 	info, err := client.Info(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", errGuestAgentUnreachable, err)
 	}
 
 	logrus.Debugf("guest agent info: %+v", info)
+	a.stats.recordGuestAgentConnection()
+	a.guestAgentInfo.connect(info, time.Now())
+	defer a.guestAgentInfo.disconnect()
+	a.guestAgentCancelMu.Lock()
+	reconnected := a.guestAgentReconnecting
+	a.guestAgentReconnecting = false
+	a.guestAgentCancelMu.Unlock()
+	if reconnected {
+		select {
+		case <-a.guestAgentReconnectCh:
+			// the reconnection request has been served by this connection
+		default:
+		}
+		a.emitEvent(ctx, events.Event{GuestAgentReconnect: &events.GuestAgentReconnect{Connected: true}})
+	}
+
+	// snapshot contains the ports forwarded from info, until the first event is reconciled with them
+	var snapshot []guestagentapi.IPPort
+	if a.eagerPortForwards && len(info.LocalPorts) > 0 {
+		snapshot = info.LocalPorts
+		logrus.Debugf("Forwarding %d ports from the guest agent info", len(snapshot))
+		a.onPortEvent(ctx, client, guestagentapi.Event{LocalPortsAdded: snapshot})
+	}
 
 	onEvent := func(ev guestagentapi.Event) {
 		logrus.Debugf("guest agent event: %+v", ev)
+		a.emitGuestAgentRawEvent(ctx, ev)
+		a.guestAgentInfo.applyEvent(ev, time.Now())
 		for _, f := range ev.Errors {
 			logrus.Warnf("received error from the guest: %q", f)
 		}
-		a.portForwarder.OnEvent(ctx, ev, a.instSSHAddress)
+		if snapshot != nil {
+			ev = reconcilePortSnapshot(snapshot, ev)
+			snapshot = nil
+		}
+		a.onPortEvent(ctx, client, ev)
 	}
 
 	if err := client.Events(ctx, onEvent); err != nil {
@@ -623,12 +1471,35 @@ func (a *HostAgent) processGuestAgentEvents(ctx context.Context, localUnix strin
 	return io.EOF
 }
 
+// onPortEvent forwards the ports of the guest agent event, or only logs them when
+// `portForwarding.dryRun` is enabled.
+func (a *HostAgent) onPortEvent(ctx context.Context, client guestagentclient.GuestAgentClient, ev guestagentapi.Event) {
+	if a.portForwardsDryRun {
+		a.portForwarder.logEvent(ev, a.instSSHAddress)
+		return
+	}
+	a.portForwarder.OnEvent(ctx, client, ev, a.instSSHAddress)
+}
+
+// emitGuestAgentRawEvent emits ev as is, until the limit of raw events is reached.
+// onEvent callbacks are not called concurrently, so guestAgentRawEventsSent needs no lock.
+func (a *HostAgent) emitGuestAgentRawEvent(ctx context.Context, ev guestagentapi.Event) {
+	if a.guestAgentRawEventsSent >= a.guestAgentRawEvents {
+		return
+	}
+	a.guestAgentRawEventsSent++
+	if a.guestAgentRawEventsSent == a.guestAgentRawEvents {
+		logrus.Infof("Emitted %d raw guest agent events, not emitting further ones", a.guestAgentRawEvents)
+	}
+	a.emitEvent(ctx, events.Event{GuestAgentRawEvent: &ev})
+}
+
 const (
 	verbForward = "forward"
 	verbCancel  = "cancel"
 )
 
-func executeSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, command ...string) error {
+func executeSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, command ...string) error {
 	args := sshConfig.Args()
 	args = append(args,
 		"-p", strconv.Itoa(port),
@@ -637,13 +1508,11 @@ func executeSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, command
 	)
 	args = append(args, command...)
 	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
-	if out, err := cmd.Output(); err != nil {
-		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
-	}
-	return nil
+	_, err := runWithLimitedOutput(cmd, outputLimit)
+	return err
 }
 
-func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, verb string, reverse bool) error {
+func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, local, remote string, verb string, reverse bool) error {
 	args := sshConfig.Args()
 	args = append(args,
 		"-T",
@@ -670,7 +1539,7 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		case verbForward:
 			if reverse {
 				logrus.Infof("Forwarding %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+				if err := executeSSH(ctx, sshConfig, port, outputLimit, "rm", "-f", remote); err != nil {
 					logrus.WithError(err).Warnf("Failed to clean up %q (guest) before setting up forwarding", remote)
 				}
 			} else {
@@ -679,13 +1548,13 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 					logrus.WithError(err).Warnf("Failed to clean up %q (host) before setting up forwarding", local)
 				}
 			}
-			if err := os.MkdirAll(filepath.Dir(local), 0o750); err != nil {
+			if err := ensureDir(filepath.Dir(local), 0o027); err != nil {
 				return fmt.Errorf("can't create directory for local socket %q: %w", local, err)
 			}
 		case verbCancel:
 			if reverse {
 				logrus.Infof("Stopping forwarding %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+				if err := executeSSH(ctx, sshConfig, port, outputLimit, "rm", "-f", remote); err != nil {
 					logrus.WithError(err).Warnf("Failed to clean up %q (guest) after stopping forwarding", remote)
 				}
 			} else {
@@ -701,11 +1570,11 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		}
 	}
 	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
-	if out, err := cmd.Output(); err != nil {
+	if _, err := runWithLimitedOutput(cmd, outputLimit); err != nil {
 		if verb == verbForward && strings.HasPrefix(local, "/") {
 			if reverse {
 				logrus.WithError(err).Warnf("Failed to set up forward from %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+				if err := executeSSH(ctx, sshConfig, port, outputLimit, "rm", "-f", remote); err != nil {
 					logrus.WithError(err).Warnf("Failed to clean up %q (guest) after forwarding failed", remote)
 				}
 			} else {
@@ -715,12 +1584,22 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 				}
 			}
 		}
-		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+		return err
 	}
 	return nil
 }
 
-func copyToHost(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string) error {
+// checksumMismatchError is returned by copyToHost when the copied file does not match `expectedSHA256`.
+type checksumMismatchError struct {
+	file             string
+	expected, actual string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("SHA-256 digest of %q is %s, expected %s", e.file, e.actual, e.expected)
+}
+
+func copyToHost(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, local, remote string, ifExists limayaml.CopyToHostExistsPolicy, expectedSHA256 string, umask os.FileMode) error {
 	args := sshConfig.Args()
 	args = append(args,
 		"-p", strconv.Itoa(port),
@@ -733,16 +1612,57 @@ func copyToHost(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		remote,
 	)
 	logrus.Infof("Copying config from %s to %s", remote, local)
-	if err := os.MkdirAll(filepath.Dir(local), 0o700); err != nil {
+	if err := os.MkdirAll(filepath.Dir(local), hostDirMode(umask)); err != nil {
 		return fmt.Errorf("can't create directory for local file %q: %w", local, err)
 	}
-	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
-	out, err := cmd.Output()
+	// The file content is streamed to a temporary file, and is not limited by outputLimit.
+	f, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".tmp-")
 	if err != nil {
-		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+		return fmt.Errorf("can't write to local file %q: %w", local, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	stderr := &limitedBuffer{limit: outputLimit}
+	h := sha256.New()
+	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
+	cmd.Stdout = io.MultiWriter(f, h)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %v: stderr=%q: %w", cmd.Args, stderr.String(), err)
+	}
+	// The temporary file is removed on mismatch, leaving the existing host file as is
+	if actual := hex.EncodeToString(h.Sum(nil)); expectedSHA256 != "" && !strings.EqualFold(actual, expectedSHA256) {
+		return &checksumMismatchError{file: remote, expected: strings.ToLower(expectedSHA256), actual: actual}
+	}
+	if err := f.Chmod(hostFileMode(umask)); err != nil {
+		return fmt.Errorf("can't write to local file %q: %w", local, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("can't write to local file %q: %w", local, err)
 	}
-	if err := os.WriteFile(local, out, 0o600); err != nil {
+	if ifExists == limayaml.CopyToHostBackup {
+		if err := backupFile(local, time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(f.Name(), local); err != nil {
 		return fmt.Errorf("can't write to local file %q: %w", local, err)
 	}
 	return nil
 }
+
+// backupFile renames the file with a suffix of the timestamp, if it exists.
+func backupFile(file string, now time.Time) error {
+	if _, err := os.Lstat(file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	backup := file + "." + now.Format("20060102-150405")
+	logrus.Infof("Backing up %s to %s", file, backup)
+	if err := os.Rename(file, backup); err != nil {
+		return fmt.Errorf("can't back up local file %q: %w", file, err)
+	}
+	return nil
+}
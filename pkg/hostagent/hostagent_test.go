@@ -0,0 +1,53 @@
+package hostagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestBackupFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "myconfig")
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	// A missing file is not an error
+	assert.NilError(t, backupFile(file, now))
+
+	assert.NilError(t, os.WriteFile(file, []byte("old"), 0o600))
+	assert.NilError(t, backupFile(file, now))
+	_, err := os.Stat(file)
+	assert.Assert(t, os.IsNotExist(err))
+	b, err := os.ReadFile(file + ".20240102-150405")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "old")
+}
+
+func TestEmitEventTimeUTC(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	emitted := time.Date(2024, 1, 2, 15, 4, 5, 123456789, tokyo)
+	for _, utc := range []bool{true, false} {
+		var b bytes.Buffer
+		a := &HostAgent{eventEnc: json.NewEncoder(&b), eventTimeUTC: utc}
+		a.emitEvent(context.Background(), events.Event{Time: emitted})
+		var raw struct {
+			Time string `json:"time"`
+		}
+		assert.NilError(t, json.Unmarshal(b.Bytes(), &raw))
+		parsed, err := time.Parse(time.RFC3339Nano, raw.Time)
+		assert.NilError(t, err)
+		assert.Assert(t, parsed.Equal(emitted))
+		if utc {
+			assert.Equal(t, raw.Time, "2024-01-02T06:04:05.123456789Z")
+		} else {
+			assert.Equal(t, raw.Time, "2024-01-02T15:04:05.123456789+09:00")
+		}
+	}
+}
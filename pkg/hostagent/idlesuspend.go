@@ -0,0 +1,201 @@
+package hostagent
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	idleSuspendPollInterval = 30 * time.Second
+	// idleCPUTicksPerSecond is the CPU usage of the idle guest, in the clock ticks (USER_HZ, usually 100) per second,
+	// i.e., 5% of a single CPU
+	idleCPUTicksPerSecond = 5
+	// idleNetworkBytesPerSecond is the network traffic of the idle guest, including the polling of the guest agent
+	idleNetworkBytesPerSecond = 2048
+)
+
+// activityIdle returns true if the guest has been idle between the counters prev and cur, elapsed apart.
+func activityIdle(prev, cur guestagentapi.Activity, elapsed time.Duration) bool {
+	if cur.Terminals > 0 {
+		return false
+	}
+	if cur.CPUBusy < prev.CPUBusy || cur.NetworkBytes < prev.NetworkBytes {
+		// The counters have been reset, e.g., by a reboot of the guest
+		return false
+	}
+	seconds := elapsed.Seconds()
+	return float64(cur.CPUBusy-prev.CPUBusy) < idleCPUTicksPerSecond*seconds &&
+		float64(cur.NetworkBytes-prev.NetworkBytes) < idleNetworkBytesPerSecond*seconds
+}
+
+// idleTracker tracks the activity of the guest for `hostAgent.idleSuspend`.
+type idleTracker struct {
+	mu sync.Mutex
+	// prev is the last activity counters observed at prevTime, or nil
+	prev     *guestagentapi.Activity
+	prevTime time.Time
+	// lastActive is the last time the guest was seen active, or a connection was relayed
+	lastActive time.Time
+	// conns is the number of the relayed connections that are open
+	conns     int
+	suspended bool
+}
+
+func newIdleTracker(now time.Time) *idleTracker {
+	return &idleTracker{lastActive: now}
+}
+
+// observe records the activity counters of the guest at now.
+func (t *idleTracker) observe(act guestagentapi.Activity, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prev != nil && !activityIdle(*t.prev, act, now.Sub(t.prevTime)) {
+		t.lastActive = now
+	}
+	t.prev = &act
+	t.prevTime = now
+}
+
+// touch marks the guest active at now. The counters observed so far are discarded,
+// as the guest does not run while it is suspended.
+func (t *idleTracker) touch(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastActive = now
+	t.prev = nil
+}
+
+// idleFor returns the duration for which the guest has been idle at now.
+func (t *idleTracker) idleFor(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns > 0 {
+		return 0
+	}
+	return now.Sub(t.lastActive)
+}
+
+func (t *idleTracker) connOpened() {
+	t.mu.Lock()
+	t.conns++
+	t.mu.Unlock()
+}
+
+func (t *idleTracker) connClosed() {
+	t.mu.Lock()
+	t.conns--
+	t.lastActive = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *idleTracker) isSuspended() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.suspended
+}
+
+func (t *idleTracker) setSuspended(suspended bool) {
+	t.mu.Lock()
+	t.suspended = suspended
+	t.mu.Unlock()
+}
+
+// suspended returns true while the VM is paused by `hostAgent.idleSuspend`.
+// The watchers that run commands in the guest skip their checks meanwhile.
+func (a *HostAgent) suspended() bool {
+	return a.idle != nil && a.idle.isSuspended()
+}
+
+// watchIdleSuspend polls the activity of the guest, and pauses the VM after it has been idle for `hostAgent.idleSuspend`.
+func (a *HostAgent) watchIdleSuspend(ctx context.Context) {
+	localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
+	ticker := time.NewTicker(idleSuspendPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.idle.isSuspended() {
+			continue
+		}
+		client, err := a.newGuestAgentClient(localUnix, a.guestAgentProto, a.instName)
+		if err != nil {
+			logrus.WithError(err).Debug("failed to create a guest agent client for the activity")
+			continue
+		}
+		act, err := client.Activity(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Debug("failed to get the guest activity")
+			continue
+		}
+		now := time.Now()
+		a.idle.observe(*act, now)
+		if a.idle.idleFor(now) >= a.idleSuspend {
+			a.suspend(ctx)
+		}
+	}
+}
+
+// suspend pauses the VM, unless a connection has been relayed in the meantime.
+func (a *HostAgent) suspend(ctx context.Context) {
+	a.suspendMu.Lock()
+	defer a.suspendMu.Unlock()
+	idle := a.idle.idleFor(time.Now())
+	if a.idle.isSuspended() || idle < a.idleSuspend {
+		return
+	}
+	if err := a.driver.Pause(ctx); err != nil {
+		logrus.WithError(err).Warn("failed to suspend the idle instance")
+		return
+	}
+	a.idle.setSuspended(true)
+	logrus.Infof("Suspended the instance after %v of inactivity", idle.Round(time.Second))
+	a.emitEvent(ctx, events.Event{IdleSuspend: &events.IdleSuspend{Suspended: true, Idle: idle}})
+}
+
+// resume resumes the VM if it has been suspended, and restarts the idle period.
+func (a *HostAgent) resume(ctx context.Context, reason string) error {
+	if a.idle == nil {
+		return nil
+	}
+	a.suspendMu.Lock()
+	defer a.suspendMu.Unlock()
+	a.idle.touch(time.Now())
+	if !a.idle.isSuspended() {
+		return nil
+	}
+	if err := a.driver.Resume(ctx); err != nil {
+		return err
+	}
+	a.idle.setSuspended(false)
+	logrus.Infof("Resumed the instance on %s", reason)
+	a.emitEvent(ctx, events.Event{IdleSuspend: &events.IdleSuspend{Reason: reason}})
+	return nil
+}
+
+// Resume resumes the VM paused by `hostAgent.idleSuspend`, e.g., before `limactl shell`.
+// Resume returns nil when the VM is not paused.
+func (a *HostAgent) Resume(ctx context.Context) error {
+	return a.resume(ctx, "request")
+}
+
+// onRelayConnect resumes the VM before a connection is relayed, and keeps it running until the connection is closed.
+func (a *HostAgent) onRelayConnect(local string) func() {
+	a.idle.connOpened()
+	if err := a.resume(context.Background(), "connection to "+local); err != nil {
+		logrus.WithError(err).Warn("failed to resume the suspended instance")
+	}
+	return a.idle.connClosed
+}
@@ -0,0 +1,47 @@
+package hostagent
+
+import (
+	"testing"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestActivityIdle(t *testing.T) {
+	prev := guestagentapi.Activity{CPUBusy: 1000, NetworkBytes: 50000}
+	elapsed := 30 * time.Second
+	assert.Assert(t, activityIdle(prev, guestagentapi.Activity{CPUBusy: 1100, NetworkBytes: 60000}, elapsed))
+	// 10 ticks per second
+	assert.Assert(t, !activityIdle(prev, guestagentapi.Activity{CPUBusy: 1300, NetworkBytes: 50000}, elapsed))
+	// 4KiB per second
+	assert.Assert(t, !activityIdle(prev, guestagentapi.Activity{CPUBusy: 1000, NetworkBytes: 50000 + 30*4096}, elapsed))
+	// an interactive session
+	assert.Assert(t, !activityIdle(prev, guestagentapi.Activity{CPUBusy: 1000, NetworkBytes: 50000, Terminals: 1}, elapsed))
+	// the counters have been reset
+	assert.Assert(t, !activityIdle(prev, guestagentapi.Activity{CPUBusy: 10, NetworkBytes: 100}, elapsed))
+}
+
+func TestIdleTracker(t *testing.T) {
+	start := time.Now()
+	tr := newIdleTracker(start)
+	idle := guestagentapi.Activity{CPUBusy: 1000, NetworkBytes: 50000}
+	tr.observe(idle, start.Add(30*time.Second))
+	tr.observe(idle, start.Add(time.Minute))
+	assert.Equal(t, tr.idleFor(start.Add(time.Minute)), time.Minute)
+
+	busy := guestagentapi.Activity{CPUBusy: 5000, NetworkBytes: 50000}
+	tr.observe(busy, start.Add(90*time.Second))
+	assert.Equal(t, tr.idleFor(start.Add(2*time.Minute)), 30*time.Second)
+
+	// the guest is never idle while a connection is relayed
+	tr.connOpened()
+	assert.Equal(t, tr.idleFor(start.Add(time.Hour)), time.Duration(0))
+	tr.connClosed()
+	assert.Assert(t, tr.idleFor(start.Add(time.Hour)) < time.Hour)
+
+	// the first counters after touch are not compared with the previous ones
+	tr.touch(start.Add(3 * time.Minute))
+	tr.observe(busy, start.Add(4*time.Minute))
+	assert.Equal(t, tr.idleFor(start.Add(4*time.Minute)), time.Minute)
+}
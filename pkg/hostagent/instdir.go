@@ -0,0 +1,37 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// checkInstDir returns an error when the instance directory does not exist or is not writable.
+func checkInstDir(instDir string) error {
+	if instDir == "" {
+		return errors.New("the instance directory is unknown")
+	}
+	st, err := os.Stat(instDir)
+	if err != nil {
+		return fmt.Errorf("the instance directory %q is not accessible: %w", instDir, err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("the instance directory %q is not a directory", instDir)
+	}
+	f, err := os.CreateTemp(instDir, ".writable-")
+	if err != nil {
+		return fmt.Errorf("the instance directory %q is not writable: %w", instDir, err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// ensureDir re-creates a directory under the instance directory before writing to it,
+// in case it has been deleted while the host agent is running.
+func ensureDir(dir string, umask os.FileMode) error {
+	if err := os.MkdirAll(dir, hostDirMode(umask)); err != nil {
+		return fmt.Errorf("failed to re-create the directory %q, which may have been deleted while the instance is running: %w", dir, err)
+	}
+	return nil
+}
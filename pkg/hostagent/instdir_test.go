@@ -0,0 +1,32 @@
+package hostagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckInstDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, checkInstDir(dir))
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+
+	assert.ErrorContains(t, checkInstDir(""), "unknown")
+	assert.ErrorContains(t, checkInstDir(filepath.Join(dir, "missing")), "not accessible")
+
+	file := filepath.Join(dir, "file")
+	assert.NilError(t, os.WriteFile(file, nil, 0o644))
+	assert.ErrorContains(t, checkInstDir(file), "not a directory")
+}
+
+func TestEnsureDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "deleted", "sock")
+	assert.NilError(t, ensureDir(dir, 0o022))
+	st, err := os.Stat(dir)
+	assert.NilError(t, err)
+	assert.Assert(t, st.IsDir())
+}
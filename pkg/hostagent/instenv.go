@@ -0,0 +1,46 @@
+package hostagent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// instanceEnv returns the environment variables describing the instance, which are passed to the
+// host commands executed by the host agent, and written to the instance environment file.
+func (a *HostAgent) instanceEnv() []string {
+	return []string{
+		"LIMA_INSTANCE=" + a.instName,
+		"LIMA_INSTANCE_DIR=" + a.instDir,
+		"LIMA_SSH_PORT=" + strconv.Itoa(a.sshLocalPort),
+		"LIMA_DNS_UDP_PORT=" + strconv.Itoa(a.udpDNSLocalPort),
+		"LIMA_DNS_TCP_PORT=" + strconv.Itoa(a.tcpDNSLocalPort),
+		"LIMA_VSOCK_PORT=" + strconv.Itoa(a.vSockPort),
+	}
+}
+
+// hostCommandEnv returns the environment of a host command: the environment of the host agent,
+// the instance environment, LIMA_INSTANCE_ENV_FILE, and extra.
+func (a *HostAgent) hostCommandEnv(extra ...string) []string {
+	env := append(os.Environ(), a.instanceEnv()...)
+	env = append(env, "LIMA_INSTANCE_ENV_FILE="+a.instanceEnvFile)
+	return append(env, extra...)
+}
+
+// writeInstanceEnvFile writes the environment variables as a file that can be sourced by sh.
+func writeInstanceEnvFile(path string, env []string, umask os.FileMode) error {
+	var b bytes.Buffer
+	b.WriteString("# This file is created by the Lima host agent, and removed when it exits.\n")
+	for _, kv := range env {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid environment variable %q", kv)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", k, shellescape.Quote(v))
+	}
+	return os.WriteFile(path, b.Bytes(), hostFileMode(umask))
+}
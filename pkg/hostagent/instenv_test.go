@@ -0,0 +1,28 @@
+package hostagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteInstanceEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ha.env")
+	env := []string{
+		"LIMA_INSTANCE=default",
+		"LIMA_INSTANCE_DIR=/Users/me/Library/Application Support/lima/default",
+		"LIMA_SSH_PORT=60022",
+	}
+	assert.NilError(t, writeInstanceEnvFile(path, env, 0o022))
+	b, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `# This file is created by the Lima host agent, and removed when it exits.
+LIMA_INSTANCE=default
+LIMA_INSTANCE_DIR='/Users/me/Library/Application Support/lima/default'
+LIMA_SSH_PORT=60022
+`)
+
+	assert.ErrorContains(t, writeInstanceEnvFile(path, []string{"INVALID"}, 0o022), "invalid environment variable")
+}
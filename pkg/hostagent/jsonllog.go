@@ -0,0 +1,84 @@
+package hostagent
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// jsonLinesLog appends values to a JSON lines file, e.g., the forwarding decisions.
+// The file is rotated to "<path>.1" when it would exceed maxSize.
+type jsonLinesLog struct {
+	path    string
+	maxSize int64
+	perm    os.FileMode
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+}
+
+func openJSONLinesLog(path string, maxSize int64, perm os.FileMode) (*jsonLinesLog, error) {
+	l := &jsonLinesLog{path: path, maxSize: maxSize, perm: perm}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *jsonLinesLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, l.perm)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.f = f
+	l.size = st.Size()
+	return nil
+}
+
+func (l *jsonLinesLog) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	if l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	return err
+}
+
+func (l *jsonLinesLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *jsonLinesLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
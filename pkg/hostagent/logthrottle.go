@@ -0,0 +1,33 @@
+package hostagent
+
+import "time"
+
+// guestAgentWarningInterval is the minimum interval between the warnings about the guest agent
+// connection, while it keeps failing.
+const guestAgentWarningInterval = time.Minute
+
+// logThrottle coalesces repeated log messages, allowing one message per interval.
+type logThrottle struct {
+	interval   time.Duration
+	last       time.Time
+	suppressed int
+}
+
+// allow returns true if a message may be logged at now, along with the number of messages
+// suppressed since the last allowed one.
+func (t *logThrottle) allow(now time.Time) (bool, int) {
+	if !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		t.suppressed++
+		return false, 0
+	}
+	suppressed := t.suppressed
+	t.last = now
+	t.suppressed = 0
+	return true, suppressed
+}
+
+// reset allows the next message immediately.
+func (t *logThrottle) reset() {
+	t.last = time.Time{}
+	t.suppressed = 0
+}
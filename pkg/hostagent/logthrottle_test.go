@@ -0,0 +1,31 @@
+package hostagent
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLogThrottle(t *testing.T) {
+	th := logThrottle{interval: time.Minute}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ok, suppressed := th.allow(t0)
+	assert.Assert(t, ok)
+	assert.Equal(t, suppressed, 0)
+	for i := 1; i <= 5; i++ {
+		ok, _ = th.allow(t0.Add(time.Duration(i) * 10 * time.Second))
+		assert.Assert(t, !ok)
+	}
+	ok, suppressed = th.allow(t0.Add(time.Minute))
+	assert.Assert(t, ok)
+	assert.Equal(t, suppressed, 5)
+
+	ok, _ = th.allow(t0.Add(time.Minute + time.Second))
+	assert.Assert(t, !ok)
+	th.reset()
+	ok, suppressed = th.allow(t0.Add(time.Minute + 2*time.Second))
+	assert.Assert(t, ok)
+	assert.Equal(t, suppressed, 0)
+}
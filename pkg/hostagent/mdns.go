@@ -0,0 +1,259 @@
+package hostagent
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mdnsPort = 5353
+	// mdnsTTL is the TTL of the host address records recommended by RFC 6762, section 10.
+	mdnsTTL = 120
+	// mdnsLegacyTTL is the maximum TTL of the answers to the legacy unicast queries (RFC 6762, section 6.7).
+	mdnsLegacyTTL = 10
+	// mdnsCacheFlush is the cache-flush bit of the class of the unique records (RFC 6762, section 10.2).
+	mdnsCacheFlush = 1 << 15
+	// mdnsMaxPacketSize is the maximum size of the multicast DNS messages (RFC 6762, section 17).
+	mdnsMaxPacketSize = 9000
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// mdnsHostname returns the fully qualified multicast DNS hostname of the instance.
+func mdnsHostname(instName string) string {
+	return dns.Fqdn("lima-" + strings.ToLower(instName) + ".local")
+}
+
+// mdnsResponder answers the multicast DNS queries for a single hostname.
+// The probing for the name conflicts (RFC 6762, section 8.1) is not implemented.
+type mdnsResponder struct {
+	hostname string
+	// addrs are the published addresses. When empty, the address of the host on the subnet
+	// of each querier is published instead.
+	addrs []net.IP
+	// interfaceAddrs is replaced in the tests
+	interfaceAddrs func() ([]net.Addr, error)
+
+	conn      *net.UDPConn
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newMDNSResponder(hostname string, addrs []net.IP) *mdnsResponder {
+	return &mdnsResponder{
+		hostname:       hostname,
+		addrs:          addrs,
+		interfaceAddrs: net.InterfaceAddrs,
+		done:           make(chan struct{}),
+	}
+}
+
+// startMDNSResponder joins the multicast DNS group, and announces the fixed addresses.
+func startMDNSResponder(hostname string, addrs []net.IP) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	r := newMDNSResponder(hostname, addrs)
+	r.conn = conn
+	go r.serve()
+	if len(addrs) > 0 {
+		go r.announce()
+	}
+	return r, nil
+}
+
+func (r *mdnsResponder) serve() {
+	buf := make([]byte, mdnsMaxPacketSize)
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.WithError(err).Warn("the mDNS responder exited with an error")
+			}
+			return
+		}
+		var query dns.Msg
+		if err := query.Unpack(buf[:n]); err != nil {
+			logrus.WithError(err).Debugf("ignoring an invalid mDNS message from %v", src)
+			continue
+		}
+		resp, unicast := r.reply(&query, src)
+		if resp == nil {
+			continue
+		}
+		b, err := resp.Pack()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to pack an mDNS response")
+			continue
+		}
+		dst := mdnsGroup
+		if unicast {
+			dst = src
+		}
+		if _, err := r.conn.WriteToUDP(b, dst); err != nil {
+			logrus.WithError(err).Debugf("failed to send an mDNS response to %v", dst)
+		}
+	}
+}
+
+// reply returns the response to query from src, or nil when query does not ask for the hostname.
+// unicast is true when the response has to be sent to src rather than to the multicast group.
+func (r *mdnsResponder) reply(query *dns.Msg, src *net.UDPAddr) (resp *dns.Msg, unicast bool) {
+	if query.Response || query.Opcode != dns.OpcodeQuery {
+		return nil, false
+	}
+	// The queries from a port other than 5353 are the legacy unicast queries, e.g., `dig -p 5353 @224.0.0.251`,
+	// answered like a conventional DNS server.
+	legacy := src.Port != mdnsPort
+	resp = new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	if legacy {
+		resp.Id = query.Id
+	}
+	for _, q := range query.Question {
+		if !strings.EqualFold(q.Name, r.hostname) || q.Qclass&^mdnsCacheFlush != dns.ClassINET {
+			continue
+		}
+		answers := r.answers(q.Qtype, src.IP, mdnsTTL)
+		if len(answers) == 0 {
+			continue
+		}
+		if q.Qclass&mdnsCacheFlush != 0 {
+			// The "QU" bit requests a unicast response (RFC 6762, section 5.4)
+			unicast = true
+		}
+		if legacy {
+			resp.Question = append(resp.Question, dns.Question{Name: q.Name, Qtype: q.Qtype, Qclass: dns.ClassINET})
+			for _, rr := range answers {
+				rr.Header().Class = dns.ClassINET
+				rr.Header().Ttl = mdnsLegacyTTL
+			}
+		}
+		resp.Answer = append(resp.Answer, answers...)
+	}
+	if len(resp.Answer) == 0 {
+		return nil, false
+	}
+	return resp, unicast || legacy
+}
+
+// answers returns the address records of type qtype for a querier at src.
+func (r *mdnsResponder) answers(qtype uint16, src net.IP, ttl uint32) []dns.RR {
+	addrs := r.addrs
+	if len(addrs) == 0 {
+		if hostIP := r.hostAddress(src); hostIP != nil {
+			addrs = []net.IP{hostIP}
+		}
+	}
+	var rrs []dns.RR
+	for _, ip := range addrs {
+		hdr := dns.RR_Header{Name: r.hostname, Class: dns.ClassINET | mdnsCacheFlush, Ttl: ttl}
+		if ip4 := ip.To4(); ip4 != nil {
+			if qtype == dns.TypeA || qtype == dns.TypeANY {
+				hdr.Rrtype = dns.TypeA
+				rrs = append(rrs, &dns.A{Hdr: hdr, A: ip4})
+			}
+		} else if qtype == dns.TypeAAAA || qtype == dns.TypeANY {
+			hdr.Rrtype = dns.TypeAAAA
+			rrs = append(rrs, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return rrs
+}
+
+// hostAddress returns the IPv4 address of the host on the subnet of src, or nil.
+func (r *mdnsResponder) hostAddress(src net.IP) net.IP {
+	ifAddrs, err := r.interfaceAddrs()
+	if err != nil {
+		logrus.WithError(err).Debug("failed to list the addresses of the host")
+		return nil
+	}
+	for _, a := range ifAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ipNet.Contains(src) {
+			return ipNet.IP
+		}
+	}
+	return nil
+}
+
+// unsolicited returns the response announcing the fixed addresses, or with ttl 0, withdrawing them.
+func (r *mdnsResponder) unsolicited(ttl uint32) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	resp.Answer = r.answers(dns.TypeANY, nil, ttl)
+	return resp
+}
+
+func (r *mdnsResponder) send(msg *dns.Msg) error {
+	b, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.WriteToUDP(b, mdnsGroup)
+	return err
+}
+
+// announce sends the unsolicited responses twice, one second apart (RFC 6762, section 8.3).
+func (r *mdnsResponder) announce() {
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		if err := r.send(r.unsolicited(mdnsTTL)); err != nil {
+			logrus.WithError(err).Debugf("failed to announce %s", r.hostname)
+		}
+	}
+}
+
+// close withdraws the fixed addresses with a "goodbye" response (RFC 6762, section 10.1), and stops the responder.
+func (r *mdnsResponder) close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.done)
+		if len(r.addrs) > 0 {
+			if goodbyeErr := r.send(r.unsolicited(0)); goodbyeErr != nil {
+				logrus.WithError(goodbyeErr).Debugf("failed to withdraw %s", r.hostname)
+			}
+		}
+		err = r.conn.Close()
+	})
+	return err
+}
+
+// startMDNS starts the mDNS responder for "lima-<name>.local", or logs a warning when the mDNS port
+// cannot be shared with the mDNS service of the host. The responder is shut down on closing the host agent.
+func (a *HostAgent) startMDNS(address string) {
+	hostname := mdnsHostname(a.instName)
+	var addrs []net.IP
+	if address != "" {
+		addrs = append(addrs, net.ParseIP(address))
+	}
+	r, err := startMDNSResponder(hostname, addrs)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to start the mDNS responder for %s, continuing without it", hostname)
+		return
+	}
+	published := address
+	if published == "" {
+		published = "the host address"
+	}
+	logrus.Infof("Publishing %s (%s) with mDNS", strings.TrimSuffix(hostname, "."), published)
+	a.onClose.push(r.close)
+}
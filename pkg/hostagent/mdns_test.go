@@ -0,0 +1,80 @@
+package hostagent
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+func TestMDNSHostname(t *testing.T) {
+	assert.Equal(t, mdnsHostname("Default"), "lima-default.local.")
+}
+
+func mdnsQuery(name string, qtype, qclass uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.Id = 42
+	m.Question = []dns.Question{{Name: name, Qtype: qtype, Qclass: qclass}}
+	return m
+}
+
+func TestMDNSReply(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: mdnsPort}
+	r := newMDNSResponder("lima-default.local.", []net.IP{net.ParseIP("192.168.105.2")})
+
+	resp, unicast := r.reply(mdnsQuery("LIMA-default.local.", dns.TypeA, dns.ClassINET), peer)
+	assert.Assert(t, resp != nil)
+	assert.Assert(t, !unicast)
+	assert.Equal(t, resp.Id, uint16(0))
+	assert.Equal(t, len(resp.Question), 0)
+	assert.Equal(t, len(resp.Answer), 1)
+	a := resp.Answer[0].(*dns.A)
+	assert.Equal(t, a.A.String(), "192.168.105.2")
+	assert.Equal(t, a.Hdr.Class, uint16(dns.ClassINET|mdnsCacheFlush))
+	assert.Equal(t, a.Hdr.Ttl, uint32(mdnsTTL))
+
+	// no IPv6 address is published
+	resp, _ = r.reply(mdnsQuery("lima-default.local.", dns.TypeAAAA, dns.ClassINET), peer)
+	assert.Assert(t, resp == nil)
+	resp, _ = r.reply(mdnsQuery("lima-other.local.", dns.TypeA, dns.ClassINET), peer)
+	assert.Assert(t, resp == nil)
+
+	// "QU" question
+	_, unicast = r.reply(mdnsQuery("lima-default.local.", dns.TypeA, dns.ClassINET|mdnsCacheFlush), peer)
+	assert.Assert(t, unicast)
+
+	// legacy unicast query
+	legacy := &net.UDPAddr{IP: peer.IP, Port: 54321}
+	resp, unicast = r.reply(mdnsQuery("lima-default.local.", dns.TypeANY, dns.ClassINET), legacy)
+	assert.Assert(t, resp != nil)
+	assert.Assert(t, unicast)
+	assert.Equal(t, resp.Id, uint16(42))
+	assert.Equal(t, len(resp.Question), 1)
+	assert.Equal(t, resp.Answer[0].Header().Class, uint16(dns.ClassINET))
+	assert.Equal(t, resp.Answer[0].Header().Ttl, uint32(mdnsLegacyTTL))
+}
+
+func TestMDNSReplyHostAddress(t *testing.T) {
+	r := newMDNSResponder("lima-default.local.", nil)
+	r.interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(16, 32)},
+		}, nil
+	}
+	query := mdnsQuery("lima-default.local.", dns.TypeA, dns.ClassINET)
+
+	resp, _ := r.reply(query, &net.UDPAddr{IP: net.ParseIP("10.0.3.4"), Port: mdnsPort})
+	assert.Assert(t, resp != nil)
+	assert.Equal(t, resp.Answer[0].(*dns.A).A.String(), "10.0.0.5")
+
+	resp, _ = r.reply(query, &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: mdnsPort})
+	assert.Assert(t, resp != nil)
+	assert.Equal(t, resp.Answer[0].(*dns.A).A.String(), "192.168.1.10")
+
+	// not on a subnet of the host
+	resp, _ = r.reply(query, &net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: mdnsPort})
+	assert.Assert(t, resp == nil)
+}
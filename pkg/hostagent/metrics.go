@@ -0,0 +1,112 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metrics is a snapshot of the metrics of the host agent.
+type metrics struct {
+	instance             string
+	activePortForwards   int
+	portForwards         int
+	portForwardFailures  int
+	guestAgentReconnects int
+	sshMasterRecoveries  int
+	degraded             bool
+	phases               []events.TimelinePhase
+}
+
+func (a *HostAgent) metrics() metrics {
+	m := metrics{
+		instance:           a.instName,
+		activePortForwards: len(a.portForwarder.activeForwards()),
+	}
+	a.stats.mu.Lock()
+	m.portForwards = a.stats.portForwards
+	m.portForwardFailures = a.stats.portForwardFailures
+	if a.stats.guestAgentConnections > 1 {
+		m.guestAgentReconnects = a.stats.guestAgentConnections - 1
+	}
+	m.sshMasterRecoveries = a.stats.sshMasterRecoveries
+	a.stats.mu.Unlock()
+	a.runningMu.Lock()
+	m.degraded = a.degraded
+	a.runningMu.Unlock()
+	if tl := a.timeline.event(); tl != nil {
+		m.phases = tl.Phases
+	}
+	return m
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m metrics) write(w io.Writer) error {
+	label := fmt.Sprintf("lima_instance=%q", m.instance)
+	var degraded int
+	if m.degraded {
+		degraded = 1
+	}
+	for _, x := range []struct {
+		name, typ, help string
+		value           int
+	}{
+		{"lima_hostagent_port_forwards_active", "gauge", "The number of the active port forwards.", m.activePortForwards},
+		{"lima_hostagent_port_forwards_total", "counter", "The number of the port forwards that have been set up.", m.portForwards},
+		{"lima_hostagent_port_forward_failures_total", "counter", "The number of the port forwards that failed to be set up.", m.portForwardFailures},
+		{"lima_hostagent_guest_agent_reconnects_total", "counter", "The number of the reconnections to the guest agent.", m.guestAgentReconnects},
+		{"lima_hostagent_ssh_master_recoveries_total", "counter", "The number of the recreations of the SSH master.", m.sshMasterRecoveries},
+		{"lima_hostagent_degraded", "gauge", "Whether the instance has been reported as degraded.", degraded},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s{%s} %d\n", x.name, x.help, x.name, x.typ, x.name, label, x.value); err != nil {
+			return err
+		}
+	}
+	if len(m.phases) == 0 {
+		return nil
+	}
+	const name = "lima_hostagent_startup_phase_duration_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s The duration of the startup phase.\n# TYPE %s gauge\n", name, name); err != nil {
+		return err
+	}
+	for _, p := range m.phases {
+		value := strconv.FormatFloat(p.Duration.Seconds(), 'f', -1, 64)
+		if _, err := fmt.Fprintf(w, "%s{%s,phase=%q} %s\n", name, label, p.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startMetricsServer starts serving the metrics on "/metrics" of address.
+func (a *HostAgent) startMetricsServer(address string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		if err := a.metrics().write(w); err != nil {
+			logrus.WithError(err).Debug("failed to write the metrics")
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	logrus.Infof("Serving the metrics on http://%s/metrics", ln.Addr())
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Warn("the metrics server exited with an error")
+		}
+	}()
+	return srv, nil
+}
@@ -0,0 +1,45 @@
+package hostagent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := metrics{
+		instance:             "default",
+		activePortForwards:   2,
+		portForwards:         3,
+		portForwardFailures:  1,
+		guestAgentReconnects: 4,
+		degraded:             true,
+		phases: []events.TimelinePhase{
+			{Name: "driverStart", Duration: 1500 * time.Millisecond},
+		},
+	}
+	var b strings.Builder
+	assert.NilError(t, m.write(&b))
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE lima_hostagent_port_forwards_active gauge",
+		`lima_hostagent_port_forwards_active{lima_instance="default"} 2`,
+		`lima_hostagent_port_forwards_total{lima_instance="default"} 3`,
+		`lima_hostagent_port_forward_failures_total{lima_instance="default"} 1`,
+		`lima_hostagent_guest_agent_reconnects_total{lima_instance="default"} 4`,
+		`lima_hostagent_ssh_master_recoveries_total{lima_instance="default"} 0`,
+		`lima_hostagent_degraded{lima_instance="default"} 1`,
+		"# TYPE lima_hostagent_startup_phase_duration_seconds gauge",
+		`lima_hostagent_startup_phase_duration_seconds{lima_instance="default",phase="driverStart"} 1.5`,
+	} {
+		assert.Assert(t, strings.Contains(out, line+"\n"), "missing %q in %q", line, out)
+	}
+
+	// The phases are omitted until the first one has been recorded
+	b.Reset()
+	assert.NilError(t, metrics{instance: "default"}.write(&b))
+	assert.Assert(t, !strings.Contains(b.String(), "startup_phase"))
+}
@@ -1,18 +1,31 @@
 package hostagent
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/sshocker/pkg/reversesshfs"
+	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
 
 type mount struct {
-	close func() error
+	location   string
+	mountPoint string
+	config     limayaml.Mount
+
+	mu     sync.Mutex
+	rsf    *reversesshfs.ReverseSSHFS
+	closed bool
 }
 
 func (a *HostAgent) setupMounts() ([]*mount, error) {
@@ -21,12 +34,14 @@ func (a *HostAgent) setupMounts() ([]*mount, error) {
 		errs []error
 	)
 	for _, f := range a.y.Mounts {
+		// m is non-nil when the mount failed the verification, so that it is still unmounted on close
 		m, err := a.setupMount(f)
 		if err != nil {
 			errs = append(errs, err)
-			continue
 		}
-		res = append(res, m)
+		if m != nil {
+			res = append(res, m)
+		}
 	}
 	return res, errors.Join(errs...)
 }
@@ -44,46 +59,108 @@ func (a *HostAgent) setupMount(m limayaml.Mount) (*mount, error) {
 	if err := os.MkdirAll(location, 0o755); err != nil {
 		return nil, err
 	}
+	logrus.Infof("Mounting %q on %q", location, mountPoint)
+
+	res := &mount{
+		location:   location,
+		mountPoint: mountPoint,
+		config:     m,
+	}
+	if err := a.startMount(res); err != nil {
+		return nil, err
+	}
+	if *m.Verify {
+		if err := a.verifyMount(location, mountPoint, *m.Writable); err != nil {
+			return res, fmt.Errorf("reverse sshfs for %q on %q failed the verification: %w", location, mountPoint, err)
+		}
+		logrus.Infof("Verified the mount of %q on %q", location, mountPoint)
+	}
+	return res, nil
+}
+
+// startMount starts the reverse sshfs process for m. m.mu must be held by the caller,
+// unless m is not visible to the other goroutines yet.
+func (a *HostAgent) startMount(m *mount) error {
 	// NOTE: allow_other requires "user_allow_other" in /etc/fuse.conf
 	sshfsOptions := "allow_other"
-	if !*m.SSHFS.Cache {
+	if !*m.config.SSHFS.Cache {
 		sshfsOptions = sshfsOptions + ",cache=no"
 	}
-	if *m.SSHFS.FollowSymlinks {
+	if *m.config.SSHFS.FollowSymlinks {
 		sshfsOptions = sshfsOptions + ",follow_symlinks"
 	}
-	logrus.Infof("Mounting %q on %q", location, mountPoint)
 
 	rsf := &reversesshfs.ReverseSSHFS{
-		Driver:              *m.SSHFS.SFTPDriver,
+		Driver:              *m.config.SSHFS.SFTPDriver,
 		SSHConfig:           a.sshConfig,
-		LocalPath:           location,
+		LocalPath:           m.location,
 		Host:                "127.0.0.1",
 		Port:                a.sshLocalPort,
-		RemotePath:          mountPoint,
-		Readonly:            !(*m.Writable),
+		RemotePath:          m.mountPoint,
+		Readonly:            !(*m.config.Writable),
 		SSHFSAdditionalArgs: []string{"-o", sshfsOptions},
 	}
 	if err := rsf.Prepare(); err != nil {
-		return nil, fmt.Errorf("failed to prepare reverse sshfs for %q on %q: %w", location, mountPoint, err)
+		return fmt.Errorf("failed to prepare reverse sshfs for %q on %q: %w", m.location, m.mountPoint, err)
 	}
 	if err := rsf.Start(); err != nil {
-		logrus.WithError(err).Warnf("failed to mount reverse sshfs for %q on %q, retrying with `-o nonempty`", location, mountPoint)
+		logrus.WithError(err).Warnf("failed to mount reverse sshfs for %q on %q, retrying with `-o nonempty`", m.location, m.mountPoint)
 		// NOTE: nonempty is not supported for libfuse3: https://github.com/canonical/multipass/issues/1381
 		rsf.SSHFSAdditionalArgs = []string{"-o", "nonempty"}
 		if err := rsf.Start(); err != nil {
-			return nil, fmt.Errorf("failed to mount reverse sshfs for %q on %q: %w", location, mountPoint, err)
+			return fmt.Errorf("failed to mount reverse sshfs for %q on %q: %w", m.location, m.mountPoint, err)
 		}
 	}
+	m.rsf = rsf
+	return nil
+}
 
-	res := &mount{
-		close: func() error {
-			logrus.Infof("Unmounting %q", location)
-			if closeErr := rsf.Close(); closeErr != nil {
-				return fmt.Errorf("failed to unmount reverse sshfs for %q on %q: %w", location, mountPoint, err)
-			}
-			return nil
-		},
+func (m *mount) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.rsf == nil {
+		return nil
 	}
-	return res, nil
+	logrus.Infof("Unmounting %q", m.location)
+	if err := m.rsf.Close(); err != nil {
+		return fmt.Errorf("failed to unmount reverse sshfs for %q on %q: %w", m.location, m.mountPoint, err)
+	}
+	return nil
+}
+
+// verifyMount checks that a sentinel file created in location on the host appears in mountPoint
+// in the guest, and, for a writable mount, vice versa.
+func (a *HostAgent) verifyMount(location, mountPoint string, writable bool) error {
+	sentinel := fmt.Sprintf(".lima-mount-verify-%d", time.Now().UnixNano())
+	hostSentinel := filepath.Join(location, sentinel+".host")
+	if err := os.WriteFile(hostSentinel, []byte(sentinel), 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(hostSentinel)
+
+	script := fmt.Sprintf(`#!/bin/sh
+set -eu
+[ "$(cat %s)" = %s ]
+`, shellescape.Quote(path.Join(mountPoint, sentinel+".host")), shellescape.Quote(sentinel))
+	guestSentinel := filepath.Join(location, sentinel+".guest")
+	if writable {
+		script += fmt.Sprintf("printf '%%s' %s >%s\n", shellescape.Quote(sentinel), shellescape.Quote(path.Join(mountPoint, sentinel+".guest")))
+		defer os.Remove(guestSentinel)
+	}
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, script, "verifying the mount")
+	if err != nil {
+		return fmt.Errorf("the host sentinel file does not appear in the guest: stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	if !writable {
+		return nil
+	}
+	b, err := os.ReadFile(guestSentinel)
+	if err != nil {
+		return fmt.Errorf("the guest sentinel file does not appear on the host: %w", err)
+	}
+	if !bytes.Equal(b, []byte(sentinel)) {
+		return fmt.Errorf("the guest sentinel file has unexpected content %q on the host", string(b))
+	}
+	return nil
 }
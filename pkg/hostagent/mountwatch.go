@@ -0,0 +1,173 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+const mountCheckInterval = 10 * time.Second
+
+// checkMount returns an error when mountPoint is no longer mounted in the guest, or when it is
+// mounted but stale.
+//
+// sshocker does not expose the SSH process of the mount, so the exit of the process is detected
+// from the guest: sshfs unmounts the mount point when the connection is closed, and a killed
+// sshfs leaves the mount point returning ENOTCONN.
+func (a *HostAgent) checkMount(mountPoint string) error {
+	script := fmt.Sprintf(`#!/bin/sh
+set -eu
+dir=%s
+mountpoint -q "${dir}"
+timeout 10 stat -- "${dir}" >/dev/null
+`, shellescape.Quote(mountPoint))
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, script, "checking the mount")
+	if err != nil {
+		return fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return nil
+}
+
+// mountWatcher applies `mounts[].sshfs.onDisconnect` to a mount.
+// The functions are replaceable in tests.
+type mountWatcher struct {
+	onDisconnect limayaml.SSHFSOnDisconnect
+	maxRemounts  int
+
+	check   func() error
+	remount func() error
+	// emit emits a MountDisconnection event
+	emit func(state string, attempt int, err error)
+	// degrade marks the instance as degraded
+	degrade func(err error)
+
+	// remounts is the number of the remount attempts for the current disconnection
+	remounts int
+}
+
+func (a *HostAgent) newMountWatcher(ctx context.Context, m *mount) *mountWatcher {
+	return &mountWatcher{
+		onDisconnect: *m.config.SSHFS.OnDisconnect,
+		maxRemounts:  *m.config.SSHFS.MaxRemounts,
+		check: func() error {
+			return a.checkMount(m.mountPoint)
+		},
+		remount: func() error {
+			return a.remount(m)
+		},
+		emit: func(state string, attempt int, err error) {
+			ev := events.Event{
+				MountDisconnection: &events.MountDisconnection{
+					Location:   m.location,
+					MountPoint: m.mountPoint,
+					State:      state,
+					Attempt:    attempt,
+				},
+			}
+			if err != nil {
+				ev.MountDisconnection.Error = err.Error()
+			}
+			a.emitEvent(ctx, ev)
+		},
+		degrade: func(err error) {
+			msg := fmt.Sprintf("the mount of %q on %q has been disconnected: %v", m.location, m.mountPoint, err)
+			logrus.Error(msg)
+			a.reportDegraded(ctx, msg)
+		},
+	}
+}
+
+// watchMount periodically checks m until ctx is done, or until the watcher gives up.
+func (a *HostAgent) watchMount(ctx context.Context, m *mount) {
+	w := a.newMountWatcher(ctx, m)
+	ticker := time.NewTicker(mountCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.suspended() {
+			continue
+		}
+		if !w.step() || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// step checks the mount once, and handles the disconnection if any.
+// step returns false when the mount should no longer be watched.
+func (w *mountWatcher) step() bool {
+	err := w.check()
+	if err == nil {
+		return true
+	}
+	if w.remounts == 0 {
+		logrus.WithError(err).Warn("A mount has been disconnected")
+		w.emit("disconnected", 0, err)
+	}
+	switch w.onDisconnect {
+	case limayaml.SSHFSOnDisconnectIgnore:
+		w.emit("ignored", 0, nil)
+		return false
+	case limayaml.SSHFSOnDisconnectDegrade:
+		w.emit("degraded", 0, err)
+		w.degrade(err)
+		return false
+	}
+	if w.remounts >= w.maxRemounts {
+		err = fmt.Errorf("gave up remounting after %d attempts: %w", w.remounts, err)
+		w.emit("degraded", 0, err)
+		w.degrade(err)
+		return false
+	}
+	w.remounts++
+	w.emit("remounting", w.remounts, nil)
+	if remountErr := w.remount(); remountErr != nil {
+		if errors.Is(remountErr, errMountClosed) {
+			return false
+		}
+		logrus.WithError(remountErr).Warnf("Failed to remount (attempt %d/%d)", w.remounts, w.maxRemounts)
+		w.emit("remountFailed", w.remounts, remountErr)
+		return true
+	}
+	w.emit("remounted", w.remounts, nil)
+	w.remounts = 0
+	return true
+}
+
+var errMountClosed = errors.New("the mount has been closed")
+
+// remount restarts the reverse sshfs process of m.
+func (a *HostAgent) remount(m *mount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errMountClosed
+	}
+	logrus.Infof("Remounting %q on %q", m.location, m.mountPoint)
+	if m.rsf != nil {
+		if err := m.rsf.Close(); err != nil {
+			logrus.WithError(err).Debugf("failed to close the disconnected reverse sshfs for %q", m.location)
+		}
+		m.rsf = nil
+	}
+	if err := a.startMount(m); err != nil {
+		return err
+	}
+	if *m.config.Verify {
+		if err := a.verifyMount(m.location, m.mountPoint, *m.config.Writable); err != nil {
+			return fmt.Errorf("reverse sshfs for %q on %q failed the verification: %w", m.location, m.mountPoint, err)
+		}
+	}
+	return nil
+}
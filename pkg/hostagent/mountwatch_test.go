@@ -0,0 +1,121 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+type mountWatcherEvent struct {
+	State   string
+	Attempt int
+}
+
+func newTestMountWatcher(onDisconnect limayaml.SSHFSOnDisconnect, maxRemounts int, checks, remounts []error) (*mountWatcher, *[]mountWatcherEvent, *[]error) {
+	var (
+		evs      []mountWatcherEvent
+		degraded []error
+	)
+	w := &mountWatcher{
+		onDisconnect: onDisconnect,
+		maxRemounts:  maxRemounts,
+		check: func() error {
+			err := checks[0]
+			checks = checks[1:]
+			return err
+		},
+		remount: func() error {
+			err := remounts[0]
+			remounts = remounts[1:]
+			return err
+		},
+		emit: func(state string, attempt int, _ error) {
+			evs = append(evs, mountWatcherEvent{State: state, Attempt: attempt})
+		},
+		degrade: func(err error) {
+			degraded = append(degraded, err)
+		},
+	}
+	return w, &evs, &degraded
+}
+
+func TestMountWatcherRemount(t *testing.T) {
+	errDisconnected := errors.New("disconnected")
+	errRemount := errors.New("remount failed")
+	w, evs, degraded := newTestMountWatcher(limayaml.SSHFSOnDisconnectRemount, 2,
+		[]error{nil, errDisconnected, errDisconnected, nil, errDisconnected},
+		[]error{errRemount, nil, nil})
+
+	for i := 0; i < 5; i++ {
+		assert.Assert(t, w.step())
+	}
+	assert.DeepEqual(t, *evs, []mountWatcherEvent{
+		{State: "disconnected"},
+		{State: "remounting", Attempt: 1},
+		{State: "remountFailed", Attempt: 1},
+		{State: "remounting", Attempt: 2},
+		{State: "remounted", Attempt: 2},
+		// the attempts are counted per disconnection
+		{State: "disconnected"},
+		{State: "remounting", Attempt: 1},
+		{State: "remounted", Attempt: 1},
+	})
+	assert.Equal(t, len(*degraded), 0)
+}
+
+func TestMountWatcherGiveUp(t *testing.T) {
+	errDisconnected := errors.New("disconnected")
+	errRemount := errors.New("remount failed")
+	w, evs, degraded := newTestMountWatcher(limayaml.SSHFSOnDisconnectRemount, 1,
+		[]error{errDisconnected, errDisconnected},
+		[]error{errRemount})
+
+	assert.Assert(t, w.step())
+	assert.Assert(t, !w.step())
+	assert.DeepEqual(t, *evs, []mountWatcherEvent{
+		{State: "disconnected"},
+		{State: "remounting", Attempt: 1},
+		{State: "remountFailed", Attempt: 1},
+		{State: "degraded"},
+	})
+	assert.Equal(t, len(*degraded), 1)
+	assert.ErrorIs(t, (*degraded)[0], errDisconnected)
+}
+
+func TestMountWatcherPolicies(t *testing.T) {
+	errDisconnected := errors.New("disconnected")
+	testCases := []struct {
+		onDisconnect limayaml.SSHFSOnDisconnect
+		maxRemounts  int
+		expected     []mountWatcherEvent
+		degraded     int
+	}{
+		{
+			onDisconnect: limayaml.SSHFSOnDisconnectIgnore,
+			maxRemounts:  3,
+			expected:     []mountWatcherEvent{{State: "disconnected"}, {State: "ignored"}},
+		},
+		{
+			onDisconnect: limayaml.SSHFSOnDisconnectDegrade,
+			maxRemounts:  3,
+			expected:     []mountWatcherEvent{{State: "disconnected"}, {State: "degraded"}},
+			degraded:     1,
+		},
+		{
+			onDisconnect: limayaml.SSHFSOnDisconnectRemount,
+			maxRemounts:  0,
+			expected:     []mountWatcherEvent{{State: "disconnected"}, {State: "degraded"}},
+			degraded:     1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.onDisconnect, func(t *testing.T) {
+			w, evs, degraded := newTestMountWatcher(tc.onDisconnect, tc.maxRemounts, []error{errDisconnected}, nil)
+			assert.Assert(t, !w.step())
+			assert.DeepEqual(t, *evs, tc.expected)
+			assert.Equal(t, len(*degraded), tc.degraded)
+		})
+	}
+}
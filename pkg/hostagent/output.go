@@ -0,0 +1,52 @@
+package hostagent
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// DefaultSSHOutputLimit is the default maximum number of bytes captured from the stdout and
+// the stderr of the SSH commands run by the host agent.
+const DefaultSSHOutputLimit = 64 * 1024
+
+// limitedBuffer keeps the first limit bytes written to it, and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		if remaining < 0 {
+			remaining = 0
+		}
+		b.truncated += int64(len(p) - remaining)
+		p = p[:remaining]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String returns the captured output, with an indicator when it was truncated.
+func (b *limitedBuffer) String() string {
+	if b.truncated == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s... (truncated %d bytes)", b.buf.String(), b.truncated)
+}
+
+// runWithLimitedOutput runs cmd, capturing at most limit bytes of its stdout and stderr.
+// The returned error contains the captured output.
+func runWithLimitedOutput(cmd *exec.Cmd, limit int) (*limitedBuffer, error) {
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return stdout, fmt.Errorf("failed to run %v: stdout=%q, stderr=%q: %w", cmd.Args, stdout.String(), stderr.String(), err)
+	}
+	return stdout, nil
+}
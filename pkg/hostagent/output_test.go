@@ -0,0 +1,57 @@
+package hostagent
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		limit     int
+		writes    []string
+		expected  string
+		truncated int64
+	}{
+		{
+			name:     "under the limit",
+			limit:    8,
+			writes:   []string{"foo", "bar"},
+			expected: "foobar",
+		},
+		{
+			name:     "exactly the limit",
+			limit:    6,
+			writes:   []string{"foo", "bar"},
+			expected: "foobar",
+		},
+		{
+			name:      "truncated in a write",
+			limit:     4,
+			writes:    []string{"foo", "bar"},
+			expected:  "foob... (truncated 2 bytes)",
+			truncated: 2,
+		},
+		{
+			name:      "writes after the limit",
+			limit:     3,
+			writes:    []string{"foo", "bar", "baz"},
+			expected:  "foo... (truncated 6 bytes)",
+			truncated: 6,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tc.limit}
+			for _, w := range tc.writes {
+				n, err := b.Write([]byte(w))
+				assert.NilError(t, err)
+				// Write must not report a short write, as exec.Cmd would fail otherwise
+				assert.Equal(t, n, len(w))
+			}
+			assert.Equal(t, b.String(), tc.expected)
+			assert.Equal(t, b.truncated, tc.truncated)
+		})
+	}
+}
@@ -2,9 +2,18 @@ package hostagent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
@@ -13,18 +22,104 @@ import (
 type portForwarder struct {
 	sshConfig   *ssh.SSHConfig
 	sshHostPort int
-	rules       []limayaml.PortForward
 	vmType      limayaml.VMType
+	// rules are replaced as a whole by replaceRules, so the slice returned by currentRules is never modified
+	rules   []limayaml.PortForward
+	rulesMu sync.RWMutex
+	// eventMu serializes OnEvent and reloadRules
+	eventMu sync.Mutex
+
+	// mu serializes forwardTCP calls, as forwardTCP is not thread-safe on all platforms
+	mu sync.Mutex
+	// pending contains the lazy forwards that are still waiting for the guest, keyed by the guest address
+	pending   map[string]*pendingForward
+	pendingMu sync.Mutex
+	// poolPorts contains the host ports allocated from the `hostPortPool` of the rules, keyed by the guest address
+	poolPorts   map[string]poolPort
+	poolPortsMu sync.Mutex
+	// active contains the forwards that have been set up, keyed by the guest address
+	active   map[string]activeForward
+	activeMu sync.Mutex
+	// agents contains the names of the additional guest agents that reported the guest addresses.
+	// The addresses reported by the guest agent of Lima are not contained.
+	agents   map[string]string
+	agentsMu sync.Mutex
+
+	// forward is forwardTCP, replaced in tests
+	forward func(ctx context.Context, local, remote string, verb string, backlog int) error
+	// onChange is called when the set of active forwards may have changed, if non-nil
+	onChange func()
+
+	// tlsForwarders contains the relays for the forwards with `guestTLS`, keyed by the host address
+	tlsForwarders   map[string]*guestTLSForwarder
+	tlsForwardersMu sync.Mutex
+	// onTLSHandshakeError is called when the TLS handshake with a guest service failed, if non-nil
+	onTLSHandshakeError func(name, local, remote string, err error)
+	// targetsForwarders contains the relays for the rules with `guestTargets`, keyed by the host address
+	targetsForwarders   map[string]*guestTargetsForwarder
+	targetsForwardersMu sync.Mutex
+	// onRelayStopped is called with the bytes relayed by a relay after it has been stopped, if non-nil
+	onRelayStopped func(ev events.PortForwardBytes)
+	// onGuestTargets is called when the health of the targets of a relay has changed, if non-nil
+	onGuestTargets func(ev events.GuestTargets)
+	// onForwarded is called after any forward has been set up, if non-nil
+	onForwarded func()
+	// onForwardFailed is called after any forward failed to be set up, if non-nil
+	onForwardFailed func()
+	// onReady is called after a forward with `onReady` has been set up, if non-nil
+	onReady func(rule limayaml.PortForward, local, remote string)
+	// relayAll relays all the TCP forwards in userspace, so that onConnect is called for every connection
+	relayAll bool
+	// onConnect is called with the host address before a connection is relayed by a guestTLSForwarder, if non-nil.
+	// The returned function is called after the connection has been closed.
+	onConnect func(local string) func()
+	// onDecision is called for each decision of OnEvent, if non-nil
+	onDecision func(d forwardDecision)
+}
+
+type poolPort struct {
+	pool [2]int
+	port int
+}
+
+type pendingForward struct {
+	cancel context.CancelFunc
+}
+
+type activeForward struct {
+	local string
+	guest api.IPPort
+	// err is the error from setting up the forward, if it failed
+	err error
 }
 
 const sshGuestPort = 22
 
-func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.PortForward, vmType limayaml.VMType) *portForwarder {
+// guestAgentVSockPort is the vsock port of the guest agent for VZ and QEMU.
+const guestAgentVSockPort = 2222
+
+// lazyBindRetries and lazyBindInterval are variables, to be shortened in the tests.
+var (
+	lazyBindRetries  = 30
+	lazyBindInterval = 2 * time.Second
+)
+
+func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort, outputLimit int, rules []limayaml.PortForward, vmType limayaml.VMType) *portForwarder {
 	return &portForwarder{
 		sshConfig:   sshConfig,
 		sshHostPort: sshHostPort,
 		rules:       rules,
 		vmType:      vmType,
+		pending:     make(map[string]*pendingForward),
+		active:      make(map[string]activeForward),
+		agents:      make(map[string]string),
+		poolPorts:   make(map[string]poolPort),
+
+		tlsForwarders:     make(map[string]*guestTLSForwarder),
+		targetsForwarders: make(map[string]*guestTargetsForwarder),
+		forward: func(ctx context.Context, local, remote string, verb string, backlog int) error {
+			return forwardTCP(ctx, sshConfig, sshHostPort, outputLimit, local, remote, verb, backlog)
+		},
 	}
 }
 
@@ -42,17 +137,48 @@ func hostAddress(rule limayaml.PortForward, guest api.IPPort) string {
 	return host.String()
 }
 
-func (pf *portForwarder) forwardingAddresses(guest api.IPPort, localUnixIP net.IP) (string, string) {
-	if pf.vmType == limayaml.WSL2 {
-		guest.IP = localUnixIP
-		host := api.IPPort{
-			IP:   net.ParseIP("127.0.0.1"),
-			Port: guest.Port,
-		}
-		return host.String(), guest.String()
+// isReverseTCPRule returns true for the rules that forward a host port to a guest TCP port.
+func isReverseTCPRule(rule limayaml.PortForward) bool {
+	return rule.Reverse && rule.GuestSocket == ""
+}
+
+// reverseTCPAddresses returns the host address and the guest address of a reverse TCP rule.
+func reverseTCPAddresses(rule limayaml.PortForward) (string, string) {
+	guest := api.IPPort{IP: rule.GuestIP, Port: rule.GuestPortRange[0]}
+	return hostAddress(rule, guest), guest.String()
+}
+
+// currentRules returns the rules. The returned slice must not be modified.
+func (pf *portForwarder) currentRules() []limayaml.PortForward {
+	pf.rulesMu.RLock()
+	defer pf.rulesMu.RUnlock()
+	return pf.rules
+}
+
+// replaceRules replaces the rules. The existing forwards are not affected.
+func (pf *portForwarder) replaceRules(rules []limayaml.PortForward) {
+	pf.rulesMu.Lock()
+	defer pf.rulesMu.Unlock()
+	pf.rules = rules
+}
+
+// matchRule returns the first rule matching the guest address.
+// The second return value is false when the address must not be forwarded.
+func (pf *portForwarder) matchRule(guest api.IPPort) (limayaml.PortForward, bool) {
+	rules := pf.currentRules()
+	i, ok := matchRuleIndex(rules, guest)
+	if !ok {
+		return limayaml.PortForward{}, false
 	}
-	for _, rule := range pf.rules {
-		if rule.GuestSocket != "" {
+	return rules[i], true
+}
+
+// matchRuleIndex returns the index of the first rule matching the guest address, or -1.
+// The second return value is false when the address must not be forwarded, including when
+// it is matched by an `ignore` rule.
+func matchRuleIndex(rules []limayaml.PortForward, guest api.IPPort) (int, bool) {
+	for i, rule := range rules {
+		if rule.GuestSocket != "" || len(rule.GuestTargets) > 0 {
 			continue
 		}
 		if guest.Port < rule.GuestPortRange[0] || guest.Port > rule.GuestPortRange[1] {
@@ -68,18 +194,382 @@ func (pf *portForwarder) forwardingAddresses(guest api.IPPort, localUnixIP net.I
 		default:
 			continue
 		}
-		if rule.Ignore {
+		// The guest port of a reverse rule is listened on by sshd, and must not be forwarded back to the host
+		if rule.Ignore || rule.Reverse {
 			if guest.IP.IsUnspecified() && !rule.GuestIP.IsUnspecified() {
 				continue
 			}
-			break
+			return i, false
+		}
+		return i, true
+	}
+	return -1, false
+}
+
+func (pf *portForwarder) forwardingAddresses(guest api.IPPort, localUnixIP net.IP) (string, string) {
+	if pf.vmType == limayaml.WSL2 {
+		guest.IP = localUnixIP
+		host := api.IPPort{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: guest.Port,
+		}
+		return host.String(), guest.String()
+	}
+	rule, ok := pf.matchRule(guest)
+	if !ok {
+		return "", guest.String()
+	}
+	if rule.HostPortPool != [2]int{} {
+		port, ok := pf.allocatePoolPort(rule.HostPortPool, guest)
+		if !ok {
+			logrus.Warnf("no free port in the host port pool %v for %s", rule.HostPortPool, guest.String())
+			return "", guest.String()
+		}
+		host := api.IPPort{IP: rule.HostIP, Port: port}
+		return host.String(), guest.String()
+	}
+	return hostAddress(rule, guest), guest.String()
+}
+
+// allocatePoolPort returns the host port allocated to the guest address from the pool,
+// allocating the lowest free one if none has been allocated yet.
+func (pf *portForwarder) allocatePoolPort(pool [2]int, guest api.IPPort) (int, bool) {
+	pf.poolPortsMu.Lock()
+	defer pf.poolPortsMu.Unlock()
+	if p, ok := pf.poolPorts[guest.String()]; ok && p.pool == pool {
+		return p.port, true
+	}
+	used := make(map[int]bool)
+	for _, p := range pf.poolPorts {
+		if p.pool == pool {
+			used[p.port] = true
+		}
+	}
+	for port := pool[0]; port <= pool[1]; port++ {
+		if !used[port] {
+			pf.poolPorts[guest.String()] = poolPort{pool: pool, port: port}
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+// releasePoolPort frees the host port allocated to the guest address, if any.
+func (pf *portForwarder) releasePoolPort(guest api.IPPort) {
+	pf.poolPortsMu.Lock()
+	defer pf.poolPortsMu.Unlock()
+	delete(pf.poolPorts, guest.String())
+}
+
+// lazyBind returns true if the host port for the guest address should only be bound
+// after the guest has confirmed that the port is accepting connections.
+func (pf *portForwarder) lazyBind(guest api.IPPort) bool {
+	if pf.vmType == limayaml.WSL2 {
+		return false
+	}
+	rule, ok := pf.matchRule(guest)
+	return ok && rule.LazyBind
+}
+
+// ruleName returns the name of the rule matching the guest address, or an empty string.
+func (pf *portForwarder) ruleName(guest api.IPPort) string {
+	rule, _ := pf.matchRule(guest)
+	return rule.Name
+}
+
+// forwardName formats the name of a forward for the logs, or returns an empty string.
+func forwardName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%q)", name)
+}
+
+// forwardAgent formats the name of the additional guest agent of a forward for the logs, or returns an empty string.
+func forwardAgent(agent string) string {
+	if agent == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (guest agent %q)", agent)
+}
+
+// agentOf returns the name of the additional guest agent that reported the guest address, or an empty string.
+func (pf *portForwarder) agentOf(remote string) string {
+	pf.agentsMu.Lock()
+	defer pf.agentsMu.Unlock()
+	return pf.agents[remote]
+}
+
+// setAgent records the additional guest agent that reported the guest address. An empty agent removes the record.
+func (pf *portForwarder) setAgent(remote, agent string) {
+	pf.agentsMu.Lock()
+	defer pf.agentsMu.Unlock()
+	if agent == "" {
+		delete(pf.agents, remote)
+		return
+	}
+	pf.agents[remote] = agent
+}
+
+// guestTLS returns the TLS credentials for connecting to the guest address, or nil.
+func (pf *portForwarder) guestTLS(guest api.IPPort) *limayaml.GuestTLS {
+	if pf.vmType == limayaml.WSL2 {
+		return nil
+	}
+	rule, ok := pf.matchRule(guest)
+	if !ok {
+		return nil
+	}
+	return rule.GuestTLS
+}
+
+// connLimits returns the limits of the connections to the guest address.
+func (pf *portForwarder) connLimits(guest api.IPPort) connLimits {
+	if pf.vmType == limayaml.WSL2 {
+		return connLimits{}
+	}
+	rule, ok := pf.matchRule(guest)
+	if !ok {
+		return connLimits{}
+	}
+	return ruleConnLimits(rule)
+}
+
+// hostACL returns the `hostBindACL` of the rule for the guest address, or nil.
+func (pf *portForwarder) hostACL(guest api.IPPort) hostACL {
+	if pf.vmType == limayaml.WSL2 {
+		return nil
+	}
+	rule, ok := pf.matchRule(guest)
+	if !ok {
+		return nil
+	}
+	return ruleHostACL(rule)
+}
+
+// relayed returns true if the forward for the guest address is relayed by a guestTLSForwarder,
+// i.e., for `guestTLS`, `maxConnections`, `idleTimeout`, `hostBindACL`, or `hostAgent.idleSuspend`.
+func (pf *portForwarder) relayed(guest api.IPPort) bool {
+	return pf.relayAll || pf.guestTLS(guest) != nil || pf.connLimits(guest).enabled() || len(pf.hostACL(guest)) > 0
+}
+
+// forwardTCP sets up or cancels the forward. backlog is the listen backlog for the
+// forwards relayed in userspace, or 0 for the system default.
+func (pf *portForwarder) forwardTCP(ctx context.Context, local, remote string, verb string, backlog int) error {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.forward(ctx, local, remote, verb, backlog)
+}
+
+// listenBacklog returns the listen backlog for the guest address, or 0.
+func (pf *portForwarder) listenBacklog(guest api.IPPort) int {
+	if pf.vmType == limayaml.WSL2 {
+		return 0
+	}
+	rule, ok := pf.matchRule(guest)
+	if !ok {
+		return 0
+	}
+	return rule.ListenBacklog
+}
+
+// isForwarding returns true if the forward from remote to local has been set up successfully.
+func (pf *portForwarder) isForwarding(local, remote string) bool {
+	pf.activeMu.Lock()
+	defer pf.activeMu.Unlock()
+	f, ok := pf.active[remote]
+	return ok && f.local == local && f.err == nil
+}
+
+// setUpForward sets up the forward from remote to local, and records the result.
+func (pf *portForwarder) setUpForward(ctx context.Context, guest api.IPPort, local, remote string) error {
+	pf.activeMu.Lock()
+	_, retry := pf.active[remote]
+	pf.activeMu.Unlock()
+	name := pf.ruleName(guest)
+	if retry {
+		logrus.Infof("Retrying forwarding TCP from %s to %s%s%s", remote, local, forwardName(name), forwardAgent(pf.agentOf(remote)))
+	} else {
+		logrus.Infof("Forwarding TCP from %s to %s%s%s", remote, local, forwardName(name), forwardAgent(pf.agentOf(remote)))
+	}
+	var err error
+	if pf.relayed(guest) {
+		err = pf.forwardGuestTLS(ctx, pf.guestTLS(guest), name, local, remote, pf.listenBacklog(guest), pf.connLimits(guest), pf.hostACL(guest))
+	} else {
+		err = pf.forwardTCP(ctx, local, remote, verbForward, pf.listenBacklog(guest))
+	}
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", guest.Port)
+	}
+	pf.activeMu.Lock()
+	pf.active[remote] = activeForward{local: local, guest: guest, err: err}
+	pf.activeMu.Unlock()
+	pf.changed()
+	if err == nil && pf.onForwarded != nil {
+		pf.onForwarded()
+	}
+	if err != nil && pf.onForwardFailed != nil {
+		pf.onForwardFailed()
+	}
+	if err == nil && pf.onReady != nil && pf.vmType != limayaml.WSL2 {
+		if rule, ok := pf.matchRule(guest); ok && len(rule.OnReady) > 0 {
+			pf.onReady(rule, local, remote)
+		}
+	}
+	return err
+}
+
+func (pf *portForwarder) changed() {
+	if pf.onChange != nil {
+		pf.onChange()
+	}
+}
+
+// activeForwards returns the forwards that have been set up successfully, sorted by the guest address.
+// Each forward is returned as a pair of the host address and the guest address.
+func (pf *portForwarder) activeForwards() [][2]string {
+	pf.activeMu.Lock()
+	defer pf.activeMu.Unlock()
+	var res [][2]string
+	for remote, f := range pf.active {
+		if f.err == nil {
+			res = append(res, [2]string{f.local, remote})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][1] < res[j][1]
+	})
+	return res
+}
+
+// cancelSocketForwards stops the active forwards to host unix sockets, so that the sockets
+// are not left behind on the host.
+func (pf *portForwarder) cancelSocketForwards(ctx context.Context) error {
+	pf.activeMu.Lock()
+	var forwards [][2]string
+	for remote, f := range pf.active {
+		if strings.HasPrefix(f.local, "/") {
+			forwards = append(forwards, [2]string{f.local, remote})
+			delete(pf.active, remote)
+		}
+	}
+	pf.activeMu.Unlock()
+	var errs []error
+	for _, f := range forwards {
+		local, remote := f[0], f[1]
+		logrus.Infof("Stopping forwarding TCP from %s to %s", remote, local)
+		pf.tlsForwardersMu.Lock()
+		_, isTLS := pf.tlsForwarders[local]
+		pf.tlsForwardersMu.Unlock()
+		if isTLS {
+			errs = append(errs, pf.cancelGuestTLS(ctx, local, remote))
+		} else {
+			errs = append(errs, pf.forwardTCP(ctx, local, remote, verbCancel, 0))
+		}
+	}
+	if len(forwards) > 0 {
+		pf.changed()
+	}
+	return errors.Join(errs...)
+}
+
+// reforward sets up the active forwards again, after the SSH control master has been recreated.
+// The forwards are canceled first, as the relays on the host may still hold the host addresses.
+func (pf *portForwarder) reforward(ctx context.Context) {
+	pf.activeMu.Lock()
+	remotes := make([]string, 0, len(pf.active))
+	for remote := range pf.active {
+		remotes = append(remotes, remote)
+	}
+	pf.activeMu.Unlock()
+	sort.Strings(remotes)
+	for _, remote := range remotes {
+		pf.activeMu.Lock()
+		f, ok := pf.active[remote]
+		pf.activeMu.Unlock()
+		if !ok {
+			continue
+		}
+		// The relayed forwards are canceled by forwardGuestTLS
+		if !pf.relayed(f.guest) {
+			if err := pf.forwardTCP(ctx, f.local, remote, verbCancel, 0); err != nil {
+				logrus.WithError(err).Debugf("failed to cancel the stale forward from %s to %s", remote, f.local)
+			}
+		}
+		pf.setUpForward(ctx, f.guest, f.local, remote)
+	}
+	pf.reforwardGuestTargets(ctx)
+}
+
+// cancelPending cancels a lazy forward that is still waiting for the guest.
+// It returns false if there was no such forward.
+func (pf *portForwarder) cancelPending(remote string) bool {
+	pf.pendingMu.Lock()
+	defer pf.pendingMu.Unlock()
+	p, ok := pf.pending[remote]
+	if ok {
+		p.cancel()
+		delete(pf.pending, remote)
+	}
+	return ok
+}
+
+func (pf *portForwarder) forwardLazily(ctx context.Context, client guestagentclient.GuestAgentClient, guest api.IPPort, local, remote string) {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &pendingForward{cancel: cancel}
+	pf.pendingMu.Lock()
+	if prev, ok := pf.pending[remote]; ok {
+		prev.cancel()
+	}
+	pf.pending[remote] = p
+	pf.pendingMu.Unlock()
+
+	go func() {
+		defer func() {
+			pf.pendingMu.Lock()
+			if pf.pending[remote] == p {
+				delete(pf.pending, remote)
+			}
+			pf.pendingMu.Unlock()
+			cancel()
+		}()
+		if err := waitForGuestPort(ctx, client, guest); err != nil {
+			if ctx.Err() == nil {
+				logrus.WithError(err).Warnf("not forwarding TCP from %s to %s", remote, local)
+			}
+			return
+		}
+		pf.setUpForward(ctx, guest, local, remote)
+	}()
+}
+
+// waitForGuestPort waits until the guest agent confirms that the guest port is accepting connections.
+func waitForGuestPort(ctx context.Context, client guestagentclient.GuestAgentClient, guest api.IPPort) error {
+	var err error
+	for i := 0; i < lazyBindRetries; i++ {
+		if err = client.CheckPort(ctx, guest); err == nil {
+			return nil
+		}
+		logrus.WithError(err).Debugf("guest port %s is not accepting connections yet", guest.String())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lazyBindInterval):
 		}
-		return hostAddress(rule, guest), guest.String()
 	}
-	return "", guest.String()
+	return fmt.Errorf("guest port %s did not accept connections after %d attempts: %w", guest.String(), lazyBindRetries, err)
+}
+
+func (pf *portForwarder) OnEvent(ctx context.Context, client guestagentclient.GuestAgentClient, ev api.Event, instSSHAddress string) {
+	pf.OnAgentEvent(ctx, "", client, ev, instSSHAddress)
 }
 
-func (pf *portForwarder) OnEvent(ctx context.Context, ev api.Event, instSSHAddress string) {
+// OnAgentEvent is OnEvent for the event of the additional guest agent with the name, or of the guest
+// agent of Lima when agent is empty. The ports are tagged with the guest agent, and the ports reported
+// by another guest agent are not stopped being forwarded.
+func (pf *portForwarder) OnAgentEvent(ctx context.Context, agent string, client guestagentclient.GuestAgentClient, ev api.Event, instSSHAddress string) {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
 	localUnixIP := net.ParseIP(instSSHAddress)
 
 	for _, f := range ev.LocalPortsRemoved {
@@ -87,20 +577,124 @@ func (pf *portForwarder) OnEvent(ctx context.Context, ev api.Event, instSSHAddre
 		if local == "" {
 			continue
 		}
-		logrus.Infof("Stopping forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbCancel); err != nil {
+		if owner := pf.agentOf(remote); owner != agent {
+			logrus.Debugf("Not stopping forwarding TCP from %s, as it has been reported by another guest agent%s", remote, forwardAgent(owner))
+			continue
+		}
+		// The forward is canceled below, before the ports added by ev are allocated
+		pf.releasePoolPort(f)
+		if pf.cancelPending(remote) {
+			logrus.Infof("Not forwarding TCP from %s to %s anymore", remote, local)
+			pf.decide(f, forwardActionCancel, local, nil)
+			pf.setAgent(remote, "")
+			continue
+		}
+		pf.activeMu.Lock()
+		delete(pf.active, remote)
+		pf.activeMu.Unlock()
+		pf.changed()
+		logrus.Infof("Stopping forwarding TCP from %s to %s%s%s", remote, local, forwardName(pf.ruleName(f)), forwardAgent(agent))
+		var err error
+		if pf.relayed(f) {
+			err = pf.cancelGuestTLS(ctx, local, remote)
+		} else {
+			err = pf.forwardTCP(ctx, local, remote, verbCancel, 0)
+		}
+		if err != nil {
 			logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.Port)
 		}
+		pf.decide(f, forwardActionCancel, local, err)
+		pf.setAgent(remote, "")
 	}
 	for _, f := range ev.LocalPortsAdded {
 		local, remote := pf.forwardingAddresses(f, localUnixIP)
 		if local == "" {
 			logrus.Infof("Not forwarding TCP %s", remote)
+			pf.decide(f, forwardActionIgnore, "", nil)
+			continue
+		}
+		if pf.isForwarding(local, remote) {
+			logrus.Debugf("Already forwarding TCP from %s to %s", remote, local)
+			pf.decide(f, forwardActionAlreadyForwarding, local, nil)
+			continue
+		}
+		pf.setAgent(remote, agent)
+		if rule, _ := pf.matchRule(f); !rule.AcknowledgeWellKnownPort {
+			warnWellKnownHostPort(local)
+		}
+		if pf.lazyBind(f) {
+			logrus.Infof("Waiting for %s to accept connections before forwarding TCP to %s%s", remote, local, forwardName(pf.ruleName(f)))
+			pf.forwardLazily(ctx, client, f, local, remote)
+			pf.decide(f, forwardActionLazyForward, local, nil)
 			continue
 		}
-		logrus.Infof("Forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbForward); err != nil {
-			logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", f.Port)
+		err := pf.setUpForward(ctx, f, local, remote)
+		pf.decide(f, forwardActionForward, local, err)
+	}
+}
+
+// logEvent logs the forwards that OnEvent would set up or cancel for ev, without setting them up.
+func (pf *portForwarder) logEvent(ev api.Event, instSSHAddress string) {
+	localUnixIP := net.ParseIP(instSSHAddress)
+	for _, f := range ev.LocalPortsRemoved {
+		if local, remote := pf.forwardingAddresses(f, localUnixIP); local != "" {
+			logrus.Infof("Would stop forwarding TCP from %s to %s", remote, local)
+		}
+		pf.releasePoolPort(f)
+	}
+	for _, f := range ev.LocalPortsAdded {
+		local, remote := pf.forwardingAddresses(f, localUnixIP)
+		if local == "" {
+			logrus.Infof("Would not forward TCP %s", remote)
+			continue
+		}
+		logrus.Infof("Would forward TCP from %s to %s%s", remote, local, forwardName(pf.ruleName(f)))
+	}
+}
+
+// guestSocketPruneCandidates returns the parent directories of the guest socket that may be removed,
+// from the innermost one. Only the directories in allowed, or below them, are returned.
+func guestSocketPruneCandidates(guestSocket string, allowed []string) []string {
+	var res []string
+	for dir := path.Dir(guestSocket); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		ok := false
+		for _, a := range allowed {
+			a = path.Clean(a)
+			if dir == a || strings.HasPrefix(dir, a+"/") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			break
+		}
+		res = append(res, dir)
+	}
+	return res
+}
+
+// reconcilePortSnapshot adjusts the first event from the guest agent for the ports that have
+// already been forwarded from the snapshot in the guest agent Info.
+// The first event contains the full ports as LocalPortsAdded, so the ports that are
+// in the snapshot but not in the event are no longer listening.
+func reconcilePortSnapshot(snapshot []api.IPPort, ev api.Event) api.Event {
+	stale := make(map[string]api.IPPort, len(snapshot))
+	for _, f := range snapshot {
+		stale[f.String()] = f
+	}
+	var added []api.IPPort
+	for _, f := range ev.LocalPortsAdded {
+		if _, ok := stale[f.String()]; ok {
+			delete(stale, f.String())
+			continue
+		}
+		added = append(added, f)
+	}
+	ev.LocalPortsAdded = added
+	for _, f := range snapshot {
+		if _, ok := stale[f.String()]; ok {
+			ev.LocalPortsRemoved = append(ev.LocalPortsRemoved, f)
 		}
 	}
+	return ev
 }
@@ -15,10 +15,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// forwardTCP is not thread-safe
-func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, verb string) error {
+// forwardTCP is not thread-safe.
+// backlog is the listen backlog of the pseudoloopback forwarder, or 0 for the system default.
+// Other forwards use the listen backlog of `ssh -L`.
+func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, local, remote string, verb string, backlog int) error {
 	if strings.HasPrefix(local, "/") {
-		return forwardSSH(ctx, sshConfig, port, local, remote, verb, false)
+		return forwardSSH(ctx, sshConfig, port, outputLimit, local, remote, verb, false)
 	}
 	localIPStr, localPortStr, err := net.SplitHostPort(local)
 	if err != nil {
@@ -31,7 +33,7 @@ func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 	}
 
 	if !localIP.Equal(api.IPv4loopback1) || localPort >= 1024 {
-		return forwardSSH(ctx, sshConfig, port, local, remote, verb, false)
+		return forwardSSH(ctx, sshConfig, port, outputLimit, local, remote, verb, false)
 	}
 
 	// on macOS, listening on 127.0.0.1:80 requires root while 0.0.0.0:80 does not require root.
@@ -46,7 +48,7 @@ func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 			localUnix := plf.unixAddr.Name
 			_ = plf.Close()
 			delete(pseudoLoopbackForwarders, local)
-			if err := forwardSSH(ctx, sshConfig, port, localUnix, remote, verb, false); err != nil {
+			if err := forwardSSH(ctx, sshConfig, port, outputLimit, localUnix, remote, verb, false); err != nil {
 				return err
 			}
 		} else {
@@ -61,12 +63,12 @@ func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 	}
 	localUnix := filepath.Join(localUnixDir, "sock")
 	logrus.Debugf("forwarding %q to %q", localUnix, remote)
-	if err := forwardSSH(ctx, sshConfig, port, localUnix, remote, verb, false); err != nil {
+	if err := forwardSSH(ctx, sshConfig, port, outputLimit, localUnix, remote, verb, false); err != nil {
 		return err
 	}
-	plf, err := newPseudoLoopbackForwarder(localPort, localUnix)
+	plf, err := newPseudoLoopbackForwarder(localPort, localUnix, backlog)
 	if err != nil {
-		if cancelErr := forwardSSH(ctx, sshConfig, port, localUnix, remote, verbCancel, false); cancelErr != nil {
+		if cancelErr := forwardSSH(ctx, sshConfig, port, outputLimit, localUnix, remote, verbCancel, false); cancelErr != nil {
 			logrus.WithError(cancelErr).Warnf("failed to cancel forwarding %q to %q", localUnix, remote)
 		}
 		return err
@@ -91,7 +93,7 @@ type pseudoLoopbackForwarder struct {
 	onClose  func() error
 }
 
-func newPseudoLoopbackForwarder(localPort int, unixSock string) (*pseudoLoopbackForwarder, error) {
+func newPseudoLoopbackForwarder(localPort int, unixSock string, backlog int) (*pseudoLoopbackForwarder, error) {
 	unixAddr, err := net.ResolveUnixAddr("unix", unixSock)
 	if err != nil {
 		return nil, err
@@ -105,6 +107,12 @@ func newPseudoLoopbackForwarder(localPort int, unixSock string) (*pseudoLoopback
 	if err != nil {
 		return nil, err
 	}
+	if backlog > 0 {
+		if err := setListenBacklog(ln, backlog); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
 
 	plf := &pseudoLoopbackForwarder{
 		ln:       ln,
@@ -157,6 +165,7 @@ func (plf *pseudoLoopbackForwarder) Close() error {
 	return plf.onClose()
 }
 
+// getFreeVSockPort returns guestAgentVSockPort, as the vsock ports of VZ are per VM.
 func getFreeVSockPort() (int, error) {
-	return 0, nil
+	return guestAgentVSockPort, nil
 }
@@ -8,10 +8,12 @@ import (
 	"github.com/lima-vm/sshocker/pkg/ssh"
 )
 
-func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, verb string) error {
-	return forwardSSH(ctx, sshConfig, port, local, remote, verb, false)
+// forwardTCP ignores backlog, as `ssh -L` uses its own listen backlog
+func forwardTCP(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, local, remote string, verb string, _ int) error {
+	return forwardSSH(ctx, sshConfig, port, outputLimit, local, remote, verb, false)
 }
 
+// getFreeVSockPort returns guestAgentVSockPort, as the vsock ports of QEMU are per guest CID.
 func getFreeVSockPort() (int, error) {
-	return 0, nil
+	return guestAgentVSockPort, nil
 }
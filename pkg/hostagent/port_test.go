@@ -0,0 +1,407 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+type forwardCall struct {
+	Local, Remote, Verb string
+}
+
+func newTestPortForwarder(results ...error) (*portForwarder, *[]forwardCall) {
+	rules := []limayaml.PortForward{{
+		GuestIP:        api.IPv4loopback1,
+		GuestPortRange: [2]int{1, 65535},
+		HostIP:         api.IPv4loopback1,
+		HostPortRange:  [2]int{1, 65535},
+	}}
+	pf := newPortForwarder(nil, 0, DefaultSSHOutputLimit, rules, limayaml.QEMU)
+	var calls []forwardCall
+	pf.forward = func(_ context.Context, local, remote string, verb string, _ int) error {
+		calls = append(calls, forwardCall{Local: local, Remote: remote, Verb: verb})
+		if len(results) == 0 {
+			return nil
+		}
+		err := results[0]
+		results = results[1:]
+		return err
+	}
+	return pf, &calls
+}
+
+func TestOnEventDuplicateHealthyForward(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	ev := api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: 8080}}}
+
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+
+	// After the port has been removed, it is forwarded again
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsRemoved: ev.LocalPortsAdded}, "127.0.0.1")
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbCancel},
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+}
+
+func TestOnEventDuplicateFailedForward(t *testing.T) {
+	pf, calls := newTestPortForwarder(errors.New("address already in use"))
+	ev := api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: 8080}}}
+
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.Assert(t, !pf.isForwarding("127.0.0.1:8080", "127.0.0.1:8080"))
+
+	// The failed forward is retried, and the successful one is not
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.Assert(t, pf.isForwarding("127.0.0.1:8080", "127.0.0.1:8080"))
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+}
+
+func TestCancelSocketForwards(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	rule := limayaml.PortForward{GuestPort: 8080, HostSocket: "/tmp/lima-test/http.sock"}
+	limayaml.FillPortForwardDefaults(&rule, "/tmp/lima-test")
+	pf.rules = append([]limayaml.PortForward{rule}, pf.rules...)
+	ev := api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: 8080},
+		{IP: api.IPv4loopback1, Port: 8081},
+	}}
+
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.NilError(t, pf.cancelSocketForwards(context.Background()))
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "/tmp/lima-test/http.sock", Remote: "127.0.0.1:8080", Verb: verbForward},
+		{Local: "127.0.0.1:8081", Remote: "127.0.0.1:8081", Verb: verbForward},
+		{Local: "/tmp/lima-test/http.sock", Remote: "127.0.0.1:8080", Verb: verbCancel},
+	})
+	assert.DeepEqual(t, pf.activeForwards(), [][2]string{{"127.0.0.1:8081", "127.0.0.1:8081"}})
+}
+
+func TestReforward(t *testing.T) {
+	pf, calls := newTestPortForwarder(nil, errors.New("address already in use"))
+	ev := api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: 8080},
+		{IP: api.IPv4loopback1, Port: 8081},
+	}}
+
+	// 8081 fails to be forwarded
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	*calls = nil
+
+	// After the SSH master has been recreated, all the forwards are set up again
+	pf.reforward(context.Background())
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbCancel},
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+		{Local: "127.0.0.1:8081", Remote: "127.0.0.1:8081", Verb: verbCancel},
+		{Local: "127.0.0.1:8081", Remote: "127.0.0.1:8081", Verb: verbForward},
+	})
+	assert.DeepEqual(t, pf.activeForwards(), [][2]string{
+		{"127.0.0.1:8080", "127.0.0.1:8080"},
+		{"127.0.0.1:8081", "127.0.0.1:8081"},
+	})
+
+	// The ports announced again by the guest agent are not forwarded twice
+	*calls = nil
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.Equal(t, len(*calls), 0)
+}
+
+// fakeGuestAgentClient implements CheckPort, returning the results in order and then nil.
+type fakeGuestAgentClient struct {
+	guestagentclient.GuestAgentClient
+	results []error
+	checks  int
+}
+
+func (c *fakeGuestAgentClient) CheckPort(_ context.Context, _ api.IPPort) error {
+	c.checks++
+	if len(c.results) == 0 {
+		return nil
+	}
+	err := c.results[0]
+	c.results = c.results[1:]
+	return err
+}
+
+func shortenLazyBind(t *testing.T) {
+	retries, interval := lazyBindRetries, lazyBindInterval
+	lazyBindRetries, lazyBindInterval = 3, time.Millisecond
+	t.Cleanup(func() {
+		lazyBindRetries, lazyBindInterval = retries, interval
+	})
+}
+
+func TestLazyBind(t *testing.T) {
+	guest := api.IPPort{IP: api.IPv4loopback1, Port: 8080}
+	testCases := []struct {
+		name     string
+		lazyBind bool
+		vmType   limayaml.VMType
+		guest    api.IPPort
+		expected bool
+	}{
+		{name: "enabled", lazyBind: true, vmType: limayaml.QEMU, guest: guest, expected: true},
+		{name: "disabled", lazyBind: false, vmType: limayaml.QEMU, guest: guest, expected: false},
+		{name: "WSL2", lazyBind: true, vmType: limayaml.WSL2, guest: guest, expected: false},
+		{name: "no matching rule", lazyBind: true, vmType: limayaml.QEMU, guest: api.IPPort{IP: api.IPv4loopback1, Port: 0}, expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pf, _ := newTestPortForwarder()
+			pf.rules[0].LazyBind = tc.lazyBind
+			pf.vmType = tc.vmType
+			assert.Equal(t, pf.lazyBind(tc.guest), tc.expected)
+		})
+	}
+}
+
+func TestWaitForGuestPort(t *testing.T) {
+	shortenLazyBind(t)
+	notReady := errors.New("connection refused")
+	testCases := []struct {
+		name           string
+		results        []error
+		expectedChecks int
+		expectedErr    string
+	}{
+		{name: "ready", expectedChecks: 1},
+		{name: "ready after retries", results: []error{notReady, notReady}, expectedChecks: 3},
+		{
+			name:           "never ready",
+			results:        []error{notReady, notReady, notReady},
+			expectedChecks: 3,
+			expectedErr:    "guest port 127.0.0.1:8080 did not accept connections after 3 attempts: connection refused",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeGuestAgentClient{results: tc.results}
+			err := waitForGuestPort(context.Background(), client, api.IPPort{IP: api.IPv4loopback1, Port: 8080})
+			if tc.expectedErr == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tc.expectedErr)
+			}
+			assert.Equal(t, client.checks, tc.expectedChecks)
+		})
+	}
+}
+
+func TestOnEventLazyBind(t *testing.T) {
+	shortenLazyBind(t)
+	pf, calls := newTestPortForwarder()
+	pf.rules[0].LazyBind = true
+	client := &fakeGuestAgentClient{results: []error{errors.New("connection refused")}}
+	ev := api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: 8080}}}
+
+	pf.OnEvent(context.Background(), client, ev, "127.0.0.1")
+	// The forward is set up in the background, after the guest port has accepted connections
+	for {
+		pf.pendingMu.Lock()
+		n := len(pf.pending)
+		pf.pendingMu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, client.checks, 2)
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+}
+
+func TestGuestSocketPruneCandidates(t *testing.T) {
+	assert.DeepEqual(t, guestSocketPruneCandidates("/run/user/501/app/sub/app.sock", []string{"/run/user/501/app"}),
+		[]string{"/run/user/501/app/sub", "/run/user/501/app"})
+	assert.DeepEqual(t, guestSocketPruneCandidates("/run/user/501/app/app.sock", []string{"/run/user/501/app/"}),
+		[]string{"/run/user/501/app"})
+	// Directories outside of the allowed ones are never pruned
+	assert.Assert(t, guestSocketPruneCandidates("/run/user/501/app.sock", []string{"/run/user/501/app"}) == nil)
+	assert.Assert(t, guestSocketPruneCandidates("/run/user/501/application/app.sock", []string{"/run/user/501/app"}) == nil)
+}
+
+func TestReconcilePortSnapshot(t *testing.T) {
+	p := func(port int) api.IPPort {
+		return api.IPPort{IP: api.IPv4loopback1, Port: port}
+	}
+	testCases := []struct {
+		name     string
+		snapshot []api.IPPort
+		added    []api.IPPort
+		expected api.Event
+	}{
+		{
+			name:     "empty snapshot",
+			added:    []api.IPPort{p(80)},
+			expected: api.Event{LocalPortsAdded: []api.IPPort{p(80)}},
+		},
+		{
+			name:     "unchanged",
+			snapshot: []api.IPPort{p(80), p(443)},
+			added:    []api.IPPort{p(443), p(80)},
+			expected: api.Event{},
+		},
+		{
+			name:     "added",
+			snapshot: []api.IPPort{p(80)},
+			added:    []api.IPPort{p(80), p(8080)},
+			expected: api.Event{LocalPortsAdded: []api.IPPort{p(8080)}},
+		},
+		{
+			name:     "removed",
+			snapshot: []api.IPPort{p(80), p(443)},
+			added:    []api.IPPort{p(80)},
+			expected: api.Event{LocalPortsRemoved: []api.IPPort{p(443)}},
+		},
+		{
+			name:     "added and removed",
+			snapshot: []api.IPPort{p(80), p(443)},
+			added:    []api.IPPort{p(443), p(8080)},
+			expected: api.Event{
+				LocalPortsAdded:   []api.IPPort{p(8080)},
+				LocalPortsRemoved: []api.IPPort{p(80)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev := reconcilePortSnapshot(tc.snapshot, api.Event{LocalPortsAdded: tc.added})
+			assert.DeepEqual(t, ev, tc.expected)
+		})
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	ev := api.Event{
+		LocalPortsAdded:   []api.IPPort{{IP: api.IPv4loopback1, Port: 8080}},
+		LocalPortsRemoved: []api.IPPort{{IP: api.IPv4loopback1, Port: 8081}},
+	}
+
+	// In dry run mode, the ports are only logged
+	pf.logEvent(ev, "127.0.0.1")
+	assert.Equal(t, len(*calls), 0)
+	assert.Equal(t, len(pf.activeForwards()), 0)
+}
+
+func TestOnEventHostPortPool(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	pf.rules = []limayaml.PortForward{{
+		GuestIP:        api.IPv4loopback1,
+		GuestPortRange: [2]int{30000, 32767},
+		HostIP:         api.IPv4loopback1,
+		HostPortRange:  [2]int{30000, 32767},
+		HostPortPool:   [2]int{9000, 9001},
+	}}
+	guest := func(port int) api.IPPort {
+		return api.IPPort{IP: api.IPv4loopback1, Port: port}
+	}
+
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsAdded: []api.IPPort{guest(31000), guest(30500), guest(32000)}}, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:9000", Remote: "127.0.0.1:31000", Verb: verbForward},
+		{Local: "127.0.0.1:9001", Remote: "127.0.0.1:30500", Verb: verbForward},
+	})
+
+	// The freed port is allocated to the next guest port
+	*calls = nil
+	pf.OnEvent(context.Background(), nil, api.Event{
+		LocalPortsRemoved: []api.IPPort{guest(31000)},
+		LocalPortsAdded:   []api.IPPort{guest(32000)},
+	}, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:9000", Remote: "127.0.0.1:31000", Verb: verbCancel},
+		{Local: "127.0.0.1:9000", Remote: "127.0.0.1:32000", Verb: verbForward},
+	})
+}
+
+func TestOnEventDecisions(t *testing.T) {
+	pf, _ := newTestPortForwarder(errors.New("address already in use"))
+	pf.rules = append([]limayaml.PortForward{{
+		Name:           "ignored",
+		GuestIP:        api.IPv4loopback1,
+		GuestPortRange: [2]int{22, 22},
+		Ignore:         true,
+	}}, pf.rules...)
+	var decisions []forwardDecision
+	pf.onDecision = func(d forwardDecision) {
+		d.Time = time.Time{}
+		decisions = append(decisions, d)
+	}
+	guest := func(port int) api.IPPort {
+		return api.IPPort{IP: api.IPv4loopback1, Port: port}
+	}
+	ruleIndex := func(i int) *int {
+		return &i
+	}
+
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsAdded: []api.IPPort{guest(22), guest(8080), guest(8081)}}, "127.0.0.1")
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsAdded: []api.IPPort{guest(8081)}}, "127.0.0.1")
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsRemoved: []api.IPPort{guest(8081)}}, "127.0.0.1")
+	assert.DeepEqual(t, decisions, []forwardDecision{
+		{Guest: "127.0.0.1:22", Action: forwardActionIgnore, Rule: ruleIndex(0), RuleName: "ignored", Result: "ok"},
+		{Guest: "127.0.0.1:8080", Action: forwardActionForward, Host: "127.0.0.1:8080", Rule: ruleIndex(1), Result: "error", Error: "address already in use"},
+		{Guest: "127.0.0.1:8081", Action: forwardActionForward, Host: "127.0.0.1:8081", Rule: ruleIndex(1), Result: "ok"},
+		{Guest: "127.0.0.1:8081", Action: forwardActionAlreadyForwarding, Host: "127.0.0.1:8081", Rule: ruleIndex(1), Result: "ok"},
+		{Guest: "127.0.0.1:8081", Action: forwardActionCancel, Host: "127.0.0.1:8081", Rule: ruleIndex(1), Result: "ok"},
+	})
+}
+
+func TestOnEventReverse(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	rule := limayaml.PortForward{GuestPort: 5000, HostPort: 15000, Reverse: true}
+	limayaml.FillPortForwardDefaults(&rule, "/tmp/lima-test")
+	pf.rules = append([]limayaml.PortForward{rule}, pf.rules...)
+	local, remote := reverseTCPAddresses(rule)
+	assert.Equal(t, local, "127.0.0.1:15000")
+	assert.Equal(t, remote, "127.0.0.1:5000")
+
+	// The guest port listened on by sshd for the reverse rule is not forwarded back to the host
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: 5000},
+		{IP: api.IPv4loopback1, Port: 8080},
+	}}, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+}
+
+func TestOnAgentEvent(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	ev := api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: 8080}}}
+
+	pf.OnAgentEvent(context.Background(), "kind", nil, ev, "127.0.0.1")
+	assert.Equal(t, pf.agentOf("127.0.0.1:8080"), "kind")
+
+	// The port reported by the additional guest agent is not stopped by the guest agent of Lima
+	removed := api.Event{LocalPortsRemoved: ev.LocalPortsAdded}
+	pf.OnEvent(context.Background(), nil, removed, "127.0.0.1")
+	assert.Assert(t, pf.isForwarding("127.0.0.1:8080", "127.0.0.1:8080"))
+
+	pf.OnAgentEvent(context.Background(), "kind", nil, removed, "127.0.0.1")
+	assert.Assert(t, !pf.isForwarding("127.0.0.1:8080", "127.0.0.1:8080"))
+	assert.Equal(t, pf.agentOf("127.0.0.1:8080"), "")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbCancel},
+	})
+}
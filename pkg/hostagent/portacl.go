@@ -0,0 +1,49 @@
+package hostagent
+
+import (
+	"net"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// hostACL is the `hostBindACL` of a rule. nil accepts any client.
+type hostACL []*net.IPNet
+
+// ruleHostACL returns the networks of the clients accepted by the host listener of the rule.
+// The IP addresses are converted to single-address networks.
+func ruleHostACL(rule limayaml.PortForward) hostACL {
+	var acl hostACL
+	for _, entry := range rule.HostBindACL {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			acl = append(acl, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		// Validated by limayaml
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			acl = append(acl, ipNet)
+		}
+	}
+	return acl
+}
+
+// allows returns true if the client address is accepted. The clients without an IP address,
+// e.g., of unix sockets, are only accepted when the ACL is empty.
+func (acl hostACL) allows(addr net.Addr) bool {
+	if len(acl) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range acl {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
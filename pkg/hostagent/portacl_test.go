@@ -0,0 +1,32 @@
+package hostagent
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestHostACL(t *testing.T) {
+	assert.Assert(t, hostACL(nil).allows(&net.TCPAddr{IP: net.ParseIP("203.0.113.1")}))
+
+	acl := ruleHostACL(limayaml.PortForward{HostBindACL: []string{"127.0.0.1", "::1", "192.168.1.0/24"}})
+	assert.Equal(t, len(acl), 3)
+	for _, tc := range []struct {
+		ip      string
+		allowed bool
+	}{
+		{"127.0.0.1", true},
+		{"127.0.0.2", false},
+		{"::1", true},
+		{"192.168.1.42", true},
+		{"::ffff:192.168.1.42", true},
+		{"192.168.2.1", false},
+		{"203.0.113.1", false},
+	} {
+		assert.Equal(t, acl.allows(&net.TCPAddr{IP: net.ParseIP(tc.ip), Port: 50000}), tc.allowed, tc.ip)
+	}
+	// The clients of unix sockets have no IP address
+	assert.Assert(t, !acl.allows(&net.UnixAddr{Name: "@", Net: "unix"}))
+}
@@ -0,0 +1,100 @@
+package hostagent
+
+import (
+	"net"
+	"sort"
+	"sync/atomic"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// byteCounter counts the bytes relayed by a relay, across its connections.
+type byteCounter struct {
+	toGuest   atomic.Uint64
+	fromGuest atomic.Uint64
+}
+
+// wrap returns the connection accepted by the relay, counting the bytes read from it as sent to the guest,
+// and the bytes written to it as received from the guest.
+func (c *byteCounter) wrap(conn net.Conn) net.Conn {
+	return &countingConn{Conn: conn, counter: c}
+}
+
+// event returns the PortForwardBytes with the current counts.
+func (c *byteCounter) event(name, local, remote string) events.PortForwardBytes {
+	return events.PortForwardBytes{
+		Name:      name,
+		Local:     local,
+		Remote:    remote,
+		ToGuest:   c.toGuest.Load(),
+		FromGuest: c.fromGuest.Load(),
+	}
+}
+
+type countingConn struct {
+	net.Conn
+	counter *byteCounter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.counter.toGuest.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.counter.fromGuest.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) CloseRead() error {
+	return closeRead(c.Conn)
+}
+
+func (c *countingConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// closeRead and closeWrite half-close the connection, if supported, for the wrappers of the relayed connections.
+
+func closeRead(conn net.Conn) error {
+	if cr, ok := conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return nil
+}
+
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// portForwardBytes returns the bytes relayed by the active relays, sorted by the host address.
+// The forwards set up by SSH are not relayed by the host agent, and are not included.
+func (pf *portForwarder) portForwardBytes() []events.PortForwardBytes {
+	var res []events.PortForwardBytes
+	pf.tlsForwardersMu.Lock()
+	for _, f := range pf.tlsForwarders {
+		res = append(res, f.bytes.event(f.name, f.local, f.remote))
+	}
+	pf.tlsForwardersMu.Unlock()
+	pf.targetsForwardersMu.Lock()
+	for _, f := range pf.targetsForwarders {
+		res = append(res, f.bytes.event(f.name, f.local, ""))
+	}
+	pf.targetsForwardersMu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Local < res[j].Local
+	})
+	return res
+}
+
+// relayStopped calls onRelayStopped with the bytes relayed by the relay, if non-nil.
+func (pf *portForwarder) relayStopped(ev events.PortForwardBytes) {
+	if pf.onRelayStopped != nil {
+		pf.onRelayStopped(ev)
+	}
+}
@@ -0,0 +1,38 @@
+package hostagent
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestByteCounter(t *testing.T) {
+	var c byteCounter
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	wrapped := c.wrap(conn)
+	defer wrapped.Close()
+
+	go func() {
+		_, _ = peer.Write([]byte("hello"))
+	}()
+	_, err := io.ReadFull(wrapped, make([]byte, 5))
+	assert.NilError(t, err)
+
+	go func() {
+		_, _ = io.ReadFull(peer, make([]byte, 3))
+	}()
+	_, err = wrapped.Write([]byte("bye"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, c.event("web", "127.0.0.1:8080", "127.0.0.1:80"), events.PortForwardBytes{
+		Name:      "web",
+		Local:     "127.0.0.1:8080",
+		Remote:    "127.0.0.1:80",
+		ToGuest:   5,
+		FromGuest: 3,
+	})
+}
@@ -0,0 +1,155 @@
+package hostagent
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// connLimitWarningInterval is the minimum interval between the warnings about the rejected connections
+// of a relay, while the limit keeps being reached.
+const connLimitWarningInterval = time.Minute
+
+// connLimits are the `maxConnections` and `idleTimeout` of a rule. The zero value means no limits.
+type connLimits struct {
+	maxConnections int
+	idleTimeout    time.Duration
+}
+
+// ruleConnLimits returns the limits of the connections relayed for the rule.
+func ruleConnLimits(rule limayaml.PortForward) connLimits {
+	l := connLimits{maxConnections: rule.MaxConnections}
+	if rule.IdleTimeout != "" {
+		// Validated by limayaml
+		l.idleTimeout, _ = time.ParseDuration(rule.IdleTimeout)
+	}
+	return l
+}
+
+// enabled returns true if any of the limits is set, i.e., the forward has to be relayed by the host agent.
+func (l connLimits) enabled() bool {
+	return l.maxConnections > 0 || l.idleTimeout > 0
+}
+
+// connLimiter enforces the limits and the `hostBindACL` on the connections accepted by a relay.
+type connLimiter struct {
+	limits connLimits
+	acl    hostACL
+	local  string
+
+	mu          sync.Mutex
+	active      int
+	throttle    logThrottle
+	aclThrottle logThrottle
+}
+
+func newConnLimiter(limits connLimits, acl hostACL, local string) *connLimiter {
+	return &connLimiter{
+		limits:      limits,
+		acl:         acl,
+		local:       local,
+		throttle:    logThrottle{interval: connLimitWarningInterval},
+		aclThrottle: logThrottle{interval: connLimitWarningInterval},
+	}
+}
+
+// accept returns the connection to relay, closed after the idle timeout, or false when the client is not
+// allowed by `hostBindACL` or `maxConnections` connections are already being relayed, in which case the
+// connection has been closed.
+// release must be called after relaying an accepted connection.
+func (c *connLimiter) accept(conn net.Conn) (net.Conn, bool) {
+	if !c.acl.allows(conn.RemoteAddr()) {
+		c.mu.Lock()
+		ok, suppressed := c.aclThrottle.allow(time.Now())
+		c.mu.Unlock()
+		switch {
+		case !ok:
+			logrus.Debugf("rejecting a connection from %s to %s, as it is not allowed by hostBindACL", conn.RemoteAddr(), c.local)
+		case suppressed > 0:
+			logrus.Warnf("Rejecting a connection from %s to %s, as it is not allowed by hostBindACL (%d similar warnings suppressed)",
+				conn.RemoteAddr(), c.local, suppressed)
+		default:
+			logrus.Warnf("Rejecting a connection from %s to %s, as it is not allowed by hostBindACL", conn.RemoteAddr(), c.local)
+		}
+		_ = conn.Close()
+		return nil, false
+	}
+	c.mu.Lock()
+	if c.limits.maxConnections > 0 && c.active >= c.limits.maxConnections {
+		ok, suppressed := c.throttle.allow(time.Now())
+		c.mu.Unlock()
+		switch {
+		case !ok:
+			logrus.Debugf("rejecting a connection to %s, as %d connections are already relayed", c.local, c.limits.maxConnections)
+		case suppressed > 0:
+			logrus.Warnf("Rejecting a connection to %s, as %d connections are already relayed (%d similar warnings suppressed)",
+				c.local, c.limits.maxConnections, suppressed)
+		default:
+			logrus.Warnf("Rejecting a connection to %s, as %d connections are already relayed", c.local, c.limits.maxConnections)
+		}
+		_ = conn.Close()
+		return nil, false
+	}
+	c.active++
+	c.mu.Unlock()
+	if c.limits.idleTimeout > 0 {
+		conn = newIdleConn(conn, c.limits.idleTimeout)
+	}
+	return conn, true
+}
+
+func (c *connLimiter) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+}
+
+// idleConn closes the connection when no data has been read or written for the timeout.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleConn(conn net.Conn, timeout time.Duration) *idleConn {
+	c := &idleConn{Conn: conn, timeout: timeout}
+	c.timer = time.AfterFunc(timeout, func() {
+		logrus.Debugf("closing the connection from %s after being idle for %s", conn.RemoteAddr(), timeout)
+		_ = conn.Close()
+	})
+	return c
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *idleConn) Close() error {
+	c.timer.Stop()
+	return c.Conn.Close()
+}
+
+// CloseRead and CloseWrite are called by bicopy.Bicopy for the half-close of TCP and unix connections.
+
+func (c *idleConn) CloseRead() error {
+	return closeRead(c.Conn)
+}
+
+func (c *idleConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
@@ -0,0 +1,57 @@
+package hostagent
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestRuleConnLimits(t *testing.T) {
+	assert.Assert(t, !ruleConnLimits(limayaml.PortForward{}).enabled())
+	l := ruleConnLimits(limayaml.PortForward{MaxConnections: 2, IdleTimeout: "1m"})
+	assert.Equal(t, l, connLimits{maxConnections: 2, idleTimeout: time.Minute})
+	assert.Assert(t, l.enabled())
+}
+
+func TestConnLimiterMaxConnections(t *testing.T) {
+	c := newConnLimiter(connLimits{maxConnections: 1}, nil, "127.0.0.1:8080")
+	conn1, peer1 := net.Pipe()
+	defer peer1.Close()
+	_, ok := c.accept(conn1)
+	assert.Assert(t, ok)
+
+	// The connection beyond the limit is closed right away
+	conn2, peer2 := net.Pipe()
+	_, ok = c.accept(conn2)
+	assert.Assert(t, !ok)
+	_, err := peer2.Read(make([]byte, 1))
+	assert.Equal(t, err, io.EOF)
+
+	c.release()
+	conn3, peer3 := net.Pipe()
+	defer peer3.Close()
+	_, ok = c.accept(conn3)
+	assert.Assert(t, ok)
+}
+
+func TestConnLimiterIdleTimeout(t *testing.T) {
+	c := newConnLimiter(connLimits{idleTimeout: 50 * time.Millisecond}, nil, "127.0.0.1:8080")
+	conn, peer := net.Pipe()
+	conn, ok := c.accept(conn)
+	assert.Assert(t, ok)
+	defer c.release()
+
+	go func() {
+		_, _ = conn.Read(make([]byte, 1))
+	}()
+	_, err := peer.Write([]byte("x"))
+	assert.NilError(t, err)
+
+	// The connection is closed after being idle, without being closed by the relay
+	_, err = peer.Read(make([]byte, 1))
+	assert.Equal(t, err, io.EOF)
+}
@@ -0,0 +1,52 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+const onReadyTimeout = 30 * time.Second
+
+// runOnReady runs the `onReady` command of a port forward in the background.
+// The host and guest addresses are passed as LIMA_PORT_FORWARD_HOST_ADDRESS and
+// LIMA_PORT_FORWARD_GUEST_ADDRESS, and the name of the rule as LIMA_PORT_FORWARD_NAME,
+// along with the instance environment.
+func (a *HostAgent) runOnReady(rule limayaml.PortForward, local, remote string) {
+	command := rule.OnReady
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), onReadyTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Env = a.hostCommandEnv(
+			"LIMA_PORT_FORWARD_HOST_ADDRESS="+local,
+			"LIMA_PORT_FORWARD_GUEST_ADDRESS="+remote,
+			"LIMA_PORT_FORWARD_NAME="+rule.Name,
+		)
+		logrus.Debugf("Running the onReady command %v for forwarding %s to %s%s", command, remote, local, forwardName(rule.Name))
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return
+		}
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		logrus.WithError(err).Warnf("the onReady command %v for forwarding %s to %s%s failed: %q", command, remote, local, forwardName(rule.Name), string(out))
+		a.emitEvent(ctx, events.Event{
+			PortForwardOnReadyFailure: &events.PortForwardOnReadyFailure{
+				Name:     rule.Name,
+				Local:    local,
+				Remote:   remote,
+				ExitCode: exitCode,
+				Error:    err.Error(),
+			},
+		})
+	}()
+}
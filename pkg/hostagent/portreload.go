@@ -0,0 +1,158 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// portForwardRules returns the rules of y and y.PortForwarding.IncludeFiles, between the builtin
+// rules that block the SSH ports and the builtin rule that forwards the rest of the localhost ports.
+func portForwardRules(y *limayaml.LimaYAML, instDir string, sshLocalPort int) ([]limayaml.PortForward, error) {
+	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
+	// Block ports 22 and sshLocalPort on all IPs
+	for _, port := range []int{sshGuestPort, sshLocalPort} {
+		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
+		limayaml.FillPortForwardDefaults(&rule, instDir)
+		rules = append(rules, rule)
+	}
+	rules = append(rules, y.PortForwards...)
+	includedRules, err := limayaml.LoadPortForwardIncludes(y, instDir)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, includedRules...)
+	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
+	rule := limayaml.PortForward{GuestIP: guestagentapi.IPv4loopback1}
+	limayaml.FillPortForwardDefaults(&rule, instDir)
+	rules = append(rules, rule)
+	return rules, nil
+}
+
+// isStaticRule returns true for the rules that are set up once on start, rather than on the guest agent events.
+func isStaticRule(rule limayaml.PortForward) bool {
+	return rule.GuestSocket != "" || len(rule.GuestTargets) > 0 || rule.Reverse
+}
+
+// reloadRules replaces the rules for the guest ports with the ones of rules, and cancels the active
+// forwards whose host address has changed, or that are no longer matched by any rule.
+// The static rules are kept as is, as they are only set up on start and torn down on stop.
+// They keep the positions of the static rules of rules, as a reverse rule has to precede the
+// catch-all localhost rule to block its guest port.
+// It returns false if the static rules of rules differ from the current ones.
+func (pf *portForwarder) reloadRules(ctx context.Context, rules []limayaml.PortForward) bool {
+	pf.eventMu.Lock()
+	defer pf.eventMu.Unlock()
+	var oldStatic, newStatic []limayaml.PortForward
+	for _, rule := range pf.currentRules() {
+		if isStaticRule(rule) {
+			oldStatic = append(oldStatic, rule)
+		}
+	}
+	merged := make([]limayaml.PortForward, 0, len(rules)+len(oldStatic))
+	for _, rule := range rules {
+		if !isStaticRule(rule) {
+			merged = append(merged, rule)
+			continue
+		}
+		if len(newStatic) < len(oldStatic) {
+			merged = append(merged, oldStatic[len(newStatic)])
+		}
+		newStatic = append(newStatic, rule)
+	}
+	// The old static rules without a counterpart are kept at the end, except the reverse rules,
+	// which are kept first so that they still block their guest ports
+	for i := len(newStatic); i < len(oldStatic); i++ {
+		rule := oldStatic[i]
+		if rule.Reverse {
+			merged = append([]limayaml.PortForward{rule}, merged...)
+		} else {
+			merged = append(merged, rule)
+		}
+	}
+	pf.replaceRules(merged)
+
+	pf.activeMu.Lock()
+	active := make(map[string]activeForward, len(pf.active))
+	for remote, f := range pf.active {
+		active[remote] = f
+	}
+	pf.activeMu.Unlock()
+	var canceled bool
+	for remote, f := range active {
+		// WSL2 is rejected by ReloadPortForwards, so the guest address is never rewritten
+		local, _ := pf.forwardingAddresses(f.guest, nil)
+		if local == f.local {
+			continue
+		}
+		pf.activeMu.Lock()
+		delete(pf.active, remote)
+		pf.activeMu.Unlock()
+		canceled = true
+		logrus.Infof("Stopping forwarding TCP from %s to %s, as the rules have changed", remote, f.local)
+		pf.tlsForwardersMu.Lock()
+		_, isTLS := pf.tlsForwarders[f.local]
+		pf.tlsForwardersMu.Unlock()
+		var err error
+		if isTLS {
+			err = pf.cancelGuestTLS(ctx, f.local, remote)
+		} else if f.err == nil {
+			err = pf.forwardTCP(ctx, f.local, remote, verbCancel, 0)
+		}
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.guest.Port)
+		}
+		if local == "" {
+			pf.releasePoolPort(f.guest)
+		}
+		pf.decide(f.guest, forwardActionCancel, f.local, err)
+	}
+	if canceled {
+		pf.changed()
+	}
+	return reflect.DeepEqual(oldStatic, newStatic)
+}
+
+// ReloadPortForwards reloads the `portForwards` rules and `portForwarding.includeFiles` of the instance,
+// and applies them to the guest ports without restarting the instance. The forwards that are no longer
+// matched, or whose host address has changed, are canceled, and the guest agent is reconnected to
+// forward the guest ports again with the new rules. The forwards whose host address is unchanged are kept.
+// The changes of the `guestSocket`, `guestTargets`, and `reverse` rules only take effect on restart.
+func (a *HostAgent) ReloadPortForwards(ctx context.Context) error {
+	if *a.y.Plain {
+		return errors.New("port forwarding is disabled in plain mode")
+	}
+	if *a.y.VMType == limayaml.WSL2 {
+		return errors.New("the port forwards of WSL2 instances are not configurable")
+	}
+	y, err := store.LoadYAMLByFilePath(filepath.Join(a.instDir, filenames.LimaYAML))
+	if err != nil {
+		return fmt.Errorf("failed to reload the port forwards: %w", err)
+	}
+	rules, err := portForwardRules(y, a.instDir, a.sshLocalPort)
+	if err != nil {
+		return fmt.Errorf("failed to reload the port forwards: %w", err)
+	}
+	logrus.Infof("Reloading %d port forward rules", len(rules))
+	if !a.portForwarder.reloadRules(ctx, rules) {
+		msg := "the changes of the guestSocket, guestTargets, and reverse rules take effect after restarting the instance"
+		logrus.Warn(msg)
+		a.emitEvent(ctx, events.Event{Warnings: []string{msg}})
+	}
+	// The first event after reconnecting contains all the guest ports, so the ports that are matched
+	// by the new rules are forwarded
+	if err := a.ReconnectGuestAgent(ctx); err != nil {
+		return fmt.Errorf("reloaded the port forwards, but failed to reconnect to the guest agent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package hostagent
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestReloadRules(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	socketRule := limayaml.PortForward{GuestSocket: "/run/my.sock", HostSocket: "my.sock"}
+	limayaml.FillPortForwardDefaults(&socketRule, "/tmp/lima-test")
+	pf.rules = append(pf.rules, socketRule)
+	ev := api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: 3000},
+		{IP: api.IPv4loopback1, Port: 8080},
+		{IP: api.IPv4loopback1, Port: 9000},
+	}}
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.Equal(t, len(*calls), 3)
+
+	// 8080 is moved to another host port, 9000 is no longer forwarded, and 3000 is kept as is
+	moved := limayaml.PortForward{GuestPort: 8080, HostPort: 18080}
+	ignored := limayaml.PortForward{GuestPort: 9000, Ignore: true}
+	kept := limayaml.PortForward{GuestPort: 3000}
+	rules := []limayaml.PortForward{moved, ignored, kept}
+	for i := range rules {
+		limayaml.FillPortForwardDefaults(&rules[i], "/tmp/lima-test")
+	}
+	assert.Assert(t, pf.reloadRules(context.Background(), append(rules, socketRule)))
+	canceled := (*calls)[3:]
+	sort.Slice(canceled, func(i, j int) bool {
+		return canceled[i].Local < canceled[j].Local
+	})
+	assert.DeepEqual(t, canceled, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbCancel},
+		{Local: "127.0.0.1:9000", Remote: "127.0.0.1:9000", Verb: verbCancel},
+	})
+	assert.DeepEqual(t, pf.activeForwards(), [][2]string{{"127.0.0.1:3000", "127.0.0.1:3000"}})
+
+	// The guest agent reports the ports again after reconnecting
+	pf.OnEvent(context.Background(), nil, ev, "127.0.0.1")
+	assert.DeepEqual(t, pf.activeForwards(), [][2]string{
+		{"127.0.0.1:3000", "127.0.0.1:3000"},
+		{"127.0.0.1:18080", "127.0.0.1:8080"},
+	})
+
+	// The static rules are kept
+	assert.Assert(t, !pf.reloadRules(context.Background(), rules))
+	assert.DeepEqual(t, pf.currentRules()[len(pf.currentRules())-1], socketRule)
+}
+
+func TestReloadRulesReverse(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	reverse := limayaml.PortForward{GuestPort: 5000, HostPort: 15000, Reverse: true}
+	limayaml.FillPortForwardDefaults(&reverse, "/tmp/lima-test")
+	pf.rules = append([]limayaml.PortForward{reverse}, pf.rules...)
+	rules := pf.currentRules()
+
+	// The reverse rule still precedes the catch-all rule after reloading
+	assert.Assert(t, pf.reloadRules(context.Background(), rules))
+	assert.DeepEqual(t, pf.currentRules(), rules)
+	pf.OnEvent(context.Background(), nil, api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: 5000},
+		{IP: api.IPv4loopback1, Port: 8080},
+	}}, "127.0.0.1")
+	assert.DeepEqual(t, *calls, []forwardCall{
+		{Local: "127.0.0.1:8080", Remote: "127.0.0.1:8080", Verb: verbForward},
+	})
+
+	// Also when the reverse rule has been removed from the reloaded rules
+	assert.Assert(t, !pf.reloadRules(context.Background(), rules[1:]))
+	_, ok := pf.matchRule(api.IPPort{IP: api.IPv4loopback1, Port: 5000})
+	assert.Assert(t, !ok)
+}
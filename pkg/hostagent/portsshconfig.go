@@ -0,0 +1,46 @@
+package hostagent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// PortForwardsSSHConfig returns an SSH config snippet with a LocalForward entry for each
+// TCP port forward that is currently active.
+func (a *HostAgent) PortForwardsSSHConfig() (string, error) {
+	var opts []string
+	for _, f := range a.portForwarder.activeForwards() {
+		opts = append(opts, fmt.Sprintf("LocalForward=%s %s", f[0], f[1]))
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `# This SSH config snippet lists the TCP ports forwarded by Lima.
+# It can be included into an SSH config file, along with %q.
+`, filenames.SSHConfig)
+	if err := sshutil.Format(&b, a.instName, sshutil.FormatConfig, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writePortForwardsSSHConfig writes PortForwardsSSHConfig next to the SSH config file.
+func (a *HostAgent) writePortForwardsSSHConfig() {
+	a.portForwardsSSHConfigMu.Lock()
+	defer a.portForwardsSSHConfigMu.Unlock()
+	s, err := a.PortForwardsSSHConfig()
+	if err == nil {
+		err = ensureDir(a.instDir, a.hostFileUmask)
+	}
+	if err == nil {
+		fileName := filepath.Join(a.instDir, filenames.SSHForwardsConfig)
+		err = os.WriteFile(fileName, []byte(s), hostFileMode(a.hostFileUmask))
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("failed to write the SSH config snippet for the port forwards")
+	}
+}
@@ -0,0 +1,289 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/bicopy"
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// guestTargetHealthInterval and guestTargetProbeTimeout are variables, to be shortened in the tests.
+var (
+	guestTargetHealthInterval = 10 * time.Second
+	guestTargetProbeTimeout   = time.Second
+)
+
+// guestTarget is a target of a guestTargetsForwarder. The target is forwarded to a unix socket by SSH.
+type guestTarget struct {
+	remote   string
+	unixSock string
+	healthy  bool
+}
+
+// guestTargetsForwarder listens on the host address, and relays the connections to the guest targets
+// round-robin, skipping the unhealthy targets. When all the targets are unhealthy, the connections are
+// relayed to all of them, as the health checks may be wrong for some services.
+type guestTargetsForwarder struct {
+	ln       net.Listener
+	unixDir  string
+	name     string
+	local    string
+	cancel   context.CancelFunc
+	onChange func(ev events.GuestTargets)
+	limiter  *connLimiter
+	bytes    byteCounter
+
+	mu      sync.Mutex
+	targets []*guestTarget
+	next    int
+}
+
+// forwardGuestTargets forwards each of the guest targets of the rule to a temporary unix socket over SSH,
+// and starts relaying the connections to the host address of the rule.
+func (pf *portForwarder) forwardGuestTargets(ctx context.Context, rule limayaml.PortForward) error {
+	local := hostAddress(rule, guestagentapi.IPPort{})
+	pf.targetsForwardersMu.Lock()
+	defer pf.targetsForwardersMu.Unlock()
+	if _, ok := pf.targetsForwarders[local]; ok {
+		return fmt.Errorf("already relaying %q to the guest targets", local)
+	}
+
+	// The sockets are created in a short-named directory, like the ones of forwardGuestTLS
+	unixDir, err := os.MkdirTemp("", "lima-rr-")
+	if err != nil {
+		return err
+	}
+	f := &guestTargetsForwarder{
+		unixDir:  unixDir,
+		name:     rule.Name,
+		local:    local,
+		onChange: pf.onGuestTargets,
+		limiter:  newConnLimiter(ruleConnLimits(rule), ruleHostACL(rule), local),
+	}
+	for i, remote := range rule.GuestTargets {
+		unixSock := filepath.Join(unixDir, strconv.Itoa(i))
+		if err := pf.forwardTCP(ctx, unixSock, remote, verbForward, 0); err != nil {
+			_ = f.cancelTargets(ctx, pf)
+			_ = os.RemoveAll(unixDir)
+			return fmt.Errorf("failed to forward the guest target %q: %w", remote, err)
+		}
+		f.targets = append(f.targets, &guestTarget{remote: remote, unixSock: unixSock, healthy: true})
+	}
+	network := "tcp"
+	if strings.HasPrefix(local, "/") {
+		network = "unix"
+	}
+	ln, err := net.Listen(network, local)
+	if err == nil && rule.ListenBacklog > 0 {
+		if err = setListenBacklog(ln, rule.ListenBacklog); err != nil {
+			_ = ln.Close()
+		}
+	}
+	if err != nil {
+		_ = f.cancelTargets(ctx, pf)
+		_ = os.RemoveAll(unixDir)
+		return err
+	}
+	f.ln = ln
+	healthCtx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	pf.targetsForwarders[local] = f
+	go func() {
+		if err := f.serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logrus.WithError(err).Warnf("guest targets relay for %q crashed", local)
+		}
+	}()
+	go f.watchHealth(healthCtx)
+	return nil
+}
+
+// cancelGuestTargets stops all the relays started by forwardGuestTargets.
+func (pf *portForwarder) cancelGuestTargets(ctx context.Context) error {
+	pf.targetsForwardersMu.Lock()
+	defer pf.targetsForwardersMu.Unlock()
+	var errs []error
+	for local, f := range pf.targetsForwarders {
+		logrus.Infof("Stopping relaying %s to the guest targets", local)
+		errs = append(errs, f.close(ctx, pf))
+		delete(pf.targetsForwarders, local)
+		pf.relayStopped(f.bytes.event(f.name, f.local, ""))
+	}
+	return errors.Join(errs...)
+}
+
+// reforwardGuestTargets sets up the forwards of the guest targets again, after the SSH control master
+// has been recreated. The relays on the host are kept.
+func (pf *portForwarder) reforwardGuestTargets(ctx context.Context) {
+	pf.targetsForwardersMu.Lock()
+	defer pf.targetsForwardersMu.Unlock()
+	locals := make([]string, 0, len(pf.targetsForwarders))
+	for local := range pf.targetsForwarders {
+		locals = append(locals, local)
+	}
+	sort.Strings(locals)
+	for _, local := range locals {
+		for _, t := range pf.targetsForwarders[local].targets {
+			if err := pf.forwardTCP(ctx, t.unixSock, t.remote, verbCancel, 0); err != nil {
+				logrus.WithError(err).Debugf("failed to cancel the stale forward from %s to %s", t.remote, t.unixSock)
+			}
+			// The socket may still exist when ssh was killed
+			_ = os.Remove(t.unixSock)
+			if err := pf.forwardTCP(ctx, t.unixSock, t.remote, verbForward, 0); err != nil {
+				logrus.WithError(err).Warnf("failed to forward the guest target %q of %q again", t.remote, local)
+			}
+		}
+	}
+}
+
+func (f *guestTargetsForwarder) serve() error {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return err
+		}
+		conn, ok := f.limiter.accept(conn)
+		if !ok {
+			continue
+		}
+		conn = f.bytes.wrap(conn)
+		go func() {
+			defer f.limiter.release()
+			t := f.pick()
+			if err := f.relay(conn, t); err != nil {
+				logrus.WithError(err).Warnf("failed to relay %q to the guest target %q", f.local, t.remote)
+			}
+		}()
+	}
+}
+
+// pick returns the next healthy target, or the next target when none is healthy.
+func (f *guestTargetsForwarder) pick() *guestTarget {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.targets)
+	for i := 0; i < n; i++ {
+		t := f.targets[(f.next+i)%n]
+		if t.healthy {
+			f.next = (f.next + i + 1) % n
+			return t
+		}
+	}
+	t := f.targets[f.next]
+	f.next = (f.next + 1) % n
+	return t
+}
+
+func (f *guestTargetsForwarder) relay(conn net.Conn, t *guestTarget) error {
+	defer conn.Close()
+	unixConn, err := net.Dial("unix", t.unixSock)
+	if err != nil {
+		return err
+	}
+	defer unixConn.Close()
+	bicopy.Bicopy(conn, unixConn, nil)
+	return nil
+}
+
+// probeGuestTarget connects to the unix socket of the target. SSH accepts the connection regardless
+// of the target, and closes it right away when the target refused the connection, so the target is
+// considered healthy unless the connection is closed before the timeout.
+func probeGuestTarget(unixSock string) error {
+	conn, err := net.DialTimeout("unix", unixSock, guestTargetProbeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(guestTargetProbeTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	switch {
+	case err == nil:
+		// The service sent a banner
+		return nil
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return nil
+	case errors.Is(err, io.EOF):
+		return errors.New("the connection was closed right away")
+	default:
+		return err
+	}
+}
+
+// checkHealth probes all the targets, and calls onChange when the health of any of them has changed.
+// onChange is also called on the first check, with changed set.
+func (f *guestTargetsForwarder) checkHealth(changed bool) {
+	for _, t := range f.targets {
+		err := probeGuestTarget(t.unixSock)
+		f.mu.Lock()
+		healthy := err == nil
+		if t.healthy != healthy {
+			changed = true
+			t.healthy = healthy
+		}
+		f.mu.Unlock()
+		if err != nil {
+			logrus.WithError(err).Debugf("guest target %q of %q is unhealthy", t.remote, f.local)
+		}
+	}
+	if changed && f.onChange != nil {
+		f.onChange(f.status())
+	}
+}
+
+func (f *guestTargetsForwarder) status() events.GuestTargets {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ev := events.GuestTargets{Name: f.name, Local: f.local}
+	for _, t := range f.targets {
+		ev.Targets = append(ev.Targets, events.GuestTarget{Remote: t.remote, Healthy: t.healthy})
+	}
+	return ev
+}
+
+func (f *guestTargetsForwarder) watchHealth(ctx context.Context) {
+	f.checkHealth(true)
+	ticker := time.NewTicker(guestTargetHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.checkHealth(false)
+		}
+	}
+}
+
+// cancelTargets cancels the forwards of the targets over SSH.
+func (f *guestTargetsForwarder) cancelTargets(ctx context.Context, pf *portForwarder) error {
+	var errs []error
+	for _, t := range f.targets {
+		if err := pf.forwardTCP(ctx, t.unixSock, t.remote, verbCancel, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *guestTargetsForwarder) close(ctx context.Context, pf *portForwarder) error {
+	f.cancel()
+	err := f.ln.Close()
+	err = errors.Join(err, f.cancelTargets(ctx, pf))
+	return errors.Join(err, os.RemoveAll(f.unixDir))
+}
@@ -0,0 +1,106 @@
+package hostagent
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestGuestTargetsPick(t *testing.T) {
+	f := &guestTargetsForwarder{
+		targets: []*guestTarget{
+			{remote: "a:1", healthy: true},
+			{remote: "b:1", healthy: false},
+			{remote: "c:1", healthy: true},
+		},
+	}
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, f.pick().remote)
+	}
+	assert.DeepEqual(t, picked, []string{"a:1", "c:1", "a:1", "c:1"})
+
+	for _, target := range f.targets {
+		target.healthy = false
+	}
+	picked = nil
+	for i := 0; i < 3; i++ {
+		picked = append(picked, f.pick().remote)
+	}
+	assert.DeepEqual(t, picked, []string{"a:1", "b:1", "c:1"})
+}
+
+func TestProbeGuestTarget(t *testing.T) {
+	origTimeout := guestTargetProbeTimeout
+	guestTargetProbeTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { guestTargetProbeTimeout = origTimeout })
+
+	listen := func(name string, closeRightAway bool) string {
+		sock := filepath.Join(t.TempDir(), name)
+		ln, err := net.Listen("unix", sock)
+		assert.NilError(t, err)
+		t.Cleanup(func() { _ = ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				if closeRightAway {
+					_ = conn.Close()
+				} else {
+					t.Cleanup(func() { _ = conn.Close() })
+				}
+			}
+		}()
+		return sock
+	}
+	assert.NilError(t, probeGuestTarget(listen("healthy", false)))
+	assert.ErrorContains(t, probeGuestTarget(listen("refused", true)), "closed right away")
+	assert.Assert(t, probeGuestTarget(filepath.Join(t.TempDir(), "missing")) != nil)
+}
+
+func TestForwardGuestTargets(t *testing.T) {
+	pf, calls := newTestPortForwarder()
+	statuses := make(chan events.GuestTargets, 1)
+	pf.onGuestTargets = func(ev events.GuestTargets) {
+		statuses <- ev
+	}
+	rule := limayaml.PortForward{
+		Name:         "replicas",
+		HostIP:       api.IPv4loopback1,
+		GuestTargets: []string{"127.0.0.1:8001", "10.0.2.100:8000"},
+	}
+	assert.NilError(t, pf.forwardGuestTargets(context.Background(), rule))
+	assert.Equal(t, len(*calls), 2)
+	for i, target := range rule.GuestTargets {
+		assert.Equal(t, (*calls)[i].Remote, target)
+		assert.Equal(t, (*calls)[i].Verb, verbForward)
+	}
+
+	// The unix sockets are not created by the fake forward, so the targets are unhealthy
+	status := <-statuses
+	assert.DeepEqual(t, status, events.GuestTargets{
+		Name:  "replicas",
+		Local: "127.0.0.1:0",
+		Targets: []events.GuestTarget{
+			{Remote: "127.0.0.1:8001"},
+			{Remote: "10.0.2.100:8000"},
+		},
+	})
+
+	assert.NilError(t, pf.cancelGuestTargets(context.Background()))
+	assert.Equal(t, len(*calls), 4)
+	for i, target := range rule.GuestTargets {
+		assert.Equal(t, (*calls)[2+i].Remote, target)
+		assert.Equal(t, (*calls)[2+i].Verb, verbCancel)
+	}
+	assert.Equal(t, len(pf.targetsForwarders), 0)
+}
@@ -0,0 +1,212 @@
+package hostagent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/bicopy"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+const guestTLSHandshakeTimeout = 10 * time.Second
+
+// guestTLSForwarder listens on the host address, and relays the connections to the guest
+// over TLS. The guest port is forwarded to a unix socket by SSH, and the TLS connection is
+// established over that socket. Without config, the connections are relayed as is, for the
+// rules with `maxConnections`, `idleTimeout`, or `hostBindACL`.
+type guestTLSForwarder struct {
+	ln        net.Listener
+	unixSock  string
+	unixDir   string
+	config    *tls.Config
+	limiter   *connLimiter
+	bytes     byteCounter
+	name      string
+	local     string
+	remote    string
+	onFailure func(name, local, remote string, err error)
+	onConnect func(local string) func()
+}
+
+// guestTLSConfig returns the TLS client config for connecting to remote.
+func guestTLSConfig(t *limayaml.GuestTLS, remote string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(remote)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", t.CA)
+		}
+	}
+	if t.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// forwardGuestTLS forwards remote to a temporary unix socket over SSH, and starts relaying the
+// connections to local over TLS, or as is when t is nil.
+func (pf *portForwarder) forwardGuestTLS(ctx context.Context, t *limayaml.GuestTLS, name, local, remote string, backlog int, limits connLimits, acl hostACL) error {
+	var config *tls.Config
+	if t != nil {
+		var err error
+		config, err = guestTLSConfig(t, remote)
+		if err != nil {
+			return fmt.Errorf("failed to load the TLS credentials for %s: %w", remote, err)
+		}
+	}
+	pf.tlsForwardersMu.Lock()
+	defer pf.tlsForwardersMu.Unlock()
+	if prev, ok := pf.tlsForwarders[local]; ok {
+		if err := prev.close(ctx, pf); err != nil {
+			logrus.WithError(err).Warnf("failed to close the previous TLS relay for %q", local)
+		}
+		delete(pf.tlsForwarders, local)
+		pf.relayStopped(prev.bytes.event(prev.name, prev.local, prev.remote))
+	}
+
+	// The socket is created in a short-named directory, to fit in UNIX_PATH_MAX even with the
+	// long $TMPDIR of macOS
+	unixDir, err := os.MkdirTemp("", "lima-tls-")
+	if err != nil {
+		return err
+	}
+	unixSock := filepath.Join(unixDir, "sock")
+	if err := pf.forwardTCP(ctx, unixSock, remote, verbForward, 0); err != nil {
+		_ = os.RemoveAll(unixDir)
+		return err
+	}
+	network := "tcp"
+	if strings.HasPrefix(local, "/") {
+		network = "unix"
+	}
+	ln, err := net.Listen(network, local)
+	if err == nil && backlog > 0 {
+		if err = setListenBacklog(ln, backlog); err != nil {
+			_ = ln.Close()
+		}
+	}
+	if err != nil {
+		if cancelErr := pf.forwardTCP(ctx, unixSock, remote, verbCancel, 0); cancelErr != nil {
+			logrus.WithError(cancelErr).Warnf("failed to cancel forwarding %q to %q", unixSock, remote)
+		}
+		_ = os.RemoveAll(unixDir)
+		return err
+	}
+	f := &guestTLSForwarder{
+		ln:        ln,
+		unixSock:  unixSock,
+		unixDir:   unixDir,
+		config:    config,
+		limiter:   newConnLimiter(limits, acl, local),
+		name:      name,
+		local:     local,
+		remote:    remote,
+		onFailure: pf.onTLSHandshakeError,
+		onConnect: pf.onConnect,
+	}
+	pf.tlsForwarders[local] = f
+	go func() {
+		if err := f.serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logrus.WithError(err).Warnf("TLS relay for %q crashed", local)
+		}
+	}()
+	return nil
+}
+
+// cancelGuestTLS stops the relay started by forwardGuestTLS.
+func (pf *portForwarder) cancelGuestTLS(ctx context.Context, local, remote string) error {
+	pf.tlsForwardersMu.Lock()
+	defer pf.tlsForwardersMu.Unlock()
+	f, ok := pf.tlsForwarders[local]
+	if !ok || f.remote != remote {
+		return fmt.Errorf("not relaying %q to %q", remote, local)
+	}
+	delete(pf.tlsForwarders, local)
+	err := f.close(ctx, pf)
+	pf.relayStopped(f.bytes.event(f.name, f.local, f.remote))
+	return err
+}
+
+func (f *guestTLSForwarder) serve() error {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return err
+		}
+		conn, ok := f.limiter.accept(conn)
+		if !ok {
+			continue
+		}
+		conn = f.bytes.wrap(conn)
+		go func() {
+			defer f.limiter.release()
+			if f.onConnect != nil {
+				done := f.onConnect(f.local)
+				defer done()
+			}
+			if err := f.relay(conn); err != nil {
+				logrus.WithError(err).Warnf("failed to relay %q to %q", f.local, f.remote)
+			}
+		}()
+	}
+}
+
+func (f *guestTLSForwarder) relay(conn net.Conn) error {
+	defer conn.Close()
+	unixConn, err := net.Dial("unix", f.unixSock)
+	if err != nil {
+		return err
+	}
+	if f.config == nil {
+		defer unixConn.Close()
+		bicopy.Bicopy(conn, unixConn, nil)
+		return nil
+	}
+	tlsConn := tls.Client(unixConn, f.config)
+	defer tlsConn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), guestTLSHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		if f.onFailure != nil {
+			f.onFailure(f.name, f.local, f.remote, err)
+		}
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	bicopy.Bicopy(conn, tlsConn, nil)
+	return nil
+}
+
+func (f *guestTLSForwarder) close(ctx context.Context, pf *portForwarder) error {
+	err := f.ln.Close()
+	if cancelErr := pf.forwardTCP(ctx, f.unixSock, f.remote, verbCancel, 0); cancelErr != nil {
+		err = errors.Join(err, cancelErr)
+	}
+	return errors.Join(err, os.RemoveAll(f.unixDir))
+}
@@ -0,0 +1,48 @@
+package hostagent
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// poweroffScript powers off the guest in the background, so that ssh exits before the connection is lost.
+const poweroffScript = `#!/bin/sh
+set -eu
+sudo -n true
+nohup sudo -n sh -c 'sleep 1; poweroff' >/dev/null 2>&1 &
+`
+
+// poweroffGuest powers off the guest over SSH, and waits for the VM to exit until
+// `hostAgent.guestPoweroffTimeout`. It returns true if the VM has exited.
+func (a *HostAgent) poweroffGuest() bool {
+	timeout := a.guestPoweroffTimeout
+	logrus.Infof("Powering off the guest, waiting up to %s", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stdout, stderr, err := executeScript(ctx, a.instSSHAddress, a.sshLocalPort, a.provisionSSHConfig, poweroffScript, "powering off the guest")
+	logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to power off the guest, stopping the VM with the driver")
+		return false
+	}
+	select {
+	case driverErr := <-a.driverErrCh:
+		logrus.WithError(driverErr).Info("The guest has powered off")
+		return true
+	case <-ctx.Done():
+		logrus.Warnf("The guest did not power off in %s, stopping the VM with the driver", timeout)
+		return false
+	}
+}
+
+// stopDriver stops the VM with the driver. When the guest has already powered off, driver.Stop
+// only cleans up, and its errors about the VM not running are ignored.
+func (a *HostAgent) stopDriver(ctx context.Context) error {
+	err := a.driver.Stop(ctx)
+	if err != nil && a.guestPoweredOff {
+		logrus.WithError(err).Debug("failed to stop the driver after the guest powered off")
+		return nil
+	}
+	return err
+}
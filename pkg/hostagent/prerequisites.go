@@ -0,0 +1,75 @@
+package hostagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+const prerequisiteTimeout = 30 * time.Second
+
+// checkHostPrerequisites checks `host.prerequisites` in order, and returns an error
+// for the first prerequisite that is not met.
+func (a *HostAgent) checkHostPrerequisites(ctx context.Context) error {
+	for _, p := range a.y.Host.Prerequisites {
+		logrus.Infof("Checking the host prerequisite %q", p.Description)
+		err := checkHostPrerequisite(ctx, p, a.hostCommandEnv())
+		ev := &events.HostPrerequisite{
+			Description: p.Description,
+			Satisfied:   err == nil,
+		}
+		if err != nil {
+			ev.Error = err.Error()
+			ev.Hint = p.Hint
+		}
+		a.emitEvent(ctx, events.Event{HostPrerequisite: ev})
+		if err != nil {
+			if p.Hint != "" {
+				return fmt.Errorf("host prerequisite %q is not met: %w; hint: %s", p.Description, err, p.Hint)
+			}
+			return fmt.Errorf("host prerequisite %q is not met: %w", p.Description, err)
+		}
+	}
+	return nil
+}
+
+// checkHostPrerequisite runs the command of the prerequisite with env, or the environment of the host agent if nil.
+func checkHostPrerequisite(ctx context.Context, p limayaml.Prerequisite, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, prerequisiteTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return fmt.Errorf("failed to run %v: %w", p.Command, err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	if exitCode != p.ExpectedExitCode {
+		return fmt.Errorf("%v exited with %d, expected %d (stderr=%q)", p.Command, exitCode, p.ExpectedExitCode, strings.TrimSpace(stderr.String()))
+	}
+	if p.ExpectedOutput != "" {
+		re, err := regexp.Compile(p.ExpectedOutput)
+		if err != nil {
+			return err
+		}
+		if !re.Match(stdout.Bytes()) {
+			return fmt.Errorf("the output of %v does not match %q (stdout=%q)", p.Command, p.ExpectedOutput, strings.TrimSpace(stdout.String()))
+		}
+	}
+	return nil
+}
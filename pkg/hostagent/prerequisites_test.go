@@ -0,0 +1,42 @@
+package hostagent
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckHostPrerequisite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on windows, as the test depends on sh")
+	}
+	ctx := context.Background()
+
+	t.Run("satisfied", func(t *testing.T) {
+		p := limayaml.Prerequisite{Command: []string{"sh", "-c", "echo kvm loaded"}, ExpectedOutput: "^kvm "}
+		assert.NilError(t, checkHostPrerequisite(ctx, p, nil))
+	})
+
+	t.Run("expected exit code", func(t *testing.T) {
+		p := limayaml.Prerequisite{Command: []string{"sh", "-c", "exit 3"}, ExpectedExitCode: 3}
+		assert.NilError(t, checkHostPrerequisite(ctx, p, nil))
+	})
+
+	t.Run("unexpected exit code", func(t *testing.T) {
+		p := limayaml.Prerequisite{Command: []string{"sh", "-c", "echo no tap0 >&2; exit 1"}}
+		assert.ErrorContains(t, checkHostPrerequisite(ctx, p, nil), `exited with 1, expected 0 (stderr="no tap0")`)
+	})
+
+	t.Run("unexpected output", func(t *testing.T) {
+		p := limayaml.Prerequisite{Command: []string{"sh", "-c", "echo state DOWN"}, ExpectedOutput: "state UP"}
+		assert.ErrorContains(t, checkHostPrerequisite(ctx, p, nil), `does not match "state UP"`)
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		p := limayaml.Prerequisite{Command: []string{"lima-nonexistent-command"}}
+		assert.ErrorContains(t, checkHostPrerequisite(ctx, p, nil), "failed to run")
+	})
+}
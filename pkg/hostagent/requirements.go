@@ -1,62 +1,244 @@
 package hostagent
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/alessio/shellescape"
 	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
 
+// requirementsPhases maps the labels of the requirements to the boot phases.
+var requirementsPhases = map[string]events.Phase{
+	"essential": events.PhaseRequirementsEssential,
+	"optional":  events.PhaseRequirementsOptional,
+	"final":     events.PhaseRequirementsFinal,
+}
+
 func (a *HostAgent) waitForRequirements(label string, requirements []requirement) error {
-	const (
-		retries       = 60
-		sleepDuration = 10 * time.Second
-	)
 	var errs []error
+	a.emitPhase(context.Background(), requirementsPhases[label])
+	start := time.Now()
+	defer a.timeline.record(label+"Requirements", start)
 
-	for i, req := range requirements {
-	retryLoop:
-		for j := 0; j < retries; j++ {
-			logrus.Infof("Waiting for the %s requirement %d of %d: %q", label, i+1, len(requirements), req.description)
-			err := a.waitForRequirement(req)
-			if err == nil {
-				logrus.Infof("The %s requirement %d of %d is satisfied", label, i+1, len(requirements))
-				break retryLoop
+	for _, group := range groupRequirements(requirements) {
+		// The errors are collected by index, so that they are reported in the order of the requirements
+		groupErrs := make([]error, len(group))
+		fatal := false
+		sem := make(chan struct{}, *a.y.HostAgent.RequirementsParallelism)
+		// done[k] is closed when the requirement group[k] has been checked
+		done := make([]chan struct{}, len(group))
+		groupIndex := make(map[string]int)
+		for k, i := range group {
+			done[k] = make(chan struct{})
+			if name := requirements[i].name; name != "" {
+				groupIndex[name] = k
 			}
-			if req.fatal {
-				logrus.Infof("No further %s requirements will be checked", label)
-				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s; skipping further checks: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
-				return errors.Join(errs...)
+		}
+		var wg sync.WaitGroup
+		for k, i := range group {
+			k, i := k, i
+			req := requirements[i]
+			wg.Add(1)
+			// The slots are taken in the order of the requirements, except for the requirements
+			// with dependencies, which wait for them before taking a slot, as they may still need one
+			if len(req.after) == 0 {
+				sem <- struct{}{}
 			}
-			if j == retries-1 {
-				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
-				break retryLoop
+			go func() {
+				defer wg.Done()
+				defer close(done[k])
+				for _, name := range req.after {
+					if j, ok := groupIndex[name]; ok {
+						<-done[j]
+					}
+				}
+				for _, name := range req.after {
+					if !a.probeSatisfied(name) {
+						groupErrs[k] = fmt.Errorf("skipped the %s requirement %d of %d %q, as the probe %q was not satisfied", label, i+1, len(requirements), req.description, name)
+						break
+					}
+				}
+				if len(req.after) > 0 && groupErrs[k] == nil {
+					sem <- struct{}{}
+				}
+				if groupErrs[k] == nil {
+					var isFatal bool
+					isFatal, groupErrs[k] = a.waitForRequirementWithRetries(label, i, len(requirements), req, start)
+					<-sem
+					if isFatal {
+						// A fatal requirement is always a group on its own, so there is no race
+						fatal = true
+					}
+				}
+				if req.probe > 0 {
+					a.recordProbeResult(req.probe-1, groupErrs[k])
+				}
+			}()
+		}
+		wg.Wait()
+		for _, err := range groupErrs {
+			if err != nil {
+				errs = append(errs, err)
 			}
-			time.Sleep(10 * time.Second)
+		}
+		if fatal {
+			logrus.Infof("No further %s requirements will be checked", label)
+			break
 		}
 	}
 	return errors.Join(errs...)
 }
 
-func (a *HostAgent) waitForRequirement(r requirement) error {
+const (
+	defaultRequirementRetries  = 60
+	defaultRequirementInterval = 10 * time.Second
+)
+
+// waitForRequirementWithRetries checks the requirement i of n until it is satisfied.
+// The first return value is true when a fatal requirement failed.
+func (a *HostAgent) waitForRequirementWithRetries(label string, i, n int, req requirement, start time.Time) (bool, error) {
+	retries, interval := req.retries, req.interval
+	if retries == 0 && req.timeout == 0 {
+		retries = defaultRequirementRetries
+	}
+	if interval == 0 {
+		interval = defaultRequirementInterval
+	}
+	ctx := context.Background()
+	if req.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.timeout)
+		defer cancel()
+	}
+	for j := 0; ; j++ {
+		logrus.Infof("Waiting for the %s requirement %d of %d: %q", label, i+1, n, req.description)
+		err := a.waitForRequirement(ctx, req)
+		if err == nil {
+			logrus.Infof("The %s requirement %d of %d is satisfied", label, i+1, n)
+			if label == "essential" && i == 0 {
+				// The first essential requirement is "ssh"
+				a.timeline.record("sshReady", start)
+			}
+			return false, nil
+		}
+		if req.fatal {
+			return true, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s; skipping further checks: %w", label, i+1, n, req.description, req.debugHint, err)
+		}
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q within %s: %s: %w", label, i+1, n, req.description, req.timeout, req.debugHint, err)
+		}
+		if retries > 0 && j == retries-1 {
+			return false, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s: %w", label, i+1, n, req.description, req.debugHint, err)
+		}
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q within %s: %s: %w", label, i+1, n, req.description, req.timeout, req.debugHint, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// groupRequirements returns the indices of the requirements in the order of the checks.
+// The consecutive concurrent requirements are grouped together, and any other requirement
+// is a group on its own, so that it is only checked after all the previous ones.
+func groupRequirements(requirements []requirement) [][]int {
+	var groups [][]int
+	for i, req := range requirements {
+		if req.concurrent && !req.fatal && len(groups) > 0 {
+			last := groups[len(groups)-1]
+			if first := requirements[last[0]]; first.concurrent && !first.fatal {
+				groups[len(groups)-1] = append(last, i)
+				continue
+			}
+		}
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+func (a *HostAgent) waitForRequirement(ctx context.Context, r requirement) error {
 	logrus.Debugf("executing script %q", r.description)
-	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, r.script, r.description)
+	stdout, stderr, err := executeScript(ctx, a.instSSHAddress, a.sshLocalPort, a.provisionSSHConfig, r.script, r.description)
 	logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
-	if err != nil {
+	if err = checkExitCode(err, r.expectedExitCode); err != nil {
 		return fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
 	}
 	return nil
 }
 
+// checkExitCode returns nil if err is the result of a command that exited with expected.
+func checkExitCode(err error, expected int) error {
+	if expected == 0 {
+		return err
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return fmt.Errorf("exited with 0, expected %d", expected)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == expected:
+		return nil
+	default:
+		return err
+	}
+}
+
+// executeScript is like ssh.ExecuteScript, but kills ssh when ctx is done.
+func executeScript(ctx context.Context, host string, port int, c *ssh.SSHConfig, script, scriptName string) (string, string, error) {
+	interpreter, err := ssh.ParseScriptInterpreter(script)
+	if err != nil {
+		return "", "", err
+	}
+	args := c.Args()
+	if port != 0 {
+		args = append(args, "-p", strconv.Itoa(port))
+	}
+	args = append(args, host, "--", interpreter)
+	cmd := exec.CommandContext(ctx, c.Binary(), args...)
+	cmd.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	logrus.Debugf("executing ssh for script %q: %s %v", scriptName, cmd.Path, cmd.Args)
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), stderr.String(), fmt.Errorf("failed to execute script %q: %w", scriptName, err)
+	}
+	return string(out), stderr.String(), nil
+}
+
 type requirement struct {
 	description string
 	script      string
 	debugHint   string
 	fatal       bool
+	// concurrent requirements do not depend on each other, and may be checked concurrently
+	// with the adjacent concurrent requirements. Other requirements depend on all the previous ones.
+	concurrent bool
+	// name identifies the requirement in after
+	name string
+	// after is the names of the previous requirements that must be satisfied before checking this one
+	after []string
+	// timeout is the time to wait for the requirement, or 0
+	timeout time.Duration
+	// retries is the number of checks, or 0 for defaultRequirementRetries, or unlimited until the timeout
+	retries int
+	// interval is the time between the checks, or 0 for defaultRequirementInterval
+	interval         time.Duration
+	expectedExitCode int
+	// probe is the index of the probe in `probes` plus 1, or 0 for the builtin requirements
+	probe int
 }
 
 func (a *HostAgent) essentialRequirements() []requirement {
@@ -73,7 +255,7 @@ If any private key under ~/.ssh is protected with a passphrase, you need to have
 `,
 		})
 	if *a.y.Plain {
-		return req
+		return append(req, a.probeRequirements(limayaml.ProbePhaseEssential)...)
 	}
 	req = append(req,
 		requirement{
@@ -154,7 +336,7 @@ A possible workaround is to run "lima-guestagent install-systemd" in the guest.
 `,
 		})
 	}
-	return req
+	return append(req, a.probeRequirements(limayaml.ProbePhaseEssential)...)
 }
 
 func (a *HostAgent) optionalRequirements() []requirement {
@@ -192,18 +374,75 @@ Also see "/var/log/cloud-init-output.log" in the guest.
 `,
 			})
 	}
-	for _, probe := range a.y.Probes {
-		if probe.Mode == limayaml.ProbeModeReadiness {
-			req = append(req, requirement{
-				description: probe.Description,
-				script:      probe.Script,
-				debugHint:   probe.Hint,
-			})
+	return append(req, a.probeRequirements(limayaml.ProbePhaseOptional)...)
+}
+
+// probeRequirements returns the requirements for the readiness probes of the phase.
+func (a *HostAgent) probeRequirements(phase limayaml.ProbePhase) []requirement {
+	var req []requirement
+	for i, probe := range a.y.Probes {
+		if probe.Mode != limayaml.ProbeModeReadiness || probe.Phase != phase {
+			continue
+		}
+		// The durations have been validated by limayaml.Validate
+		timeout, _ := time.ParseDuration(probe.Timeout)
+		interval, _ := time.ParseDuration(probe.Interval)
+		r := requirement{
+			description:      probe.Description,
+			script:           probe.Script,
+			debugHint:        probe.Hint,
+			concurrent:       true,
+			name:             probe.Name,
+			after:            probe.After,
+			timeout:          timeout,
+			interval:         interval,
+			expectedExitCode: probe.ExpectedExitCode,
+			probe:            i + 1,
 		}
+		if probe.Retries != nil {
+			r.retries = *probe.Retries
+		}
+		req = append(req, r)
 	}
 	return req
 }
 
+func newProbeResults(probes []limayaml.Probe) []events.ProbeResult {
+	var res []events.ProbeResult
+	for _, probe := range probes {
+		res = append(res, events.ProbeResult{Name: probe.Name, Description: probe.Description, Phase: probe.Phase})
+	}
+	return res
+}
+
+func (a *HostAgent) recordProbeResult(i int, err error) {
+	a.probeResultsMu.Lock()
+	defer a.probeResultsMu.Unlock()
+	a.probeResults[i].Satisfied = err == nil
+	a.probeResults[i].Error = ""
+	if err != nil {
+		a.probeResults[i].Error = err.Error()
+	}
+}
+
+// probeSatisfied returns true if the probe with the name has been satisfied.
+func (a *HostAgent) probeSatisfied(name string) bool {
+	a.probeResultsMu.Lock()
+	defer a.probeResultsMu.Unlock()
+	for _, r := range a.probeResults {
+		if r.Name == name {
+			return r.Satisfied
+		}
+	}
+	return false
+}
+
+func (a *HostAgent) probeResultsSnapshot() []events.ProbeResult {
+	a.probeResultsMu.Lock()
+	defer a.probeResultsMu.Unlock()
+	return append([]events.ProbeResult(nil), a.probeResults...)
+}
+
 func (a *HostAgent) finalRequirements() []requirement {
 	req := make([]requirement, 0)
 	req = append(req,
@@ -221,5 +460,37 @@ finish before the instance is considered "ready".
 Check "/var/log/cloud-init-output.log" in the guest to see where the process is blocked!
 `,
 		})
+	req = append(req, a.probeRequirements(limayaml.ProbePhaseFinal)...)
+	if a.y.GuestReadyFile.Path != "" {
+		req = append(req, a.guestReadyFileRequirement())
+	}
 	return req
 }
+
+// guestReadyFileRequirement waits for `guestReadyFile.path` until `guestReadyFile.timeout`.
+// The requirement is fatal, as the script already waits until the timeout.
+func (a *HostAgent) guestReadyFileRequirement() requirement {
+	f := a.y.GuestReadyFile
+	// The timeout has been validated by limayaml.Validate
+	timeout, _ := time.ParseDuration(*f.Timeout)
+	seconds := int(math.Ceil(timeout.Seconds()))
+	return requirement{
+		description: fmt.Sprintf("guest ready file %q must exist", f.Path),
+		fatal:       true,
+		script: fmt.Sprintf(`#!/bin/bash
+set -eux -o pipefail
+deadline=$((SECONDS + %d))
+until sudo test -e %s; do
+	if [ "$SECONDS" -ge "$deadline" ]; then
+		echo >&2 "the guest ready file has not been created"
+		exit 1
+	fi
+	sleep 3
+done
+`, seconds, shellescape.Quote(f.Path)),
+		debugHint: fmt.Sprintf(`The guest ready file %q has not been created within %s.
+The file is expected to be created by the image, e.g., at the end of its provisioning.
+Check "/var/log/cloud-init-output.log" in the guest.
+`, f.Path, *f.Timeout),
+	}
+}
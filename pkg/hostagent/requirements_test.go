@@ -0,0 +1,54 @@
+package hostagent
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestGroupRequirements(t *testing.T) {
+	reqs := []requirement{
+		{description: "ssh"},
+		{description: "systemd", fatal: true},
+		{description: "probe 1", concurrent: true},
+		{description: "probe 2", concurrent: true},
+		{description: "fatal probe", concurrent: true, fatal: true},
+		{description: "probe 3", concurrent: true},
+		{description: "boot scripts"},
+		{description: "probe 4", concurrent: true},
+	}
+	assert.DeepEqual(t, groupRequirements(reqs), [][]int{{0}, {1}, {2, 3}, {4}, {5}, {6}, {7}})
+	assert.Assert(t, groupRequirements(nil) == nil)
+}
+
+func TestCheckExitCode(t *testing.T) {
+	exitWith := func(code string) error {
+		return exec.Command("sh", "-c", "exit "+code).Run()
+	}
+	assert.NilError(t, checkExitCode(nil, 0))
+	assert.ErrorContains(t, checkExitCode(exitWith("1"), 0), "exit status 1")
+	assert.NilError(t, checkExitCode(exitWith("3"), 3))
+	assert.ErrorContains(t, checkExitCode(exitWith("1"), 3), "exit status 1")
+	assert.Error(t, checkExitCode(nil, 3), "exited with 0, expected 3")
+	assert.ErrorContains(t, checkExitCode(errors.New("ssh failed"), 3), "ssh failed")
+}
+
+func TestProbeResults(t *testing.T) {
+	a := &HostAgent{probeResults: newProbeResults([]limayaml.Probe{
+		{Name: "a", Description: "probe a", Phase: limayaml.ProbePhaseEssential},
+		{Description: "probe b", Phase: limayaml.ProbePhaseOptional},
+	})}
+	assert.Assert(t, !a.probeSatisfied("a"))
+	a.recordProbeResult(0, nil)
+	a.recordProbeResult(1, errors.New("failed"))
+	assert.Assert(t, a.probeSatisfied("a"))
+	assert.Assert(t, !a.probeSatisfied("b"))
+	assert.DeepEqual(t, a.probeResultsSnapshot(), []events.ProbeResult{
+		{Name: "a", Description: "probe a", Phase: "essential", Satisfied: true},
+		{Description: "probe b", Phase: "optional", Error: "failed"},
+	})
+}
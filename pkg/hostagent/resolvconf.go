@@ -0,0 +1,88 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+const resolvConfCheckInterval = time.Minute
+
+// checkResolvConfScript prints the nameservers from cidata that are missing from the guest
+// DNS configuration.
+const checkResolvConfScript = `#!/bin/sh
+set -eu
+eval "$(sudo grep -E '^LIMA_CIDATA_DNS_ADDRESSES=' /mnt/lima-cidata/lima.env)"
+for ns in ${LIMA_CIDATA_DNS_ADDRESSES}; do
+	if grep -q "^nameserver ${ns}\$" /etc/resolv.conf 2>/dev/null; then
+		continue
+	fi
+	if command -v resolvectl >/dev/null 2>&1 && resolvectl dns 2>/dev/null | grep -qwF "${ns}"; then
+		continue
+	fi
+	echo "${ns}"
+done
+`
+
+// applyResolvConfScript runs the boot script that appends the nameservers, with the cidata environment.
+const applyResolvConfScript = `#!/bin/sh
+set -eu
+sudo sh -c 'while read -r line; do export "$line"; done </mnt/lima-cidata/lima.env; /mnt/lima-cidata/boot/09-resolv-conf.sh'
+`
+
+// missingNameservers returns the nameservers configured by Lima that are missing from the guest.
+func (a *HostAgent) missingNameservers() ([]string, error) {
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, checkResolvConfScript, "checking the nameservers in resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return strings.Fields(stdout), nil
+}
+
+// watchResolvConf periodically checks that the nameservers configured by Lima are present in the guest.
+// With `hostResolver.resolvConfMode: append`, the nameservers are appended again when they have been removed.
+// A warning is emitted when the nameservers are missing, e.g., because the guest network manager
+// has overwritten resolv.conf.
+func (a *HostAgent) watchResolvConf(ctx context.Context) {
+	mode := *a.y.HostResolver.ResolvConfMode
+	if *a.y.VMType == limayaml.WSL2 || mode == limayaml.ResolvConfUnmanaged {
+		return
+	}
+	var warned bool
+	ticker := time.NewTicker(resolvConfCheckInterval)
+	defer ticker.Stop()
+	for {
+		missing, err := a.missingNameservers()
+		if err == nil && len(missing) > 0 && mode == limayaml.ResolvConfAppend {
+			logrus.Infof("Appending the nameservers %v to the guest DNS configuration", missing)
+			stdout, stderr, applyErr := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, applyResolvConfScript, "appending the nameservers")
+			if applyErr != nil {
+				logrus.WithError(applyErr).Warnf("failed to append the nameservers: stdout=%q, stderr=%q", stdout, stderr)
+			}
+			missing, err = a.missingNameservers()
+		}
+		switch {
+		case err != nil:
+			logrus.WithError(err).Debug("failed to check the nameservers in resolv.conf")
+		case len(missing) == 0:
+			warned = false
+		case !warned:
+			msg := fmt.Sprintf("the nameservers %v are missing from the guest DNS configuration (hostResolver.resolvConfMode=%q), "+
+				"the guest network manager may have overwritten resolv.conf", missing, mode)
+			logrus.Warn(msg)
+			a.emitEvent(ctx, events.Event{Warnings: []string{msg}})
+			warned = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
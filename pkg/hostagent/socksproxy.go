@@ -0,0 +1,52 @@
+package hostagent
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// forwardSOCKSProxy sets up or cancels the dynamic forward of `portForwarding.socksProxy` on the SSH
+// control master. sshd in the guest makes the connections, so the guest-only addresses are reachable.
+func forwardSOCKSProxy(ctx context.Context, sshConfig *ssh.SSHConfig, port, outputLimit int, local, verb string) error {
+	args := sshConfig.Args()
+	args = append(args,
+		"-T",
+		"-O", verb,
+		"-D", local,
+		"-N",
+		"-f",
+		"-p", strconv.Itoa(port),
+		"127.0.0.1",
+		"--",
+	)
+	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
+	_, err := runWithLimitedOutput(cmd, outputLimit)
+	return err
+}
+
+// startSOCKSProxy starts the SOCKS5 proxy of `portForwarding.socksProxy`, if enabled.
+// A failure is not fatal, as the other forwards still work.
+func (a *HostAgent) startSOCKSProxy(ctx context.Context) {
+	local := *a.y.PortForwarding.SOCKSProxy
+	if local == "" {
+		return
+	}
+	logrus.Infof("Starting the SOCKS5 proxy into the guest network on %s", local)
+	if err := forwardSOCKSProxy(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, verbForward); err != nil {
+		logrus.WithError(err).Warnf("Failed to start the SOCKS5 proxy on %s", local)
+	}
+}
+
+// stopSOCKSProxy stops the SOCKS5 proxy started by startSOCKSProxy.
+func (a *HostAgent) stopSOCKSProxy(ctx context.Context) error {
+	local := *a.y.PortForwarding.SOCKSProxy
+	if local == "" {
+		return nil
+	}
+	logrus.Infof("Stopping the SOCKS5 proxy on %s", local)
+	return forwardSOCKSProxy(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, verbCancel)
+}
@@ -0,0 +1,58 @@
+package hostagent
+
+import (
+	"context"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// sshAddressInitialInterval and sshAddressMaxInterval are variables, to be shortened in the tests.
+var (
+	sshAddressInitialInterval = 500 * time.Millisecond
+	sshAddressMaxInterval     = 5 * time.Second
+)
+
+// resolveSSHAddress resolves the SSH address of a WSL2 instance, retrying until `ssh.addressTimeout`
+// as the WSL2 network may not be ready right after start.
+func (a *HostAgent) resolveSSHAddress(ctx context.Context) (string, error) {
+	return retrySSHAddress(ctx, a.sshAddressTimeout, func() (string, error) {
+		return store.GetSSHAddress(a.instName)
+	}, func(attempt int, err error) {
+		logrus.WithError(err).Infof("Waiting for the SSH address of the instance (attempt %d)", attempt)
+		a.emitEvent(ctx, events.Event{
+			SSHAddressResolution: &events.SSHAddressResolution{
+				Attempt: attempt,
+				Error:   err.Error(),
+			},
+		})
+	})
+}
+
+// retrySSHAddress calls resolve with an exponential backoff until it succeeds or timeout has elapsed.
+// onRetry is called after each failed attempt that is going to be retried.
+func retrySSHAddress(ctx context.Context, timeout time.Duration, resolve func() (string, error), onRetry func(attempt int, err error)) (string, error) {
+	deadline := time.Now().Add(timeout)
+	interval := sshAddressInitialInterval
+	for attempt := 1; ; attempt++ {
+		addr, err := resolve()
+		if err == nil {
+			return addr, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return "", err
+		}
+		onRetry(attempt, err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > sshAddressMaxInterval {
+			interval = sshAddressMaxInterval
+		}
+	}
+}
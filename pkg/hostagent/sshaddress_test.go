@@ -0,0 +1,71 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func shortenSSHAddressInterval(t *testing.T) {
+	t.Helper()
+	initial, maxInterval := sshAddressInitialInterval, sshAddressMaxInterval
+	sshAddressInitialInterval, sshAddressMaxInterval = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() {
+		sshAddressInitialInterval, sshAddressMaxInterval = initial, maxInterval
+	})
+}
+
+func TestRetrySSHAddress(t *testing.T) {
+	shortenSSHAddressInterval(t)
+	errNotReady := errors.New("not ready")
+
+	t.Run("eventually succeeds", func(t *testing.T) {
+		calls := 0
+		var retried []int
+		addr, err := retrySSHAddress(context.Background(), time.Second, func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", errNotReady
+			}
+			return "172.20.0.2", nil
+		}, func(attempt int, err error) {
+			assert.ErrorIs(t, err, errNotReady)
+			retried = append(retried, attempt)
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, addr, "172.20.0.2")
+		assert.DeepEqual(t, retried, []int{1, 2})
+	})
+
+	t.Run("zero timeout means a single attempt", func(t *testing.T) {
+		calls := 0
+		_, err := retrySSHAddress(context.Background(), 0, func() (string, error) {
+			calls++
+			return "", errNotReady
+		}, func(int, error) {
+			t.Fatal("must not retry")
+		})
+		assert.ErrorIs(t, err, errNotReady)
+		assert.Equal(t, calls, 1)
+	})
+
+	t.Run("gives up after the timeout", func(t *testing.T) {
+		_, err := retrySSHAddress(context.Background(), 20*time.Millisecond, func() (string, error) {
+			return "", errNotReady
+		}, func(int, error) {})
+		assert.ErrorIs(t, err, errNotReady)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := retrySSHAddress(ctx, time.Second, func() (string, error) {
+			return "", errNotReady
+		}, func(int, error) {
+			cancel()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
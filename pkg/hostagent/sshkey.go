@@ -0,0 +1,127 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// withInstanceKeyOpt prepends the IdentityFile option for the SSH key of the instance, if missing, so that the
+// SSH connections of the host agent keep working after rotating the SSH key for the first time.
+// ssh skips the identity files that do not exist.
+func withInstanceKeyOpt(instDir string, opts []string) []string {
+	opt := sshutil.InstanceKeyOpt(instDir)
+	if slices.Contains(opts, opt) {
+		return opts
+	}
+	return append([]string{opt}, opts...)
+}
+
+// authorizeSSHKeyScript adds the public key to the authorized keys of the SSH user, unless already added.
+func authorizeSSHKeyScript(pubKey string) string {
+	return fmt.Sprintf(`#!/bin/sh
+set -eu
+mkdir -p ~/.ssh
+chmod 700 ~/.ssh
+touch ~/.ssh/authorized_keys
+chmod 600 ~/.ssh/authorized_keys
+grep -qxF -- %[1]s ~/.ssh/authorized_keys || echo %[1]s >>~/.ssh/authorized_keys
+`, shellescape.Quote(pubKey))
+}
+
+// revokeSSHKeyScript removes the public key from the authorized keys of the SSH user.
+func revokeSSHKeyScript(pubKey string) string {
+	return fmt.Sprintf(`#!/bin/sh
+set -eu
+f=~/.ssh/authorized_keys
+tmp="$(mktemp "$f.XXXXXX")"
+grep -vxF -- %s "$f" >"$tmp" || [ $? -eq 1 ]
+chmod 600 "$tmp"
+mv -f "$tmp" "$f"
+`, shellescape.Quote(pubKey))
+}
+
+// RotateSSHKey replaces the SSH key of the instance, $LIMA_HOME/<INSTANCE>/ssh.key, with a new key.
+// The new public key is authorized in the guest over the existing connection before the private key is
+// replaced on the host, and the old public key is revoked afterwards. The old key is
+// $LIMA_HOME/_config/user on the first rotation, in which case ssh.config is rewritten to use the new key.
+func (a *HostAgent) RotateSSHKey(ctx context.Context) error {
+	a.sshKeyMu.Lock()
+	defer a.sshKeyMu.Unlock()
+	oldPubKey, err := sshutil.InstancePubKey(a.instDir)
+	if err != nil {
+		return err
+	}
+	firstRotation := oldPubKey == nil
+	if firstRotation {
+		pubKeys, err := sshutil.DefaultPubKeys(false)
+		if err != nil {
+			return err
+		}
+		oldPubKey = &pubKeys[0]
+	}
+
+	tmpDir, err := os.MkdirTemp(a.instDir, ".ssh-key-tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpKey := filepath.Join(tmpDir, filenames.SSHKey)
+	keygenCmd := exec.CommandContext(ctx, "ssh-keygen", "-t", "ed25519", "-q", "-N", "", "-C", "lima-"+a.instName, "-f", tmpKey)
+	logrus.Debugf("executing %v", keygenCmd.Args)
+	if out, err := keygenCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %v: %q: %w", keygenCmd.Args, string(out), err)
+	}
+	b, err := os.ReadFile(tmpKey + ".pub")
+	if err != nil {
+		return err
+	}
+	newPubKey := strings.TrimSpace(string(b))
+
+	// The provision user has its own authorized keys, when it differs from the runtime user
+	sshConfigs := []*ssh.SSHConfig{a.sshConfig}
+	if a.provisionSSHConfig != a.sshConfig {
+		sshConfigs = append(sshConfigs, a.provisionSSHConfig)
+	}
+	for _, c := range sshConfigs {
+		if stdout, stderr, err := executeScript(ctx, a.instSSHAddress, a.sshLocalPort, c, authorizeSSHKeyScript(newPubKey), "authorizing the new SSH key"); err != nil {
+			return fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+		}
+	}
+
+	// The SSH connections use the new key from here on, as each rename is atomic
+	keyFile := filepath.Join(a.instDir, filenames.SSHKey)
+	if err := os.Rename(tmpKey, keyFile); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpKey+".pub", filepath.Join(a.instDir, filenames.SSHPublicKey)); err != nil {
+		return err
+	}
+	if firstRotation {
+		a.sshOptsMu.Lock()
+		a.sshOpts = withInstanceKeyOpt(a.instDir, a.sshOpts)
+		_, err := writeSSHConfigFile(a.instName, a.instDir, a.instSSHAddress, a.sshLocalPort, a.sshOpts, a.hostFileUmask)
+		a.sshOptsMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to rewrite %q: %w", filenames.SSHConfig, err)
+		}
+	}
+
+	for _, c := range sshConfigs {
+		if stdout, stderr, err := executeScript(ctx, a.instSSHAddress, a.sshLocalPort, c, revokeSSHKeyScript(oldPubKey.Content), "revoking the old SSH key"); err != nil {
+			return fmt.Errorf("failed to revoke the old SSH key %q: stdout=%q, stderr=%q: %w", oldPubKey.Filename, stdout, stderr, err)
+		}
+	}
+	logrus.Infof("Rotated the SSH key %q", keyFile)
+	return nil
+}
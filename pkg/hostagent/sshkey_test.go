@@ -0,0 +1,19 @@
+package hostagent
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestWithInstanceKeyOpt(t *testing.T) {
+	instDir := t.TempDir()
+	opt := sshutil.InstanceKeyOpt(instDir)
+	opts := []string{`IdentityFile="/home/user/.lima/_config/user"`, "BatchMode=yes"}
+
+	got := withInstanceKeyOpt(instDir, opts)
+	assert.DeepEqual(t, got, append([]string{opt}, opts...))
+	// The option is not added twice
+	assert.DeepEqual(t, withInstanceKeyOpt(instDir, got), got)
+}
@@ -0,0 +1,226 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sshMasterCheckInterval = 30 * time.Second
+	sshMasterCheckTimeout  = 10 * time.Second
+)
+
+var sshMasterPIDRegexp = regexp.MustCompile(`pid=(\d+)`)
+
+// checkSSHMaster runs `ssh -O check` and returns the PID of the SSH control master.
+func checkSSHMaster(ctx context.Context, host string, port int, sshConfig *ssh.SSHConfig) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, sshMasterCheckTimeout)
+	defer cancel()
+	args := sshConfig.Args()
+	args = append(args,
+		"-O", "check",
+		"-p", strconv.Itoa(port),
+		host,
+	)
+	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
+	// `ssh -O check` prints "Master running (pid=N)" to stderr
+	out, err := cmd.CombinedOutput()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, fmt.Errorf("`ssh -O check` did not return in %v: %w", sshMasterCheckTimeout, ctxErr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+	}
+	m := sshMasterPIDRegexp.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("unexpected output from %v: %q", cmd.Args, string(out))
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+// sshMasterRecoveryAction returns whether the SSH master has to be recreated after `ssh -O check`
+// failed with err, and the PID of the master to kill first, or 0.
+// A wedged master is killed. A master that has exited is recreated only when it had been running,
+// or when the previous recovery failed, so that the forwards that have been lost along with it
+// are set up again. Otherwise, ControlMaster=auto starts a new master on the next SSH invocation.
+func sshMasterRecoveryAction(err error, masterPID int, recoveryPending bool) (bool, int) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return true, masterPID
+	case masterPID != 0 || recoveryPending:
+		return true, 0
+	default:
+		return false, 0
+	}
+}
+
+// watchSSHMaster periodically checks that the SSH control master is servicing requests,
+// and recreates it along with the forwards when it is alive but does not respond, or when it has exited.
+func (a *HostAgent) watchSSHMaster(ctx context.Context) {
+	var (
+		masterPID       int
+		recoveryPending bool
+	)
+	ticker := time.NewTicker(sshMasterCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// The SSH master cannot be recovered while the VM is paused by `hostAgent.idleSuspend`
+		if a.suspended() {
+			continue
+		}
+		pid, err := checkSSHMaster(ctx, a.instSSHAddress, a.sshLocalPort, a.sshConfig)
+		if err == nil {
+			masterPID = pid
+			a.sshMasterPID.Store(int64(pid))
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if a.suspended() {
+			continue
+		}
+		recreate, killPID := sshMasterRecoveryAction(err, masterPID, recoveryPending)
+		if !recreate {
+			logrus.WithError(err).Debug("SSH master is not running")
+			continue
+		}
+		exited := !errors.Is(err, context.DeadlineExceeded)
+		if !exited {
+			logrus.WithError(err).Warn("SSH master seems wedged, recreating it")
+		} else {
+			logrus.WithError(err).Warn("SSH master has exited, recreating it")
+		}
+		recoverErr := a.recoverSSHMaster(ctx, killPID)
+		if recoverErr != nil {
+			logrus.WithError(recoverErr).Error("failed to recreate the SSH master")
+		} else {
+			logrus.Info("Recreated the SSH master")
+		}
+		// The failed retries are not reported again, e.g., while the guest is rebooting
+		if !recoveryPending || recoverErr == nil {
+			a.stats.recordSSHMasterRecovery()
+			ev := events.Event{
+				SSHMasterRecovery: &events.SSHMasterRecovery{
+					PreviousPID: masterPID,
+					Exited:      exited,
+					Reason:      err.Error(),
+				},
+			}
+			if recoverErr != nil {
+				ev.SSHMasterRecovery.Error = recoverErr.Error()
+			}
+			a.emitEvent(ctx, ev)
+		}
+		recoveryPending = recoverErr != nil
+		masterPID = 0
+		a.sshMasterPID.Store(0)
+	}
+}
+
+// exitSSHMaster runs `ssh -O exit`, and kills the SSH master when it does not exit within
+// `ssh.exitMasterTimeout`, so that a wedged master cannot hang the shutdown.
+func (a *HostAgent) exitSSHMaster() {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ssh.ExitMaster(a.instSSHAddress, a.sshLocalPort, a.sshConfig)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			logrus.WithError(err).Warn("failed to exit SSH master")
+		}
+		return
+	case <-time.After(a.sshExitMasterTimeout):
+	}
+	pid := int(a.sshMasterPID.Load())
+	if pid == 0 {
+		// `ssh -O check` may hang as well, but it has its own timeout
+		if checkedPID, err := checkSSHMaster(context.Background(), a.instSSHAddress, a.sshLocalPort, a.sshConfig); err == nil {
+			pid = checkedPID
+		}
+	}
+	logrus.Warnf("SSH master did not exit in %v, killing it (pid=%d)", a.sshExitMasterTimeout, pid)
+	ev := events.Event{
+		SSHMasterTermination: &events.SSHMasterTermination{
+			PID:     pid,
+			Timeout: a.sshExitMasterTimeout,
+		},
+	}
+	err := killSSHMaster(pid)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to kill the SSH master")
+		ev.SSHMasterTermination.Error = err.Error()
+	}
+	a.emitEvent(context.Background(), ev)
+}
+
+func killSSHMaster(pid int) error {
+	if pid == 0 {
+		return errors.New("the PID of the SSH master is unknown")
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
+
+// recoverSSHMaster kills the SSH control master, starts a new one, and re-establishes the
+// unix socket forwards and the active TCP forwards. The guest agent socket is re-established by
+// watchGuestAgentEvents, once it reconnects to the guest agent.
+func (a *HostAgent) recoverSSHMaster(ctx context.Context, masterPID int) error {
+	if masterPID != 0 {
+		if proc, err := os.FindProcess(masterPID); err == nil {
+			if err := proc.Kill(); err != nil {
+				logrus.WithError(err).Warnf("failed to kill the SSH master (pid=%d)", masterPID)
+			}
+		}
+	}
+	if err := os.RemoveAll(a.sshControlSock); err != nil {
+		return err
+	}
+	// The first SSH session after removing the control socket starts a new master
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, "#!/bin/sh\ntrue\n", "starting a new SSH master")
+	if err != nil {
+		return fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	if *a.y.VMType == limayaml.WSL2 || a.portForwardsDryRun {
+		return nil
+	}
+	a.portForwarder.reforward(ctx)
+	a.startSOCKSProxy(ctx)
+	var errs []error
+	for _, rule := range a.portForwarder.currentRules() {
+		if rule.GuestSocket != "" {
+			local := hostAddress(rule, guestagentapi.IPPort{})
+			if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, rule.GuestSocket, verbForward, rule.Reverse); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if isReverseTCPRule(rule) {
+			local, remote := reverseTCPAddresses(rule)
+			if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, local, remote, verbForward, true); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSSHMasterRecoveryAction(t *testing.T) {
+	wedged := fmt.Errorf("`ssh -O check` did not return: %w", context.DeadlineExceeded)
+	exited := errors.New("Control socket connect: No such file or directory")
+	testCases := []struct {
+		name            string
+		err             error
+		masterPID       int
+		recoveryPending bool
+		recreate        bool
+		killPID         int
+	}{
+		{name: "wedged", err: wedged, masterPID: 42, recreate: true, killPID: 42},
+		{name: "wedged, unknown PID", err: wedged, recreate: true},
+		{name: "exited", err: exited, masterPID: 42, recreate: true},
+		{name: "never started", err: exited},
+		{name: "recovery pending", err: exited, recoveryPending: true, recreate: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recreate, killPID := sshMasterRecoveryAction(tc.err, tc.masterPID, tc.recoveryPending)
+			assert.Equal(t, recreate, tc.recreate)
+			assert.Equal(t, killPID, tc.killPID)
+		})
+	}
+}
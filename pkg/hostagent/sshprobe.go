@@ -0,0 +1,109 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sshProbeInterval = 30 * time.Second
+	sshProbeTimeout  = 10 * time.Second
+)
+
+// sshProbeState counts the consecutive failed SSH health probes.
+type sshProbeState struct {
+	threshold int
+	failures  int
+	lost      bool
+}
+
+// record records the result of a probe. lost is true when the failures have just reached the
+// threshold, and restored is true when a probe has succeeded after the connectivity was lost.
+func (s *sshProbeState) record(err error) (lost, restored bool) {
+	if err == nil {
+		restored = s.lost
+		s.failures = 0
+		s.lost = false
+		return false, restored
+	}
+	s.failures++
+	if !s.lost && s.failures >= s.threshold {
+		s.lost = true
+		return true, false
+	}
+	return false, false
+}
+
+// watchSSHConnectivity periodically runs a command over SSH, and applies `ssh.onConnectivityLoss`
+// after `ssh.probeFailureThreshold` consecutive failures.
+func (a *HostAgent) watchSSHConnectivity(ctx context.Context) {
+	threshold := *a.y.SSH.ProbeFailureThreshold
+	if threshold == 0 {
+		return
+	}
+	state := sshProbeState{threshold: threshold}
+	ticker := time.NewTicker(sshProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.suspended() {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, sshProbeTimeout)
+		err := executeSSH(probeCtx, a.sshConfig, a.sshLocalPort, a.sshOutputLimit, "true")
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("SSH health probe failed (%d consecutive failures)", state.failures+1)
+		}
+		lost, restored := state.record(err)
+		switch {
+		case lost:
+			a.onSSHConnectivityLoss(ctx, state.failures, err)
+		case restored:
+			logrus.Info("SSH connectivity has been restored")
+			a.emitEvent(ctx, events.Event{SSHConnectivity: &events.SSHConnectivity{}})
+		}
+	}
+}
+
+// onSSHConnectivityLoss applies `ssh.onConnectivityLoss`.
+func (a *HostAgent) onSSHConnectivityLoss(ctx context.Context, failures int, err error) {
+	action := *a.y.SSH.OnConnectivityLoss
+	msg := fmt.Sprintf("SSH connectivity lost after %d failed health probes: %v", failures, err)
+	logrus.Error(msg)
+	a.emitEvent(ctx, events.Event{
+		SSHConnectivity: &events.SSHConnectivity{
+			Lost:     true,
+			Failures: failures,
+			Action:   action,
+			Error:    err.Error(),
+		},
+	})
+	a.reportDegraded(ctx, msg)
+	switch action {
+	case limayaml.SSHConnectivityLossRecover:
+		if recoverErr := a.recoverSSHMaster(ctx, 0); recoverErr != nil {
+			logrus.WithError(recoverErr).Error("failed to recreate the SSH master")
+		} else {
+			logrus.Info("Recreated the SSH master")
+		}
+	case limayaml.SSHConnectivityLossStop:
+		logrus.Info("Stopping the instance, as `ssh.onConnectivityLoss` is \"stop\"")
+		select {
+		case a.stopCh <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSSHProbeState(t *testing.T) {
+	errProbe := errors.New("connection timed out")
+	s := sshProbeState{threshold: 3}
+
+	type result struct{ lost, restored bool }
+	record := func(err error) result {
+		lost, restored := s.record(err)
+		return result{lost, restored}
+	}
+	assert.Equal(t, record(errProbe), result{})
+	assert.Equal(t, record(nil), result{})
+	assert.Equal(t, record(errProbe), result{})
+	assert.Equal(t, record(errProbe), result{})
+	assert.Equal(t, record(errProbe), result{lost: true})
+	// The loss is only reported once
+	assert.Equal(t, record(errProbe), result{})
+	assert.Equal(t, s.failures, 4)
+	assert.Equal(t, record(nil), result{restored: true})
+	assert.Equal(t, record(nil), result{})
+	assert.Equal(t, s.failures, 0)
+}
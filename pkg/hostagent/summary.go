@@ -0,0 +1,100 @@
+package hostagent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+const (
+	stopReasonSignal        = "signal"
+	stopReasonDriverStopped = "driverStopped"
+	stopReasonError         = "error"
+	// stopReasonSSHConnectivityLoss is recorded when stopped by `ssh.onConnectivityLoss`
+	stopReasonSSHConnectivityLoss = "sshConnectivityLoss"
+	// stopReasonAPI is recorded when stopped by the shutdown request of the host agent API
+	stopReasonAPI = "api"
+)
+
+// shutdownStats collects the statistics of the run, for the ShutdownSummary event.
+type shutdownStats struct {
+	start                 time.Time
+	portForwards          int
+	portForwardFailures   int
+	guestAgentConnections int
+	sshMasterRecoveries   int
+	dnsCacheHits          uint64
+	dnsCacheMisses        uint64
+	stopReason            string
+	teardownErrs          []string
+	mu                    sync.Mutex
+}
+
+func (s *shutdownStats) recordPortForward() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portForwards++
+}
+
+func (s *shutdownStats) recordPortForwardFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portForwardFailures++
+}
+
+func (s *shutdownStats) recordGuestAgentConnection() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guestAgentConnections++
+}
+
+func (s *shutdownStats) recordSSHMasterRecovery() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sshMasterRecoveries++
+}
+
+// recordDNSCache records the numbers of the cache hits and misses of the DNS server.
+func (s *shutdownStats) recordDNSCache(hits, misses uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dnsCacheHits = hits
+	s.dnsCacheMisses = misses
+}
+
+// recordStop records the reason of the stop, and the errors during the teardown.
+func (s *shutdownStats) recordStop(reason string, errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopReason = reason
+	for _, err := range errs {
+		if err != nil {
+			s.teardownErrs = append(s.teardownErrs, err.Error())
+		}
+	}
+}
+
+func (s *shutdownStats) summary() *events.ShutdownSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := &events.ShutdownSummary{
+		PortForwards:        s.portForwards,
+		SSHMasterRecoveries: s.sshMasterRecoveries,
+		DNSCacheHits:        s.dnsCacheHits,
+		DNSCacheMisses:      s.dnsCacheMisses,
+		Reason:              s.stopReason,
+		Graceful:            s.stopReason == stopReasonSignal || s.stopReason == stopReasonAPI,
+		TeardownErrors:      s.teardownErrs,
+	}
+	if !s.start.IsZero() {
+		summary.Uptime = time.Since(s.start)
+	}
+	if s.guestAgentConnections > 1 {
+		summary.GuestAgentReconnects = s.guestAgentConnections - 1
+	}
+	if summary.Reason == "" {
+		summary.Reason = stopReasonError
+	}
+	return summary
+}
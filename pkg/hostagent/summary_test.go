@@ -0,0 +1,40 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestShutdownStats(t *testing.T) {
+	var s shutdownStats
+	summary := s.summary()
+	assert.Equal(t, summary.Reason, stopReasonError)
+	assert.Equal(t, summary.Graceful, false)
+	assert.Equal(t, summary.Uptime, time.Duration(0))
+
+	s = shutdownStats{start: time.Now().Add(-time.Minute)}
+	s.recordPortForward()
+	s.recordPortForward()
+	s.recordGuestAgentConnection()
+	s.recordGuestAgentConnection()
+	s.recordGuestAgentConnection()
+	s.recordSSHMasterRecovery()
+	s.recordStop(stopReasonSignal, nil, errors.New("failed to stop"))
+	summary = s.summary()
+	assert.Assert(t, summary.Uptime >= time.Minute)
+	assert.Equal(t, summary.PortForwards, 2)
+	assert.Equal(t, summary.GuestAgentReconnects, 2)
+	assert.Equal(t, summary.SSHMasterRecoveries, 1)
+	assert.Equal(t, summary.Reason, stopReasonSignal)
+	assert.Equal(t, summary.Graceful, true)
+	assert.DeepEqual(t, summary.TeardownErrors, []string{"failed to stop"})
+
+	s.recordStop(stopReasonDriverStopped)
+	assert.Equal(t, s.summary().Graceful, false)
+
+	s.recordStop(stopReasonAPI)
+	assert.Equal(t, s.summary().Graceful, true)
+}
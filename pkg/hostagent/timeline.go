@@ -0,0 +1,60 @@
+package hostagent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// timeline collects the durations of the startup phases, for the Timeline event.
+// All the methods are no-op on a nil timeline.
+type timeline struct {
+	start        time.Time
+	phases       []events.TimelinePhase
+	firstForward bool
+	mu           sync.Mutex
+}
+
+func newTimeline() *timeline {
+	return &timeline{start: time.Now()}
+}
+
+// record records the phase that started at start and has just finished.
+func (t *timeline) record(name string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, events.TimelinePhase{
+		Name:     name,
+		Start:    start.Sub(t.start),
+		Duration: time.Since(start),
+	})
+}
+
+// recordFirstForward records the time until the first port forward, once.
+func (t *timeline) recordFirstForward() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	first := !t.firstForward
+	t.firstForward = true
+	t.mu.Unlock()
+	if first {
+		t.record("firstPortForward", t.start)
+	}
+}
+
+func (t *timeline) event() *events.Timeline {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &events.Timeline{
+		Phases: append([]events.TimelinePhase(nil), t.phases...),
+	}
+}
@@ -0,0 +1,43 @@
+package hostagent
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTimeline(t *testing.T) {
+	tl := newTimeline()
+	tl.start = time.Now().Add(-time.Minute)
+
+	tl.record("driverStart", tl.start)
+	sshStart := tl.start.Add(10 * time.Second)
+	tl.record("sshReady", sshStart)
+	tl.recordFirstForward()
+	tl.recordFirstForward()
+
+	ev := tl.event()
+	assert.Equal(t, len(ev.Phases), 3)
+	for i, name := range []string{"driverStart", "sshReady", "firstPortForward"} {
+		assert.Equal(t, ev.Phases[i].Name, name)
+	}
+	assert.Equal(t, ev.Phases[0].Start, time.Duration(0))
+	assert.Assert(t, ev.Phases[0].Duration >= time.Minute)
+	assert.Equal(t, ev.Phases[1].Start, 10*time.Second)
+	assert.Assert(t, ev.Phases[1].Duration >= 50*time.Second)
+	// The first port forward is measured from the start of the host agent
+	assert.Equal(t, ev.Phases[2].Start, time.Duration(0))
+
+	// The event is a copy
+	ev.Phases[0].Name = "modified"
+	assert.Equal(t, tl.event().Phases[0].Name, "driverStart")
+}
+
+func TestTimelineNil(t *testing.T) {
+	// The timeline is nil when hostAgent.startupTimeline is disabled
+	var tl *timeline
+	tl.record("driverStart", time.Now())
+	tl.recordFirstForward()
+	assert.Assert(t, tl.event() == nil)
+}
@@ -0,0 +1,88 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// invalidVNCDisplayError is returned when `video.vnc.display` cannot be parsed.
+type invalidVNCDisplayError struct {
+	display string
+	err     error
+}
+
+func (e *invalidVNCDisplayError) Error() string {
+	return fmt.Sprintf("field `video.vnc.display` %q is invalid: %v", e.display, e.err)
+}
+
+func (e *invalidVNCDisplayError) Unwrap() error {
+	return e.err
+}
+
+// parseVNCDisplay parses the VNC display "host:d[,options]".
+func parseVNCDisplay(display string) (vncdisplay, vnchost, vncnum, vncoptions string, err error) {
+	vncdisplay, vncoptions, _ = strings.Cut(display, ",")
+	vnchost, vncnum, err = net.SplitHostPort(vncdisplay)
+	if err != nil {
+		return "", "", "", "", &invalidVNCDisplayError{display: display, err: err}
+	}
+	if _, err := strconv.Atoi(vncnum); err != nil {
+		return "", "", "", "", &invalidVNCDisplayError{display: display, err: err}
+	}
+	return vncdisplay, vnchost, vncnum, vncoptions, nil
+}
+
+// setUpVNC sets the VNC password, and writes the VNC password and display files.
+// An *invalidVNCDisplayError is returned when the display cannot be parsed.
+func (a *HostAgent) setUpVNC(ctx context.Context) error {
+	vncdisplay, vnchost, vncnum, vncoptions, err := parseVNCDisplay(*a.y.Video.VNC.Display)
+	if err != nil {
+		return err
+	}
+	// vncnum has been validated by parseVNCDisplay
+	n, _ := strconv.Atoi(vncnum)
+	vncport := strconv.Itoa(5900 + n)
+	vncpwdfile := filepath.Join(a.instDir, filenames.VNCPasswordFile)
+	vncpasswd, err := generatePassword(a.y.Secrets.VNC)
+	if err != nil {
+		return err
+	}
+	if err := a.driver.ChangeDisplayPassword(ctx, vncpasswd); err != nil {
+		return err
+	}
+	if err := ensureDir(a.instDir, a.hostFileUmask); err != nil {
+		return err
+	}
+	if err := os.WriteFile(vncpwdfile, []byte(vncpasswd), hostFileMode(a.hostFileUmask)); err != nil {
+		return err
+	}
+	if strings.Contains(vncoptions, "to=") {
+		vncport, err = a.driver.GetDisplayConnection(ctx)
+		if err != nil {
+			return err
+		}
+		p, err := strconv.Atoi(vncport)
+		if err != nil {
+			return err
+		}
+		vncnum = strconv.Itoa(p - 5900)
+		vncdisplay = net.JoinHostPort(vnchost, vncnum)
+	}
+	vncfile := filepath.Join(a.instDir, filenames.VNCDisplayFile)
+	if err := os.WriteFile(vncfile, []byte(vncdisplay), hostFileMode(a.hostFileUmask)); err != nil {
+		return err
+	}
+	vncurl := "vnc://" + net.JoinHostPort(vnchost, vncport)
+	logrus.Infof("VNC server running at %s <%s>", vncdisplay, vncurl)
+	logrus.Infof("VNC Display: `%s`", vncfile)
+	logrus.Infof("VNC Password: `%s`", vncpwdfile)
+	return nil
+}
@@ -0,0 +1,24 @@
+package hostagent
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseVNCDisplay(t *testing.T) {
+	vncdisplay, vnchost, vncnum, vncoptions, err := parseVNCDisplay("127.0.0.1:0,to=9")
+	assert.NilError(t, err)
+	assert.Equal(t, vncdisplay, "127.0.0.1:0")
+	assert.Equal(t, vnchost, "127.0.0.1")
+	assert.Equal(t, vncnum, "0")
+	assert.Equal(t, vncoptions, "to=9")
+
+	for _, display := range []string{"127.0.0.1", "unix:/tmp/vnc.sock", "none"} {
+		_, _, _, _, err := parseVNCDisplay(display)
+		var displayErr *invalidVNCDisplayError
+		assert.Assert(t, errors.As(err, &displayErr), display)
+		assert.Equal(t, displayErr.display, display)
+	}
+}
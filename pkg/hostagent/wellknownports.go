@@ -0,0 +1,66 @@
+package hostagent
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// wellKnownHostPorts are the ports of the host services that a forward binding the same host port may disrupt.
+var wellKnownHostPorts = map[int]string{
+	22:   "SSH",
+	53:   "DNS",
+	88:   "Kerberos",
+	111:  "rpcbind",
+	139:  "NetBIOS",
+	445:  "SMB",
+	548:  "AFP",
+	631:  "CUPS",
+	2049: "NFS",
+	3283: "Apple Remote Desktop",
+	5000: "AirPlay Receiver",
+	5353: "mDNS",
+	5900: "VNC (Screen Sharing)",
+	7000: "AirPlay Receiver",
+}
+
+// wellKnownHostService returns the name of the well-known host service of the host address, if any.
+// Unix sockets never match.
+func wellKnownHostService(local string) (int, string, bool) {
+	_, portStr, err := net.SplitHostPort(local)
+	if err != nil {
+		return 0, "", false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, "", false
+	}
+	service, ok := wellKnownHostPorts[port]
+	return port, service, ok
+}
+
+// alternateHostPort suggests a host port that does not collide with a well-known host service.
+func alternateHostPort(port int) int {
+	for alt := port + 10000; alt <= 65535; alt += 10000 {
+		if _, ok := wellKnownHostPorts[alt]; !ok {
+			return alt
+		}
+	}
+	return 0
+}
+
+// warnWellKnownHostPort warns when the host address is the port of a well-known host service.
+// The warning is advisory; the forward is set up anyway.
+func warnWellKnownHostPort(local string) {
+	port, service, ok := wellKnownHostService(local)
+	if !ok {
+		return
+	}
+	if alt := alternateHostPort(port); alt != 0 {
+		logrus.Warnf("forwarding to %s may disrupt the %s service of the host; consider forwarding to host port %d instead, "+
+			"or set `acknowledgeWellKnownPort: true` for the rule", local, service, alt)
+		return
+	}
+	logrus.Warnf("forwarding to %s may disrupt the %s service of the host; set `acknowledgeWellKnownPort: true` for the rule to acknowledge", local, service)
+}
@@ -0,0 +1,29 @@
+package hostagent
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWellKnownHostService(t *testing.T) {
+	port, service, ok := wellKnownHostService("127.0.0.1:631")
+	assert.Assert(t, ok)
+	assert.Equal(t, port, 631)
+	assert.Equal(t, service, "CUPS")
+
+	_, _, ok = wellKnownHostService("[::1]:5353")
+	assert.Assert(t, ok)
+
+	_, _, ok = wellKnownHostService("127.0.0.1:8080")
+	assert.Assert(t, !ok)
+
+	_, _, ok = wellKnownHostService("/tmp/lima/http.sock")
+	assert.Assert(t, !ok)
+}
+
+func TestAlternateHostPort(t *testing.T) {
+	assert.Equal(t, alternateHostPort(631), 10631)
+	assert.Equal(t, alternateHostPort(5353), 15353)
+	assert.Equal(t, alternateHostPort(65000), 0)
+}
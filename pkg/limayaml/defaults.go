@@ -12,6 +12,7 @@ import (
 	"text/template"
 
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/ptr"
 	"github.com/pbnjay/memory"
@@ -35,6 +36,9 @@ const (
 	Default9pCacheForRW      string = "mmap"
 
 	DefaultVirtiofsQueueSize int = 1024
+
+	// DefaultHostFileUmask results in 0600 for files and 0700 for directories created on the host
+	DefaultHostFileUmask string = "077"
 )
 
 func defaultContainerdArchives() []File {
@@ -125,6 +129,10 @@ func defaultGuestInstallPrefix() string {
 //     the highest priority Writable setting wins.
 //   - Networks are appended in d, y, o order
 //   - DNS are picked from the highest priority where DNS is not empty.
+//   - HostResolver SearchDomains are picked from the highest priority where SearchDomains is not empty.
+//   - HostResolver UpstreamServers are picked from the highest priority where UpstreamServers is not empty.
+//   - Host CPUAffinity is picked from the highest priority where CPUAffinity is not empty.
+//   - PortForwarding IncludeFiles are picked from the highest priority where IncludeFiles is not empty.
 //   - CACertificates Files and Certs are uniquely appended in d, y, o order
 func FillDefault(y, d, o *LimaYAML, filePath string) {
 	if y.VMType == nil {
@@ -221,6 +229,21 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.CPUs = ptr.Of(defaultCPUs())
 	}
 
+	if len(y.Host.CPUAffinity) == 0 {
+		y.Host.CPUAffinity = d.Host.CPUAffinity
+	}
+	if len(o.Host.CPUAffinity) > 0 {
+		y.Host.CPUAffinity = o.Host.CPUAffinity
+	}
+
+	y.Host.Prerequisites = append(append(o.Host.Prerequisites, y.Host.Prerequisites...), d.Host.Prerequisites...)
+	for i := range y.Host.Prerequisites {
+		prerequisite := &y.Host.Prerequisites[i]
+		if prerequisite.Description == "" {
+			prerequisite.Description = fmt.Sprintf("host prerequisite %d/%d", i+1, len(y.Host.Prerequisites))
+		}
+	}
+
 	if y.Memory == nil {
 		y.Memory = d.Memory
 	}
@@ -272,6 +295,24 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	if (y.Video.VNC.Display == nil || *y.Video.VNC.Display == "") && *y.VMType == QEMU {
 		y.Video.VNC.Display = ptr.Of("127.0.0.1:0,to=9")
 	}
+	if y.Video.VNC.OnInvalidDisplay == nil {
+		y.Video.VNC.OnInvalidDisplay = d.Video.VNC.OnInvalidDisplay
+	}
+	if o.Video.VNC.OnInvalidDisplay != nil {
+		y.Video.VNC.OnInvalidDisplay = o.Video.VNC.OnInvalidDisplay
+	}
+	if y.Video.VNC.OnInvalidDisplay == nil {
+		y.Video.VNC.OnInvalidDisplay = ptr.Of(VNCInvalidDisplayFail)
+	}
+
+	// The VNC password is limited to 8 characters by the protocol.
+	// Symbols are avoided to make it easier to copy/paste.
+	fillSecretPolicyDefaults(&y.Secrets.VNC, &d.Secrets.VNC, &o.Secrets.VNC, SecretPolicy{
+		Length:  ptr.Of(8),
+		Digits:  ptr.Of(2),
+		Symbols: ptr.Of(0),
+		NoUpper: ptr.Of(false),
+	})
 
 	if y.Firmware.LegacyBIOS == nil {
 		y.Firmware.LegacyBIOS = d.Firmware.LegacyBIOS
@@ -333,6 +374,97 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.SSH.ForwardX11Trusted = ptr.Of(false)
 	}
 
+	if y.SSH.OnX11Unavailable == nil {
+		y.SSH.OnX11Unavailable = d.SSH.OnX11Unavailable
+	}
+	if o.SSH.OnX11Unavailable != nil {
+		y.SSH.OnX11Unavailable = o.SSH.OnX11Unavailable
+	}
+	if y.SSH.OnX11Unavailable == nil {
+		y.SSH.OnX11Unavailable = ptr.Of(X11UnavailableWarn)
+	}
+
+	limaUser, _ := osutil.LimaUser(false)
+	if y.SSH.ProvisionUser == nil {
+		y.SSH.ProvisionUser = d.SSH.ProvisionUser
+	}
+	if o.SSH.ProvisionUser != nil {
+		y.SSH.ProvisionUser = o.SSH.ProvisionUser
+	}
+	if y.SSH.ProvisionUser == nil || *y.SSH.ProvisionUser == "" {
+		y.SSH.ProvisionUser = ptr.Of(limaUser.Username)
+	}
+
+	if y.SSH.RuntimeUser == nil {
+		y.SSH.RuntimeUser = d.SSH.RuntimeUser
+	}
+	if o.SSH.RuntimeUser != nil {
+		y.SSH.RuntimeUser = o.SSH.RuntimeUser
+	}
+	if y.SSH.RuntimeUser == nil || *y.SSH.RuntimeUser == "" {
+		y.SSH.RuntimeUser = ptr.Of(limaUser.Username)
+	}
+
+	if y.SSH.OutputLimit == nil {
+		y.SSH.OutputLimit = d.SSH.OutputLimit
+	}
+	if o.SSH.OutputLimit != nil {
+		y.SSH.OutputLimit = o.SSH.OutputLimit
+	}
+	if y.SSH.OutputLimit == nil {
+		y.SSH.OutputLimit = ptr.Of(64 * 1024)
+	}
+
+	if y.SSH.PortForwardsConfig == nil {
+		y.SSH.PortForwardsConfig = d.SSH.PortForwardsConfig
+	}
+	if o.SSH.PortForwardsConfig != nil {
+		y.SSH.PortForwardsConfig = o.SSH.PortForwardsConfig
+	}
+	if y.SSH.PortForwardsConfig == nil {
+		y.SSH.PortForwardsConfig = ptr.Of(false)
+	}
+
+	if y.SSH.AddressTimeout == nil {
+		y.SSH.AddressTimeout = d.SSH.AddressTimeout
+	}
+	if o.SSH.AddressTimeout != nil {
+		y.SSH.AddressTimeout = o.SSH.AddressTimeout
+	}
+	if y.SSH.AddressTimeout == nil {
+		y.SSH.AddressTimeout = ptr.Of("30s")
+	}
+
+	if y.SSH.ExitMasterTimeout == nil {
+		y.SSH.ExitMasterTimeout = d.SSH.ExitMasterTimeout
+	}
+	if o.SSH.ExitMasterTimeout != nil {
+		y.SSH.ExitMasterTimeout = o.SSH.ExitMasterTimeout
+	}
+	if y.SSH.ExitMasterTimeout == nil {
+		y.SSH.ExitMasterTimeout = ptr.Of("10s")
+	}
+
+	if y.SSH.ProbeFailureThreshold == nil {
+		y.SSH.ProbeFailureThreshold = d.SSH.ProbeFailureThreshold
+	}
+	if o.SSH.ProbeFailureThreshold != nil {
+		y.SSH.ProbeFailureThreshold = o.SSH.ProbeFailureThreshold
+	}
+	if y.SSH.ProbeFailureThreshold == nil {
+		y.SSH.ProbeFailureThreshold = ptr.Of(3)
+	}
+
+	if y.SSH.OnConnectivityLoss == nil {
+		y.SSH.OnConnectivityLoss = d.SSH.OnConnectivityLoss
+	}
+	if o.SSH.OnConnectivityLoss != nil {
+		y.SSH.OnConnectivityLoss = o.SSH.OnConnectivityLoss
+	}
+	if y.SSH.OnConnectivityLoss == nil {
+		y.SSH.OnConnectivityLoss = ptr.Of(SSHConnectivityLossDegrade)
+	}
+
 	hosts := make(map[string]string)
 	// Values can be either names or IP addresses. Name values are canonicalized in the hostResolver.
 	for k, v := range d.HostResolver.Hosts {
@@ -346,6 +478,18 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	}
 	y.HostResolver.Hosts = hosts
 
+	forwarders := make(map[string][]string)
+	for k, v := range d.HostResolver.Forwarders {
+		forwarders[k] = v
+	}
+	for k, v := range y.HostResolver.Forwarders {
+		forwarders[k] = v
+	}
+	for k, v := range o.HostResolver.Forwarders {
+		forwarders[k] = v
+	}
+	y.HostResolver.Forwarders = forwarders
+
 	y.Provision = append(append(o.Provision, y.Provision...), d.Provision...)
 	for i := range y.Provision {
 		provision := &y.Provision[i]
@@ -367,6 +511,228 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.GuestInstallPrefix = ptr.Of(defaultGuestInstallPrefix())
 	}
 
+	if y.GuestAgent.MaxReconnects == nil {
+		y.GuestAgent.MaxReconnects = d.GuestAgent.MaxReconnects
+	}
+	if o.GuestAgent.MaxReconnects != nil {
+		y.GuestAgent.MaxReconnects = o.GuestAgent.MaxReconnects
+	}
+	if y.GuestAgent.MaxReconnects == nil {
+		y.GuestAgent.MaxReconnects = ptr.Of(0)
+	}
+
+	if y.GuestAgent.DialTimeout == nil {
+		y.GuestAgent.DialTimeout = d.GuestAgent.DialTimeout
+	}
+	if o.GuestAgent.DialTimeout != nil {
+		y.GuestAgent.DialTimeout = o.GuestAgent.DialTimeout
+	}
+	if y.GuestAgent.DialTimeout == nil {
+		y.GuestAgent.DialTimeout = ptr.Of("10s")
+	}
+
+	if y.GuestAgent.ReconnectInterval == nil {
+		y.GuestAgent.ReconnectInterval = d.GuestAgent.ReconnectInterval
+	}
+	if o.GuestAgent.ReconnectInterval != nil {
+		y.GuestAgent.ReconnectInterval = o.GuestAgent.ReconnectInterval
+	}
+	if y.GuestAgent.ReconnectInterval == nil {
+		y.GuestAgent.ReconnectInterval = ptr.Of("10s")
+	}
+
+	if y.GuestAgent.ReconnectMaxInterval == nil {
+		y.GuestAgent.ReconnectMaxInterval = d.GuestAgent.ReconnectMaxInterval
+	}
+	if o.GuestAgent.ReconnectMaxInterval != nil {
+		y.GuestAgent.ReconnectMaxInterval = o.GuestAgent.ReconnectMaxInterval
+	}
+	if y.GuestAgent.ReconnectMaxInterval == nil {
+		y.GuestAgent.ReconnectMaxInterval = ptr.Of("5m")
+	}
+
+	if y.GuestAgent.DegradeAfterFailures == nil {
+		y.GuestAgent.DegradeAfterFailures = d.GuestAgent.DegradeAfterFailures
+	}
+	if o.GuestAgent.DegradeAfterFailures != nil {
+		y.GuestAgent.DegradeAfterFailures = o.GuestAgent.DegradeAfterFailures
+	}
+	if y.GuestAgent.DegradeAfterFailures == nil {
+		y.GuestAgent.DegradeAfterFailures = ptr.Of(0)
+	}
+
+	if y.GuestAgent.VSock == nil {
+		y.GuestAgent.VSock = d.GuestAgent.VSock
+	}
+	if o.GuestAgent.VSock != nil {
+		y.GuestAgent.VSock = o.GuestAgent.VSock
+	}
+	if y.GuestAgent.VSock == nil {
+		y.GuestAgent.VSock = ptr.Of(true)
+	}
+
+	if y.GuestAgent.VSockFallback == nil {
+		y.GuestAgent.VSockFallback = d.GuestAgent.VSockFallback
+	}
+	if o.GuestAgent.VSockFallback != nil {
+		y.GuestAgent.VSockFallback = o.GuestAgent.VSockFallback
+	}
+	if y.GuestAgent.VSockFallback == nil {
+		y.GuestAgent.VSockFallback = ptr.Of(true)
+	}
+
+	if y.GuestAgent.EagerPortForwards == nil {
+		y.GuestAgent.EagerPortForwards = d.GuestAgent.EagerPortForwards
+	}
+	if o.GuestAgent.EagerPortForwards != nil {
+		y.GuestAgent.EagerPortForwards = o.GuestAgent.EagerPortForwards
+	}
+	if y.GuestAgent.EagerPortForwards == nil {
+		y.GuestAgent.EagerPortForwards = ptr.Of(false)
+	}
+
+	if y.GuestAgent.ReachabilityCommand == nil {
+		y.GuestAgent.ReachabilityCommand = d.GuestAgent.ReachabilityCommand
+	}
+	if o.GuestAgent.ReachabilityCommand != nil {
+		y.GuestAgent.ReachabilityCommand = o.GuestAgent.ReachabilityCommand
+	}
+	if y.GuestAgent.ReachabilityCommand == nil {
+		y.GuestAgent.ReachabilityCommand = ptr.Of("")
+	}
+
+	if y.GuestAgent.OnPermanentError == nil {
+		y.GuestAgent.OnPermanentError = d.GuestAgent.OnPermanentError
+	}
+	if o.GuestAgent.OnPermanentError != nil {
+		y.GuestAgent.OnPermanentError = o.GuestAgent.OnPermanentError
+	}
+	if y.GuestAgent.OnPermanentError == nil {
+		y.GuestAgent.OnPermanentError = ptr.Of(GuestAgentPermanentErrorDegrade)
+	}
+
+	y.GuestAgent.Additional = append(append(o.GuestAgent.Additional, y.GuestAgent.Additional...), d.GuestAgent.Additional...)
+
+	if y.HostAgent.EventTimeUTC == nil {
+		y.HostAgent.EventTimeUTC = d.HostAgent.EventTimeUTC
+	}
+	if o.HostAgent.EventTimeUTC != nil {
+		y.HostAgent.EventTimeUTC = o.HostAgent.EventTimeUTC
+	}
+	if y.HostAgent.EventTimeUTC == nil {
+		y.HostAgent.EventTimeUTC = ptr.Of(false)
+	}
+
+	if y.HostAgent.StartupTimeline == nil {
+		y.HostAgent.StartupTimeline = d.HostAgent.StartupTimeline
+	}
+	if o.HostAgent.StartupTimeline != nil {
+		y.HostAgent.StartupTimeline = o.HostAgent.StartupTimeline
+	}
+	if y.HostAgent.StartupTimeline == nil {
+		y.HostAgent.StartupTimeline = ptr.Of(false)
+	}
+
+	if y.HostAgent.RequirementsParallelism == nil {
+		y.HostAgent.RequirementsParallelism = d.HostAgent.RequirementsParallelism
+	}
+	if o.HostAgent.RequirementsParallelism != nil {
+		y.HostAgent.RequirementsParallelism = o.HostAgent.RequirementsParallelism
+	}
+	if y.HostAgent.RequirementsParallelism == nil {
+		y.HostAgent.RequirementsParallelism = ptr.Of(1)
+	}
+
+	if y.HostAgent.MetricsAddress == nil {
+		y.HostAgent.MetricsAddress = d.HostAgent.MetricsAddress
+	}
+	if o.HostAgent.MetricsAddress != nil {
+		y.HostAgent.MetricsAddress = o.HostAgent.MetricsAddress
+	}
+	if y.HostAgent.MetricsAddress == nil {
+		y.HostAgent.MetricsAddress = ptr.Of("")
+	}
+
+	if y.HostAgent.EventLog == nil {
+		y.HostAgent.EventLog = d.HostAgent.EventLog
+	}
+	if o.HostAgent.EventLog != nil {
+		y.HostAgent.EventLog = o.HostAgent.EventLog
+	}
+	if y.HostAgent.EventLog == nil {
+		y.HostAgent.EventLog = ptr.Of(false)
+	}
+
+	if y.HostAgent.EventLogMaxSize == nil {
+		y.HostAgent.EventLogMaxSize = d.HostAgent.EventLogMaxSize
+	}
+	if o.HostAgent.EventLogMaxSize != nil {
+		y.HostAgent.EventLogMaxSize = o.HostAgent.EventLogMaxSize
+	}
+	if y.HostAgent.EventLogMaxSize == nil {
+		y.HostAgent.EventLogMaxSize = ptr.Of("10MiB")
+	}
+
+	if y.HostAgent.SyslogTag == nil {
+		y.HostAgent.SyslogTag = d.HostAgent.SyslogTag
+	}
+	if o.HostAgent.SyslogTag != nil {
+		y.HostAgent.SyslogTag = o.HostAgent.SyslogTag
+	}
+	if y.HostAgent.SyslogTag == nil {
+		y.HostAgent.SyslogTag = ptr.Of("")
+	}
+
+	if y.HostAgent.SyslogFacility == nil {
+		y.HostAgent.SyslogFacility = d.HostAgent.SyslogFacility
+	}
+	if o.HostAgent.SyslogFacility != nil {
+		y.HostAgent.SyslogFacility = o.HostAgent.SyslogFacility
+	}
+	if y.HostAgent.SyslogFacility == nil {
+		y.HostAgent.SyslogFacility = ptr.Of("daemon")
+	}
+
+	if y.HostAgent.GuestPoweroffTimeout == nil {
+		y.HostAgent.GuestPoweroffTimeout = d.HostAgent.GuestPoweroffTimeout
+	}
+	if o.HostAgent.GuestPoweroffTimeout != nil {
+		y.HostAgent.GuestPoweroffTimeout = o.HostAgent.GuestPoweroffTimeout
+	}
+	if y.HostAgent.GuestPoweroffTimeout == nil {
+		y.HostAgent.GuestPoweroffTimeout = ptr.Of("")
+	}
+
+	if y.HostAgent.MDNS == nil {
+		y.HostAgent.MDNS = d.HostAgent.MDNS
+	}
+	if o.HostAgent.MDNS != nil {
+		y.HostAgent.MDNS = o.HostAgent.MDNS
+	}
+	if y.HostAgent.MDNS == nil {
+		y.HostAgent.MDNS = ptr.Of(false)
+	}
+
+	if y.HostAgent.MDNSAddress == nil {
+		y.HostAgent.MDNSAddress = d.HostAgent.MDNSAddress
+	}
+	if o.HostAgent.MDNSAddress != nil {
+		y.HostAgent.MDNSAddress = o.HostAgent.MDNSAddress
+	}
+	if y.HostAgent.MDNSAddress == nil {
+		y.HostAgent.MDNSAddress = ptr.Of("")
+	}
+
+	if y.HostAgent.IdleSuspend == nil {
+		y.HostAgent.IdleSuspend = d.HostAgent.IdleSuspend
+	}
+	if o.HostAgent.IdleSuspend != nil {
+		y.HostAgent.IdleSuspend = o.HostAgent.IdleSuspend
+	}
+	if y.HostAgent.IdleSuspend == nil {
+		y.HostAgent.IdleSuspend = ptr.Of("")
+	}
+
 	if y.Containerd.System == nil {
 		y.Containerd.System = d.Containerd.System
 	}
@@ -406,6 +772,31 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		if probe.Description == "" {
 			probe.Description = fmt.Sprintf("user probe %d/%d", i+1, len(y.Probes))
 		}
+		if probe.Phase == "" {
+			probe.Phase = ProbePhaseOptional
+		}
+		if probe.Retries == nil && probe.Timeout == "" {
+			probe.Retries = ptr.Of(60)
+		}
+		if probe.Interval == "" {
+			probe.Interval = "10s"
+		}
+	}
+
+	if y.GuestReadyFile.Path == "" {
+		y.GuestReadyFile.Path = d.GuestReadyFile.Path
+	}
+	if o.GuestReadyFile.Path != "" {
+		y.GuestReadyFile.Path = o.GuestReadyFile.Path
+	}
+	if y.GuestReadyFile.Timeout == nil {
+		y.GuestReadyFile.Timeout = d.GuestReadyFile.Timeout
+	}
+	if o.GuestReadyFile.Timeout != nil {
+		y.GuestReadyFile.Timeout = o.GuestReadyFile.Timeout
+	}
+	if y.GuestReadyFile.Timeout == nil {
+		y.GuestReadyFile.Timeout = ptr.Of("10m")
 	}
 
 	y.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
@@ -415,11 +806,73 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		// After defaults processing the singular HostPort and GuestPort values should not be used again.
 	}
 
+	if len(y.PortForwarding.IncludeFiles) == 0 {
+		y.PortForwarding.IncludeFiles = d.PortForwarding.IncludeFiles
+	}
+	if len(o.PortForwarding.IncludeFiles) > 0 {
+		y.PortForwarding.IncludeFiles = o.PortForwarding.IncludeFiles
+	}
+
+	if y.PortForwarding.DryRun == nil {
+		y.PortForwarding.DryRun = d.PortForwarding.DryRun
+	}
+	if o.PortForwarding.DryRun != nil {
+		y.PortForwarding.DryRun = o.PortForwarding.DryRun
+	}
+	if y.PortForwarding.DryRun == nil {
+		y.PortForwarding.DryRun = ptr.Of(false)
+	}
+
+	if y.PortForwarding.DecisionLog == nil {
+		y.PortForwarding.DecisionLog = d.PortForwarding.DecisionLog
+	}
+	if o.PortForwarding.DecisionLog != nil {
+		y.PortForwarding.DecisionLog = o.PortForwarding.DecisionLog
+	}
+	if y.PortForwarding.DecisionLog == nil {
+		y.PortForwarding.DecisionLog = ptr.Of(false)
+	}
+
+	if y.PortForwarding.DecisionLogMaxSize == nil {
+		y.PortForwarding.DecisionLogMaxSize = d.PortForwarding.DecisionLogMaxSize
+	}
+	if o.PortForwarding.DecisionLogMaxSize != nil {
+		y.PortForwarding.DecisionLogMaxSize = o.PortForwarding.DecisionLogMaxSize
+	}
+	if y.PortForwarding.DecisionLogMaxSize == nil {
+		y.PortForwarding.DecisionLogMaxSize = ptr.Of("10MiB")
+	}
+
+	if y.PortForwarding.SOCKSProxy == nil {
+		y.PortForwarding.SOCKSProxy = d.PortForwarding.SOCKSProxy
+	}
+	if o.PortForwarding.SOCKSProxy != nil {
+		y.PortForwarding.SOCKSProxy = o.PortForwarding.SOCKSProxy
+	}
+	if y.PortForwarding.SOCKSProxy == nil {
+		y.PortForwarding.SOCKSProxy = ptr.Of("")
+	}
+
 	y.CopyToHost = append(append(o.CopyToHost, y.CopyToHost...), d.CopyToHost...)
 	for i := range y.CopyToHost {
 		FillCopyToHostDefaults(&y.CopyToHost[i], instDir)
 	}
 
+	y.CopyToGuest = append(append(o.CopyToGuest, y.CopyToGuest...), d.CopyToGuest...)
+	for i := range y.CopyToGuest {
+		FillCopyToGuestDefaults(&y.CopyToGuest[i], instDir)
+	}
+
+	if y.HostFileUmask == nil {
+		y.HostFileUmask = d.HostFileUmask
+	}
+	if o.HostFileUmask != nil {
+		y.HostFileUmask = o.HostFileUmask
+	}
+	if y.HostFileUmask == nil || *y.HostFileUmask == "" {
+		y.HostFileUmask = ptr.Of(DefaultHostFileUmask)
+	}
+
 	if y.HostResolver.Enabled == nil {
 		y.HostResolver.Enabled = d.HostResolver.Enabled
 	}
@@ -440,6 +893,66 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.HostResolver.IPv6 = ptr.Of(false)
 	}
 
+	if y.HostResolver.Optional == nil {
+		y.HostResolver.Optional = d.HostResolver.Optional
+	}
+	if o.HostResolver.Optional != nil {
+		y.HostResolver.Optional = o.HostResolver.Optional
+	}
+	if y.HostResolver.Optional == nil {
+		y.HostResolver.Optional = ptr.Of(false)
+	}
+
+	if y.HostResolver.ResolvConfMode == nil {
+		y.HostResolver.ResolvConfMode = d.HostResolver.ResolvConfMode
+	}
+	if o.HostResolver.ResolvConfMode != nil {
+		y.HostResolver.ResolvConfMode = o.HostResolver.ResolvConfMode
+	}
+	if y.HostResolver.ResolvConfMode == nil {
+		y.HostResolver.ResolvConfMode = ptr.Of(ResolvConfManaged)
+	}
+
+	if y.HostResolver.PersistPorts == nil {
+		y.HostResolver.PersistPorts = d.HostResolver.PersistPorts
+	}
+	if o.HostResolver.PersistPorts != nil {
+		y.HostResolver.PersistPorts = o.HostResolver.PersistPorts
+	}
+	if y.HostResolver.PersistPorts == nil {
+		y.HostResolver.PersistPorts = ptr.Of(false)
+	}
+
+	if y.HostResolver.CacheSize == nil {
+		y.HostResolver.CacheSize = d.HostResolver.CacheSize
+	}
+	if o.HostResolver.CacheSize != nil {
+		y.HostResolver.CacheSize = o.HostResolver.CacheSize
+	}
+	if y.HostResolver.CacheSize == nil {
+		y.HostResolver.CacheSize = ptr.Of(1000)
+	}
+
+	if y.HostResolver.LogQueries == nil {
+		y.HostResolver.LogQueries = d.HostResolver.LogQueries
+	}
+	if o.HostResolver.LogQueries != nil {
+		y.HostResolver.LogQueries = o.HostResolver.LogQueries
+	}
+	if y.HostResolver.LogQueries == nil {
+		y.HostResolver.LogQueries = ptr.Of(false)
+	}
+
+	if y.HostResolver.QueryLog == nil {
+		y.HostResolver.QueryLog = d.HostResolver.QueryLog
+	}
+	if o.HostResolver.QueryLog != nil {
+		y.HostResolver.QueryLog = o.HostResolver.QueryLog
+	}
+	if y.HostResolver.QueryLog == nil {
+		y.HostResolver.QueryLog = ptr.Of(false)
+	}
+
 	if y.PropagateProxyEnv == nil {
 		y.PropagateProxyEnv = d.PropagateProxyEnv
 	}
@@ -525,6 +1038,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
+	if y.MountsAfter == nil {
+		y.MountsAfter = d.MountsAfter
+	}
+	if o.MountsAfter != nil {
+		y.MountsAfter = o.MountsAfter
+	}
+	if y.MountsAfter == nil || *y.MountsAfter == "" {
+		y.MountsAfter = ptr.Of(MountsAfterEssential)
+	}
+
 	// Combine all mounts; highest priority entry determines writable status.
 	// Only works for exact matches; does not normalize case or resolve symlinks.
 	mounts := make([]Mount, 0, len(d.Mounts)+len(y.Mounts)+len(o.Mounts))
@@ -540,6 +1063,12 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 			if mount.SSHFS.SFTPDriver != nil {
 				mounts[i].SSHFS.SFTPDriver = mount.SSHFS.SFTPDriver
 			}
+			if mount.SSHFS.OnDisconnect != nil {
+				mounts[i].SSHFS.OnDisconnect = mount.SSHFS.OnDisconnect
+			}
+			if mount.SSHFS.MaxRemounts != nil {
+				mounts[i].SSHFS.MaxRemounts = mount.SSHFS.MaxRemounts
+			}
 			if mount.NineP.SecurityModel != nil {
 				mounts[i].NineP.SecurityModel = mount.NineP.SecurityModel
 			}
@@ -558,6 +1087,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 			if mount.Writable != nil {
 				mounts[i].Writable = mount.Writable
 			}
+			if mount.Verify != nil {
+				mounts[i].Verify = mount.Verify
+			}
 			if mount.MountPoint != "" {
 				mounts[i].MountPoint = mount.MountPoint
 			}
@@ -579,6 +1111,12 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		if mount.SSHFS.SFTPDriver == nil {
 			mount.SSHFS.SFTPDriver = ptr.Of("")
 		}
+		if mount.SSHFS.OnDisconnect == nil {
+			mount.SSHFS.OnDisconnect = ptr.Of(SSHFSOnDisconnectRemount)
+		}
+		if mount.SSHFS.MaxRemounts == nil {
+			mount.SSHFS.MaxRemounts = ptr.Of(3)
+		}
 		if mount.NineP.SecurityModel == nil {
 			mounts[i].NineP.SecurityModel = ptr.Of(Default9pSecurityModel)
 		}
@@ -594,6 +1132,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		if mount.Writable == nil {
 			mount.Writable = ptr.Of(false)
 		}
+		if mount.Verify == nil {
+			mount.Verify = ptr.Of(false)
+		}
 		if mount.NineP.Cache == nil {
 			if *mount.Writable {
 				mounts[i].NineP.Cache = ptr.Of(Default9pCacheForRW)
@@ -614,6 +1155,20 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.DNS = o.DNS
 	}
 
+	// Note: search domain lists are not combined either
+	if len(y.HostResolver.SearchDomains) == 0 {
+		y.HostResolver.SearchDomains = d.HostResolver.SearchDomains
+	}
+	if len(o.HostResolver.SearchDomains) > 0 {
+		y.HostResolver.SearchDomains = o.HostResolver.SearchDomains
+	}
+	if len(y.HostResolver.UpstreamServers) == 0 {
+		y.HostResolver.UpstreamServers = d.HostResolver.UpstreamServers
+	}
+	if len(o.HostResolver.UpstreamServers) > 0 {
+		y.HostResolver.UpstreamServers = o.HostResolver.UpstreamServers
+	}
+
 	env := make(map[string]string)
 	for k, v := range d.Env {
 		env[k] = v
@@ -685,6 +1240,7 @@ func fixUpForPlainMode(y *LimaYAML) {
 	}
 	y.Mounts = nil
 	y.PortForwards = nil
+	y.PortForwarding.IncludeFiles = nil
 	y.Containerd.System = ptr.Of(false)
 	y.Containerd.User = ptr.Of(false)
 	y.Rosetta.BinFmt = ptr.Of(false)
@@ -746,6 +1302,11 @@ func FillPortForwardDefaults(rule *PortForward, instDir string) {
 	if rule.HostIP == nil {
 		rule.HostIP = api.IPv4loopback1
 	}
+	if len(rule.GuestTargets) > 0 && rule.GuestPort == 0 && rule.HostPort != 0 &&
+		rule.GuestPortRange[0] == 0 && rule.GuestPortRange[1] == 0 {
+		// The guest ports are never matched for guestTargets, so they just mirror the host port
+		rule.GuestPortRange = [2]int{rule.HostPort, rule.HostPort}
+	}
 	if rule.GuestPortRange[0] == 0 && rule.GuestPortRange[1] == 0 {
 		if rule.GuestPort == 0 {
 			rule.GuestPortRange[0] = 1
@@ -770,6 +1331,13 @@ func FillPortForwardDefaults(rule *PortForward, instDir string) {
 			logrus.WithError(err).Warnf("Couldn't process guestSocket %q as a template", rule.GuestSocket)
 		}
 	}
+	for i, dir := range rule.GuestSocketPruneDirs {
+		if out, err := executeGuestTemplate(dir); err == nil {
+			rule.GuestSocketPruneDirs[i] = out.String()
+		} else {
+			logrus.WithError(err).Warnf("Couldn't process guestSocketPruneDirs %q as a template", dir)
+		}
+	}
 	if rule.HostSocket != "" {
 		if out, err := executeHostTemplate(rule.HostSocket, instDir); err == nil {
 			rule.HostSocket = out.String()
@@ -780,6 +1348,18 @@ func FillPortForwardDefaults(rule *PortForward, instDir string) {
 			rule.HostSocket = filepath.Join(instDir, filenames.SocketDir, rule.HostSocket)
 		}
 	}
+	if rule.GuestTLS != nil {
+		for _, f := range []*string{&rule.GuestTLS.CA, &rule.GuestTLS.ClientCert, &rule.GuestTLS.ClientKey} {
+			if *f == "" {
+				continue
+			}
+			if expanded, err := localpathutil.Expand(*f); err == nil {
+				*f = expanded
+			} else {
+				logrus.WithError(err).Warnf("Couldn't expand the guestTLS path %q", *f)
+			}
+		}
+	}
 }
 
 func FillCopyToHostDefaults(rule *CopyToHost, instDir string) {
@@ -797,6 +1377,42 @@ func FillCopyToHostDefaults(rule *CopyToHost, instDir string) {
 			logrus.WithError(err).Warnf("Couldn't process host %q as a template", rule.HostFile)
 		}
 	}
+	if rule.IfExists == "" {
+		rule.IfExists = CopyToHostOverwrite
+	}
+	if rule.Watch && rule.WatchInterval == "" {
+		rule.WatchInterval = "10s"
+	}
+}
+
+func FillCopyToGuestDefaults(rule *CopyToGuest, instDir string) {
+	if rule.HostFile != "" {
+		if out, err := executeHostTemplate(rule.HostFile, instDir); err == nil {
+			rule.HostFile = out.String()
+		} else {
+			logrus.WithError(err).Warnf("Couldn't process host %q as a template", rule.HostFile)
+		}
+	}
+	if rule.GuestFile != "" {
+		if out, err := executeGuestTemplate(rule.GuestFile); err == nil {
+			rule.GuestFile = out.String()
+		} else {
+			logrus.WithError(err).Warnf("Couldn't process guest %q as a template", rule.GuestFile)
+		}
+	}
+	if rule.Owner == "" {
+		rule.Owner = "root"
+	} else if out, err := executeGuestTemplate(rule.Owner); err == nil {
+		rule.Owner = out.String()
+	} else {
+		logrus.WithError(err).Warnf("Couldn't process owner %q as a template", rule.Owner)
+	}
+	if rule.Permissions == "" {
+		rule.Permissions = "644"
+	}
+	if rule.Watch && rule.WatchInterval == "" {
+		rule.WatchInterval = "10s"
+	}
 }
 
 func NewOS(osname string) OS {
@@ -926,3 +1542,45 @@ func unique(s []string) []string {
 	}
 	return list
 }
+
+func fillSecretPolicyDefaults(y, d, o *SecretPolicy, builtin SecretPolicy) {
+	if y.Length == nil {
+		y.Length = d.Length
+	}
+	if o.Length != nil {
+		y.Length = o.Length
+	}
+	if y.Length == nil {
+		y.Length = builtin.Length
+	}
+
+	if y.Digits == nil {
+		y.Digits = d.Digits
+	}
+	if o.Digits != nil {
+		y.Digits = o.Digits
+	}
+	if y.Digits == nil {
+		y.Digits = builtin.Digits
+	}
+
+	if y.Symbols == nil {
+		y.Symbols = d.Symbols
+	}
+	if o.Symbols != nil {
+		y.Symbols = o.Symbols
+	}
+	if y.Symbols == nil {
+		y.Symbols = builtin.Symbols
+	}
+
+	if y.NoUpper == nil {
+		y.NoUpper = d.NoUpper
+	}
+	if o.NoUpper != nil {
+		y.NoUpper = o.NoUpper
+	}
+	if y.NoUpper == nil {
+		y.NoUpper = builtin.NoUpper
+	}
+}
@@ -73,17 +73,60 @@ func TestFillDefault(t *testing.T) {
 		Memory:             ptr.Of(defaultMemoryAsString()),
 		Disk:               ptr.Of(defaultDiskSizeAsString()),
 		GuestInstallPrefix: ptr.Of(defaultGuestInstallPrefix()),
+		MountsAfter:        ptr.Of(MountsAfterEssential),
+		GuestAgent: GuestAgent{
+			MaxReconnects:        ptr.Of(0),
+			DialTimeout:          ptr.Of("10s"),
+			ReconnectInterval:    ptr.Of("10s"),
+			ReconnectMaxInterval: ptr.Of("5m"),
+			DegradeAfterFailures: ptr.Of(0),
+			VSock:                ptr.Of(true),
+			VSockFallback:        ptr.Of(true),
+			EagerPortForwards:    ptr.Of(false),
+			ReachabilityCommand:  ptr.Of(""),
+			OnPermanentError:     ptr.Of(GuestAgentPermanentErrorDegrade),
+		},
+		HostAgent: HostAgent{
+			EventTimeUTC:            ptr.Of(false),
+			StartupTimeline:         ptr.Of(false),
+			RequirementsParallelism: ptr.Of(1),
+			MetricsAddress:          ptr.Of(""),
+			EventLog:                ptr.Of(false),
+			EventLogMaxSize:         ptr.Of("10MiB"),
+			SyslogTag:               ptr.Of(""),
+			SyslogFacility:          ptr.Of("daemon"),
+			GuestPoweroffTimeout:    ptr.Of(""),
+			MDNS:                    ptr.Of(false),
+			MDNSAddress:             ptr.Of(""),
+			IdleSuspend:             ptr.Of(""),
+		},
+		PortForwarding: PortForwarding{
+			DryRun: ptr.Of(false),
+
+			DecisionLog:        ptr.Of(false),
+			DecisionLogMaxSize: ptr.Of("10MiB"),
+			SOCKSProxy:         ptr.Of(""),
+		},
 		Containerd: Containerd{
 			System:   ptr.Of(false),
 			User:     ptr.Of(true),
 			Archives: defaultContainerdArchives(),
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(0),
-			LoadDotSSHPubKeys: ptr.Of(true),
-			ForwardAgent:      ptr.Of(false),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:             ptr.Of(0),
+			LoadDotSSHPubKeys:     ptr.Of(true),
+			ForwardAgent:          ptr.Of(false),
+			ForwardX11:            ptr.Of(false),
+			ForwardX11Trusted:     ptr.Of(false),
+			OnX11Unavailable:      ptr.Of(X11UnavailableWarn),
+			ProvisionUser:         ptr.Of(user.Username),
+			RuntimeUser:           ptr.Of(user.Username),
+			OutputLimit:           ptr.Of(64 * 1024),
+			PortForwardsConfig:    ptr.Of(false),
+			AddressTimeout:        ptr.Of("30s"),
+			ProbeFailureThreshold: ptr.Of(3),
+			OnConnectivityLoss:    ptr.Of(SSHConnectivityLossDegrade),
+			ExitMasterTimeout:     ptr.Of("10s"),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: ptr.Of(false),
@@ -94,14 +137,34 @@ func TestFillDefault(t *testing.T) {
 		Video: Video{
 			Display: ptr.Of("none"),
 			VNC: VNCOptions{
-				Display: ptr.Of("127.0.0.1:0,to=9"),
+				Display:          ptr.Of("127.0.0.1:0,to=9"),
+				OnInvalidDisplay: ptr.Of(VNCInvalidDisplayFail),
+			},
+		},
+		Secrets: Secrets{
+			VNC: SecretPolicy{
+				Length:  ptr.Of(8),
+				Digits:  ptr.Of(2),
+				Symbols: ptr.Of(0),
+				NoUpper: ptr.Of(false),
 			},
 		},
+		GuestReadyFile: GuestReadyFile{
+			Timeout: ptr.Of("10m"),
+		},
 		HostResolver: HostResolver{
-			Enabled: ptr.Of(true),
-			IPv6:    ptr.Of(false),
+			Enabled:  ptr.Of(true),
+			IPv6:     ptr.Of(false),
+			Optional: ptr.Of(false),
+
+			ResolvConfMode: ptr.Of(ResolvConfManaged),
+			PersistPorts:   ptr.Of(false),
+			CacheSize:      ptr.Of(1000),
+			LogQueries:     ptr.Of(false),
+			QueryLog:       ptr.Of(false),
 		},
 		PropagateProxyEnv: ptr.Of(true),
+		HostFileUmask:     ptr.Of(DefaultHostFileUmask),
 		CACertificates: CACertificates{
 			RemoveDefaults: ptr.Of(false),
 		},
@@ -151,6 +214,11 @@ func TestFillDefault(t *testing.T) {
 		Probes: []Probe{
 			{Script: "#!/bin/false"},
 		},
+		Host: Host{
+			Prerequisites: []Prerequisite{
+				{Command: []string{"true"}},
+			},
+		},
 		Networks: []Network{
 			{Lima: "shared"},
 		},
@@ -172,6 +240,13 @@ func TestFillDefault(t *testing.T) {
 				HostFile:  "{{.Home}} | {{.Dir}} | {{.Name}} | {{.UID}} | {{.User}}",
 			},
 		},
+		CopyToGuest: []CopyToGuest{
+			{
+				HostFile:  "{{.Home}} | {{.Dir}} | {{.Name}} | {{.UID}} | {{.User}}",
+				GuestFile: "{{.Home}} | {{.UID}} | {{.User}}",
+				Owner:     "{{.User}}",
+			},
+		},
 		Env: map[string]string{
 			"ONE": "Eins",
 		},
@@ -191,9 +266,12 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts = y.Mounts
 	expect.Mounts[0].MountPoint = expect.Mounts[0].Location
 	expect.Mounts[0].Writable = ptr.Of(false)
+	expect.Mounts[0].Verify = ptr.Of(false)
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(true)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(false)
 	expect.Mounts[0].SSHFS.SFTPDriver = ptr.Of("")
+	expect.Mounts[0].SSHFS.OnDisconnect = ptr.Of(SSHFSOnDisconnectRemount)
+	expect.Mounts[0].SSHFS.MaxRemounts = ptr.Of(3)
 	expect.Mounts[0].NineP.SecurityModel = ptr.Of(Default9pSecurityModel)
 	expect.Mounts[0].NineP.ProtocolVersion = ptr.Of(Default9pProtocolVersion)
 	expect.Mounts[0].NineP.Msize = ptr.Of(Default9pMsize)
@@ -209,6 +287,12 @@ func TestFillDefault(t *testing.T) {
 	expect.Probes = y.Probes
 	expect.Probes[0].Mode = ProbeModeReadiness
 	expect.Probes[0].Description = "user probe 1/1"
+	expect.Probes[0].Phase = ProbePhaseOptional
+	expect.Probes[0].Retries = ptr.Of(60)
+	expect.Probes[0].Interval = "10s"
+
+	expect.Host.Prerequisites = y.Host.Prerequisites
+	expect.Host.Prerequisites[0].Description = "host prerequisite 1/1"
 
 	expect.Networks = y.Networks
 	expect.Networks[0].MACAddress = MACAddress(fmt.Sprintf("%s#%d", filePath, 0))
@@ -222,7 +306,9 @@ func TestFillDefault(t *testing.T) {
 		defaultPortForward,
 	}
 	expect.CopyToHost = []CopyToHost{
-		{},
+		{
+			IfExists: CopyToHostOverwrite,
+		},
 	}
 
 	// Setting GuestPort and HostPort for DeepEqual(), but they are not supposed to be used
@@ -242,6 +328,15 @@ func TestFillDefault(t *testing.T) {
 	expect.CopyToHost[0].GuestFile = fmt.Sprintf("%s | %s | %s", guestHome, user.Uid, user.Username)
 	expect.CopyToHost[0].HostFile = fmt.Sprintf("%s | %s | %s | %s | %s", hostHome, instDir, instName, user.Uid, user.Username)
 
+	expect.CopyToGuest = []CopyToGuest{
+		{
+			HostFile:    fmt.Sprintf("%s | %s | %s | %s | %s", hostHome, instDir, instName, user.Uid, user.Username),
+			GuestFile:   fmt.Sprintf("%s | %s | %s", guestHome, user.Uid, user.Username),
+			Owner:       user.Username,
+			Permissions: "644",
+		},
+	}
+
 	expect.Env = y.Env
 
 	expect.CACertificates = CACertificates{
@@ -276,13 +371,57 @@ func TestFillDefault(t *testing.T) {
 			X8664:   "amd64",
 			RISCV64: "riscv64",
 		},
-		CPUs:   ptr.Of(7),
+		CPUs: ptr.Of(7),
+		Host: Host{
+			CPUAffinity: []int{0, 1},
+			Prerequisites: []Prerequisite{
+				{
+					Description: "Default Prerequisite",
+					Command:     []string{"test", "-e", "/dev/kvm"},
+				},
+			},
+		},
 		Memory: ptr.Of("5GiB"),
 		Disk:   ptr.Of("105GiB"),
 		AdditionalDisks: []Disk{
 			{Name: "data"},
 		},
 		GuestInstallPrefix: ptr.Of("/opt"),
+		MountsAfter:        ptr.Of(MountsAfterOptional),
+		GuestAgent: GuestAgent{
+			MaxReconnects:        ptr.Of(5),
+			DialTimeout:          ptr.Of("5s"),
+			ReconnectInterval:    ptr.Of("5s"),
+			ReconnectMaxInterval: ptr.Of("1m"),
+			DegradeAfterFailures: ptr.Of(3),
+			VSock:                ptr.Of(false),
+			VSockFallback:        ptr.Of(false),
+			EagerPortForwards:    ptr.Of(true),
+			ReachabilityCommand:  ptr.Of("nc -z {{.IP}} {{.Port}}"),
+			OnPermanentError:     ptr.Of(GuestAgentPermanentErrorRetry),
+		},
+		HostAgent: HostAgent{
+			EventTimeUTC:            ptr.Of(true),
+			StartupTimeline:         ptr.Of(true),
+			RequirementsParallelism: ptr.Of(4),
+			MetricsAddress:          ptr.Of("127.0.0.1:9187"),
+			EventLog:                ptr.Of(true),
+			EventLogMaxSize:         ptr.Of("1MiB"),
+			SyslogTag:               ptr.Of("lima-test"),
+			SyslogFacility:          ptr.Of("local0"),
+			GuestPoweroffTimeout:    ptr.Of("30s"),
+			MDNS:                    ptr.Of(true),
+			MDNSAddress:             ptr.Of("192.168.105.2"),
+			IdleSuspend:             ptr.Of("30m"),
+		},
+		PortForwarding: PortForwarding{
+			IncludeFiles: []string{"d.yaml"},
+			DryRun:       ptr.Of(true),
+
+			DecisionLog:        ptr.Of(true),
+			DecisionLogMaxSize: ptr.Of("1MiB"),
+			SOCKSProxy:         ptr.Of("127.0.0.1:1080"),
+		},
 		Containerd: Containerd{
 			System: ptr.Of(true),
 			User:   ptr.Of(false),
@@ -291,11 +430,20 @@ func TestFillDefault(t *testing.T) {
 			},
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(888),
-			LoadDotSSHPubKeys: ptr.Of(false),
-			ForwardAgent:      ptr.Of(true),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:             ptr.Of(888),
+			LoadDotSSHPubKeys:     ptr.Of(false),
+			ForwardAgent:          ptr.Of(true),
+			ForwardX11:            ptr.Of(false),
+			ForwardX11Trusted:     ptr.Of(false),
+			OnX11Unavailable:      ptr.Of(X11UnavailableDisable),
+			ProvisionUser:         ptr.Of("provisioner"),
+			RuntimeUser:           ptr.Of("runner"),
+			OutputLimit:           ptr.Of(32 * 1024),
+			PortForwardsConfig:    ptr.Of(true),
+			AddressTimeout:        ptr.Of("1m"),
+			ProbeFailureThreshold: ptr.Of(5),
+			OnConnectivityLoss:    ptr.Of(SSHConnectivityLossRecover),
+			ExitMasterTimeout:     ptr.Of("20s"),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: ptr.Of(true),
@@ -306,17 +454,43 @@ func TestFillDefault(t *testing.T) {
 		Video: Video{
 			Display: ptr.Of("cocoa"),
 			VNC: VNCOptions{
-				Display: ptr.Of("none"),
+				Display:          ptr.Of("none"),
+				OnInvalidDisplay: ptr.Of(VNCInvalidDisplayDisable),
+			},
+		},
+		Secrets: Secrets{
+			VNC: SecretPolicy{
+				Length:  ptr.Of(6),
+				Digits:  ptr.Of(1),
+				Symbols: ptr.Of(1),
+				NoUpper: ptr.Of(true),
 			},
 		},
+		GuestReadyFile: GuestReadyFile{
+			Path:    "/run/d-ready",
+			Timeout: ptr.Of("5m"),
+		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
 			IPv6:    ptr.Of(true),
 			Hosts: map[string]string{
 				"default": "localhost",
 			},
+			SearchDomains:   []string{"d.lima.internal"},
+			Optional:        ptr.Of(true),
+			UpstreamServers: []string{"tls://dns.d.example"},
+			Forwarders: map[string][]string{
+				"corp.example": {"10.0.0.53"},
+			},
+
+			ResolvConfMode: ptr.Of(ResolvConfAppend),
+			PersistPorts:   ptr.Of(true),
+			CacheSize:      ptr.Of(500),
+			LogQueries:     ptr.Of(true),
+			QueryLog:       ptr.Of(true),
 		},
 		PropagateProxyEnv: ptr.Of(false),
+		HostFileUmask:     ptr.Of("022"),
 
 		Mounts: []Mount{
 			{
@@ -335,6 +509,9 @@ func TestFillDefault(t *testing.T) {
 				Script:      "#!/bin/false",
 				Mode:        ProbeModeReadiness,
 				Description: "User Probe",
+				Phase:       ProbePhaseEssential,
+				Retries:     ptr.Of(3),
+				Interval:    "1s",
 			},
 		},
 		Networks: []Network{
@@ -357,7 +534,8 @@ func TestFillDefault(t *testing.T) {
 			HostPortRange:  [2]int{80, 80},
 			Proto:          TCP,
 		}},
-		CopyToHost: []CopyToHost{{}},
+		CopyToHost:  []CopyToHost{{IfExists: CopyToHostBackup}},
+		CopyToGuest: []CopyToGuest{{Owner: "root", Permissions: "600"}},
 		Env: map[string]string{
 			"ONE": "one",
 			"TWO": "two",
@@ -378,9 +556,12 @@ func TestFillDefault(t *testing.T) {
 	// Also verify that archive arch is filled in
 	expect.Containerd.Archives[0].Arch = *d.Arch
 	expect.Mounts[0].MountPoint = expect.Mounts[0].Location
+	expect.Mounts[0].Verify = ptr.Of(false)
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(true)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(false)
 	expect.Mounts[0].SSHFS.SFTPDriver = ptr.Of("")
+	expect.Mounts[0].SSHFS.OnDisconnect = ptr.Of(SSHFSOnDisconnectRemount)
+	expect.Mounts[0].SSHFS.MaxRemounts = ptr.Of(3)
 	expect.Mounts[0].NineP.SecurityModel = ptr.Of(Default9pSecurityModel)
 	expect.Mounts[0].NineP.ProtocolVersion = ptr.Of(Default9pProtocolVersion)
 	expect.Mounts[0].NineP.Msize = ptr.Of(Default9pMsize)
@@ -417,14 +598,21 @@ func TestFillDefault(t *testing.T) {
 
 	y = filledDefaults
 	y.DNS = []net.IP{net.ParseIP("8.8.8.8")}
+	y.HostResolver.SearchDomains = []string{"y.lima.internal"}
+	y.HostResolver.UpstreamServers = []string{"10.0.0.1"}
+	y.Host.CPUAffinity = []int{2}
+	y.GuestReadyFile.Path = "/run/y-ready"
+	y.PortForwarding.IncludeFiles = []string{"y.yaml"}
 	y.AdditionalDisks = []Disk{{Name: "overridden"}}
 
 	expect = y
 
 	expect.Provision = append(y.Provision, d.Provision...)
 	expect.Probes = append(y.Probes, d.Probes...)
+	expect.Host.Prerequisites = append(y.Host.Prerequisites, d.Host.Prerequisites...)
 	expect.PortForwards = append(y.PortForwards, d.PortForwards...)
 	expect.CopyToHost = append(y.CopyToHost, d.CopyToHost...)
+	expect.CopyToGuest = append(y.CopyToGuest, d.CopyToGuest...)
 	expect.Containerd.Archives = append(y.Containerd.Archives, d.Containerd.Archives...)
 	expect.AdditionalDisks = append(y.AdditionalDisks, d.AdditionalDisks...)
 
@@ -433,6 +621,7 @@ func TestFillDefault(t *testing.T) {
 	expect.Networks = append(d.Networks, y.Networks...)
 
 	expect.HostResolver.Hosts["default"] = d.HostResolver.Hosts["default"]
+	expect.HostResolver.Forwarders["corp.example"] = d.HostResolver.Forwarders["corp.example"]
 
 	// d.DNS will be ignored, and not appended to y.DNS
 
@@ -455,13 +644,60 @@ func TestFillDefault(t *testing.T) {
 			X8664:   "pentium",
 			RISCV64: "sifive-u54",
 		},
-		CPUs:   ptr.Of(12),
+		CPUs: ptr.Of(12),
+		Host: Host{
+			CPUAffinity: []int{3},
+			Prerequisites: []Prerequisite{
+				{
+					Description:      "Another Prerequisite",
+					Command:          []string{"ip", "link", "show", "tap0"},
+					ExpectedExitCode: 0,
+					ExpectedOutput:   "state UP",
+					Hint:             "Create tap0",
+				},
+			},
+		},
 		Memory: ptr.Of("7GiB"),
 		Disk:   ptr.Of("117GiB"),
 		AdditionalDisks: []Disk{
 			{Name: "test"},
 		},
 		GuestInstallPrefix: ptr.Of("/usr"),
+		MountsAfter:        ptr.Of(MountsAfterFinal),
+		GuestAgent: GuestAgent{
+			MaxReconnects:        ptr.Of(10),
+			DialTimeout:          ptr.Of("1m"),
+			ReconnectInterval:    ptr.Of("2s"),
+			ReconnectMaxInterval: ptr.Of("10m"),
+			DegradeAfterFailures: ptr.Of(6),
+			VSock:                ptr.Of(true),
+			VSockFallback:        ptr.Of(true),
+			EagerPortForwards:    ptr.Of(false),
+			ReachabilityCommand:  ptr.Of(""),
+			OnPermanentError:     ptr.Of(GuestAgentPermanentErrorDegrade),
+		},
+		HostAgent: HostAgent{
+			EventTimeUTC:            ptr.Of(false),
+			StartupTimeline:         ptr.Of(false),
+			RequirementsParallelism: ptr.Of(2),
+			MetricsAddress:          ptr.Of("127.0.0.1:9188"),
+			EventLog:                ptr.Of(false),
+			EventLogMaxSize:         ptr.Of("2MiB"),
+			SyslogTag:               ptr.Of("lima-override"),
+			SyslogFacility:          ptr.Of("local1"),
+			GuestPoweroffTimeout:    ptr.Of("1m"),
+			MDNS:                    ptr.Of(false),
+			MDNSAddress:             ptr.Of("192.168.105.3"),
+			IdleSuspend:             ptr.Of("1h"),
+		},
+		PortForwarding: PortForwarding{
+			IncludeFiles: []string{"o.yaml", "o2.yaml"},
+			DryRun:       ptr.Of(false),
+
+			DecisionLog:        ptr.Of(false),
+			DecisionLogMaxSize: ptr.Of("100MiB"),
+			SOCKSProxy:         ptr.Of("127.0.0.1:1081"),
+		},
 		Containerd: Containerd{
 			System: ptr.Of(true),
 			User:   ptr.Of(false),
@@ -474,11 +710,20 @@ func TestFillDefault(t *testing.T) {
 			},
 		},
 		SSH: SSH{
-			LocalPort:         ptr.Of(4433),
-			LoadDotSSHPubKeys: ptr.Of(true),
-			ForwardAgent:      ptr.Of(true),
-			ForwardX11:        ptr.Of(false),
-			ForwardX11Trusted: ptr.Of(false),
+			LocalPort:             ptr.Of(4433),
+			LoadDotSSHPubKeys:     ptr.Of(true),
+			ForwardAgent:          ptr.Of(true),
+			ForwardX11:            ptr.Of(false),
+			ForwardX11Trusted:     ptr.Of(false),
+			OnX11Unavailable:      ptr.Of(X11UnavailableFail),
+			ProvisionUser:         ptr.Of("admin"),
+			RuntimeUser:           ptr.Of("app"),
+			OutputLimit:           ptr.Of(1024 * 1024),
+			PortForwardsConfig:    ptr.Of(false),
+			AddressTimeout:        ptr.Of("10s"),
+			ProbeFailureThreshold: ptr.Of(0),
+			OnConnectivityLoss:    ptr.Of(SSHConnectivityLossStop),
+			ExitMasterTimeout:     ptr.Of("5s"),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: ptr.Of(true),
@@ -489,25 +734,54 @@ func TestFillDefault(t *testing.T) {
 		Video: Video{
 			Display: ptr.Of("cocoa"),
 			VNC: VNCOptions{
-				Display: ptr.Of("none"),
+				Display:          ptr.Of("none"),
+				OnInvalidDisplay: ptr.Of(VNCInvalidDisplayFail),
 			},
 		},
+		Secrets: Secrets{
+			VNC: SecretPolicy{
+				Length:  ptr.Of(7),
+				Digits:  ptr.Of(3),
+				Symbols: ptr.Of(2),
+				NoUpper: ptr.Of(false),
+			},
+		},
+		GuestReadyFile: GuestReadyFile{
+			Path:    "/run/o-ready",
+			Timeout: ptr.Of("1m"),
+		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
 			IPv6:    ptr.Of(false),
 			Hosts: map[string]string{
 				"override.": "underflow",
 			},
+			SearchDomains:   []string{"o.lima.internal"},
+			Optional:        ptr.Of(false),
+			UpstreamServers: []string{"https://dns.o.example/dns-query"},
+			Forwarders: map[string][]string{
+				"corp.example": {"10.0.0.54:5353"},
+			},
+
+			ResolvConfMode: ptr.Of(ResolvConfUnmanaged),
+			PersistPorts:   ptr.Of(false),
+			CacheSize:      ptr.Of(0),
+			LogQueries:     ptr.Of(false),
+			QueryLog:       ptr.Of(true),
 		},
 		PropagateProxyEnv: ptr.Of(false),
+		HostFileUmask:     ptr.Of("027"),
 
 		Mounts: []Mount{
 			{
 				Location: "/var/log",
 				Writable: ptr.Of(true),
+				Verify:   ptr.Of(true),
 				SSHFS: SSHFS{
 					Cache:          ptr.Of(false),
 					FollowSymlinks: ptr.Of(true),
+					OnDisconnect:   ptr.Of(SSHFSOnDisconnectDegrade),
+					MaxRemounts:    ptr.Of(5),
 				},
 				NineP: NineP{
 					SecurityModel:   ptr.Of("mapped-file"),
@@ -531,6 +805,9 @@ func TestFillDefault(t *testing.T) {
 				Script:      "#!/bin/false",
 				Mode:        ProbeModeReadiness,
 				Description: "Another Probe",
+				Phase:       ProbePhaseFinal,
+				Timeout:     "1m",
+				Interval:    "5s",
 			},
 		},
 		Networks: []Network{
@@ -556,7 +833,8 @@ func TestFillDefault(t *testing.T) {
 			HostPortRange:  [2]int{8080, 8080},
 			Proto:          TCP,
 		}},
-		CopyToHost: []CopyToHost{{}},
+		CopyToHost:  []CopyToHost{{IfExists: CopyToHostBackup}},
+		CopyToGuest: []CopyToGuest{{Owner: "root", Permissions: "600"}},
 		Env: map[string]string{
 			"TWO":   "deux",
 			"THREE": "trois",
@@ -576,8 +854,10 @@ func TestFillDefault(t *testing.T) {
 
 	expect.Provision = append(append(o.Provision, y.Provision...), d.Provision...)
 	expect.Probes = append(append(o.Probes, y.Probes...), d.Probes...)
+	expect.Host.Prerequisites = append(append(o.Host.Prerequisites, y.Host.Prerequisites...), d.Host.Prerequisites...)
 	expect.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
 	expect.CopyToHost = append(append(o.CopyToHost, y.CopyToHost...), d.CopyToHost...)
+	expect.CopyToGuest = append(append(o.CopyToGuest, y.CopyToGuest...), d.CopyToGuest...)
 	expect.Containerd.Archives = append(append(o.Containerd.Archives, y.Containerd.Archives...), d.Containerd.Archives...)
 	expect.AdditionalDisks = append(append(o.AdditionalDisks, y.AdditionalDisks...), d.AdditionalDisks...)
 
@@ -587,8 +867,11 @@ func TestFillDefault(t *testing.T) {
 	// o.Mounts just makes d.Mounts[0] writable because the Location matches
 	expect.Mounts = append(d.Mounts, y.Mounts...)
 	expect.Mounts[0].Writable = ptr.Of(true)
+	expect.Mounts[0].Verify = ptr.Of(true)
 	expect.Mounts[0].SSHFS.Cache = ptr.Of(false)
 	expect.Mounts[0].SSHFS.FollowSymlinks = ptr.Of(true)
+	expect.Mounts[0].SSHFS.OnDisconnect = ptr.Of(SSHFSOnDisconnectDegrade)
+	expect.Mounts[0].SSHFS.MaxRemounts = ptr.Of(5)
 	expect.Mounts[0].NineP.SecurityModel = ptr.Of("mapped-file")
 	expect.Mounts[0].NineP.ProtocolVersion = ptr.Of("9p2000")
 	expect.Mounts[0].NineP.Msize = ptr.Of("8KiB")
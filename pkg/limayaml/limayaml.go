@@ -13,21 +13,30 @@ type LimaYAML struct {
 	Images             []Image         `yaml:"images" json:"images"` // REQUIRED
 	CPUType            map[Arch]string `yaml:"cpuType,omitempty" json:"cpuType,omitempty"`
 	CPUs               *int            `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	Host               Host            `yaml:"host,omitempty" json:"host,omitempty"`
 	Memory             *string         `yaml:"memory,omitempty" json:"memory,omitempty"` // go-units.RAMInBytes
 	Disk               *string         `yaml:"disk,omitempty" json:"disk,omitempty"`     // go-units.RAMInBytes
 	AdditionalDisks    []Disk          `yaml:"additionalDisks,omitempty" json:"additionalDisks,omitempty"`
 	Mounts             []Mount         `yaml:"mounts,omitempty" json:"mounts,omitempty"`
 	MountType          *MountType      `yaml:"mountType,omitempty" json:"mountType,omitempty"`
+	MountsAfter        *MountsAfter    `yaml:"mountsAfter,omitempty" json:"mountsAfter,omitempty"`
 	SSH                SSH             `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
 	Firmware           Firmware        `yaml:"firmware,omitempty" json:"firmware,omitempty"`
 	Audio              Audio           `yaml:"audio,omitempty" json:"audio,omitempty"`
 	Video              Video           `yaml:"video,omitempty" json:"video,omitempty"`
+	Secrets            Secrets         `yaml:"secrets,omitempty" json:"secrets,omitempty"`
 	Provision          []Provision     `yaml:"provision,omitempty" json:"provision,omitempty"`
 	Containerd         Containerd      `yaml:"containerd,omitempty" json:"containerd,omitempty"`
 	GuestInstallPrefix *string         `yaml:"guestInstallPrefix,omitempty" json:"guestInstallPrefix,omitempty"`
+	GuestAgent         GuestAgent      `yaml:"guestAgent,omitempty" json:"guestAgent,omitempty"`
+	HostAgent          HostAgent       `yaml:"hostAgent,omitempty" json:"hostAgent,omitempty"`
 	Probes             []Probe         `yaml:"probes,omitempty" json:"probes,omitempty"`
+	GuestReadyFile     GuestReadyFile  `yaml:"guestReadyFile,omitempty" json:"guestReadyFile,omitempty"`
 	PortForwards       []PortForward   `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
+	PortForwarding     PortForwarding  `yaml:"portForwarding,omitempty" json:"portForwarding,omitempty"`
 	CopyToHost         []CopyToHost    `yaml:"copyToHost,omitempty" json:"copyToHost,omitempty"`
+	CopyToGuest        []CopyToGuest   `yaml:"copyToGuest,omitempty" json:"copyToGuest,omitempty"`
+	HostFileUmask      *string         `yaml:"hostFileUmask,omitempty" json:"hostFileUmask,omitempty"` // octal, e.g. "077"
 	Message            string          `yaml:"message,omitempty" json:"message,omitempty"`
 	Networks           []Network       `yaml:"networks,omitempty" json:"networks,omitempty"`
 	// `network` was deprecated in Lima v0.7.0, removed in Lima v0.14.0. Use `networks` instead.
@@ -42,10 +51,11 @@ type LimaYAML struct {
 }
 
 type (
-	OS        = string
-	Arch      = string
-	MountType = string
-	VMType    = string
+	OS          = string
+	Arch        = string
+	MountType   = string
+	MountsAfter = string
+	VMType      = string
 )
 
 const (
@@ -61,6 +71,11 @@ const (
 	VIRTIOFS MountType = "virtiofs"
 	WSLMount MountType = "wsl2"
 
+	// MountsAfter* specify the requirements to be satisfied before setting up reverse-sshfs mounts
+	MountsAfterEssential MountsAfter = "essential"
+	MountsAfterOptional  MountsAfter = "optional"
+	MountsAfterFinal     MountsAfter = "final"
+
 	QEMU VMType = "qemu"
 	VZ   VMType = "vz"
 	WSL2 VMType = "wsl2"
@@ -102,6 +117,8 @@ type Mount struct {
 	SSHFS      SSHFS    `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
 	NineP      NineP    `yaml:"9p,omitempty" json:"9p,omitempty"`
 	Virtiofs   Virtiofs `yaml:"virtiofs,omitempty" json:"virtiofs,omitempty"`
+	// Verify checks that the reverse-sshfs mount reflects the host directory, using sentinel files
+	Verify *bool `yaml:"verify,omitempty" json:"verify,omitempty"` // default: false
 }
 
 type SFTPDriver = string
@@ -115,8 +132,19 @@ type SSHFS struct {
 	Cache          *bool       `yaml:"cache,omitempty" json:"cache,omitempty"`
 	FollowSymlinks *bool       `yaml:"followSymlinks,omitempty" json:"followSymlinks,omitempty"`
 	SFTPDriver     *SFTPDriver `yaml:"sftpDriver,omitempty" json:"sftpDriver,omitempty"`
+
+	OnDisconnect *SSHFSOnDisconnect `yaml:"onDisconnect,omitempty" json:"onDisconnect,omitempty"` // default: "remount"
+	MaxRemounts  *int               `yaml:"maxRemounts,omitempty" json:"maxRemounts,omitempty"`   // default: 3
 }
 
+type SSHFSOnDisconnect = string
+
+const (
+	SSHFSOnDisconnectRemount SSHFSOnDisconnect = "remount"
+	SSHFSOnDisconnectIgnore  SSHFSOnDisconnect = "ignore"
+	SSHFSOnDisconnectDegrade SSHFSOnDisconnect = "degrade"
+)
+
 type NineP struct {
 	SecurityModel   *string `yaml:"securityModel,omitempty" json:"securityModel,omitempty"`
 	ProtocolVersion *string `yaml:"protocolVersion,omitempty" json:"protocolVersion,omitempty"`
@@ -128,6 +156,132 @@ type Virtiofs struct {
 	QueueSize *int `yaml:"queueSize,omitempty" json:"queueSize,omitempty"`
 }
 
+type Host struct {
+	// CPUAffinity is the list of host CPUs the VM process is pinned to
+	CPUAffinity []int `yaml:"cpuAffinity,omitempty" json:"cpuAffinity,omitempty"`
+	// Prerequisites are checked on the host in order, before the VM is started
+	Prerequisites []Prerequisite `yaml:"prerequisites,omitempty" json:"prerequisites,omitempty"`
+}
+
+type Prerequisite struct {
+	Description string `yaml:"description,omitempty" json:"description,omitempty"` // default: "host prerequisite N/M"
+	// Command is the host command to run, without a shell
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+	// ExpectedExitCode is the exit code of the command when the prerequisite is met
+	ExpectedExitCode int `yaml:"expectedExitCode,omitempty" json:"expectedExitCode,omitempty"` // default: 0
+	// ExpectedOutput is a regular expression that the stdout of the command must match, if not empty
+	ExpectedOutput string `yaml:"expectedOutput,omitempty" json:"expectedOutput,omitempty"`
+	// Hint is shown when the prerequisite is not met, e.g., how to meet it
+	Hint string `yaml:"hint,omitempty" json:"hint,omitempty"`
+}
+
+type GuestAgent struct {
+	// MaxReconnects is the number of consecutive failed attempts to connect to the guest agent,
+	// after which the host agent stops trying. 0 means unlimited.
+	MaxReconnects *int `yaml:"maxReconnects,omitempty" json:"maxReconnects,omitempty"` // default: 0
+	// DialTimeout is the timeout for connecting to the guest agent, as a duration string. "0s" means no timeout.
+	DialTimeout *string `yaml:"dialTimeout,omitempty" json:"dialTimeout,omitempty"` // default: "10s"
+	// ReconnectInterval is the interval before retrying to connect to the guest agent after the first failure.
+	// The interval is doubled for each consecutive failure up to ReconnectMaxInterval, with a jitter of 20%.
+	ReconnectInterval    *string `yaml:"reconnectInterval,omitempty" json:"reconnectInterval,omitempty"`       // default: "10s"
+	ReconnectMaxInterval *string `yaml:"reconnectMaxInterval,omitempty" json:"reconnectMaxInterval,omitempty"` // default: "5m"
+	// DegradeAfterFailures is the number of consecutive failed attempts to connect to the guest agent,
+	// after which the instance is reported as degraded while retrying. 0 means never.
+	DegradeAfterFailures *int `yaml:"degradeAfterFailures,omitempty" json:"degradeAfterFailures,omitempty"` // default: 0
+
+	// VSock connects to the guest agent over vsock when the driver supports it (VZ, and QEMU on Linux hosts),
+	// instead of forwarding the guest agent socket over SSH. WSL2 always uses vsock.
+	VSock *bool `yaml:"vsock,omitempty" json:"vsock,omitempty"` // default: true
+	// VSockFallback falls back to forwarding the guest agent socket over SSH when no VSock port can be allocated.
+	// When disabled, failing to allocate a VSock port is an error.
+	VSockFallback *bool `yaml:"vsockFallback,omitempty" json:"vsockFallback,omitempty"` // default: true
+
+	// EagerPortForwards forwards the ports listed in the guest agent Info on (re)connect,
+	// without waiting for the first event from the guest agent.
+	EagerPortForwards *bool `yaml:"eagerPortForwards,omitempty" json:"eagerPortForwards,omitempty"` // default: false
+
+	// ReachabilityCommand is the shell command run by the guest agent to check whether a guest port accepts
+	// connections, e.g., before binding a lazy port forward. "{{.IP}}" and "{{.Port}}" are substituted.
+	// When empty, or when the command is not found in the guest, the guest agent dials the port itself.
+	ReachabilityCommand *string `yaml:"reachabilityCommand,omitempty" json:"reachabilityCommand,omitempty"` // default: ""
+
+	// OnPermanentError is the action when connecting to the guest agent failed with an error that will not
+	// go away by retrying, e.g., an authentication failure or an incompatible API version.
+	OnPermanentError *GuestAgentPermanentErrorPolicy `yaml:"onPermanentError,omitempty" json:"onPermanentError,omitempty"` // default: "degrade"
+
+	// Additional are the guest agents run by the user in addition to the one of Lima, e.g., one for each
+	// network namespace of the containers. Their ports are forwarded like the ones of the guest agent of Lima.
+	Additional []AdditionalGuestAgent `yaml:"additional,omitempty" json:"additional,omitempty"`
+}
+
+type AdditionalGuestAgent struct {
+	// Name tags the ports forwarded for the guest agent, in the logs and the decision log
+	Name string `yaml:"name" json:"name"`
+	// Socket is the unix socket of the guest agent in the guest, i.e., `lima-guestagent daemon --socket`
+	Socket string `yaml:"socket" json:"socket"`
+	// GuestIP is the address of the network namespace of the guest agent, which replaces the unspecified
+	// address of the ports reported by it. The loopback ports are then skipped, as they are not reachable.
+	GuestIP net.IP `yaml:"guestIP,omitempty" json:"guestIP,omitempty"` // default: the reported addresses as is
+}
+
+type GuestAgentPermanentErrorPolicy = string
+
+const (
+	GuestAgentPermanentErrorDegrade GuestAgentPermanentErrorPolicy = "degrade"
+	GuestAgentPermanentErrorRetry   GuestAgentPermanentErrorPolicy = "retry"
+)
+
+type PortForwarding struct {
+	// IncludeFiles are YAML files with additional `portForwards` rules, loaded by the host agent.
+	// Relative paths are resolved against the instance directory.
+	IncludeFiles []string `yaml:"includeFiles,omitempty" json:"includeFiles,omitempty"`
+	// DryRun receives the guest agent events, but only logs the forwards instead of setting them up.
+	// This is useful for telling guest agent issues apart from port forwarding issues.
+	DryRun *bool `yaml:"dryRun,omitempty" json:"dryRun,omitempty"` // default: false
+	// DecisionLog appends the forwarding decisions for the guest agent events to a JSON lines file
+	// in the instance directory.
+	DecisionLog *bool `yaml:"decisionLog,omitempty" json:"decisionLog,omitempty"` // default: false
+	// DecisionLogMaxSize is the size after which the decision log is rotated, e.g., "10MiB"
+	DecisionLogMaxSize *string `yaml:"decisionLogMaxSize,omitempty" json:"decisionLogMaxSize,omitempty"` // default: "10MiB"
+	// SOCKSProxy is the host address of a SOCKS5 proxy into the guest network, e.g., "127.0.0.1:1080".
+	// The connections are made by sshd in the guest. An empty string disables the proxy.
+	SOCKSProxy *string `yaml:"socksProxy,omitempty" json:"socksProxy,omitempty"` // default: ""
+}
+
+type HostAgent struct {
+	// EventTimeUTC emits the event timestamps in UTC rather than in the local time zone.
+	EventTimeUTC *bool `yaml:"eventTimeUTC,omitempty" json:"eventTimeUTC,omitempty"` // default: false
+	// StartupTimeline emits the durations of the startup phases as an event, along with the Running status.
+	StartupTimeline *bool `yaml:"startupTimeline,omitempty" json:"startupTimeline,omitempty"` // default: false
+	// RequirementsParallelism is the maximum number of independent requirements, e.g., readiness probes,
+	// checked concurrently.
+	RequirementsParallelism *int `yaml:"requirementsParallelism,omitempty" json:"requirementsParallelism,omitempty"` // default: 1
+	// MetricsAddress is the host address of the HTTP listener for the Prometheus metrics on "/metrics",
+	// e.g., "127.0.0.1:9187". An empty string disables the listener.
+	MetricsAddress *string `yaml:"metricsAddress,omitempty" json:"metricsAddress,omitempty"` // default: ""
+	// EventLog appends the events to a JSON lines file in the instance directory, with the sequence numbers,
+	// so that the events can be replayed by the clients that attach after the events have been emitted.
+	EventLog *bool `yaml:"eventLog,omitempty" json:"eventLog,omitempty"` // default: false
+	// EventLogMaxSize is the size after which the event log is rotated, e.g., "10MiB"
+	EventLogMaxSize *string `yaml:"eventLogMaxSize,omitempty" json:"eventLogMaxSize,omitempty"` // default: "10MiB"
+	// SyslogTag forwards the events to the system log with the tag, e.g., "lima-default".
+	// An empty string disables forwarding. Not supported on Windows.
+	SyslogTag *string `yaml:"syslogTag,omitempty" json:"syslogTag,omitempty"` // default: ""
+	// SyslogFacility is the facility of the events forwarded to the system log, e.g., "daemon" or "local0".
+	SyslogFacility *string `yaml:"syslogFacility,omitempty" json:"syslogFacility,omitempty"` // default: "daemon"
+	// GuestPoweroffTimeout is the time to wait for the guest to power off with `sudo poweroff` over SSH,
+	// when the instance is stopped, before stopping the VM with the driver. An empty string disables it.
+	GuestPoweroffTimeout *string `yaml:"guestPoweroffTimeout,omitempty" json:"guestPoweroffTimeout,omitempty"` // default: ""
+	// MDNS publishes "lima-<name>.local" with a multicast DNS responder on the host.
+	MDNS *bool `yaml:"mdns,omitempty" json:"mdns,omitempty"` // default: false
+	// MDNSAddress is the address published for "lima-<name>.local", e.g., the guest address on a bridged network.
+	// An empty string publishes the address of the host on the subnet of each querier.
+	MDNSAddress *string `yaml:"mdnsAddress,omitempty" json:"mdnsAddress,omitempty"` // default: ""
+	// IdleSuspend is the duration of the guest inactivity after which the VM is paused, e.g., "30m".
+	// The VM is resumed on the next SSH or port forwarding connection. An empty string disables it.
+	IdleSuspend *string `yaml:"idleSuspend,omitempty" json:"idleSuspend,omitempty"` // default: ""
+}
+
 type SSH struct {
 	LocalPort *int `yaml:"localPort,omitempty" json:"localPort,omitempty"`
 
@@ -136,8 +290,49 @@ type SSH struct {
 	ForwardAgent      *bool `yaml:"forwardAgent,omitempty" json:"forwardAgent,omitempty"`           // default: false
 	ForwardX11        *bool `yaml:"forwardX11,omitempty" json:"forwardX11,omitempty"`               // default: false
 	ForwardX11Trusted *bool `yaml:"forwardX11Trusted,omitempty" json:"forwardX11Trusted,omitempty"` // default: false
+	// OnX11Unavailable is the action when X11 forwarding is requested, but no X server is detected on the host.
+	OnX11Unavailable *X11UnavailablePolicy `yaml:"onX11Unavailable,omitempty" json:"onX11Unavailable,omitempty"` // default: "warn"
+
+	// ProvisionUser is the guest user for the requirement checks and copyToHost.
+	ProvisionUser *string `yaml:"provisionUser,omitempty" json:"provisionUser,omitempty"` // default: the Lima user
+	// RuntimeUser is the guest user for port forwarding, mounts, and interactive sessions.
+	RuntimeUser *string `yaml:"runtimeUser,omitempty" json:"runtimeUser,omitempty"` // default: the Lima user
+
+	// OutputLimit is the maximum number of bytes captured from the stdout and the stderr of the
+	// SSH commands executed by the host agent.
+	OutputLimit *int `yaml:"outputLimit,omitempty" json:"outputLimit,omitempty"` // default: 65536
+	// PortForwardsConfig writes an SSH config snippet with the active TCP port forwards
+	// next to the SSH config file, and keeps it in sync.
+	PortForwardsConfig *bool `yaml:"portForwardsConfig,omitempty" json:"portForwardsConfig,omitempty"` // default: false
+	// AddressTimeout is the timeout for resolving the SSH address of a WSL2 instance after start,
+	// as a duration string. "0s" means a single attempt.
+	AddressTimeout *string `yaml:"addressTimeout,omitempty" json:"addressTimeout,omitempty"` // default: "30s"
+	// ProbeFailureThreshold is the number of consecutive failed SSH health probes after which the SSH
+	// connectivity is considered lost, once the instance is running. 0 disables the probes.
+	ProbeFailureThreshold *int `yaml:"probeFailureThreshold,omitempty" json:"probeFailureThreshold,omitempty"` // default: 3
+	// OnConnectivityLoss is the action when the SSH connectivity is lost.
+	OnConnectivityLoss *SSHConnectivityLossPolicy `yaml:"onConnectivityLoss,omitempty" json:"onConnectivityLoss,omitempty"` // default: "degrade"
+	// ExitMasterTimeout is the timeout for the SSH control master to exit on shutdown, as a duration string.
+	// The master is killed when it does not exit in time.
+	ExitMasterTimeout *string `yaml:"exitMasterTimeout,omitempty" json:"exitMasterTimeout,omitempty"` // default: "10s"
 }
 
+type SSHConnectivityLossPolicy = string
+
+const (
+	SSHConnectivityLossDegrade SSHConnectivityLossPolicy = "degrade"
+	SSHConnectivityLossRecover SSHConnectivityLossPolicy = "recover"
+	SSHConnectivityLossStop    SSHConnectivityLossPolicy = "stop"
+)
+
+type X11UnavailablePolicy = string
+
+const (
+	X11UnavailableWarn    X11UnavailablePolicy = "warn"
+	X11UnavailableDisable X11UnavailablePolicy = "disable"
+	X11UnavailableFail    X11UnavailablePolicy = "fail"
+)
+
 type Firmware struct {
 	// LegacyBIOS disables UEFI if set.
 	// LegacyBIOS is ignored for aarch64.
@@ -151,14 +346,37 @@ type Audio struct {
 
 type VNCOptions struct {
 	Display *string `yaml:"display,omitempty" json:"display,omitempty"`
+	// OnInvalidDisplay is the action when the display cannot be parsed by the host agent.
+	OnInvalidDisplay *VNCInvalidDisplayPolicy `yaml:"onInvalidDisplay,omitempty" json:"onInvalidDisplay,omitempty"` // default: "fail"
 }
 
+type VNCInvalidDisplayPolicy = string
+
+const (
+	VNCInvalidDisplayFail    VNCInvalidDisplayPolicy = "fail"
+	VNCInvalidDisplayDisable VNCInvalidDisplayPolicy = "disable"
+)
+
 type Video struct {
 	// Display is a QEMU display string
 	Display *string    `yaml:"display,omitempty" json:"display,omitempty"`
 	VNC     VNCOptions `yaml:"vnc" json:"vnc"`
 }
 
+// Secrets contains the policies for the secrets generated by Lima, per purpose.
+type Secrets struct {
+	// VNC is the policy for the VNC password
+	VNC SecretPolicy `yaml:"vnc,omitempty" json:"vnc,omitempty"`
+}
+
+// SecretPolicy specifies the length and the character set of a generated secret.
+type SecretPolicy struct {
+	Length  *int  `yaml:"length,omitempty" json:"length,omitempty"`
+	Digits  *int  `yaml:"digits,omitempty" json:"digits,omitempty"`   // number of digits
+	Symbols *int  `yaml:"symbols,omitempty" json:"symbols,omitempty"` // number of special symbols
+	NoUpper *bool `yaml:"noUpper,omitempty" json:"noUpper,omitempty"` // exclude uppercase letters
+}
+
 type ProvisionMode = string
 
 const (
@@ -186,11 +404,45 @@ const (
 	ProbeModeReadiness ProbeMode = "readiness"
 )
 
+type ProbePhase = string
+
+const (
+	ProbePhaseEssential ProbePhase = "essential"
+	ProbePhaseOptional  ProbePhase = "optional"
+	ProbePhaseFinal     ProbePhase = "final"
+)
+
 type Probe struct {
 	Mode        ProbeMode // default: "readiness"
 	Description string
 	Script      string
 	Hint        string
+	// Name identifies the probe in the `after` field of the other probes
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// After is the names of the previous probes that must be satisfied before the probe is checked.
+	// The probe is checked concurrently with the other probes otherwise, see `hostAgent.requirementsParallelism`.
+	After []string `yaml:"after,omitempty" json:"after,omitempty"`
+	// Timeout is the time to wait for the probe to be satisfied, as a duration string.
+	// The running check is killed on the timeout. Empty means retrying the probe for about 10 minutes.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Phase is the requirements the probe is checked along with, see ProbePhase
+	Phase ProbePhase `yaml:"phase,omitempty" json:"phase,omitempty"` // default: "optional"
+	// ExpectedExitCode is the exit code of the script when the probe is satisfied
+	ExpectedExitCode int `yaml:"expectedExitCode,omitempty" json:"expectedExitCode,omitempty"` // default: 0
+	// Retries is the number of times the script is run until the probe is satisfied.
+	// When Timeout is set, nil means retrying until the timeout.
+	Retries *int `yaml:"retries,omitempty" json:"retries,omitempty"` // default: 60, unless Timeout is set
+	// Interval is the time between the retries, as a duration string
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"` // default: "10s"
+}
+
+// GuestReadyFile is a sentinel file in the guest that signals the readiness of the instance,
+// checked after all the other requirements.
+type GuestReadyFile struct {
+	// Path is the absolute path of the file in the guest. Empty disables the check.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Timeout is the time to wait for the file to appear, as a duration string
+	Timeout *string `yaml:"timeout,omitempty" json:"timeout,omitempty"` // default: "10m"
 }
 
 type Proto = string
@@ -200,6 +452,9 @@ const (
 )
 
 type PortForward struct {
+	// Name is an optional name of the rule, shown in the logs and the events of its forwards.
+	// Names must be unique.
+	Name              string `yaml:"name,omitempty" json:"name,omitempty"`
 	GuestIPMustBeZero bool   `yaml:"guestIPMustBeZero,omitempty" json:"guestIPMustBeZero,omitempty"`
 	GuestIP           net.IP `yaml:"guestIP,omitempty" json:"guestIP,omitempty"`
 	GuestPort         int    `yaml:"guestPort,omitempty" json:"guestPort,omitempty"`
@@ -212,14 +467,81 @@ type PortForward struct {
 	Proto             Proto  `yaml:"proto,omitempty" json:"proto,omitempty"`
 	Reverse           bool   `yaml:"reverse,omitempty" json:"reverse,omitempty"`
 	Ignore            bool   `yaml:"ignore,omitempty" json:"ignore,omitempty"`
+	LazyBind          bool   `yaml:"lazyBind,omitempty" json:"lazyBind,omitempty"`
+	// HostPortPool is a range of host ports allocated sequentially to the matching guest ports,
+	// instead of HostPortRange. A port is freed when the guest port is closed.
+	HostPortPool [2]int `yaml:"hostPortPool,omitempty" json:"hostPortPool,omitempty"`
+
+	// GuestTLS makes the host agent connect to the guest port over TLS
+	GuestTLS *GuestTLS `yaml:"guestTLS,omitempty" json:"guestTLS,omitempty"`
+	// OnReady is the host command to run after the forward has been set up
+	OnReady []string `yaml:"onReady,omitempty" json:"onReady,omitempty"`
+	// GuestSocketPruneDirs are the guest directories that may be created for a reverse GuestSocket,
+	// and removed again on teardown when they are empty
+	GuestSocketPruneDirs []string `yaml:"guestSocketPruneDirs,omitempty" json:"guestSocketPruneDirs,omitempty"`
+	// ListenBacklog is the listen backlog of the host listener for the forwards relayed by the host agent,
+	// i.e., `guestTLS` forwards, forwards with connection limits, and privileged ports on macOS. 0 means the system default.
+	ListenBacklog int `yaml:"listenBacklog,omitempty" json:"listenBacklog,omitempty"`
+	// AcknowledgeWellKnownPort suppresses the warning about forwarding to the host port of a well-known host service
+	AcknowledgeWellKnownPort bool `yaml:"acknowledgeWellKnownPort,omitempty" json:"acknowledgeWellKnownPort,omitempty"`
+	// GuestTargets are the "host:port" addresses reachable from the guest, which the host address is
+	// relayed to round-robin by the host agent. The relay is set up on start, like the guestSocket forwards.
+	GuestTargets []string `yaml:"guestTargets,omitempty" json:"guestTargets,omitempty"`
+	// MaxConnections is the maximum number of connections relayed at a time. The connections beyond
+	// the limit are closed right away. 0 means unlimited.
+	MaxConnections int `yaml:"maxConnections,omitempty" json:"maxConnections,omitempty"`
+	// IdleTimeout closes the relayed connections that have not sent or received any data for the duration.
+	IdleTimeout string `yaml:"idleTimeout,omitempty" json:"idleTimeout,omitempty"` // default: no timeout
+	// HostBindACL are the IP addresses and the CIDRs of the clients accepted by the host listener.
+	// The connections from the other clients are closed right away. Empty means any client.
+	HostBindACL []string `yaml:"hostBindACL,omitempty" json:"hostBindACL,omitempty"`
+}
+
+// GuestTLS contains the credentials for connecting to a guest service over TLS.
+// The paths are local paths on the host.
+type GuestTLS struct {
+	CA         string `yaml:"ca,omitempty" json:"ca,omitempty"` // default: the system CAs
+	ClientCert string `yaml:"clientCert,omitempty" json:"clientCert,omitempty"`
+	ClientKey  string `yaml:"clientKey,omitempty" json:"clientKey,omitempty"`
+	ServerName string `yaml:"serverName,omitempty" json:"serverName,omitempty"` // default: the guest IP
 }
 
 type CopyToHost struct {
 	GuestFile    string `yaml:"guest,omitempty" json:"guest,omitempty"`
 	HostFile     string `yaml:"host,omitempty" json:"host,omitempty"`
 	DeleteOnStop bool   `yaml:"deleteOnStop,omitempty" json:"deleteOnStop,omitempty"`
+	// IfExists is the action when the host file already exists
+	IfExists CopyToHostExistsPolicy `yaml:"ifExists,omitempty" json:"ifExists,omitempty"` // default: "overwrite"
+	// ExpectedSHA256 is the hex-encoded SHA-256 digest of the file. A copy that does not match is discarded.
+	ExpectedSHA256 string `yaml:"expectedSHA256,omitempty" json:"expectedSHA256,omitempty"`
+	// Watch makes the host agent copy the file again whenever it has changed in the guest
+	Watch bool `yaml:"watch,omitempty" json:"watch,omitempty"`
+	// WatchInterval is the interval of checking the guest file for changes
+	WatchInterval string `yaml:"watchInterval,omitempty" json:"watchInterval,omitempty"` // default: "10s" with `watch`
 }
 
+// CopyToGuest copies a host file to the guest, after the essential requirements.
+type CopyToGuest struct {
+	HostFile  string `yaml:"host,omitempty" json:"host,omitempty"`
+	GuestFile string `yaml:"guest,omitempty" json:"guest,omitempty"`
+	// Owner is the owner of the guest file, as "user" or "user:group"
+	Owner string `yaml:"owner,omitempty" json:"owner,omitempty"` // default: "root"
+	// Permissions are the permissions of the guest file
+	Permissions string `yaml:"permissions,omitempty" json:"permissions,omitempty"` // octal, default: "644"
+	// Watch makes the host agent copy the file again whenever it has changed on the host
+	Watch bool `yaml:"watch,omitempty" json:"watch,omitempty"`
+	// WatchInterval is the interval of checking the host file for changes
+	WatchInterval string `yaml:"watchInterval,omitempty" json:"watchInterval,omitempty"` // default: "10s" with `watch`
+}
+
+type CopyToHostExistsPolicy = string
+
+const (
+	CopyToHostOverwrite CopyToHostExistsPolicy = "overwrite"
+	CopyToHostSkip      CopyToHostExistsPolicy = "skip"
+	CopyToHostBackup    CopyToHostExistsPolicy = "backup"
+)
+
 type Network struct {
 	// `Lima`, `Socket`, and `VNL` are mutually exclusive; exactly one is required
 	Lima string `yaml:"lima,omitempty" json:"lima,omitempty"`
@@ -238,11 +560,42 @@ type Network struct {
 }
 
 type HostResolver struct {
-	Enabled *bool             `yaml:"enabled,omitempty" json:"enabled,omitempty"`
-	IPv6    *bool             `yaml:"ipv6,omitempty" json:"ipv6,omitempty"`
-	Hosts   map[string]string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Enabled       *bool             `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	IPv6          *bool             `yaml:"ipv6,omitempty" json:"ipv6,omitempty"`
+	Hosts         map[string]string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	SearchDomains []string          `yaml:"searchDomains,omitempty" json:"searchDomains,omitempty"`
+	Optional      *bool             `yaml:"optional,omitempty" json:"optional,omitempty"`
+
+	ResolvConfMode *ResolvConfMode `yaml:"resolvConfMode,omitempty" json:"resolvConfMode,omitempty"`
+	// PersistPorts saves the ports of the DNS server in the instance directory, and reuses them
+	// on the next start when they are still free.
+	PersistPorts *bool `yaml:"persistPorts,omitempty" json:"persistPorts,omitempty"` // default: false
+	// CacheSize is the maximum number of the answers cached by the DNS server, until their TTLs expire.
+	// 0 disables the cache.
+	CacheSize *int `yaml:"cacheSize,omitempty" json:"cacheSize,omitempty"` // default: 1000
+	// LogQueries logs each query served by the DNS server at the debug level.
+	LogQueries *bool `yaml:"logQueries,omitempty" json:"logQueries,omitempty"` // default: false
+	// QueryLog appends each query served by the DNS server to a JSON lines file in the instance directory.
+	QueryLog *bool `yaml:"queryLog,omitempty" json:"queryLog,omitempty"` // default: false
+	// UpstreamServers resolve the names instead of the resolver of the host: "IP", "IP:port",
+	// "tls://host[:port]" for DNS-over-TLS, or "https://host[:port]/path" for DNS-over-HTTPS.
+	UpstreamServers []string `yaml:"upstreamServers,omitempty" json:"upstreamServers,omitempty"`
+	// Forwarders maps the domains, e.g., "corp.example", to the upstream servers (in the same forms as
+	// UpstreamServers) resolving the names in these domains.
+	Forwarders map[string][]string `yaml:"forwarders,omitempty" json:"forwarders,omitempty"`
 }
 
+type ResolvConfMode = string
+
+const (
+	// ResolvConfManaged makes Lima's nameservers authoritative in the guest resolv.conf
+	ResolvConfManaged ResolvConfMode = "managed"
+	// ResolvConfUnmanaged leaves the guest resolv.conf alone
+	ResolvConfUnmanaged ResolvConfMode = "unmanaged"
+	// ResolvConfAppend adds Lima's nameservers to the ones configured by the guest
+	ResolvConfAppend ResolvConfMode = "append"
+)
+
 type CACertificates struct {
 	RemoveDefaults *bool    `yaml:"removeDefaults,omitempty" json:"removeDefaults,omitempty"` // default: false
 	Files          []string `yaml:"files,omitempty" json:"files,omitempty"`
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/sirupsen/logrus"
@@ -89,3 +91,85 @@ func Load(b []byte, filePath string) (*LimaYAML, error) {
 	FillDefault(&y, &d, &o, filePath)
 	return &y, nil
 }
+
+// LoadPortForwardIncludes loads the rules of y.PortForwarding.IncludeFiles, in order.
+// Relative paths are resolved against instDir.
+//
+// The rules are filled with the defaults and validated. A rule must not bind the same host address,
+// nor have the same name, as a rule of y.PortForwards or another included rule.
+func LoadPortForwardIncludes(y *LimaYAML, instDir string) ([]PortForward, error) {
+	var res []PortForward
+	names := make(map[string]bool)
+	for _, rule := range y.PortForwards {
+		if rule.Name != "" {
+			names[rule.Name] = true
+		}
+	}
+	for _, includeFile := range y.PortForwarding.IncludeFiles {
+		if !filepath.IsAbs(includeFile) && !strings.HasPrefix(includeFile, "~") {
+			includeFile = filepath.Join(instDir, includeFile)
+		}
+		f, err := localpathutil.Expand(includeFile)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var included struct {
+			PortForwards []PortForward `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
+		}
+		if err := unmarshalYAML(b, &included, fmt.Sprintf("port forwards file %q", f)); err != nil {
+			return nil, err
+		}
+		for i := range included.PortForwards {
+			rule := &included.PortForwards[i]
+			FillPortForwardDefaults(rule, instDir)
+			field := fmt.Sprintf("portForwards[%d]", i)
+			if err := validatePortForward(field, *rule); err != nil {
+				return nil, fmt.Errorf("port forwards file %q: %w", f, err)
+			}
+			if rule.Name != "" {
+				if names[rule.Name] {
+					return nil, fmt.Errorf("port forwards file %q: field `%s.name` value %q has already been used by another rule", f, field, rule.Name)
+				}
+				names[rule.Name] = true
+			}
+			for _, other := range y.PortForwards {
+				if hostAddressesOverlap(*rule, other) {
+					return nil, fmt.Errorf("port forwards file %q: field `%s` conflicts with a rule of the instance", f, field)
+				}
+			}
+			for _, other := range res {
+				if hostAddressesOverlap(*rule, other) {
+					return nil, fmt.Errorf("port forwards file %q: field `%s` conflicts with a rule of another included file", f, field)
+				}
+			}
+			res = append(res, *rule)
+		}
+	}
+	return res, nil
+}
+
+// hostAddressesOverlap returns true if both rules bind the same host socket, or overlapping
+// ports on the same host IP.
+func hostAddressesOverlap(a, b PortForward) bool {
+	if a.Ignore || b.Ignore || a.Reverse || b.Reverse {
+		return false
+	}
+	if a.HostSocket != "" || b.HostSocket != "" {
+		return a.HostSocket == b.HostSocket
+	}
+	if !a.HostIP.Equal(b.HostIP) && !a.HostIP.IsUnspecified() && !b.HostIP.IsUnspecified() {
+		return false
+	}
+	ar, br := a.HostPortRange, b.HostPortRange
+	if a.HostPortPool != [2]int{} {
+		ar = a.HostPortPool
+	}
+	if b.HostPortPool != [2]int{} {
+		br = b.HostPortPool
+	}
+	return ar[0] <= br[1] && br[0] <= ar[1]
+}
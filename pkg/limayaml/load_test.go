@@ -1,8 +1,13 @@
 package limayaml
 
 import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"gotest.tools/v3/assert"
 )
 
@@ -65,3 +70,95 @@ additionalDisks:
 	assert.Equal(t, y.AdditionalDisks[0].FSArgs[0], "-i")
 	assert.Equal(t, y.AdditionalDisks[0].FSArgs[1], "size=512")
 }
+
+func TestLoadPortForwardIncludes(t *testing.T) {
+	instDir := t.TempDir()
+	writeFile := func(name, content string) string {
+		f := filepath.Join(instDir, name)
+		assert.NilError(t, os.WriteFile(f, []byte(content), 0o644))
+		return f
+	}
+	writeFile("team.yaml", `
+portForwards:
+- guestPort: 3000
+- guestPort: 5432
+  hostPort: 15432
+- guestPort: 8080
+  hostSocket: http.sock
+`)
+	other := writeFile("other.yaml", `
+portForwards:
+- guestPort: 3001
+  hostPort: 3000
+`)
+	writeFile("invalid.yaml", `
+portForwards:
+- guestPort: 3000
+  hostPort: 70000
+`)
+	writeFile("named.yaml", `
+portForwards:
+- guestPort: 6379
+  name: redis
+`)
+	instanceRule := PortForward{GuestPort: 80, HostPort: 8080}
+	FillPortForwardDefaults(&instanceRule, instDir)
+
+	t.Run("relative path", func(t *testing.T) {
+		y := LimaYAML{
+			PortForwards:   []PortForward{instanceRule},
+			PortForwarding: PortForwarding{IncludeFiles: []string{"team.yaml"}},
+		}
+		rules, err := LoadPortForwardIncludes(&y, instDir)
+		assert.NilError(t, err)
+		assert.Equal(t, len(rules), 3)
+		assert.Equal(t, rules[0].HostPortRange, [2]int{3000, 3000})
+		assert.Equal(t, rules[1].HostPortRange, [2]int{15432, 15432})
+		assert.Equal(t, rules[2].HostSocket, filepath.Join(instDir, filenames.SocketDir, "http.sock"))
+	})
+
+	t.Run("conflict with the instance", func(t *testing.T) {
+		rule := PortForward{GuestPort: 3000, HostIP: net.IPv4zero}
+		FillPortForwardDefaults(&rule, instDir)
+		y := LimaYAML{
+			PortForwards:   []PortForward{rule},
+			PortForwarding: PortForwarding{IncludeFiles: []string{"team.yaml"}},
+		}
+		_, err := LoadPortForwardIncludes(&y, instDir)
+		assert.ErrorContains(t, err, "field `portForwards[0]` conflicts with a rule of the instance")
+	})
+
+	t.Run("conflict with another file", func(t *testing.T) {
+		y := LimaYAML{PortForwarding: PortForwarding{IncludeFiles: []string{"team.yaml", other}}}
+		_, err := LoadPortForwardIncludes(&y, instDir)
+		assert.ErrorContains(t, err, "field `portForwards[0]` conflicts with a rule of another included file")
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		rule := PortForward{Name: "redis", GuestPort: 6380}
+		FillPortForwardDefaults(&rule, instDir)
+		y := LimaYAML{
+			PortForwards:   []PortForward{rule},
+			PortForwarding: PortForwarding{IncludeFiles: []string{"named.yaml"}},
+		}
+		_, err := LoadPortForwardIncludes(&y, instDir)
+		assert.ErrorContains(t, err, "field `portForwards[0].name` value \"redis\" has already been used by another rule")
+
+		y.PortForwards[0].Name = "cache"
+		rules, err := LoadPortForwardIncludes(&y, instDir)
+		assert.NilError(t, err)
+		assert.Equal(t, rules[0].Name, "redis")
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		y := LimaYAML{PortForwarding: PortForwarding{IncludeFiles: []string{"invalid.yaml"}}}
+		_, err := LoadPortForwardIncludes(&y, instDir)
+		assert.ErrorContains(t, err, "field `portForwards[0].hostPort`")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		y := LimaYAML{PortForwarding: PortForwarding{IncludeFiles: []string{"missing.yaml"}}}
+		_, err := LoadPortForwardIncludes(&y, instDir)
+		assert.Assert(t, errors.Is(err, os.ErrNotExist), err)
+	})
+}
@@ -1,20 +1,28 @@
 package limayaml
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 )
 
 func validateFileObject(f File, fieldName string) error {
@@ -108,6 +116,28 @@ func Validate(y LimaYAML, warn bool) error {
 		return errors.New("field `cpus` must be set")
 	}
 
+	seenCPUs := make(map[int]bool)
+	for i, cpu := range y.Host.CPUAffinity {
+		// The availability of the CPU is checked by the host agent, as the instance may be
+		// started on another host, or with a different cpuset.
+		if cpu < 0 {
+			return fmt.Errorf("field `host.cpuAffinity[%d]` must be non-negative, got %d", i, cpu)
+		}
+		if seenCPUs[cpu] {
+			return fmt.Errorf("field `host.cpuAffinity[%d]` duplicates CPU %d", i, cpu)
+		}
+		seenCPUs[cpu] = true
+	}
+
+	for i, p := range y.Host.Prerequisites {
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			return fmt.Errorf("field `host.prerequisites[%d].command` must start with a command", i)
+		}
+		if _, err := regexp.Compile(p.ExpectedOutput); err != nil {
+			return fmt.Errorf("field `host.prerequisites[%d].expectedOutput` is not a valid regular expression: %w", i, err)
+		}
+	}
+
 	if _, err := units.RAMInBytes(*y.Memory); err != nil {
 		return fmt.Errorf("field `memory` has an invalid value: %w", err)
 	}
@@ -148,6 +178,16 @@ func Validate(y LimaYAML, warn bool) error {
 			return fmt.Errorf("field `mounts[%d].location` refers to a non-directory path: %q: %w", i, f.Location, err)
 		}
 
+		switch *f.SSHFS.OnDisconnect {
+		case SSHFSOnDisconnectRemount, SSHFSOnDisconnectIgnore, SSHFSOnDisconnectDegrade:
+		default:
+			return fmt.Errorf("field `mounts[%d].sshfs.onDisconnect` must be %q, %q, or %q, got %q",
+				i, SSHFSOnDisconnectRemount, SSHFSOnDisconnectIgnore, SSHFSOnDisconnectDegrade, *f.SSHFS.OnDisconnect)
+		}
+		if *f.SSHFS.MaxRemounts < 0 {
+			return fmt.Errorf("field `mounts[%d].sshfs.maxRemounts` must not be negative, got %d", i, *f.SSHFS.MaxRemounts)
+		}
+
 		if _, err := units.RAMInBytes(*f.NineP.Msize); err != nil {
 			return fmt.Errorf("field `msize` has an invalid value: %w", err)
 		}
@@ -158,6 +198,63 @@ func Validate(y LimaYAML, warn bool) error {
 			return err
 		}
 	}
+	switch *y.SSH.OnX11Unavailable {
+	case X11UnavailableWarn, X11UnavailableDisable, X11UnavailableFail:
+	default:
+		return fmt.Errorf("field `ssh.onX11Unavailable` must be %q, %q, or %q, got %q",
+			X11UnavailableWarn, X11UnavailableDisable, X11UnavailableFail, *y.SSH.OnX11Unavailable)
+	}
+	switch *y.Video.VNC.OnInvalidDisplay {
+	case VNCInvalidDisplayFail, VNCInvalidDisplayDisable:
+	default:
+		return fmt.Errorf("field `video.vnc.onInvalidDisplay` must be %q or %q, got %q",
+			VNCInvalidDisplayFail, VNCInvalidDisplayDisable, *y.Video.VNC.OnInvalidDisplay)
+	}
+	if err := validateGuestUser("ssh.provisionUser", y.SSH.ProvisionUser); err != nil {
+		return err
+	}
+	if err := validateProvisionUser(y.SSH.ProvisionUser, u.Username); err != nil {
+		return err
+	}
+	if err := validateGuestUser("ssh.runtimeUser", y.SSH.RuntimeUser); err != nil {
+		return err
+	}
+	// The provisioning user may be root, but the runtime user must not
+	if y.SSH.RuntimeUser != nil && *y.SSH.RuntimeUser == "root" {
+		return errors.New("field `ssh.runtimeUser` must not be \"root\"")
+	}
+	if y.SSH.OutputLimit != nil && *y.SSH.OutputLimit <= 0 {
+		return fmt.Errorf("field `ssh.outputLimit` must be positive, got %d", *y.SSH.OutputLimit)
+	}
+	if y.SSH.ProbeFailureThreshold != nil && *y.SSH.ProbeFailureThreshold < 0 {
+		return fmt.Errorf("field `ssh.probeFailureThreshold` must be >= 0, got %d", *y.SSH.ProbeFailureThreshold)
+	}
+	if y.SSH.OnConnectivityLoss != nil {
+		switch *y.SSH.OnConnectivityLoss {
+		case SSHConnectivityLossDegrade, SSHConnectivityLossRecover, SSHConnectivityLossStop:
+		default:
+			return fmt.Errorf("field `ssh.onConnectivityLoss` must be %q, %q, or %q, got %q",
+				SSHConnectivityLossDegrade, SSHConnectivityLossRecover, SSHConnectivityLossStop, *y.SSH.OnConnectivityLoss)
+		}
+	}
+	if y.SSH.AddressTimeout != nil {
+		timeout, err := time.ParseDuration(*y.SSH.AddressTimeout)
+		if err != nil {
+			return fmt.Errorf("field `ssh.addressTimeout` has an invalid value: %w", err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("field `ssh.addressTimeout` must not be negative, got %q", *y.SSH.AddressTimeout)
+		}
+	}
+	if y.SSH.ExitMasterTimeout != nil {
+		timeout, err := time.ParseDuration(*y.SSH.ExitMasterTimeout)
+		if err != nil {
+			return fmt.Errorf("field `ssh.exitMasterTimeout` has an invalid value: %w", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("field `ssh.exitMasterTimeout` must be positive, got %q", *y.SSH.ExitMasterTimeout)
+		}
+	}
 
 	switch *y.MountType {
 	case REVSSHFS, NINEP, VIRTIOFS, WSLMount:
@@ -165,6 +262,12 @@ func Validate(y LimaYAML, warn bool) error {
 		return fmt.Errorf("field `mountType` must be %q or %q or %q, or %q, got %q", REVSSHFS, NINEP, VIRTIOFS, WSLMount, *y.MountType)
 	}
 
+	switch *y.MountsAfter {
+	case MountsAfterEssential, MountsAfterOptional, MountsAfterFinal:
+	default:
+		return fmt.Errorf("field `mountsAfter` must be %q, %q, or %q, got %q", MountsAfterEssential, MountsAfterOptional, MountsAfterFinal, *y.MountsAfter)
+	}
+
 	if warn && runtime.GOOS != "linux" {
 		for i, mount := range y.Mounts {
 			if mount.Virtiofs.QueueSize != nil {
@@ -192,110 +295,265 @@ func Validate(y LimaYAML, warn bool) error {
 	if needsContainerdArchives && len(y.Containerd.Archives) == 0 {
 		return fmt.Errorf("field `containerd.archives` must be provided")
 	}
-	for i, p := range y.Probes {
-		switch p.Mode {
-		case ProbeModeReadiness:
-		default:
-			return fmt.Errorf("field `probe[%d].mode` can only be %q",
-				i, ProbeModeReadiness)
-		}
+	if err := validateProbes(y.Probes); err != nil {
+		return err
 	}
+	portForwardName := make(map[string]int)
 	for i, rule := range y.PortForwards {
 		field := fmt.Sprintf("portForwards[%d]", i)
-		if rule.GuestIPMustBeZero && !rule.GuestIP.Equal(net.IPv4zero) {
-			return fmt.Errorf("field `%s.guestIPMustBeZero` can only be true when field `%s.guestIP` is 0.0.0.0", field, field)
+		if err := validatePortForward(field, rule); err != nil {
+			return err
 		}
-		if rule.GuestPort != 0 {
-			if rule.GuestSocket != "" {
-				return fmt.Errorf("field `%s.guestPort` must be 0 when field `%s.guestSocket` is set", field, field)
+		if rule.Name != "" {
+			if prev, ok := portForwardName[rule.Name]; ok {
+				return fmt.Errorf("field `%s.name` value %q has already been used by field `portForwards[%d].name`", field, rule.Name, prev)
 			}
-			if rule.GuestPort != rule.GuestPortRange[0] {
-				return fmt.Errorf("field `%s.guestPort` must match field `%s.guestPortRange[0]`", field, field)
+			portForwardName[rule.Name] = i
+		}
+		// Not validating that the various GuestPortRanges and HostPortRanges are not overlapping. Rules will be
+		// processed sequentially and the first matching rule for a guest port determines forwarding behavior.
+	}
+	if y.PortForwarding.DecisionLogMaxSize != nil {
+		size, err := units.RAMInBytes(*y.PortForwarding.DecisionLogMaxSize)
+		if err != nil {
+			return fmt.Errorf("field `portForwarding.decisionLogMaxSize` has an invalid value: %w", err)
+		}
+		if size <= 0 {
+			return fmt.Errorf("field `portForwarding.decisionLogMaxSize` must be positive, got %q", *y.PortForwarding.DecisionLogMaxSize)
+		}
+	}
+	if y.PortForwarding.SOCKSProxy != nil && *y.PortForwarding.SOCKSProxy != "" {
+		if err := validateListenAddress(*y.PortForwarding.SOCKSProxy); err != nil {
+			return fmt.Errorf("field `portForwarding.socksProxy` is invalid: %w", err)
+		}
+	}
+	for i, f := range y.PortForwarding.IncludeFiles {
+		if f == "" {
+			return fmt.Errorf("field `portForwarding.includeFiles[%d]` must not be empty", i)
+		}
+	}
+	for i, rule := range y.CopyToHost {
+		field := fmt.Sprintf("CopyToHost[%d]", i)
+		if rule.GuestFile != "" {
+			if !path.IsAbs(rule.GuestFile) {
+				return fmt.Errorf("field `%s.guest` must be an absolute path", field)
 			}
-			// redundant validation to make sure the error contains the correct field name
-			if err := validatePort(field+".guestPort", rule.GuestPort); err != nil {
-				return err
+		}
+		if rule.HostFile != "" {
+			if !filepath.IsAbs(rule.HostFile) {
+				return fmt.Errorf("field `%s.host` must be an absolute path, but is %q", field, rule.HostFile)
 			}
 		}
-		if rule.HostPort != 0 {
-			if rule.HostSocket != "" {
-				return fmt.Errorf("field `%s.hostPort` must be 0 when field `%s.hostSocket` is set", field, field)
+		switch rule.IfExists {
+		case CopyToHostOverwrite, CopyToHostSkip, CopyToHostBackup:
+		default:
+			return fmt.Errorf("field `%s.ifExists` must be %q, %q, or %q; got %q", field, CopyToHostOverwrite, CopyToHostSkip, CopyToHostBackup, rule.IfExists)
+		}
+		if rule.ExpectedSHA256 != "" && !sha256Regexp.MatchString(rule.ExpectedSHA256) {
+			return fmt.Errorf("field `%s.expectedSHA256` must be 64 hexadecimal characters, got %q", field, rule.ExpectedSHA256)
+		}
+		if rule.Watch {
+			// A rotated file never matches the expected digest, and a skipped copy is never updated
+			if rule.ExpectedSHA256 != "" || rule.IfExists == CopyToHostSkip {
+				return fmt.Errorf("field `%s.watch` cannot be used with field `%s.expectedSHA256` or `ifExists: %s`", field, field, CopyToHostSkip)
 			}
-			if rule.HostPort != rule.HostPortRange[0] {
-				return fmt.Errorf("field `%s.hostPort` must match field `%s.hostPortRange[0]`", field, field)
+			interval, err := time.ParseDuration(rule.WatchInterval)
+			if err != nil {
+				return fmt.Errorf("field `%s.watchInterval` has an invalid value: %w", field, err)
 			}
-			// redundant validation to make sure the error contains the correct field name
-			if err := validatePort(field+".hostPort", rule.HostPort); err != nil {
-				return err
+			if interval <= 0 {
+				return fmt.Errorf("field `%s.watchInterval` must be positive, got %q", field, rule.WatchInterval)
 			}
+		} else if rule.WatchInterval != "" {
+			return fmt.Errorf("field `%s.watchInterval` requires field `%s.watch`", field, field)
 		}
-		for j := 0; j < 2; j++ {
-			if err := validatePort(fmt.Sprintf("%s.guestPortRange[%d]", field, j), rule.GuestPortRange[j]); err != nil {
-				return err
-			}
-			if err := validatePort(fmt.Sprintf("%s.hostPortRange[%d]", field, j), rule.HostPortRange[j]); err != nil {
-				return err
-			}
+	}
+	for i, rule := range y.CopyToGuest {
+		if err := validateCopyToGuest(fmt.Sprintf("copyToGuest[%d]", i), rule); err != nil {
+			return err
 		}
-		if rule.GuestPortRange[0] > rule.GuestPortRange[1] {
-			return fmt.Errorf("field `%s.guestPortRange[1]` must be greater than or equal to field `%s.guestPortRange[0]`", field, field)
+	}
+
+	if err := validateSecretPolicy(y.Secrets.VNC, "secrets.vnc", 8); err != nil {
+		return err
+	}
+
+	if y.GuestAgent.MaxReconnects != nil && *y.GuestAgent.MaxReconnects < 0 {
+		return fmt.Errorf("field `guestAgent.maxReconnects` must be >= 0, got %d", *y.GuestAgent.MaxReconnects)
+	}
+	if y.GuestAgent.OnPermanentError != nil {
+		switch *y.GuestAgent.OnPermanentError {
+		case GuestAgentPermanentErrorDegrade, GuestAgentPermanentErrorRetry:
+		default:
+			return fmt.Errorf("field `guestAgent.onPermanentError` must be %q or %q, got %q",
+				GuestAgentPermanentErrorDegrade, GuestAgentPermanentErrorRetry, *y.GuestAgent.OnPermanentError)
 		}
-		if rule.HostPortRange[0] > rule.HostPortRange[1] {
-			return fmt.Errorf("field `%s.hostPortRange[1]` must be greater than or equal to field `%s.hostPortRange[0]`", field, field)
+	}
+	if y.GuestAgent.ReachabilityCommand != nil && *y.GuestAgent.ReachabilityCommand != "" {
+		if _, err := api.ReachabilityCommand(*y.GuestAgent.ReachabilityCommand, api.IPPort{IP: api.IPv4loopback1, Port: 80}); err != nil {
+			return fmt.Errorf("field `guestAgent.reachabilityCommand` is invalid: %w", err)
 		}
-		if rule.GuestPortRange[1]-rule.GuestPortRange[0] != rule.HostPortRange[1]-rule.HostPortRange[0] {
-			return fmt.Errorf("field `%s.hostPortRange` must specify the same number of ports as field `%s.guestPortRange`", field, field)
+	}
+	if y.HostAgent.RequirementsParallelism != nil && *y.HostAgent.RequirementsParallelism < 1 {
+		return fmt.Errorf("field `hostAgent.requirementsParallelism` must be positive, got %d", *y.HostAgent.RequirementsParallelism)
+	}
+	if y.HostAgent.MetricsAddress != nil && *y.HostAgent.MetricsAddress != "" {
+		if err := validateListenAddress(*y.HostAgent.MetricsAddress); err != nil {
+			return fmt.Errorf("field `hostAgent.metricsAddress` is invalid: %w", err)
 		}
-		if rule.GuestSocket != "" {
-			if !path.IsAbs(rule.GuestSocket) {
-				return fmt.Errorf("field `%s.guestSocket` must be an absolute path", field)
-			}
-			if rule.HostSocket == "" && rule.HostPortRange[1]-rule.HostPortRange[0] > 0 {
-				return fmt.Errorf("field `%s.guestSocket` can only be mapped to a single port or socket. not a range", field)
-			}
+	}
+	if y.HostAgent.EventLogMaxSize != nil {
+		size, err := units.RAMInBytes(*y.HostAgent.EventLogMaxSize)
+		if err != nil {
+			return fmt.Errorf("field `hostAgent.eventLogMaxSize` has an invalid value: %w", err)
 		}
-		if rule.HostSocket != "" {
-			if !filepath.IsAbs(rule.HostSocket) {
-				// should be unreachable because FillDefault() will prepend the instance directory to relative names
-				return fmt.Errorf("field `%s.hostSocket` must be an absolute path, but is %q", field, rule.HostSocket)
-			}
-			if rule.GuestSocket == "" && rule.GuestPortRange[1]-rule.GuestPortRange[0] > 0 {
-				return fmt.Errorf("field `%s.hostSocket` can only be mapped from a single port or socket. not a range", field)
-			}
+		if size <= 0 {
+			return fmt.Errorf("field `hostAgent.eventLogMaxSize` must be positive, got %q", *y.HostAgent.EventLogMaxSize)
 		}
-		if len(rule.HostSocket) >= osutil.UnixPathMax {
-			return fmt.Errorf("field `%s.hostSocket` must be less than UNIX_PATH_MAX=%d characters, but is %d",
-				field, osutil.UnixPathMax, len(rule.HostSocket))
+	}
+	if err := validateSyslog(y.HostAgent.SyslogTag, y.HostAgent.SyslogFacility, runtime.GOOS); err != nil {
+		return err
+	}
+	if y.HostAgent.GuestPoweroffTimeout != nil && *y.HostAgent.GuestPoweroffTimeout != "" {
+		timeout, err := time.ParseDuration(*y.HostAgent.GuestPoweroffTimeout)
+		if err != nil {
+			return fmt.Errorf("field `hostAgent.guestPoweroffTimeout` has an invalid value: %w", err)
 		}
-		if rule.Proto != TCP {
-			return fmt.Errorf("field `%s.proto` must be %q", field, TCP)
+		if timeout <= 0 {
+			return fmt.Errorf("field `hostAgent.guestPoweroffTimeout` must be positive, got %q", *y.HostAgent.GuestPoweroffTimeout)
 		}
-		if rule.Reverse && rule.GuestSocket == "" {
-			return fmt.Errorf("field `%s.reverse` must be %t", field, false)
+	}
+	if y.HostAgent.MDNSAddress != nil && *y.HostAgent.MDNSAddress != "" {
+		ip := net.ParseIP(*y.HostAgent.MDNSAddress)
+		if ip == nil {
+			return fmt.Errorf("field `hostAgent.mdnsAddress` must be an IP address, got %q", *y.HostAgent.MDNSAddress)
 		}
-		if rule.Reverse && rule.HostSocket == "" {
-			return fmt.Errorf("field `%s.reverse` must be %t", field, false)
+		if ip.IsUnspecified() || ip.IsLoopback() {
+			return fmt.Errorf("field `hostAgent.mdnsAddress` must not be an unspecified or loopback address, got %q", *y.HostAgent.MDNSAddress)
 		}
-		// Not validating that the various GuestPortRanges and HostPortRanges are not overlapping. Rules will be
-		// processed sequentially and the first matching rule for a guest port determines forwarding behavior.
 	}
-	for i, rule := range y.CopyToHost {
-		field := fmt.Sprintf("CopyToHost[%d]", i)
-		if rule.GuestFile != "" {
-			if !path.IsAbs(rule.GuestFile) {
-				return fmt.Errorf("field `%s.guest` must be an absolute path", field)
-			}
+	if y.HostAgent.IdleSuspend != nil && *y.HostAgent.IdleSuspend != "" {
+		idle, err := time.ParseDuration(*y.HostAgent.IdleSuspend)
+		if err != nil {
+			return fmt.Errorf("field `hostAgent.idleSuspend` has an invalid value: %w", err)
 		}
-		if rule.HostFile != "" {
-			if !filepath.IsAbs(rule.HostFile) {
-				return fmt.Errorf("field `%s.host` must be an absolute path, but is %q", field, rule.HostFile)
-			}
+		if idle <= 0 {
+			return fmt.Errorf("field `hostAgent.idleSuspend` must be positive, got %q", *y.HostAgent.IdleSuspend)
+		}
+		switch *y.VMType {
+		case QEMU, VZ:
+		default:
+			return fmt.Errorf("field `hostAgent.idleSuspend` is not supported for vmType %q", *y.VMType)
+		}
+	}
+	if y.GuestReadyFile.Path != "" && !path.IsAbs(y.GuestReadyFile.Path) {
+		return fmt.Errorf("field `guestReadyFile.path` must be an absolute path, got %q", y.GuestReadyFile.Path)
+	}
+	if y.GuestReadyFile.Timeout != nil {
+		timeout, err := time.ParseDuration(*y.GuestReadyFile.Timeout)
+		if err != nil {
+			return fmt.Errorf("field `guestReadyFile.timeout` has an invalid value: %w", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("field `guestReadyFile.timeout` must be positive, got %q", *y.GuestReadyFile.Timeout)
+		}
+	}
+	if y.GuestAgent.DialTimeout != nil {
+		timeout, err := time.ParseDuration(*y.GuestAgent.DialTimeout)
+		if err != nil {
+			return fmt.Errorf("field `guestAgent.dialTimeout` has an invalid value: %w", err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("field `guestAgent.dialTimeout` must not be negative, got %q", *y.GuestAgent.DialTimeout)
+		}
+	}
+	var reconnectInterval, reconnectMaxInterval time.Duration
+	for _, f := range []struct {
+		name  string
+		value *string
+		d     *time.Duration
+	}{
+		{"guestAgent.reconnectInterval", y.GuestAgent.ReconnectInterval, &reconnectInterval},
+		{"guestAgent.reconnectMaxInterval", y.GuestAgent.ReconnectMaxInterval, &reconnectMaxInterval},
+	} {
+		if f.value == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*f.value)
+		if err != nil {
+			return fmt.Errorf("field `%s` has an invalid value: %w", f.name, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("field `%s` must be positive, got %q", f.name, *f.value)
+		}
+		*f.d = d
+	}
+	if reconnectInterval > 0 && reconnectMaxInterval > 0 && reconnectMaxInterval < reconnectInterval {
+		return fmt.Errorf("field `guestAgent.reconnectMaxInterval` must not be shorter than `guestAgent.reconnectInterval`, got %q < %q",
+			*y.GuestAgent.ReconnectMaxInterval, *y.GuestAgent.ReconnectInterval)
+	}
+	if y.GuestAgent.DegradeAfterFailures != nil && *y.GuestAgent.DegradeAfterFailures < 0 {
+		return fmt.Errorf("field `guestAgent.degradeAfterFailures` must be >= 0, got %d", *y.GuestAgent.DegradeAfterFailures)
+	}
+	if err := validateAdditionalGuestAgents(y.GuestAgent.Additional); err != nil {
+		return err
+	}
+
+	if y.HostFileUmask != nil {
+		if _, err := ParseUmask(*y.HostFileUmask); err != nil {
+			return fmt.Errorf("field `hostFileUmask` has an invalid value: %w", err)
 		}
 	}
 
 	if y.HostResolver.Enabled != nil && *y.HostResolver.Enabled && len(y.DNS) > 0 {
 		return fmt.Errorf("field `dns` must be empty when field `HostResolver.Enabled` is true")
 	}
+	if y.HostResolver.CacheSize != nil && *y.HostResolver.CacheSize < 0 {
+		return fmt.Errorf("field `hostResolver.cacheSize` must be >= 0, got %d", *y.HostResolver.CacheSize)
+	}
+	if y.HostResolver.ResolvConfMode != nil {
+		switch *y.HostResolver.ResolvConfMode {
+		case ResolvConfManaged, ResolvConfUnmanaged, ResolvConfAppend:
+		default:
+			return fmt.Errorf("field `hostResolver.resolvConfMode` must be %q, %q, or %q, got %q",
+				ResolvConfManaged, ResolvConfUnmanaged, ResolvConfAppend, *y.HostResolver.ResolvConfMode)
+		}
+	}
+	for i, domain := range y.HostResolver.SearchDomains {
+		if err := validateDomainName(domain); err != nil {
+			return fmt.Errorf("field `hostResolver.searchDomains[%d]` is invalid: %w", i, err)
+		}
+	}
+	for host := range y.HostResolver.Hosts {
+		if !strings.Contains(host, "*") {
+			continue
+		}
+		domain, ok := strings.CutPrefix(host, "*.")
+		if !ok || strings.Contains(domain, "*") {
+			return fmt.Errorf("field `hostResolver.hosts` has an invalid wildcard %q: \"*\" is only allowed as the first label", host)
+		}
+		if err := validateDomainName(domain); err != nil {
+			return fmt.Errorf("field `hostResolver.hosts` has an invalid wildcard %q: %w", host, err)
+		}
+	}
+	for i, server := range y.HostResolver.UpstreamServers {
+		if err := validateUpstreamServer(server); err != nil {
+			return fmt.Errorf("field `hostResolver.upstreamServers[%d]` is invalid: %w", i, err)
+		}
+	}
+	for domain, servers := range y.HostResolver.Forwarders {
+		if err := validateDomainName(strings.TrimPrefix(domain, "*.")); err != nil {
+			return fmt.Errorf("field `hostResolver.forwarders` has an invalid domain: %w", err)
+		}
+		if len(servers) == 0 {
+			return fmt.Errorf("field `hostResolver.forwarders[%q]` must not be empty", domain)
+		}
+		for i, server := range servers {
+			if err := validateUpstreamServer(server); err != nil {
+				return fmt.Errorf("field `hostResolver.forwarders[%q][%d]` is invalid: %w", domain, i, err)
+			}
+		}
+	}
 
 	if err := validateNetwork(y, warn); err != nil {
 		return err
@@ -438,6 +696,245 @@ func validateNetwork(y LimaYAML, warn bool) error {
 	return nil
 }
 
+func validatePortForward(field string, rule PortForward) error {
+	if rule.GuestIPMustBeZero && !rule.GuestIP.Equal(net.IPv4zero) {
+		return fmt.Errorf("field `%s.guestIPMustBeZero` can only be true when field `%s.guestIP` is 0.0.0.0", field, field)
+	}
+	if rule.GuestPort != 0 {
+		if rule.GuestSocket != "" {
+			return fmt.Errorf("field `%s.guestPort` must be 0 when field `%s.guestSocket` is set", field, field)
+		}
+		if rule.GuestPort != rule.GuestPortRange[0] {
+			return fmt.Errorf("field `%s.guestPort` must match field `%s.guestPortRange[0]`", field, field)
+		}
+		// redundant validation to make sure the error contains the correct field name
+		if err := validatePort(field+".guestPort", rule.GuestPort); err != nil {
+			return err
+		}
+	}
+	if rule.HostPort != 0 {
+		if rule.HostSocket != "" {
+			return fmt.Errorf("field `%s.hostPort` must be 0 when field `%s.hostSocket` is set", field, field)
+		}
+		if rule.HostPort != rule.HostPortRange[0] {
+			return fmt.Errorf("field `%s.hostPort` must match field `%s.hostPortRange[0]`", field, field)
+		}
+		// redundant validation to make sure the error contains the correct field name
+		if err := validatePort(field+".hostPort", rule.HostPort); err != nil {
+			return err
+		}
+	}
+	for j := 0; j < 2; j++ {
+		if err := validatePort(fmt.Sprintf("%s.guestPortRange[%d]", field, j), rule.GuestPortRange[j]); err != nil {
+			return err
+		}
+		if err := validatePort(fmt.Sprintf("%s.hostPortRange[%d]", field, j), rule.HostPortRange[j]); err != nil {
+			return err
+		}
+	}
+	if rule.GuestPortRange[0] > rule.GuestPortRange[1] {
+		return fmt.Errorf("field `%s.guestPortRange[1]` must be greater than or equal to field `%s.guestPortRange[0]`", field, field)
+	}
+	if rule.HostPortRange[0] > rule.HostPortRange[1] {
+		return fmt.Errorf("field `%s.hostPortRange[1]` must be greater than or equal to field `%s.hostPortRange[0]`", field, field)
+	}
+	if rule.GuestPortRange[1]-rule.GuestPortRange[0] != rule.HostPortRange[1]-rule.HostPortRange[0] {
+		return fmt.Errorf("field `%s.hostPortRange` must specify the same number of ports as field `%s.guestPortRange`", field, field)
+	}
+	if rule.GuestSocket != "" {
+		if !path.IsAbs(rule.GuestSocket) {
+			return fmt.Errorf("field `%s.guestSocket` must be an absolute path", field)
+		}
+		if rule.HostSocket == "" && rule.HostPortRange[1]-rule.HostPortRange[0] > 0 {
+			return fmt.Errorf("field `%s.guestSocket` can only be mapped to a single port or socket. not a range", field)
+		}
+	}
+	if rule.HostSocket != "" {
+		if !filepath.IsAbs(rule.HostSocket) {
+			// should be unreachable because FillDefault() will prepend the instance directory to relative names
+			return fmt.Errorf("field `%s.hostSocket` must be an absolute path, but is %q", field, rule.HostSocket)
+		}
+		if rule.GuestSocket == "" && len(rule.GuestTargets) == 0 && rule.GuestPortRange[1]-rule.GuestPortRange[0] > 0 {
+			return fmt.Errorf("field `%s.hostSocket` can only be mapped from a single port or socket. not a range", field)
+		}
+	}
+	if len(rule.HostSocket) >= osutil.UnixPathMax {
+		return fmt.Errorf("field `%s.hostSocket` must be less than UNIX_PATH_MAX=%d characters, but is %d",
+			field, osutil.UnixPathMax, len(rule.HostSocket))
+	}
+	if rule.Proto != TCP {
+		return fmt.Errorf("field `%s.proto` must be %q", field, TCP)
+	}
+	if rule.Reverse && rule.GuestSocket != "" && rule.HostSocket == "" {
+		return fmt.Errorf("field `%s.reverse` must be %t", field, false)
+	}
+	if rule.Reverse && rule.GuestSocket == "" {
+		if err := validateReverseTCP(rule, field); err != nil {
+			return err
+		}
+	}
+	if rule.LazyBind && rule.GuestSocket != "" {
+		return fmt.Errorf("field `%s.lazyBind` cannot be used with field `%s.guestSocket`", field, field)
+	}
+	if len(rule.GuestSocketPruneDirs) > 0 && (!rule.Reverse || rule.GuestSocket == "") {
+		return fmt.Errorf("field `%s.guestSocketPruneDirs` can only be used with field `%s.guestSocket` and field `%s.reverse`", field, field, field)
+	}
+	for j, dir := range rule.GuestSocketPruneDirs {
+		if !path.IsAbs(dir) || path.Clean(dir) == "/" {
+			return fmt.Errorf("field `%s.guestSocketPruneDirs[%d]` must be an absolute path other than \"/\", got %q", field, j, dir)
+		}
+	}
+	if rule.ListenBacklog < 0 {
+		return fmt.Errorf("field `%s.listenBacklog` must not be negative, got %d", field, rule.ListenBacklog)
+	}
+	if rule.MaxConnections < 0 {
+		return fmt.Errorf("field `%s.maxConnections` must not be negative, got %d", field, rule.MaxConnections)
+	}
+	if rule.IdleTimeout != "" {
+		timeout, err := time.ParseDuration(rule.IdleTimeout)
+		if err != nil {
+			return fmt.Errorf("field `%s.idleTimeout` has an invalid value: %w", field, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("field `%s.idleTimeout` must be positive, got %q", field, rule.IdleTimeout)
+		}
+	}
+	if (rule.MaxConnections > 0 || rule.IdleTimeout != "") && (rule.GuestSocket != "" || rule.Reverse || rule.Ignore) {
+		return fmt.Errorf("fields `%s.maxConnections` and `%s.idleTimeout` cannot be used with fields `%s.guestSocket`, `%s.reverse`, and `%s.ignore`",
+			field, field, field, field, field)
+	}
+	for j, entry := range rule.HostBindACL {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("field `%s.hostBindACL[%d]` must be an IP address or a CIDR, got %q", field, j, entry)
+			}
+		}
+	}
+	if len(rule.HostBindACL) > 0 && (rule.HostSocket != "" || rule.GuestSocket != "" || rule.Reverse || rule.Ignore) {
+		return fmt.Errorf("field `%s.hostBindACL` cannot be used with fields `%s.hostSocket`, `%s.guestSocket`, `%s.reverse`, and `%s.ignore`",
+			field, field, field, field, field)
+	}
+	if rule.HostPortPool != [2]int{} {
+		for j := 0; j < 2; j++ {
+			if err := validatePort(fmt.Sprintf("%s.hostPortPool[%d]", field, j), rule.HostPortPool[j]); err != nil {
+				return err
+			}
+		}
+		if rule.HostPortPool[0] > rule.HostPortPool[1] {
+			return fmt.Errorf("field `%s.hostPortPool[1]` must be greater than or equal to field `%s.hostPortPool[0]`", field, field)
+		}
+		if rule.HostPort != 0 || rule.HostSocket != "" || rule.GuestSocket != "" {
+			return fmt.Errorf("field `%s.hostPortPool` cannot be used with fields `%s.hostPort`, `%s.hostSocket`, and `%s.guestSocket`", field, field, field, field)
+		}
+	}
+	if len(rule.OnReady) > 0 {
+		if rule.Ignore {
+			return fmt.Errorf("field `%s.onReady` cannot be used with field `%s.ignore`", field, field)
+		}
+		if rule.OnReady[0] == "" {
+			return fmt.Errorf("field `%s.onReady` must start with a command", field)
+		}
+	}
+	if rule.GuestTLS != nil {
+		if rule.GuestSocket != "" {
+			return fmt.Errorf("field `%s.guestTLS` cannot be used with field `%s.guestSocket`", field, field)
+		}
+		if err := validateGuestTLS(*rule.GuestTLS); err != nil {
+			return fmt.Errorf("field `%s.guestTLS` is invalid: %w", field, err)
+		}
+	}
+	if len(rule.GuestTargets) > 0 {
+		if rule.GuestSocket != "" || rule.Reverse || rule.LazyBind || rule.Ignore || rule.GuestTLS != nil || rule.HostPortPool != [2]int{} {
+			return fmt.Errorf("field `%s.guestTargets` cannot be used with fields `%s.guestSocket`, `%s.reverse`, `%s.lazyBind`, `%s.ignore`, `%s.guestTLS`, and `%s.hostPortPool`",
+				field, field, field, field, field, field, field)
+		}
+		if rule.HostPort == 0 && rule.HostSocket == "" {
+			return fmt.Errorf("field `%s.guestTargets` requires field `%s.hostPort` or field `%s.hostSocket`", field, field, field)
+		}
+		for j, target := range rule.GuestTargets {
+			if err := validateGuestTarget(target); err != nil {
+				return fmt.Errorf("field `%s.guestTargets[%d]` is invalid: %w", field, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReverseTCP validates a rule that forwards a host port to a guest TCP port.
+func validateReverseTCP(rule PortForward, field string) error {
+	if rule.GuestPortRange[0] != rule.GuestPortRange[1] {
+		return fmt.Errorf("field `%s.reverse` requires a single field `%s.guestPort`, not a range", field, field)
+	}
+	if rule.HostPortRange[0] != rule.HostPortRange[1] {
+		return fmt.Errorf("field `%s.reverse` requires a single field `%s.hostPort`, not a range", field, field)
+	}
+	if rule.HostSocket != "" {
+		return fmt.Errorf("field `%s.reverse` cannot be used with field `%s.hostSocket` for a guest port", field, field)
+	}
+	// sshd binds the remote forwards to the loopback addresses unless GatewayPorts is enabled
+	if !rule.GuestIP.IsLoopback() {
+		return fmt.Errorf("field `%s.guestIP` must be a loopback address for field `%s.reverse`, got %q", field, field, rule.GuestIP)
+	}
+	if rule.Ignore || rule.LazyBind || rule.GuestTLS != nil || rule.HostPortPool != [2]int{} {
+		return fmt.Errorf("field `%s.reverse` cannot be used with fields `%s.ignore`, `%s.lazyBind`, `%s.guestTLS`, and `%s.hostPortPool`",
+			field, field, field, field, field)
+	}
+	return nil
+}
+
+func validateListenAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("%q must specify an IP address", address)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q must specify a port between 1 and 65535", address)
+	}
+	return nil
+}
+
+func validateGuestTarget(target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("%q must specify the host", target)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("%q must specify a numeric port", target)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("%q must specify a port between 1 and 65535", target)
+	}
+	return nil
+}
+
+func validateGuestUser(field string, user *string) error {
+	if user == nil {
+		return nil
+	}
+	if err := osutil.ValidateUsername(*user); err != nil {
+		return fmt.Errorf("field `%s` is invalid: %w", field, err)
+	}
+	return nil
+}
+
+// validateProvisionUser rejects provisioning users other than the Lima user and root,
+// as the requirement checks, copyToGuest, copyToHost, and the graceful poweroff need sudo,
+// which is not granted to the additional users.
+func validateProvisionUser(user *string, limaUser string) error {
+	if user == nil || *user == limaUser || *user == "root" {
+		return nil
+	}
+	return fmt.Errorf("field `ssh.provisionUser` must be the Lima user (%q) or \"root\", got %q", limaUser, *user)
+}
+
 func validatePort(field string, port int) error {
 	switch {
 	case port < 0:
@@ -452,6 +949,64 @@ func validatePort(field string, port int) error {
 	return nil
 }
 
+// SyslogFacilities are the names of the facilities for `hostAgent.syslogFacility`.
+var SyslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+func validateSyslog(tag, facility *string, goos string) error {
+	if tag != nil && *tag != "" && goos == "windows" {
+		return errors.New("field `hostAgent.syslogTag` is not supported on Windows")
+	}
+	if facility != nil && !slices.Contains(SyslogFacilities, *facility) {
+		return fmt.Errorf("field `hostAgent.syslogFacility` must be one of %v, got %q", SyslogFacilities, *facility)
+	}
+	return nil
+}
+
+// validateCopyToGuest validates the `copyToGuest` rule at field.
+func validateCopyToGuest(field string, rule CopyToGuest) error {
+	if !filepath.IsAbs(rule.HostFile) {
+		return fmt.Errorf("field `%s.host` must be an absolute path, but is %q", field, rule.HostFile)
+	}
+	if !path.IsAbs(rule.GuestFile) {
+		return fmt.Errorf("field `%s.guest` must be an absolute path, but is %q", field, rule.GuestFile)
+	}
+	if !copyToGuestOwnerRegexp.MatchString(rule.Owner) {
+		return fmt.Errorf("field `%s.owner` must be \"user\" or \"user:group\", got %q", field, rule.Owner)
+	}
+	if perm, err := strconv.ParseUint(rule.Permissions, 8, 32); err != nil || perm > 0o7777 {
+		return fmt.Errorf("field `%s.permissions` must be an octal number not greater than 7777, got %q", field, rule.Permissions)
+	}
+	if rule.Watch {
+		interval, err := time.ParseDuration(rule.WatchInterval)
+		if err != nil {
+			return fmt.Errorf("field `%s.watchInterval` has an invalid value: %w", field, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("field `%s.watchInterval` must be positive, got %q", field, rule.WatchInterval)
+		}
+	} else if rule.WatchInterval != "" {
+		return fmt.Errorf("field `%s.watchInterval` requires field `%s.watch`", field, field)
+	}
+	return nil
+}
+
+var copyToGuestOwnerRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// ParseUmask parses an octal umask string such as "022" or "0077".
+func ParseUmask(s string) (os.FileMode, error) {
+	u, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("umask %q must be an octal number: %w", s, err)
+	}
+	if u > 0o777 {
+		return 0, fmt.Errorf("umask %q must not be greater than 0777", s)
+	}
+	return os.FileMode(u), nil
+}
+
 func warnExperimental(y LimaYAML) {
 	if *y.MountType == NINEP {
 		logrus.Warn("`mountType: 9p` is experimental")
@@ -472,3 +1027,185 @@ func warnExperimental(y LimaYAML) {
 		logrus.Warn("`audio.device` is experimental")
 	}
 }
+
+var domainLabelRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+var additionalGuestAgentNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,15}$`)
+
+func validateAdditionalGuestAgents(agents []AdditionalGuestAgent) error {
+	names := make(map[string]bool)
+	for i, ga := range agents {
+		field := fmt.Sprintf("guestAgent.additional[%d]", i)
+		// The name is a part of the local socket path, which must fit in UNIX_PATH_MAX like filenames.LongestSock
+		if !additionalGuestAgentNameRegexp.MatchString(ga.Name) {
+			return fmt.Errorf("field `%s.name` must match %s, got %q", field, additionalGuestAgentNameRegexp.String(), ga.Name)
+		}
+		if names[ga.Name] {
+			return fmt.Errorf("field `%s.name` must be unique, got %q", field, ga.Name)
+		}
+		names[ga.Name] = true
+		if !path.IsAbs(ga.Socket) {
+			return fmt.Errorf("field `%s.socket` must be an absolute path, got %q", field, ga.Socket)
+		}
+		if ga.GuestIP != nil && (ga.GuestIP.IsUnspecified() || ga.GuestIP.IsLoopback()) {
+			return fmt.Errorf("field `%s.guestIP` must not be an unspecified or a loopback address, got %q", field, ga.GuestIP)
+		}
+	}
+	return nil
+}
+
+// validateUpstreamServer validates an upstream DNS server given as "IP", "IP:port",
+// "tls://host[:port]", or "https://host[:port]/path".
+func validateUpstreamServer(server string) error {
+	if net.ParseIP(server) != nil {
+		return nil
+	}
+	if hostPort, ok := strings.CutPrefix(server, "tls://"); ok {
+		host, port := hostPort, "853"
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			host, port = h, p
+		}
+		if host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("%q must be \"tls://host[:port]\"", server)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("%q has an invalid port %q", server, port)
+		}
+		return nil
+	}
+	if strings.HasPrefix(server, "https://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" {
+			return fmt.Errorf("%q must be \"https://host[:port]/path\"", server)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return fmt.Errorf("%q must be an IP address, an IP address and a port, or a \"tls://\" or \"https://\" URL: %w", server, err)
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("%q is not an IP address", host)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("%q has an invalid port %q", server, port)
+	}
+	return nil
+}
+
+func validateDomainName(domain string) error {
+	name := strings.TrimSuffix(domain, ".")
+	if name == "" {
+		return errors.New("domain name must not be empty")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("domain name %q is longer than 253 characters", domain)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !domainLabelRegexp.MatchString(label) {
+			return fmt.Errorf("domain name %q has an invalid label %q", domain, label)
+		}
+	}
+	return nil
+}
+
+// validateSecretPolicy validates p; maxLength is the maximum length allowed for the purpose, or 0.
+func validateSecretPolicy(p SecretPolicy, field string, maxLength int) error {
+	if p.Length == nil || p.Digits == nil || p.Symbols == nil {
+		return nil
+	}
+	if *p.Length <= 0 {
+		return fmt.Errorf("field `%s.length` must be positive, got %d", field, *p.Length)
+	}
+	if maxLength > 0 && *p.Length > maxLength {
+		return fmt.Errorf("field `%s.length` must be at most %d, got %d", field, maxLength, *p.Length)
+	}
+	if *p.Digits < 0 || *p.Symbols < 0 {
+		return fmt.Errorf("fields `%s.digits` and `%s.symbols` must not be negative", field, field)
+	}
+	if *p.Digits+*p.Symbols > *p.Length {
+		return fmt.Errorf("fields `%s.digits` and `%s.symbols` must not exceed `%s.length` in total", field, field, field)
+	}
+	return nil
+}
+
+func validateGuestTLS(t GuestTLS) error {
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return err
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %q", t.CA)
+		}
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return errors.New("`clientCert` and `clientKey` must be specified together")
+	}
+	if t.ClientCert != "" {
+		if _, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateProbes(probes []Probe) error {
+	phaseOrder := map[ProbePhase]int{ProbePhaseEssential: 0, ProbePhaseOptional: 1, ProbePhaseFinal: 2}
+	probeName := make(map[string]int)
+	for i, p := range probes {
+		switch p.Mode {
+		case ProbeModeReadiness:
+		default:
+			return fmt.Errorf("field `probe[%d].mode` can only be %q",
+				i, ProbeModeReadiness)
+		}
+		// Only the previous probes can be listed, so that there are no cycles
+		for _, name := range p.After {
+			j, ok := probeName[name]
+			if !ok {
+				return fmt.Errorf("field `probes[%d].after` refers to %q, which is not the name of a previous probe", i, name)
+			}
+			if phaseOrder[probes[j].Phase] > phaseOrder[p.Phase] {
+				return fmt.Errorf("field `probes[%d].after` refers to %q, which is checked in the later phase %q", i, name, probes[j].Phase)
+			}
+		}
+		if p.Name != "" {
+			if prev, ok := probeName[p.Name]; ok {
+				return fmt.Errorf("field `probes[%d].name` value %q has already been used by field `probes[%d].name`", i, p.Name, prev)
+			}
+			probeName[p.Name] = i
+		}
+		if _, ok := phaseOrder[p.Phase]; !ok {
+			return fmt.Errorf("field `probes[%d].phase` must be %q, %q, or %q, got %q", i, ProbePhaseEssential, ProbePhaseOptional, ProbePhaseFinal, p.Phase)
+		}
+		if p.Retries != nil && *p.Retries < 1 {
+			return fmt.Errorf("field `probes[%d].retries` must be positive, got %d", i, *p.Retries)
+		}
+		if p.Retries == nil && p.Timeout == "" {
+			return fmt.Errorf("field `probes[%d].retries` must be set unless `probes[%d].timeout` is set", i, i)
+		}
+		interval, err := time.ParseDuration(p.Interval)
+		if err != nil {
+			return fmt.Errorf("field `probes[%d].interval` has an invalid value: %w", i, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("field `probes[%d].interval` must be positive, got %q", i, p.Interval)
+		}
+		if p.Timeout != "" {
+			timeout, err := time.ParseDuration(p.Timeout)
+			if err != nil {
+				return fmt.Errorf("field `probes[%d].timeout` has an invalid value: %w", i, err)
+			}
+			if timeout <= 0 {
+				return fmt.Errorf("field `probes[%d].timeout` must be positive, got %q", i, p.Timeout)
+			}
+		}
+	}
+	return nil
+}
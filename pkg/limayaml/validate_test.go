@@ -0,0 +1,222 @@
+package limayaml
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseUmask(t *testing.T) {
+	testCases := []struct {
+		s           string
+		expected    os.FileMode
+		expectedErr string
+	}{
+		{s: "022", expected: 0o022},
+		{s: "077", expected: 0o077},
+		{s: "0", expected: 0},
+		{s: "777", expected: 0o777},
+		{s: "0777", expected: 0o777},
+		{s: "", expectedErr: "must be an octal number"},
+		{s: "089", expectedErr: "must be an octal number"},
+		{s: "-1", expectedErr: "must be an octal number"},
+		{s: "u=rwx", expectedErr: "must be an octal number"},
+		{s: "1000", expectedErr: "must not be greater than 0777"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			u, err := ParseUmask(tc.s)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, u, tc.expected)
+		})
+	}
+}
+
+func TestValidateSecretPolicy(t *testing.T) {
+	policy := func(length, digits, symbols int) SecretPolicy {
+		return SecretPolicy{Length: &length, Digits: &digits, Symbols: &symbols}
+	}
+	testCases := []struct {
+		name        string
+		policy      SecretPolicy
+		maxLength   int
+		expectedErr string
+	}{
+		{name: "unset", policy: SecretPolicy{}},
+		{name: "valid", policy: policy(8, 2, 1), maxLength: 8},
+		{name: "no max length", policy: policy(64, 0, 0)},
+		{name: "digits and symbols fill the length", policy: policy(4, 2, 2)},
+		{name: "zero length", policy: policy(0, 0, 0), expectedErr: "field `secrets.vnc.length` must be positive, got 0"},
+		{name: "too long", policy: policy(9, 0, 0), maxLength: 8, expectedErr: "field `secrets.vnc.length` must be at most 8, got 9"},
+		{
+			name:        "negative digits",
+			policy:      policy(8, -1, 0),
+			expectedErr: "fields `secrets.vnc.digits` and `secrets.vnc.symbols` must not be negative",
+		},
+		{
+			name:        "digits and symbols exceed the length",
+			policy:      policy(4, 3, 2),
+			expectedErr: "fields `secrets.vnc.digits` and `secrets.vnc.symbols` must not exceed `secrets.vnc.length` in total",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSecretPolicy(tc.policy, "secrets.vnc", tc.maxLength)
+			if tc.expectedErr != "" {
+				assert.Error(t, err, tc.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestValidateProbes(t *testing.T) {
+	probe := func(name, timeout string, after ...string) Probe {
+		p := Probe{Mode: ProbeModeReadiness, Name: name, After: after, Timeout: timeout, Phase: ProbePhaseOptional, Interval: "10s"}
+		if timeout == "" {
+			p.Retries = ptr.Of(60)
+		}
+		return p
+	}
+	withPhase := func(p Probe, phase ProbePhase) Probe {
+		p.Phase = phase
+		return p
+	}
+	testCases := []struct {
+		name        string
+		probes      []Probe
+		expectedErr string
+	}{
+		{name: "none"},
+		{name: "valid", probes: []Probe{probe("a", "5m"), probe("", ""), probe("b", "", "a"), probe("c", "30s", "a", "b")}},
+		{name: "unknown", probes: []Probe{probe("a", "", "b")}, expectedErr: "field `probes[0].after` refers to \"b\", which is not the name of a previous probe"},
+		{name: "later", probes: []Probe{probe("a", "", "b"), probe("b", "")}, expectedErr: "field `probes[0].after` refers to \"b\", which is not the name of a previous probe"},
+		{name: "self", probes: []Probe{probe("a", "", "a")}, expectedErr: "field `probes[0].after` refers to \"a\", which is not the name of a previous probe"},
+		{name: "duplicate", probes: []Probe{probe("a", ""), probe("a", "")}, expectedErr: "field `probes[1].name` value \"a\" has already been used by field `probes[0].name`"},
+		{name: "zero timeout", probes: []Probe{probe("a", "0s")}, expectedErr: "field `probes[0].timeout` must be positive, got \"0s\""},
+		{name: "invalid timeout", probes: []Probe{probe("a", "5")}, expectedErr: "field `probes[0].timeout` has an invalid value"},
+		{name: "earlier phase", probes: []Probe{withPhase(probe("a", ""), ProbePhaseEssential), withPhase(probe("b", "", "a"), ProbePhaseFinal)}},
+		{
+			name:        "later phase",
+			probes:      []Probe{withPhase(probe("a", ""), ProbePhaseFinal), probe("b", "", "a")},
+			expectedErr: "field `probes[1].after` refers to \"a\", which is checked in the later phase \"final\"",
+		},
+		{name: "invalid phase", probes: []Probe{withPhase(probe("a", ""), "boot")}, expectedErr: "field `probes[0].phase` must be \"essential\", \"optional\", or \"final\", got \"boot\""},
+		{name: "zero retries", probes: []Probe{{Mode: ProbeModeReadiness, Phase: ProbePhaseOptional, Retries: ptr.Of(0), Interval: "1s"}}, expectedErr: "field `probes[0].retries` must be positive, got 0"},
+		{name: "no retries", probes: []Probe{{Mode: ProbeModeReadiness, Phase: ProbePhaseOptional, Interval: "1s"}}, expectedErr: "field `probes[0].retries` must be set unless `probes[0].timeout` is set"},
+		{name: "invalid interval", probes: []Probe{{Mode: ProbeModeReadiness, Phase: ProbePhaseOptional, Retries: ptr.Of(1), Interval: "1"}}, expectedErr: "field `probes[0].interval` has an invalid value"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateProbes(tc.probes)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestValidateReverseTCP(t *testing.T) {
+	rule := func(f func(*PortForward)) PortForward {
+		r := PortForward{GuestPort: 5000, Reverse: true}
+		f(&r)
+		FillPortForwardDefaults(&r, "/tmp/lima-test")
+		return r
+	}
+	testCases := []struct {
+		name        string
+		rule        PortForward
+		expectedErr string
+	}{
+		{name: "valid", rule: rule(func(*PortForward) {})},
+		{name: "IPv6", rule: rule(func(r *PortForward) { r.GuestIP = net.IPv6loopback })},
+		{name: "range", rule: rule(func(r *PortForward) { r.GuestPort = 0 }), expectedErr: "field `rule.reverse` requires a single field `rule.guestPort`, not a range"},
+		{name: "host socket", rule: rule(func(r *PortForward) { r.HostSocket = "registry.sock" }), expectedErr: "field `rule.reverse` cannot be used with field `rule.hostSocket` for a guest port"},
+		{
+			name:        "not loopback",
+			rule:        rule(func(r *PortForward) { r.GuestIP = net.IPv4zero }),
+			expectedErr: "field `rule.guestIP` must be a loopback address for field `rule.reverse`, got \"0.0.0.0\"",
+		},
+		{name: "ignore", rule: rule(func(r *PortForward) { r.Ignore = true }), expectedErr: "field `rule.reverse` cannot be used with fields `rule.ignore`"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateReverseTCP(tc.rule, "rule")
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestValidateCopyToGuest(t *testing.T) {
+	valid := CopyToGuest{HostFile: "/tmp/registry.crt", GuestFile: "/etc/registry.crt", Owner: "root", Permissions: "644"}
+	assert.NilError(t, validateCopyToGuest("copyToGuest[0]", valid))
+
+	rule := valid
+	rule.Owner = "user:staff"
+	assert.NilError(t, validateCopyToGuest("copyToGuest[0]", rule))
+
+	rule = valid
+	rule.Owner = "root; reboot"
+	assert.ErrorContains(t, validateCopyToGuest("copyToGuest[0]", rule), "field `copyToGuest[0].owner`")
+
+	rule = valid
+	rule.Permissions = "0o644"
+	assert.ErrorContains(t, validateCopyToGuest("copyToGuest[0]", rule), "field `copyToGuest[0].permissions`")
+
+	rule = valid
+	rule.GuestFile = "etc/registry.crt"
+	assert.ErrorContains(t, validateCopyToGuest("copyToGuest[0]", rule), "field `copyToGuest[0].guest`")
+
+	rule = valid
+	rule.WatchInterval = "1m"
+	assert.ErrorContains(t, validateCopyToGuest("copyToGuest[0]", rule), "requires field `copyToGuest[0].watch`")
+}
+
+func TestValidateProvisionUser(t *testing.T) {
+	assert.NilError(t, validateProvisionUser(nil, "lima"))
+	assert.NilError(t, validateProvisionUser(ptr.Of("lima"), "lima"))
+	assert.NilError(t, validateProvisionUser(ptr.Of("root"), "lima"))
+	assert.ErrorContains(t, validateProvisionUser(ptr.Of("foo"), "lima"), "field `ssh.provisionUser` must be the Lima user")
+}
+
+func TestValidateSyslog(t *testing.T) {
+	assert.NilError(t, validateSyslog(ptr.Of(""), ptr.Of("daemon"), "windows"))
+	assert.NilError(t, validateSyslog(ptr.Of("lima-default"), ptr.Of("local0"), "darwin"))
+	assert.ErrorContains(t, validateSyslog(ptr.Of("lima-default"), ptr.Of("daemon"), "windows"), "not supported on Windows")
+	assert.ErrorContains(t, validateSyslog(ptr.Of("lima-default"), ptr.Of("local8"), "linux"), "field `hostAgent.syslogFacility` must be one of")
+}
+
+func TestSHA256Regexp(t *testing.T) {
+	assert.Assert(t, sha256Regexp.MatchString("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+	assert.Assert(t, sha256Regexp.MatchString("E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"))
+	assert.Assert(t, !sha256Regexp.MatchString("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+	assert.Assert(t, !sha256Regexp.MatchString("e3b0c44298fc1c149afbf4c8996fb924"))
+}
+
+func TestValidateHostBindACL(t *testing.T) {
+	rule := PortForward{GuestPort: 8080, HostBindACL: []string{"127.0.0.1", "::1", "192.168.1.0/24"}}
+	FillPortForwardDefaults(&rule, "/tmp/lima-test")
+	assert.NilError(t, validatePortForward("rule", rule))
+
+	invalid := rule
+	invalid.HostBindACL = []string{"192.168.1.0/33"}
+	assert.ErrorContains(t, validatePortForward("rule", invalid), "field `rule.hostBindACL[0]` must be an IP address or a CIDR")
+
+	invalid = rule
+	invalid.Ignore = true
+	assert.ErrorContains(t, validatePortForward("rule", invalid), "field `rule.hostBindACL` cannot be used with")
+}
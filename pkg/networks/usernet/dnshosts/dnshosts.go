@@ -27,6 +27,8 @@ package dnshosts
 
 import (
 	"net"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/containers/gvisor-tap-vsock/pkg/types"
@@ -47,6 +49,11 @@ func ExtractZones(hosts hostMap) (zones []types.Zone) {
 			if zone.DefaultIP == nil {
 				zone.DefaultIP = hosts.hostIP(host)
 			}
+		} else if h.isWildcard() {
+			zone.Records = append(zone.Records, types.Record{
+				Regexp: h.recordRegexp(),
+				IP:     hosts.hostIP(host),
+			})
 		} else {
 			zone.Records = append(zone.Records, types.Record{
 				Name: h.recordName(),
@@ -58,6 +65,18 @@ func ExtractZones(hosts hostMap) (zones []types.Zone) {
 	}
 
 	for _, zone := range list {
+		// The first matching record is used: the exact names take precedence over the wildcards,
+		// and the wildcards with more labels take precedence over the others.
+		sort.SliceStable(zone.Records, func(i, j int) bool {
+			a, b := zone.Records[i], zone.Records[j]
+			if (a.Regexp == nil) != (b.Regexp == nil) {
+				return a.Regexp == nil
+			}
+			if a.Regexp != nil {
+				return strings.Count(a.Regexp.String(), `\.`) > strings.Count(b.Regexp.String(), `\.`)
+			}
+			return false
+		})
 		zones = append(zones, zone)
 	}
 	return
@@ -102,6 +121,21 @@ func (z zoneHost) recordName() string {
 	return string(z)[:i]
 }
 
+// isWildcard returns true for the wildcard hosts, e.g., "*.test".
+func (z zoneHost) isWildcard() bool {
+	return strings.HasPrefix(string(z), "*.")
+}
+
+// recordRegexp returns the regexp of a wildcard record, matching the names at any depth below
+// the domain of the wildcard, but not the domain itself.
+func (z zoneHost) recordRegexp() *regexp.Regexp {
+	domain := strings.TrimPrefix(strings.TrimPrefix(z.recordName(), "*"), ".")
+	if domain == "" {
+		return regexp.MustCompile(`(?i)^.+$`)
+	}
+	return regexp.MustCompile(`(?i)^.+\.` + regexp.QuoteMeta(domain) + `$`)
+}
+
 func (z zoneHost) dotIndex() int {
 	return strings.LastIndex(string(z), ".")
 }
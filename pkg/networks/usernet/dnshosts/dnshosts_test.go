@@ -193,6 +193,48 @@ func Test_extractZones(t *testing.T) {
 	}
 }
 
+func Test_extractZonesWildcards(t *testing.T) {
+	hosts := hostMap{
+		"*.test":     "127.0.0.1",
+		"*.app.test": "10.0.0.2",
+		"exact.test": "10.0.0.1",
+	}
+	zones := ExtractZones(hosts)
+	if len(zones) != 1 || zones[0].Name != "test." {
+		t.Fatalf("extractZones() = %+v, want a single zone \"test.\"", zones)
+	}
+	records := zones[0].Records
+	if len(records) != 3 || records[0].Name != "exact" || records[1].Regexp == nil || records[2].Regexp == nil {
+		t.Fatalf("records = %+v, want the exact record first", records)
+	}
+
+	tests := []struct {
+		name string
+		want net.IP
+	}{
+		// the names are relative to the zone "test."
+		{name: "exact", want: net.ParseIP("10.0.0.1")},
+		{name: "foo", want: net.ParseIP("127.0.0.1")},
+		{name: "a.b", want: net.ParseIP("127.0.0.1")},
+		{name: "foo.app", want: net.ParseIP("10.0.0.2")},
+		{name: "app", want: net.ParseIP("127.0.0.1")},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// the first matching record is used, like gvisor-tap-vsock
+			for _, r := range records {
+				if r.Name == tt.name || (r.Regexp != nil && r.Regexp.MatchString(tt.name)) {
+					if !r.IP.Equal(tt.want) {
+						t.Errorf("%q resolved to %v, want %v", tt.name, r.IP, tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("%q did not match any record", tt.name)
+		})
+	}
+}
+
 var (
 	_ sort.Interface = (recordSorter)(nil)
 	_ sort.Interface = (zoneSorter)(nil)
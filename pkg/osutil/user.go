@@ -97,6 +97,14 @@ var cache struct {
 	warnings []string
 }
 
+// ValidateUsername returns an error if name is not a valid Linux user name.
+func ValidateUsername(name string) error {
+	if !regexUsername.MatchString(name) {
+		return fmt.Errorf("%q is not a valid Linux username (must match %q)", name, regexUsername.String())
+	}
+	return nil
+}
+
 func call(args []string) (string, error) {
 	cmd := exec.Command(args[0], args[1:]...)
 	out, err := cmd.Output()
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/fs"
+	"math"
 	"os"
 	"os/exec"
 	"os/user"
@@ -40,6 +42,8 @@ type Config struct {
 	InstanceDir  string
 	LimaYAML     *limayaml.LimaYAML
 	SSHLocalPort int
+	// VSockPort is the vsock port of the guest agent. The vsock device is only added when it is not 0.
+	VSockPort int
 }
 
 // MinimumQemuVersion is the minimum supported QEMU version
@@ -840,7 +844,10 @@ func Cmdline(cfg Config) (string, []string, error) {
 	args = append(args, "-device", "virtio-serial-pci,id=virtio-serial0,max_ports=1")
 	args = append(args, "-device", fmt.Sprintf("virtconsole,chardev=%s,id=console0", serialvChardev))
 
-	// We also want to enable vsock here, but QEMU does not support vsock for macOS hosts
+	// QEMU does not support vsock for macOS hosts, see VSockSupported
+	if cfg.VSockPort != 0 {
+		args = append(args, "-device", fmt.Sprintf("vhost-vsock-pci,guest-cid=%d", VSockCID(cfg.InstanceDir)))
+	}
 
 	if *y.MountType == limayaml.NINEP || *y.MountType == limayaml.VIRTIOFS {
 		for i, f := range y.Mounts {
@@ -1111,3 +1118,27 @@ func getFirmware(qemuExe string, arch limayaml.Arch) (string, error) {
 	}
 	return "", fmt.Errorf("could not find firmware for %q (hint: try copying the \"edk-%s-code.fd\" firmware to $HOME/.local/share/qemu/)", arch, qemuExe)
 }
+
+// VSockSupported returns true if QEMU can provide vsock to the guest, i.e., on Linux hosts
+// where /dev/vhost-vsock is accessible.
+func VSockSupported() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	f, err := os.OpenFile("/dev/vhost-vsock", os.O_RDWR, 0)
+	if err != nil {
+		logrus.WithError(err).Debug("vhost-vsock is not available")
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// VSockCID returns the vsock context ID of the guest. The CIDs are global to the host, so the CID is
+// derived from the instance directory to be stable and unlikely to collide with other VMs.
+// 0, 1, 2, and 0xFFFFFFFF are reserved.
+func VSockCID(instDir string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instDir))
+	return 3 + h.Sum32()%(math.MaxUint32-3)
+}
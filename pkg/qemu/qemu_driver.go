@@ -25,6 +25,7 @@ import (
 	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/mdlayher/vsock"
 	"github.com/sirupsen/logrus"
 )
 
@@ -72,6 +73,7 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 		InstanceDir:  l.Instance.Dir,
 		LimaYAML:     l.Yaml,
 		SSHLocalPort: l.SSHLocalPort,
+		VSockPort:    l.VSockPort,
 	}
 	qExe, qArgs, err := Cmdline(qCfg)
 	if err != nil {
@@ -200,6 +202,13 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	return l.qWaitCh, nil
 }
 
+func (l *LimaQemuDriver) GuestAgentConn(ctx context.Context) (net.Conn, error) {
+	if l.VSockPort == 0 {
+		return l.BaseDriver.GuestAgentConn(ctx)
+	}
+	return vsock.Dial(VSockCID(l.Instance.Dir), uint32(l.VSockPort), nil)
+}
+
 func (l *LimaQemuDriver) Stop(ctx context.Context) error {
 	return l.shutdownQEMU(ctx, 3*time.Minute, l.qCmd, l.qWaitCh)
 }
@@ -230,6 +239,31 @@ func waitFileExists(path string, timeout time.Duration) error {
 	return nil
 }
 
+func (l *LimaQemuDriver) Pause(_ context.Context) error {
+	return l.withQMP(func(rawClient *raw.Monitor) error {
+		return rawClient.Stop()
+	})
+}
+
+func (l *LimaQemuDriver) Resume(_ context.Context) error {
+	return l.withQMP(func(rawClient *raw.Monitor) error {
+		return rawClient.Cont()
+	})
+}
+
+func (l *LimaQemuDriver) withQMP(f func(*raw.Monitor) error) error {
+	qmpSockPath := filepath.Join(l.Instance.Dir, filenames.QMPSock)
+	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSockPath, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	return f(raw.NewMonitor(qmpClient))
+}
+
 func (l *LimaQemuDriver) changeVNCPassword(password string) error {
 	qmpSockPath := filepath.Join(l.Instance.Dir, filenames.QMPSock)
 	err := waitFileExists(qmpSockPath, 30*time.Second)
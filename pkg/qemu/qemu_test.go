@@ -1,6 +1,7 @@
 package qemu
 
 import (
+	"math"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -86,3 +87,10 @@ func TestParseQemuVersion(t *testing.T) {
 		assert.Equal(t, tc.expectedValue, v.String())
 	}
 }
+
+func TestVSockCID(t *testing.T) {
+	cid := VSockCID("/home/user/.lima/default")
+	assert.Equal(t, cid, VSockCID("/home/user/.lima/default"))
+	assert.Assert(t, cid >= 3 && cid < math.MaxUint32)
+	assert.Assert(t, cid != VSockCID("/home/user/.lima/docker"))
+}
@@ -111,6 +111,29 @@ func DefaultPubKeys(loadDotSSH bool) ([]PubKey, error) {
 	return res, nil
 }
 
+// InstancePubKey returns the public key of the SSH key of the instance, or nil if the SSH key of the instance
+// has not been created yet. The SSH key of the instance is created on rotating it, and replaces the key in
+// $LIMA_HOME/_config/user for the instance.
+func InstancePubKey(instDir string) (*PubKey, error) {
+	entry, err := readPublicKey(filepath.Join(instDir, filenames.SSHPublicKey))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// InstanceKeyOpt returns the IdentityFile option for the SSH key of the instance.
+func InstanceKeyOpt(instDir string) string {
+	privateKeyPath := filepath.Join(instDir, filenames.SSHKey)
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf(`IdentityFile='%s'`, ioutilx.CanonicalWindowsPath(privateKeyPath))
+	}
+	return fmt.Sprintf(`IdentityFile="%s"`, privateKeyPath)
+}
+
 var sshInfo struct {
 	sync.Once
 	// aesAccelerated is set to true when AES acceleration is available.
@@ -222,28 +245,33 @@ func CommonOpts(useDotSSH bool) ([]string, error) {
 }
 
 // SSHOpts adds the following options to CommonOptions: User, ControlMaster, ControlPath, ControlPersist
-func SSHOpts(instDir string, useDotSSH, forwardAgent bool, forwardX11 bool, forwardX11Trusted bool) ([]string, error) {
+//
+// The IdentityFile option for the SSH key of the instance precedes the other ones, when it has been created.
+//
+// guestUser is the user to log in as; the Lima user is used when guestUser is empty.
+func SSHOpts(instDir, guestUser string, useDotSSH, forwardAgent bool, forwardX11 bool, forwardX11Trusted bool) ([]string, error) {
 	controlSock := filepath.Join(instDir, filenames.SSHSock)
 	if len(controlSock) >= osutil.UnixPathMax {
 		return nil, fmt.Errorf("socket path %q is too long: >= UNIX_PATH_MAX=%d", controlSock, osutil.UnixPathMax)
 	}
-	u, err := osutil.LimaUser(false)
-	if err != nil {
-		return nil, err
+	if guestUser == "" {
+		u, err := osutil.LimaUser(false)
+		if err != nil {
+			return nil, err
+		}
+		guestUser = u.Username
 	}
 	opts, err := CommonOpts(useDotSSH)
 	if err != nil {
 		return nil, err
 	}
-	controlPath := fmt.Sprintf(`ControlPath="%s"`, controlSock)
-	if runtime.GOOS == "windows" {
-		controlSock = ioutilx.CanonicalWindowsPath(controlSock)
-		controlPath = fmt.Sprintf(`ControlPath='%s'`, controlSock)
+	if _, err := os.Stat(filepath.Join(instDir, filenames.SSHKey)); err == nil {
+		opts = append([]string{InstanceKeyOpt(instDir)}, opts...)
 	}
 	opts = append(opts,
-		fmt.Sprintf("User=%s", u.Username), // guest and host have the same username, but we should specify the username explicitly (#85)
+		fmt.Sprintf("User=%s", guestUser), // guest and host have the same username by default, but we should specify the username explicitly (#85)
 		"ControlMaster=auto",
-		controlPath,
+		controlPathOpt(controlSock),
 		"ControlPersist=yes",
 	)
 	if forwardAgent {
@@ -258,6 +286,54 @@ func SSHOpts(instDir string, useDotSSH, forwardAgent bool, forwardX11 bool, forw
 	return opts, nil
 }
 
+// X11Display returns the X11 display of the host, or "" when no X server is detected.
+func X11Display() string {
+	return os.Getenv("DISPLAY")
+}
+
+func controlPathOpt(controlSock string) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf(`ControlPath='%s'`, ioutilx.CanonicalWindowsPath(controlSock))
+	}
+	return fmt.Sprintf(`ControlPath="%s"`, controlSock)
+}
+
+// DisableControlMaster replaces the ControlMaster, ControlPath, and ControlPersist options in opts,
+// so that the connection does not use the SSH control master of the instance.
+func DisableControlMaster(opts []string) []string {
+	res := make([]string, 0, len(opts))
+	for _, o := range opts {
+		if strings.HasPrefix(o, "ControlMaster=") || strings.HasPrefix(o, "ControlPath=") || strings.HasPrefix(o, "ControlPersist=") {
+			continue
+		}
+		res = append(res, o)
+	}
+	return append(res, "ControlMaster=no", "ControlPath=none")
+}
+
+// redactedOpts are the options whose values may contain secrets, in lower case.
+var redactedOpts = map[string]bool{
+	"knownhostscommand": true,
+	"localcommand":      true,
+	"proxycommand":      true,
+	"remotecommand":     true,
+	"setenv":            true,
+}
+
+// RedactOpts returns a copy of opts with the values of the options that may contain secrets,
+// such as ProxyCommand and SetEnv, replaced by "<redacted>".
+func RedactOpts(opts []string) []string {
+	res := make([]string, len(opts))
+	for i, o := range opts {
+		k, _, ok := strings.Cut(o, "=")
+		if ok && redactedOpts[strings.ToLower(k)] {
+			o = k + "=<redacted>"
+		}
+		res[i] = o
+	}
+	return res
+}
+
 // SSHArgsFromOpts returns ssh args from opts.
 // The result always contains {"-F", "/dev/null} in addition to {"-o", "KEY=VALUE", ...}.
 func SSHArgsFromOpts(opts []string) []string {
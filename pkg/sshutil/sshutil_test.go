@@ -40,3 +40,18 @@ func Test_detectValidPublicKey(t *testing.T) {
 	assert.Check(t, !detectValidPublicKey("arbitrary content"))
 	assert.Check(t, !detectValidPublicKey(""))
 }
+
+func TestRedactOpts(t *testing.T) {
+	opts := []string{
+		"User=foo",
+		`ProxyCommand="connect --token=secret %h %p"`,
+		"setenv=TOKEN=secret",
+	}
+	assert.DeepEqual(t, RedactOpts(opts), []string{
+		"User=foo",
+		"ProxyCommand=<redacted>",
+		"setenv=<redacted>",
+	})
+	// opts is not modified
+	assert.Equal(t, opts[1], `ProxyCommand="connect --token=secret %h %p"`)
+}
@@ -6,4 +6,9 @@ import (
 	"syscall"
 )
 
-var SysProcAttr = &syscall.SysProcAttr{}
+// SysProcAttr runs the host agent in a new session, so that the SIGHUP on closing the terminal and
+// the SIGINT on pressing Ctrl-C in the terminal are not sent to the host agent and the VM.
+// `limactl attach` follows the host agent again after `limactl start` has exited.
+var SysProcAttr = &syscall.SysProcAttr{
+	Setsid: true,
+}
@@ -0,0 +1,205 @@
+package start
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// lazyDialTimeout is the time to wait for the host agent to forward a port, after the instance is running
+	lazyDialTimeout = 2 * time.Minute
+	lazyDialRetry   = 500 * time.Millisecond
+)
+
+// LazyAddresses returns the host addresses of the TCP port forwards with a single fixed guest port
+// and a single fixed host port, which are bound by StartLazily while the instance is stopped.
+func LazyAddresses(y *limayaml.LimaYAML) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, rule := range y.PortForwards {
+		if rule.Ignore || rule.Reverse || rule.GuestSocket != "" || rule.HostSocket != "" || rule.Proto != limayaml.TCP {
+			continue
+		}
+		if rule.GuestPortRange[0] != rule.GuestPortRange[1] || rule.HostPortRange[0] != rule.HostPortRange[1] ||
+			rule.HostPortRange[0] <= 0 || rule.HostPortPool[0] != 0 {
+			continue
+		}
+		addr := net.JoinHostPort(rule.HostIP.String(), strconv.Itoa(rule.HostPortRange[0]))
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// lazyConn is a connection accepted while the instance is stopped.
+type lazyConn struct {
+	net.Conn
+	// addr is the address of the listener
+	addr string
+}
+
+// StartLazily binds the LazyAddresses of the stopped instance, and starts the instance on the first connection.
+// The ports are released before starting the instance, so that the host agent can forward them.
+// The connections accepted until then are relayed to the forwarded ports once the instance is running,
+// and StartLazily returns after they are closed.
+//
+// StartLazily handles a single start: the ports are not bound again after the instance is stopped later.
+// The connections that arrive after the ports are released and before the host agent forwards them are refused.
+func StartLazily(ctx context.Context, inst *store.Instance) error {
+	return startLazily(ctx, inst, Start)
+}
+
+// startLazily is StartLazily with the function that starts the instance, replaced in tests.
+func startLazily(ctx context.Context, inst *store.Instance, start func(context.Context, *store.Instance) error) error {
+	addrs := LazyAddresses(inst.Config)
+	if len(addrs) == 0 {
+		return fmt.Errorf("instance %q has no TCP port forwards with a fixed guest port and a fixed host port", inst.Name)
+	}
+	listeners := make([]net.Listener, 0, len(addrs))
+	closeListeners := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeListeners()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	connCh := make(chan lazyConn)
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func(l net.Listener, addr string) {
+			defer wg.Done()
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					if !errors.Is(err, net.ErrClosed) {
+						logrus.WithError(err).Warnf("failed to accept a connection on %s", addr)
+					}
+					return
+				}
+				connCh <- lazyConn{Conn: conn, addr: addr}
+			}
+		}(l, addrs[i])
+	}
+	go func() {
+		wg.Wait()
+		close(connCh)
+	}()
+
+	logrus.Infof("Waiting for a connection to %v to start the instance %q", addrs, inst.Name)
+	var pending []lazyConn
+	select {
+	case <-ctx.Done():
+		closeListeners()
+		for conn := range connCh {
+			_ = conn.Close()
+		}
+		return ctx.Err()
+	case conn := <-connCh:
+		logrus.Infof("Accepted a connection to %s from %s", conn.addr, conn.RemoteAddr())
+		pending = append(pending, conn)
+	}
+	closeListeners()
+	// Drain the connections accepted concurrently with the first one
+	for conn := range connCh {
+		pending = append(pending, conn)
+	}
+
+	if err := start(ctx, inst); err != nil {
+		for _, conn := range pending {
+			_ = conn.Close()
+		}
+		return err
+	}
+
+	var relays sync.WaitGroup
+	for _, conn := range pending {
+		relays.Add(1)
+		go func(conn lazyConn) {
+			defer relays.Done()
+			if err := relayLazyConn(ctx, conn); err != nil {
+				logrus.WithError(err).Warnf("failed to relay the connection to %s from %s", conn.addr, conn.RemoteAddr())
+			}
+		}(conn)
+	}
+	relays.Wait()
+	return nil
+}
+
+// lazyDialAddress returns the address to dial for the listener address, e.g., "127.0.0.1:80" for "0.0.0.0:80".
+func lazyDialAddress(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if ip.To4() != nil {
+			host = "127.0.0.1"
+		} else {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// relayLazyConn relays conn to the port forwarded by the host agent, waiting for the forward to be set up.
+func relayLazyConn(ctx context.Context, conn lazyConn) error {
+	defer conn.Close()
+	dialAddr := lazyDialAddress(conn.addr)
+	ctx, cancel := context.WithTimeout(ctx, lazyDialTimeout)
+	defer cancel()
+	var (
+		upstream net.Conn
+		err      error
+		dialer   net.Dialer
+	)
+	for {
+		upstream, err = dialer.DialContext(ctx, "tcp", dialAddr)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the port %s was not forwarded: %w", dialAddr, err)
+		case <-time.After(lazyDialRetry):
+		}
+	}
+	defer upstream.Close()
+
+	errCh := make(chan error, 2)
+	relay := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		if tcpConn, ok := dst.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+		errCh <- err
+	}
+	go relay(upstream, conn.Conn)
+	go relay(conn.Conn, upstream)
+	var errs []error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
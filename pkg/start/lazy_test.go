@@ -0,0 +1,91 @@
+package start
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"gotest.tools/v3/assert"
+)
+
+func TestLazyAddresses(t *testing.T) {
+	rules := []limayaml.PortForward{
+		{GuestPort: 80, HostPort: 8080},
+		{GuestPort: 443, HostIP: net.IPv4zero},
+		{GuestPortRange: [2]int{3000, 3010}},
+		{GuestPort: 5432, Ignore: true},
+		{GuestSocket: "/run/docker.sock", HostSocket: "docker.sock"},
+		{GuestPort: 80, HostPort: 8080},
+	}
+	for i := range rules {
+		limayaml.FillPortForwardDefaults(&rules[i], "/tmp/lima-test")
+	}
+	y := &limayaml.LimaYAML{PortForwards: rules}
+	assert.DeepEqual(t, LazyAddresses(y), []string{"127.0.0.1:8080", "0.0.0.0:443"})
+}
+
+func TestLazyDialAddress(t *testing.T) {
+	assert.Equal(t, lazyDialAddress("0.0.0.0:443"), "127.0.0.1:443")
+	assert.Equal(t, lazyDialAddress("[::]:443"), "[::1]:443")
+	assert.Equal(t, lazyDialAddress("192.168.1.10:80"), "192.168.1.10:80")
+}
+
+func TestStartLazily(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	assert.NilError(t, l.Close())
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	rule := limayaml.PortForward{GuestPort: 80, HostPort: port}
+	limayaml.FillPortForwardDefaults(&rule, "/tmp/lima-test")
+	inst := &store.Instance{Name: "test", Config: &limayaml.LimaYAML{PortForwards: []limayaml.PortForward{rule}}}
+
+	var starts int
+	// The stub binds the released port like the host agent, and echoes the connection
+	start := func(context.Context, *store.Instance) error {
+		starts++
+		forwarded, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer forwarded.Close()
+			conn, err := forwarded.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+		return nil
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- startLazily(context.Background(), inst, start)
+	}()
+
+	var conn net.Conn
+	for i := 0; ; i++ {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		assert.Assert(t, i < 100, "the port was not bound: %v", err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	assert.NilError(t, err)
+	assert.NilError(t, conn.(*net.TCPConn).CloseWrite())
+	b, err := io.ReadAll(conn)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "hello")
+	assert.NilError(t, <-errCh)
+	assert.Equal(t, starts, 1)
+}
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"text/template"
 	"time"
 
@@ -33,6 +34,10 @@ import (
 // to be running before timing out.
 const DefaultWatchHostAgentEventsTimeout = 10 * time.Minute
 
+// debugGuestAgentRawEvents is the maximum number of raw guest agent events
+// emitted by the hostagent when started in debug mode.
+const debugGuestAgentRawEvents = 1000
+
 // ensureNerdctlArchiveCache prefetches the nerdctl-full-VERSION-GOOS-GOARCH.tar.gz archive
 // into the cache before launching the hostagent process, so that we can show the progress in tty.
 // https://github.com/lima-vm/lima/issues/326
@@ -185,6 +190,9 @@ func Start(ctx context.Context, inst *store.Instance) error {
 	if prepared.NerdctlArchiveCache != "" {
 		args = append(args, "--nerdctl-archive", prepared.NerdctlArchiveCache)
 	}
+	if logrus.GetLevel() >= logrus.DebugLevel {
+		args = append(args, "--guestagent-raw-events", strconv.Itoa(debugGuestAgentRawEvents))
+	}
 	args = append(args, inst.Name)
 	haCmd := exec.CommandContext(ctx, self, args...)
 	haCmd.SysProcAttr = SysProcAttr
@@ -256,6 +264,12 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 		if len(ev.Status.Errors) > 0 {
 			logrus.Errorf("%+v", ev.Status.Errors)
 		}
+		if ev.Status.Phase != "" && !ev.Status.Running {
+			logrus.Infof("Boot phase: %s", ev.Status.Phase)
+		}
+		for _, w := range ev.Warnings {
+			logrus.Warn(w)
+		}
 		if ev.Status.Exiting {
 			err = fmt.Errorf("exiting, status=%+v (hint: see %q)", ev.Status, haStderrPath)
 			return true
@@ -294,6 +308,44 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 	return nil
 }
 
+// Attach follows the events of the host agent of the instance, like `limactl start`, until the instance
+// is running. The events since the host agent has started are replayed. With follow, the warnings, the
+// errors, and the logs of the host agent are shown until the host agent exits or ctx is canceled.
+// Detaching from the host agent does not affect the instance.
+func Attach(ctx context.Context, inst *store.Instance, follow bool) error {
+	if inst.HostAgentPID == 0 {
+		return fmt.Errorf("the host agent of instance %q is not running", inst.Name)
+	}
+	haStdoutPath := filepath.Join(inst.Dir, filenames.HostAgentStdoutLog)
+	haStderrPath := filepath.Join(inst.Dir, filenames.HostAgentStderrLog)
+	begin := time.Now() // used for logrus propagation
+	if err := watchHostAgentEvents(ctx, inst, haStdoutPath, haStderrPath, begin); err != nil {
+		return err
+	}
+	if !follow {
+		return nil
+	}
+	logrus.Info("Following the host agent, press Ctrl-C to detach")
+	onEvent := func(ev hostagentevents.Event) bool {
+		// The events before attaching have already been shown by watchHostAgentEvents
+		if ev.Time.Before(begin) {
+			return false
+		}
+		if len(ev.Status.Errors) > 0 {
+			logrus.Errorf("%+v", ev.Status.Errors)
+		}
+		for _, w := range ev.Warnings {
+			logrus.Warn(w)
+		}
+		if ev.Status.Exiting {
+			logrus.Info("The host agent is exiting")
+			return true
+		}
+		return false
+	}
+	return hostagentevents.Watch(ctx, haStdoutPath, haStderrPath, begin, onEvent)
+}
+
 type watchHostAgentEventsTimeoutKey = struct{}
 
 // WithWatchHostAgentEventsTimeout sets the value of the timeout to use for
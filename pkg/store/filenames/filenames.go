@@ -43,14 +43,22 @@ const (
 	SerialVirtioSock   = "serialv.sock"
 	SSHSock            = "ssh.sock"
 	SSHConfig          = "ssh.config"
+	SSHKey             = "ssh.key" // created on rotating the SSH key of the instance
+	SSHPublicKey       = SSHKey + ".pub"
+	SSHForwardsConfig  = "ssh.forwards.config"
 	VhostSock          = "virtiofsd-%d.sock"
 	VNCDisplayFile     = "vncdisplay"
 	VNCPasswordFile    = "vncpassword"
+	HostResolverPorts  = "hostresolver-ports.json"
+	ForwardDecisions   = "forward-decisions.jsonl"
+	DNSQueries         = "dns-queries.jsonl"
+	HostAgentEvents    = "events.jsonl"
 	GuestAgentSock     = "ga.sock"
 	HostAgentPID       = "ha.pid"
 	HostAgentSock      = "ha.sock"
 	HostAgentStdoutLog = "ha.stdout.log"
 	HostAgentStderrLog = "ha.stderr.log"
+	HostAgentEnv       = "ha.env"
 	VzIdentifier       = "vz-identifier"
 	VzEfi              = "vz-efi"
 
@@ -60,6 +68,10 @@ const (
 	Protected = "protected" // empty file; used by `limactl protect`
 )
 
+// AdditionalGuestAgentSock is the socket forwarded from a guest agent of `guestAgent.additional`,
+// formatted with its name.
+const AdditionalGuestAgentSock = "ga-%s.sock"
+
 // Filenames used under a disk directory
 
 const (
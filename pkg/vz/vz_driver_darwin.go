@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"time"
 
@@ -49,18 +50,26 @@ func (l *LimaVzDriver) Validate() error {
 		"Arch",
 		"Images",
 		"CPUs",
+		"Host",
 		"CPUType",
 		"Memory",
 		"Disk",
 		"Mounts",
 		"MountType",
+		"MountsAfter",
+		"Secrets",
 		"SSH",
 		"Firmware",
 		"Provision",
 		"Containerd",
 		"GuestInstallPrefix",
+		"GuestAgent",
+		"HostAgent",
 		"Probes",
+		"GuestReadyFile",
 		"PortForwards",
+		"PortForwarding",
+		"HostFileUmask",
 		"Message",
 		"Networks",
 		"Env",
@@ -152,6 +161,20 @@ func (l *LimaVzDriver) Start(ctx context.Context) (chan error, error) {
 	return errCh, nil
 }
 
+func (l *LimaVzDriver) GuestAgentConn(ctx context.Context) (net.Conn, error) {
+	if l.VSockPort == 0 || l.machine == nil {
+		return l.BaseDriver.GuestAgentConn(ctx)
+	}
+	for _, socket := range l.machine.SocketDevices() {
+		conn, err := socket.Connect(uint32(l.VSockPort))
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	return nil, errors.New("the VM has no vsock device")
+}
+
 func (l *LimaVzDriver) CanRunGUI() bool {
 	switch *l.Yaml.Video.Display {
 	case "vz", "default":
@@ -197,3 +220,17 @@ func (l *LimaVzDriver) Stop(_ context.Context) error {
 
 	return errors.New("vz: CanRequestStop is not supported")
 }
+
+func (l *LimaVzDriver) Pause(_ context.Context) error {
+	if !l.machine.CanPause() {
+		return fmt.Errorf("vz: cannot pause the machine in the state %q", l.machine.State())
+	}
+	return l.machine.Pause()
+}
+
+func (l *LimaVzDriver) Resume(_ context.Context) error {
+	if !l.machine.CanResume() {
+		return fmt.Errorf("vz: cannot resume the machine in the state %q", l.machine.State())
+	}
+	return l.machine.Resume()
+}
@@ -38,3 +38,11 @@ func (l *LimaVzDriver) Start(_ context.Context) (chan error, error) {
 func (l *LimaVzDriver) Stop(_ context.Context) error {
 	return ErrUnsupported
 }
+
+func (l *LimaVzDriver) Pause(_ context.Context) error {
+	return ErrUnsupported
+}
+
+func (l *LimaVzDriver) Resume(_ context.Context) error {
+	return ErrUnsupported
+}
@@ -36,11 +36,18 @@ func (l *LimaWslDriver) Validate() error {
 		"Disk",
 		"Mounts",
 		"MountType",
+		"MountsAfter",
+		"Secrets",
 		"SSH",
 		"Provision",
 		"Containerd",
+		"GuestAgent",
+		"HostAgent",
 		"Probes",
+		"GuestReadyFile",
 		"PortForwards",
+		"PortForwarding",
+		"HostFileUmask",
 		"Message",
 		"Env",
 		"DNS",